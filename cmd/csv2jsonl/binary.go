@@ -0,0 +1,281 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// binaryFramings -binary-framing 的记录分隔方式：concat 直接拼接，
+// length 在每条记录前写出 4 字节大端序的长度
+var binaryFramings = map[string]bool{"concat": true, "length": true}
+
+// binaryEncoding MessagePack 或 CBOR 编码，将各类值追加到 b
+type binaryEncoding interface {
+	mapHeader(b []byte, n int) []byte
+	arrayHeader(b []byte, n int) []byte
+	str(b []byte, s string) []byte
+	int(b []byte, v int64) []byte
+	float(b []byte, v float64) []byte
+	bool(b []byte, v bool) []byte
+	null(b []byte) []byte
+}
+
+// binaryWriter 将转换器写出的每条 JSON 记录改写为 MessagePack 或 CBOR，
+// 对象的键保持记录中的顺序
+type binaryWriter struct {
+	w      io.Writer
+	format string
+	enc    binaryEncoding
+	length bool
+}
+
+func newBinaryWriter(format, framing string) *binaryWriter {
+	b := &binaryWriter{format: format, length: framing == "length"}
+	if format == "cbor" {
+		b.enc = cborEncoding{}
+	} else {
+		b.enc = msgpackEncoding{}
+	}
+	return b
+}
+
+func (b *binaryWriter) wrap(w io.Writer) io.Writer {
+	b.w = w
+	return b
+}
+
+// BeginRecord 转发给底层的 Writer，按记录切分输出文件
+func (b *binaryWriter) BeginRecord() error {
+	if rw, ok := b.w.(interface{ BeginRecord() error }); ok {
+		return rw.BeginRecord()
+	}
+	return nil
+}
+
+// Write 接收一条 JSON 记录，写出编码后的记录
+func (b *binaryWriter) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var out []byte
+	if b.length {
+		out = make([]byte, 4)
+	}
+	out, err := transcodeJSON(dec, b.enc, out)
+	if err != nil {
+		return 0, fmt.Errorf("%s: decode record failed: %v", b.format, err)
+	}
+	if b.length {
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+	}
+	if _, err := b.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 没有缓存的数据
+func (b *binaryWriter) Close() error {
+	return nil
+}
+
+// transcodeJSON 从 dec 读取一个 JSON 值，编码后追加到 b。对象和数组的元素先编码到
+// 单独的缓冲区，得到元素个数后再写出头部
+func transcodeJSON(dec *json.Decoder, enc binaryEncoding, b []byte) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		var (
+			body []byte
+			n    int
+		)
+		for ; dec.More(); n++ {
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				body = enc.str(body, key.(string))
+			}
+			if body, err = transcodeJSON(dec, enc, body); err != nil {
+				return nil, err
+			}
+		}
+		// 读取结束的 } 或 ]
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if v == '{' {
+			b = enc.mapHeader(b, n)
+		} else {
+			b = enc.arrayHeader(b, n)
+		}
+		return append(b, body...), nil
+	case string:
+		return enc.str(b, v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return enc.int(b, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return enc.float(b, f), nil
+	case bool:
+		return enc.bool(b, v), nil
+	case nil:
+		return enc.null(b), nil
+	}
+	return nil, fmt.Errorf("unexpected json token %v", tok)
+}
+
+// msgpackEncoding 按 MessagePack 规范使用最短的编码
+type msgpackEncoding struct{}
+
+// sized 按 n 的大小写出 1、2 或 4 字节长度的头部，codes 为对应的类型字节
+func (msgpackEncoding) sized(b []byte, n int, code8, code16, code32 byte) []byte {
+	switch {
+	case n <= math.MaxUint8 && code8 != 0:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+func (m msgpackEncoding) mapHeader(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x80|byte(n))
+	}
+	return m.sized(b, n, 0, 0xde, 0xdf)
+}
+
+func (m msgpackEncoding) arrayHeader(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x90|byte(n))
+	}
+	return m.sized(b, n, 0, 0xdc, 0xdd)
+}
+
+func (m msgpackEncoding) str(b []byte, s string) []byte {
+	if len(s) < 32 {
+		b = append(b, 0xa0|byte(len(s)))
+	} else {
+		b = m.sized(b, len(s), 0xd9, 0xda, 0xdb)
+	}
+	return append(b, s...)
+}
+
+func (msgpackEncoding) int(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= math.MaxInt8:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	case v >= 0 && v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v >= 0 && v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	case v >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func (msgpackEncoding) float(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func (msgpackEncoding) bool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func (msgpackEncoding) null(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+// cborEncoding 按 RFC 8949 使用确定长度的最短编码
+type cborEncoding struct{}
+
+// head 写出主类型 major 及参数 n
+func (cborEncoding) head(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func (c cborEncoding) mapHeader(b []byte, n int) []byte {
+	return c.head(b, 5, uint64(n))
+}
+
+func (c cborEncoding) arrayHeader(b []byte, n int) []byte {
+	return c.head(b, 4, uint64(n))
+}
+
+func (c cborEncoding) str(b []byte, s string) []byte {
+	return append(c.head(b, 3, uint64(len(s))), s...)
+}
+
+func (c cborEncoding) int(b []byte, v int64) []byte {
+	if v < 0 {
+		return c.head(b, 1, uint64(-1-v))
+	}
+	return c.head(b, 0, uint64(v))
+}
+
+func (cborEncoding) float(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(v))
+}
+
+func (cborEncoding) bool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+func (cborEncoding) null(b []byte) []byte {
+	return append(b, 0xf6)
+}
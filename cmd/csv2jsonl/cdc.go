@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import "math/bits"
+
+// gearTable 内容定义分块使用的随机表，由固定种子生成以保证不同运行的分块一致
+var gearTable = func() (table [256]uint64) {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// cdcChunker 使用 gear 滚动哈希在内容定义的位置切分输出，
+// 切分只发生在记录边界，输入的局部修改只影响附近的分块
+type cdcChunker struct {
+	minSize int64
+	maxSize int64
+	mask    uint64
+	hash    uint64
+	size    int64
+	cut     bool
+}
+
+// newCDCChunker 创建平均分块大小约为 avgSize 的分块器
+func newCDCChunker(avgSize int64) *cdcChunker {
+	if avgSize < 64 {
+		avgSize = 64
+	}
+	// 取哈希的高 n 位判断边界，低位只受最近几个字节的影响
+	n := uint(bits.Len64(uint64(avgSize - 1)))
+	return &cdcChunker{
+		minSize: avgSize / 4,
+		maxSize: avgSize * 4,
+		mask:    (1<<n - 1) << (64 - n),
+	}
+}
+
+func (c *cdcChunker) write(p []byte) {
+	for _, b := range p {
+		c.hash = c.hash<<1 + gearTable[b]
+		c.size++
+		if c.size >= c.minSize && c.hash&c.mask == 0 {
+			c.cut = true
+		}
+	}
+}
+
+// shouldCut 判断在下一条记录之前是否切分
+func (c *cdcChunker) shouldCut() bool {
+	return c.cut || c.size >= c.maxSize
+}
+
+func (c *cdcChunker) reset() {
+	c.hash, c.size, c.cut = 0, 0, false
+}
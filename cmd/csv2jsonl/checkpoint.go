@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointState -checkpoint 文件记录的转换进度
+type checkpointState struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// OutputBytes 检查点时输出文件的大小，继续转换时截去之后写出的记录
+	OutputBytes int64 `json:"output_bytes"`
+	convert.Checkpoint
+}
+
+// loadCheckpoint 读取检查点文件，文件不存在时返回 nil
+func loadCheckpoint(path string) (*checkpointState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s failed: %v", path, err)
+	}
+	return &state, nil
+}
+
+// save 先写入临时文件再重命名，中断时不会留下不完整的检查点
+func (s *checkpointState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// writeFileAtomic 将 data 写入同一目录下的临时文件，落盘后重命名为 path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Sync(), tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkpointWriter 写入 -checkpoint 的输出文件，在每个检查点落盘后记录进度
+type checkpointWriter struct {
+	*os.File
+	path  string
+	state checkpointState
+}
+
+// openCheckpointWriter 创建输出文件，state 不为空时继续写入其中的转换，
+// 截去检查点之后写出的记录
+func openCheckpointWriter(path, input, output string, state *checkpointState) (*checkpointWriter, error) {
+	flag := os.O_CREATE | os.O_WRONLY
+	if state == nil {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(output, flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &checkpointWriter{File: f, path: path, state: checkpointState{Input: input, Output: output}}
+	if state != nil {
+		w.state = *state
+		fi, err := f.Stat()
+		if err == nil && fi.Size() < state.OutputBytes {
+			err = fmt.Errorf("%s is shorter than at the checkpoint", output)
+		}
+		if err == nil {
+			err = f.Truncate(state.OutputBytes)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// checkpoint 在转换的检查点调用，输出落盘后再保存进度
+func (w *checkpointWriter) checkpoint(cp convert.Checkpoint) error {
+	size, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := w.Sync(); err != nil {
+		return err
+	}
+	w.state.OutputBytes, w.state.Checkpoint = size, cp
+	if err := w.state.save(w.path); err != nil {
+		return fmt.Errorf("save checkpoint failed: %v", err)
+	}
+	return nil
+}
+
+// logResume 转换失败后提示如何继续转换
+func (w *checkpointWriter) logResume() {
+	if w.state.Rows > 0 {
+		log.Infof("rerun the same command to resume the conversion from %s after %d rows", w.path, w.state.Rows)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join("testdata", "people.csv")
+	output := filepath.Join(dir, "out.jsonl")
+	state := filepath.Join(dir, "state.json")
+	var want bytes.Buffer
+	if code := Run([]string{"-log-level", "error", "-i", input}, nil, &want, io.Discard); code != 0 {
+		t.Fatalf("convert to stdout: exit code %d", code)
+	}
+
+	// 第 4 行不满足排序，转换在第 2 行的检查点之后失败，输出已经包含第 3 行
+	args := []string{"-log-level", "error", "-i", input, "-o", output, "-checkpoint", state, "-checkpoint-rows", "2"}
+	if code := Run(append(args, "-assert-sorted", "city"), nil, io.Discard, io.Discard); code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	saved, err := loadCheckpoint(state)
+	if err != nil || saved == nil {
+		t.Fatalf("checkpoint = %v, %v", saved, err)
+	}
+	if saved.Input != input || saved.Output != output || saved.Rows != 2 || saved.Line != 4 || saved.OutputBytes != 130 {
+		t.Errorf("checkpoint = %+v, want 2 rows up to line 4 and 130 bytes of output", saved)
+	}
+	if fi, err := os.Stat(output); err != nil || fi.Size() <= saved.OutputBytes {
+		t.Fatalf("output has %v bytes, %v, want records after the checkpoint", fi.Size(), err)
+	}
+
+	// 检查点与参数不符时不继续
+	if code := Run([]string{"-log-level", "error", "-i", input, "-o", filepath.Join(dir, "other.jsonl"), "-checkpoint", state}, nil, io.Discard, io.Discard); code == 0 {
+		t.Error("resumed the checkpoint of another output")
+	}
+
+	// 同样的命令从检查点继续，截去检查点之后的记录，完成后删除检查点。
+	// 检查点之前的输出不再重写，标记其中的一个字符可以看出没有从头转换
+	f, err := os.OpenFile(output, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("{\"AGE\""), 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if code := Run(args, nil, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("resume: exit code = %d, want 0", code)
+	}
+	resumed := "{\"AGE\"" + want.String()[len("{\"age\""):]
+	if data, err := os.ReadFile(output); err != nil || string(data) != resumed {
+		t.Errorf("resumed output = %q, %v, want %q", data, err, resumed)
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Errorf("checkpoint still exists after the conversion completed: %v", err)
+	}
+}
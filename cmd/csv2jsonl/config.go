@@ -0,0 +1,156 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// convertConfig -config 文件中的转换设置，键为不带 - 的参数名，
+// renames 和 types 是没有对应参数的重命名和列类型
+type convertConfig struct {
+	path  string
+	flags map[string]interface{}
+	// preset 文件中的 renames 和 types，按预设合并到选项中
+	preset preset
+}
+
+// loadConfig 读取 YAML（或 JSON）格式的配置文件，profile 不为空时
+// profiles 中同名的设置覆盖文件顶层的同名设置
+func loadConfig(path, profile string) (*convertConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("parse config %s failed: %v", path, err)
+	}
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	profiles, ok := settings["profiles"].(map[string]interface{})
+	if _, exists := settings["profiles"]; exists && !ok {
+		return nil, fmt.Errorf("config %s: profiles must map profile names to settings", path)
+	}
+	delete(settings, "profiles")
+	if profile != "" {
+		overrides, ok := profiles[profile].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config %s: profile %s not found", path, profile)
+		}
+		for name, value := range overrides {
+			settings[name] = value
+		}
+	}
+
+	c := &convertConfig{path: path, flags: settings}
+	if c.preset.Renames, err = configStrings(settings, "renames"); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	if c.preset.Types, err = configStrings(settings, "types"); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	for col, typ := range c.preset.Types {
+		if !convert.IsValidType(typ) {
+			return nil, fmt.Errorf("config %s: unknown type %s of column %s", path, typ, col)
+		}
+	}
+	return c, nil
+}
+
+// configStrings 取出并删除设置中列名到字符串的映射，如 renames
+func configStrings(settings map[string]interface{}, name string) (map[string]string, error) {
+	value, ok := settings[name]
+	if !ok {
+		return nil, nil
+	}
+	delete(settings, name)
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must map column names to values", name)
+	}
+	strs := make(map[string]string, len(m))
+	for col, v := range m {
+		strs[col] = fmt.Sprint(v)
+	}
+	return strs, nil
+}
+
+// apply 将配置的值设置给命令行中没有指定的参数。可重复指定的参数接受列表，
+// 依次设置；其他参数的列表以逗号连接，如 columns: [id, name]
+func (c *convertConfig) apply(fs *flag.FlagSet) error {
+	// 别名与原参数共用同一个 Value，如 -offset 和 -skip，命令行指定任一个时
+	// 两者都不再从配置设置
+	set := map[flag.Value]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Value] = true })
+	names := make([]string, 0, len(c.flags))
+	for name := range c.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		switch {
+		case f == nil:
+			return fmt.Errorf("config %s: unknown option %s", c.path, name)
+		case name == "config" || name == "profile":
+			return fmt.Errorf("config %s: %s can only be given on the command line", c.path, name)
+		case set[f.Value]:
+			continue
+		}
+		values, err := configValues(c.flags[name])
+		if err != nil {
+			return fmt.Errorf("config %s: %s %v", c.path, name, err)
+		}
+		if _, repeated := f.Value.(*stringsFlag); !repeated {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("config %s: invalid value %q for %s: %v", c.path, value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues 将配置的值转换为参数的值，列表的每项为一个值
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return nil, fmt.Errorf("must be a value or a list of values")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("must be a value or a list of values")
+	}
+	return []string{fmt.Sprint(value)}, nil
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// contract 输出的数据契约，字段来自转换配置，类型和可空性来自实际输出
+type contract struct {
+	Version    string   `yaml:"version"`
+	Source     string   `yaml:"source"`
+	Records    int      `yaml:"records"`
+	RowFilters []string `yaml:"row_filters,omitempty"`
+	// Inference 记录 -two-pass、-infer-sample 推断类型的依据
+	Inference *contractInference `yaml:"inference,omitempty"`
+	Fields    []contractField    `yaml:"fields"`
+}
+
+type contractInference struct {
+	Mode       string `yaml:"mode"`
+	Rows       int    `yaml:"rows"`
+	Confidence string `yaml:"confidence"`
+}
+
+type contractField struct {
+	Name    string   `yaml:"name"`
+	Sources []string `yaml:"sources"`
+	// Type 为观察到的 JSON 类型，出现多种类型时为列表
+	Type      interface{} `yaml:"type"`
+	Format    string      `yaml:"format,omitempty"`
+	Nullable  bool        `yaml:"nullable"`
+	MaxLength int         `yaml:"max_length,omitempty"`
+	// Confidence 为推断的类型在非空单元格中的比例
+	Confidence float64  `yaml:"confidence,omitempty"`
+	Semantics  string   `yaml:"semantics,omitempty"`
+	Steps      []string `yaml:"steps,omitempty"`
+}
+
+// dateFormats 各日期输出方式在契约中的 format
+var dateFormats = map[string]string{
+	convert.DateAuto:    "date",
+	convert.DateRFC3339: "date-time",
+	convert.DateEpoch:   "unix-time",
+}
+
+// fieldStats 一个输出字段观察到的类型和空值
+type fieldStats struct {
+	types    map[string]bool
+	nullable bool
+}
+
+// contractCollector 收集生成契约所需的字段来源和输出记录统计
+type contractCollector struct {
+	opts    *convertOptions
+	lineage *convert.Lineage
+	records int
+	stats   map[string]*fieldStats
+}
+
+func newContractCollector(opts *convertOptions) *contractCollector {
+	return &contractCollector{opts: opts, stats: map[string]*fieldStats{}}
+}
+
+// onLineage 记录字段来源，next 不为空时继续调用
+func (c *contractCollector) onLineage(next func(*convert.Lineage) error) func(*convert.Lineage) error {
+	return func(l *convert.Lineage) error {
+		c.lineage = l
+		for _, f := range l.Fields {
+			c.stats[f.Field] = &fieldStats{types: map[string]bool{}}
+		}
+		if next != nil {
+			return next(l)
+		}
+		return nil
+	}
+}
+
+// observe 统计一条输出记录中各字段的类型
+func (c *contractCollector) observe(record interface{}) {
+	c.records++
+	for field, s := range c.stats {
+		v, ok := record, true
+		if field != "$" {
+			v, ok = lookupField(record, field, c.opts.nested)
+		}
+		if !ok || v == nil || v == "" {
+			s.nullable = true
+		}
+		if ok {
+			s.types[jsonType(v)] = true
+		}
+	}
+}
+
+// lookupField 查找记录中的字段，nested 时按点号逐层查找，冲突的字段保留原名
+func lookupField(record interface{}, field string, nested bool) (interface{}, bool) {
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if v, ok := m[field]; ok || !nested {
+		return v, ok
+	}
+	head, rest, found := strings.Cut(field, ".")
+	if !found {
+		return nil, false
+	}
+	return lookupField(m[head], rest, nested)
+}
+
+// jsonType 返回值对应的 JSON 类型
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64:
+		return "integer"
+	case json.Number:
+		// -template 的输出保留数字的原文
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// contract 根据配置和统计生成契约
+func (c *contractCollector) contract(version, source string) *contract {
+	ct := &contract{Version: version, Source: source, Records: c.records}
+	if c.lineage == nil {
+		return ct
+	}
+	ct.RowFilters = c.lineage.RowFilters
+	if c.opts.schema != nil {
+		ct.Inference = &contractInference{Mode: c.opts.inference, Rows: c.opts.schema.Rows, Confidence: c.opts.confidence}
+	}
+	for _, f := range c.lineage.Fields {
+		s := c.stats[f.Field]
+		var types []string
+		for typ := range s.types {
+			// null 体现在 nullable 中
+			if typ != "null" {
+				types = append(types, typ)
+			}
+		}
+		sort.Strings(types)
+		field := contractField{Name: f.Field, Sources: f.Sources, Nullable: s.nullable, Steps: f.Steps}
+		switch len(types) {
+		case 0:
+			field.Type = "null"
+		case 1:
+			field.Type = types[0]
+		default:
+			field.Type = types
+		}
+		if len(f.Sources) == 1 {
+			for _, step := range f.Steps {
+				if step == "type:"+convert.TypeDate {
+					field.Format = dateFormats[c.opts.dateOutput]
+				}
+			}
+			field.Semantics = c.opts.semantics[f.Sources[0]]
+			if c.opts.schema != nil {
+				for _, col := range c.opts.schema.Columns {
+					if col.Name == f.Sources[0] {
+						field.MaxLength = col.MaxLength
+						field.Confidence = col.Confidence
+					}
+				}
+			}
+		}
+		ct.Fields = append(ct.Fields, field)
+	}
+	return ct
+}
+
+// writeContract 将契约以 YAML 写入 path
+func writeContract(path string, ct *contract) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+	if err := enc.Encode(ct); err != nil {
+		f.Close()
+		return fmt.Errorf("encode contract failed: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
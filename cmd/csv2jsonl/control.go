@@ -0,0 +1,232 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// controlRequest -control-socket 的一条命令，每行一个 JSON 对象，如 {"command":"pause"}
+type controlRequest struct {
+	Command string `json:"command"`
+}
+
+// controlResponse 对每条命令的回复，同样每行一个 JSON 对象
+type controlResponse struct {
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	State     string `json:"state,omitempty"`
+	Rows      int64  `json:"rows"`
+	BytesRead int64  `json:"bytes_read"`
+	Elapsed   string `json:"elapsed,omitempty"`
+}
+
+// controller 接收父进程通过 Unix socket 或标准输入发送的命令，暂停、继续读取输入，
+// 刷新输出的缓冲或返回进度
+type controller struct {
+	start time.Time
+	rows  atomic.Int64
+	// bytes 已读取的输入字节数，与进度条共用
+	bytes *atomic.Int64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	done   bool
+
+	// wmu 使刷新与转换器的写入互斥
+	wmu     sync.Mutex
+	flushes []func() error
+
+	listener net.Listener
+}
+
+func newController() *controller {
+	c := &controller{start: time.Now(), bytes: new(atomic.Int64)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// observe 统计一条输出记录
+func (c *controller) observe(interface{}) {
+	c.rows.Add(1)
+}
+
+// onFlush 添加 flush 命令依次刷新的缓冲，如 -format sql 的批次、压缩器
+func (c *controller) onFlush(flush func() error) {
+	c.flushes = append(c.flushes, flush)
+}
+
+// reader 返回暂停时阻塞的输入
+func (c *controller) reader(r io.ReadCloser) io.ReadCloser {
+	return pausableReader{ReadCloser: r, c: c}
+}
+
+// writer 返回与 flush 命令互斥的输出
+func (c *controller) writer(w io.Writer) io.Writer {
+	return &controlWriter{w: w, c: c}
+}
+
+// serve 在 path 上监听 Unix socket，path 为 - 时从 stdin 读取命令并将回复写入 stdout
+func (c *controller) serve(path string, stdin io.Reader, stdout io.Writer) error {
+	if path == "-" {
+		go c.handle(stdin, stdout)
+		return nil
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		// 之前的进程异常退出时留下的 socket
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	c.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				c.handle(conn, conn)
+			}()
+		}
+	}()
+	log.Infof("control: listening on %s", path)
+	return nil
+}
+
+// handle 逐行读取命令并回复，直到 r 结束
+func (c *controller) handle(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var req controlRequest
+		resp := controlResponse{OK: true}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = controlResponse{Error: fmt.Sprintf("invalid command: %v", err)}
+		} else if err := c.execute(req.Command); err != nil {
+			resp = controlResponse{Error: err.Error()}
+		}
+		resp.State, resp.Rows, resp.BytesRead = c.state(), c.rows.Load(), c.bytes.Load()
+		if req.Command == "stats" {
+			resp.Elapsed = time.Since(c.start).Round(time.Millisecond).String()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// execute 执行一条命令
+func (c *controller) execute(command string) error {
+	switch command {
+	case "pause", "resume":
+		c.mu.Lock()
+		c.paused = command == "pause"
+		c.mu.Unlock()
+		c.cond.Broadcast()
+		log.Infof("control: %s", command)
+	case "flush":
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		var errs []error
+		for _, flush := range c.flushes {
+			errs = append(errs, flush())
+		}
+		return errors.Join(errs...)
+	case "stats":
+	default:
+		return fmt.Errorf("unknown command %q, expected pause, resume, flush or stats", command)
+	}
+	return nil
+}
+
+func (c *controller) state() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.done:
+		return "finished"
+	case c.paused:
+		return "paused"
+	}
+	return "running"
+}
+
+// finish 转换结束后不再阻塞输入，关闭并删除 socket
+func (c *controller) finish() {
+	c.mu.Lock()
+	c.done = true
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+// pausableReader 暂停时阻塞读取，转换随之停止
+type pausableReader struct {
+	io.ReadCloser
+	c *controller
+}
+
+func (r pausableReader) Read(p []byte) (int, error) {
+	r.c.mu.Lock()
+	for r.c.paused && !r.c.done {
+		r.c.cond.Wait()
+	}
+	r.c.mu.Unlock()
+	return r.ReadCloser.Read(p)
+}
+
+// controlWriter 写入时持有锁，flush 命令刷新缓冲时不会与写入交错
+type controlWriter struct {
+	w io.Writer
+	c *controller
+}
+
+func (w *controlWriter) Write(p []byte) (int, error) {
+	w.c.wmu.Lock()
+	defer w.c.wmu.Unlock()
+	return w.w.Write(p)
+}
+
+// BeginRecord 转发给底层的 Writer
+func (w *controlWriter) BeginRecord() error {
+	w.c.wmu.Lock()
+	defer w.c.wmu.Unlock()
+	if rw, ok := w.w.(interface{ BeginRecord() error }); ok {
+		return rw.BeginRecord()
+	}
+	return nil
+}
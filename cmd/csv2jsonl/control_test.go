@@ -0,0 +1,131 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestControlSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "control.sock")
+	output := filepath.Join(dir, "out.jsonl")
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	code := make(chan int, 1)
+	go func() {
+		code <- Run([]string{"-log-level", "error", "-o", output, "-control-socket", socket}, pr, io.Discard, io.Discard)
+	}()
+	io.WriteString(pw, "id,name\n1,a\n")
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); conn == nil; {
+		var err error
+		if conn, err = net.Dial("unix", socket); err != nil {
+			if time.Now().After(deadline) {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	defer conn.Close()
+	replies := bufio.NewScanner(conn)
+	send := func(command string) controlResponse {
+		t.Helper()
+		if _, err := io.WriteString(conn, command+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if !replies.Scan() {
+			t.Fatalf("no reply to %s: %v", command, replies.Err())
+		}
+		var resp controlResponse
+		if err := json.Unmarshal(replies.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	// waitRows 等待转换写出 rows 条记录
+	waitRows := func(rows int64) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			resp := send(`{"command":"stats"}`)
+			if resp.Rows == rows {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("stats = %+v, want %d rows", resp, rows)
+			}
+		}
+	}
+
+	waitRows(1)
+	if resp := send(`{"command":"stats"}`); !resp.OK || resp.State != "running" || resp.BytesRead != 12 || resp.Elapsed == "" {
+		t.Errorf("stats = %+v", resp)
+	}
+	if resp := send(`{"command":"pause"}`); !resp.OK || resp.State != "paused" {
+		t.Errorf("pause = %+v", resp)
+	}
+	// 暂停前已开始的读取仍然返回下一行，之后的读取阻塞
+	io.WriteString(pw, "2,b\n")
+	waitRows(2)
+	go func() {
+		io.WriteString(pw, "3,c\n")
+		pw.Close()
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if resp := send(`{"command":"stats"}`); resp.State != "paused" || resp.Rows != 2 {
+		t.Errorf("stats while paused = %+v", resp)
+	}
+	if resp := send(`{"command":"flush"}`); !resp.OK {
+		t.Errorf("flush = %+v", resp)
+	}
+	if resp := send(`{"command":"stop"}`); resp.OK || resp.Error == "" {
+		t.Errorf("unknown command = %+v, want an error", resp)
+	}
+	if resp := send(`not json`); resp.OK || resp.Error == "" {
+		t.Errorf("invalid command = %+v, want an error", resp)
+	}
+	if resp := send(`{"command":"resume"}`); !resp.OK || resp.State != "running" {
+		t.Errorf("resume = %+v", resp)
+	}
+
+	select {
+	case c := <-code:
+		if c != 0 {
+			t.Fatalf("exit code = %d, want 0", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("conversion did not finish after resume")
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"id\":\"1\",\"name\":\"a\"}\n{\"id\":\"2\",\"name\":\"b\"}\n{\"id\":\"3\",\"name\":\"c\"}\n"; string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+	// 转换结束后关闭 socket
+	if _, err := net.Dial("unix", socket); err == nil {
+		t.Error("control socket still accepts connections after the conversion")
+	}
+}
@@ -0,0 +1,1361 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/sink"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	log "github.com/sirupsen/logrus"
+)
+
+// conversion 一次转换的状态，runConvert 按顺序执行各阶段，每个阶段返回非 0 的
+// 退出码时停止转换
+type conversion struct {
+	f      *convertFlags
+	fs     *flag.FlagSet
+	log    *log.Logger
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	started    time.Time
+	config     *convertConfig
+	deprecated []deprecation
+	notify     *notifier
+	opts       convertOptions
+	// closers 转换结束时按注册的相反顺序调用
+	closers []func()
+
+	// 输入
+	source    string
+	resume    *checkpointState
+	inferOpts convert.InferOptions
+	evolution *schemaEvolution
+	in        io.ReadCloser
+	counter   *atomic.Int64
+	deadline  *deadlineReader
+
+	// 观察写出的记录
+	collector *contractCollector
+	checker   *validator
+	reporter  *reportCollector
+	bar       *progress
+	hb        *heartbeat
+	ctl       *controller
+
+	// 输出
+	eosRecord   []byte
+	errorOut    *lazyFile
+	maxPartSize int64
+	w           io.Writer
+	flusher     *flushWriter
+	reformat    formatWriter
+	sqlOut      *sqlWriter
+	parquetOut  *parquetWriter
+	out         *splitWriter
+	sharded     *shardWriter
+	ckpt        *checkpointWriter
+	comp        io.WriteCloser
+	trainer     *dictTrainer
+
+	stats   convert.Stats
+	elapsed time.Duration
+}
+
+// onClose 注册转换结束时调用的函数
+func (c *conversion) onClose(fn func()) {
+	c.closers = append(c.closers, fn)
+}
+
+// close 按注册的相反顺序调用 onClose 注册的函数
+func (c *conversion) close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
+	}
+}
+
+// newOptions 按参数创建转换的选项
+func (c *conversion) newOptions() int {
+	var err error
+	c.opts = convertOptions{
+		limit:         c.f.limit,
+		skip:          c.f.skip,
+		workers:       c.f.workers,
+		unordered:     c.f.unordered,
+		pretty:        c.f.pretty,
+		asciiOnly:     c.f.asciiOnly,
+		nested:        c.f.nested,
+		emptyAsNull:   c.f.emptyAsNull,
+		omitEmpty:     c.f.omitEmpty,
+		trimSpace:     c.f.trimSpace,
+		stripControl:  c.f.stripControl,
+		strictColumns: c.f.strictColumns,
+		warnLimit:     c.f.warnLimit,
+		inferTypes:    c.f.inferTypes,
+		whereDate:     c.f.whereDate,
+		filter:        c.f.filter,
+		position:      c.f.positionField,
+		rowNumber:     c.f.addLineNumber,
+		foldCase:      c.f.ignoreCase,
+		keyCase:       c.f.keyCase,
+		shardBy:       c.f.shardBy,
+		logger:        c.log,
+	}
+	if c.f.addMeta != "" {
+		if c.opts.meta, err = parseMeta(c.f.addMeta, c.f.input, time.Now()); err != nil {
+			c.log.Errorf("-add-meta: %v", err)
+			return exitUsage
+		}
+	}
+	return 0
+}
+
+// checkModes 检查互相冲突的运行模式
+func (c *conversion) checkModes() int {
+	if c.f.keyCase != "" && !transform.IsValidKeyCase(c.f.keyCase) {
+		c.log.Errorf("unknown key-case %s, expected snake, camel, kebab or lower", c.f.keyCase)
+		return exitUsage
+	}
+	if _, ok := inputEncodings[c.f.inputEncoding]; !ok && c.f.inputEncoding != "" {
+		c.log.Errorf("unknown encoding %s", c.f.inputEncoding)
+		return exitUsage
+	}
+	if c.f.warnLimit < 1 {
+		c.log.Errorf("-warn-limit must be positive")
+		return exitUsage
+	}
+	if c.f.emptyAsNull && c.f.omitEmpty {
+		c.log.Errorf("-empty-as-null and -omit-empty can not be used together")
+		return exitUsage
+	}
+	if c.f.columns != "" {
+		c.opts.columns = strings.Split(c.f.columns, ",")
+	}
+	switch {
+	case c.f.header != "" && !c.f.noHeader:
+		c.log.Errorf("-header requires -no-header")
+		return exitUsage
+	case c.f.noHeader && c.f.dictionaryEncode != "":
+		c.log.Errorf("-dictionary-encode can not be used with -no-header")
+		return exitUsage
+	}
+	if c.f.unordered && c.f.workers <= 1 {
+		c.log.Warnf("-unordered has no effect without -workers")
+	}
+	if c.f.validate {
+		// 校验结果写到标准输出，不写出转换的记录
+		switch {
+		case c.f.output != "" || c.f.compress != "":
+			c.log.Errorf("-validate writes the report to stdout, -o and -compress can not be used")
+			return exitUsage
+		case c.f.follow || c.f.controlSocket != "":
+			c.log.Errorf("-validate can not be used with -follow or -control-socket")
+			return exitUsage
+		}
+	}
+	if c.f.follow {
+		// 持续读取的输入只能转换一遍，输出需要随记录及时写出
+		switch {
+		case c.f.input == "" || c.f.input == "-":
+			c.log.Errorf("-follow requires -i")
+			return exitUsage
+		case isRemoteInput(c.f.input):
+			c.log.Errorf("-follow requires a local -i")
+			return exitUsage
+		case trimCompressionExt(c.f.input) != c.f.input:
+			c.log.Errorf("-follow can not read compressed input")
+			return exitUsage
+		case c.f.output != "" || c.f.compress != "":
+			c.log.Errorf("-follow writes uncompressed records to stdout, -o and -compress can not be used")
+			return exitUsage
+		case c.f.twoPass || c.f.dictionaryEncode != "" || c.f.kAnonymity > 0 || c.f.workers > 1:
+			c.log.Errorf("-follow can not be used with -two-pass, -dictionary-encode, -k-anonymity or -workers")
+			return exitUsage
+		}
+	}
+	if c.f.stream {
+		// 每行读取后立即写出并刷新记录，不能使用需要预读输入或成批写出的选项
+		switch {
+		case c.f.output != "" || c.f.compress != "":
+			c.log.Errorf("-stream writes uncompressed records to stdout, -o and -compress can not be used")
+			return exitUsage
+		case c.f.twoPass || c.f.inferSample > 0 || c.f.dictionaryEncode != "" || c.f.kAnonymity > 0 || c.f.sampleN > 0:
+			c.log.Errorf("-stream can not be used with -two-pass, -infer-sample, -dictionary-encode, -k-anonymity or -sample-n, which read ahead of the output")
+			return exitUsage
+		case c.f.workers > 1:
+			c.log.Errorf("-stream can not be used with -workers, which converts rows in batches")
+			return exitUsage
+		case c.f.format == "parquet" || c.f.format == "sql" && c.f.sqlBatch > 1:
+			c.log.Errorf("-stream can not be used with -format parquet or -sql-batch, which write records in batches")
+			return exitUsage
+		case c.f.flushRows > 0 || c.f.flushInterval > 0:
+			c.log.Errorf("-stream flushes every record, -flush-rows and -flush-interval can not be used")
+			return exitUsage
+		}
+		c.f.flushRows = 1
+	}
+	switch {
+	case (c.f.kAnonymity != 0) != (c.f.quasiIdentifiers != ""):
+		c.log.Errorf("-k-anonymity and -quasi-identifiers must be used together")
+		return exitUsage
+	case c.f.kAnonymity < 0 || c.f.kAnonymity == 1:
+		c.log.Errorf("-k-anonymity must be at least 2")
+		return exitUsage
+	}
+	return 0
+}
+
+// recordOptions 设置表头、列和写出的记录的选项
+func (c *conversion) recordOptions() int {
+	var err error
+	c.opts.noHeader = c.f.noHeader
+	if c.f.header != "" {
+		c.opts.header = strings.Split(c.f.header, ",")
+	}
+	if c.f.schema != "" {
+		if c.opts.types, err = loadSchema(c.f.schema); err != nil {
+			c.log.Errorf("load schema failed: %v", err)
+			return 1
+		}
+	}
+	if c.opts.transforms, err = parseTransforms(c.f.transforms); err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	if c.f.mapFile != "" {
+		if c.opts.valueMaps, err = loadValueMaps(c.f.mapFile, c.f.mapCache); err != nil {
+			c.log.Errorf("load map file failed: %v", err)
+			return 1
+		}
+	}
+	overrides, err := parseValueMaps(c.f.valueMaps)
+	if err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	c.opts.valueMaps = mergeValueMaps(c.opts.valueMaps, overrides)
+	if c.opts.defaults, err = parseDefaults(c.f.defaults); err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	if c.f.decodeEntities != "" {
+		if c.opts.transforms == nil {
+			c.opts.transforms = map[string][]string{}
+		}
+		for _, col := range strings.Split(c.f.decodeEntities, ",") {
+			c.opts.transforms[col] = append(c.opts.transforms[col], "html_unescape")
+		}
+	}
+	if c.f.parseJSONColumns != "" {
+		c.opts.jsonColumns = strings.Split(c.f.parseJSONColumns, ",")
+	}
+	c.opts.flatten, c.opts.flattenPrefix = c.f.flatten, c.f.flattenPrefix
+	if c.f.detectLang != "" {
+		c.opts.detectLang = strings.Split(c.f.detectLang, ",")
+	}
+	if c.f.parseUA != "" {
+		c.opts.parseUA = strings.Split(c.f.parseUA, ",")
+	}
+	if c.f.lineage != "" {
+		c.opts.lineage = writeLineage(c.f.lineage)
+	}
+	if c.f.assertSorted != "" {
+		if c.f.assertSortedMode != "fail" && c.f.assertSortedMode != "warn" {
+			c.log.Errorf("unknown assert-sorted mode %s", c.f.assertSortedMode)
+			return exitUsage
+		}
+		c.opts.assertSorted = &convert.SortAssertion{
+			Column:     c.f.assertSorted,
+			Descending: c.f.assertSortedDesc,
+			WarnOnly:   c.f.assertSortedMode == "warn",
+		}
+	}
+
+	if !transform.IsValidHash(c.f.hash) {
+		c.log.Errorf("unknown hash %s, expected fnv, xxh3, sha256 or murmur3", c.f.hash)
+		return exitUsage
+	}
+	c.opts.hash = c.f.hash
+
+	if c.f.dedupeKey != "" {
+		if c.f.dedupeMode != "exact" && c.f.dedupeMode != "bloom" {
+			c.log.Errorf("unknown dedupe-mode %s, expected exact or bloom", c.f.dedupeMode)
+			return exitUsage
+		}
+		if c.f.dedupeRate <= 0 || c.f.dedupeRate >= 1 {
+			c.log.Errorf("-dedupe-false-positive-rate must be between 0 and 1")
+			return exitUsage
+		}
+		c.opts.dedupe = &convert.Dedupe{
+			Columns:           strings.Split(c.f.dedupeKey, ","),
+			Bloom:             c.f.dedupeMode == "bloom",
+			Capacity:          c.f.dedupeCapacity,
+			FalsePositiveRate: c.f.dedupeRate,
+		}
+	}
+
+	if c.f.sampleRate != 0 || c.f.sampleN != 0 {
+		switch {
+		case c.f.sampleRate < 0 || c.f.sampleRate > 1:
+			c.log.Errorf("-sample must be between 0 and 1")
+			return exitUsage
+		case c.f.sampleN < 0:
+			c.log.Errorf("-sample-n must be positive")
+			return exitUsage
+		case c.f.sampleN > 0 && c.f.follow:
+			// 水塘抽样读完输入后才能输出
+			c.log.Errorf("-sample-n can not be used with -follow")
+			return exitUsage
+		}
+		c.opts.sample = &convert.Sample{Rate: c.f.sampleRate, N: c.f.sampleN, Seed: c.f.sampleSeed}
+	}
+	return 0
+}
+
+// outputOptions 检查输出的参数
+func (c *conversion) outputOptions() int {
+	var err error
+	switch {
+	case c.f.flushInterval < 0 || c.f.flushRows < 0:
+		c.log.Errorf("-flush-interval and -flush-rows must be positive")
+		return exitUsage
+	case (c.f.flushInterval > 0 || c.f.flushRows > 0) && c.f.output != "":
+		c.log.Errorf("-flush-interval and -flush-rows apply to records written to stdout, they can not be used with -o")
+		return exitUsage
+	}
+	if c.f.eosRecord != "" {
+		if c.f.format != "jsonl" {
+			c.log.Errorf("-eos-record can only be used with -format jsonl")
+			return exitUsage
+		}
+		if c.eosRecord, err = parseEOSRecord(c.f.eosRecord); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+	}
+	return 0
+}
+
+// lockOutput 使用 -lock 或 -wait-lock 时锁定输出，转换结束时释放
+func (c *conversion) lockOutput() int {
+	if c.f.lock || c.f.waitLock > 0 {
+		// 在读取检查点和创建输出之前取得锁，等待的进程读到的是其他进程完成后的状态
+		switch {
+		case c.f.output == "":
+			c.log.Errorf("-lock and -wait-lock require -o")
+			return exitUsage
+		case isObjectURL(c.f.output):
+			c.log.Errorf("-lock and -wait-lock can not lock object storage")
+			return exitUsage
+		}
+		lockPath := c.f.output
+		if ext, ok := outputCompressions[c.f.compress]; ok && !strings.HasSuffix(lockPath, ext) {
+			lockPath += ext
+		}
+		lock, err := lockOutput(lockPath, c.f.waitLock)
+		if err != nil {
+			c.log.Errorf("%v", err)
+			return 1
+		}
+		c.onClose(func() { lock.Close() })
+	}
+	return 0
+}
+
+// loadCheckpoint 读取 -checkpoint 记录的上次转换的位置
+func (c *conversion) loadCheckpoint() int {
+	var err error
+	if c.f.checkpointPath != "" {
+		switch {
+		case c.f.output == "" || c.f.input == "" || c.f.input == "-" || isRemoteInput(c.f.input) || isObjectURL(c.f.output):
+			c.log.Errorf("-checkpoint requires a local -i and -o")
+			return exitUsage
+		case c.f.checkpointRows < 1:
+			c.log.Errorf("-checkpoint-rows must be positive")
+			return exitUsage
+		case c.f.follow || c.f.format != "jsonl":
+			c.log.Errorf("-checkpoint can not be used with -follow or -format %s", c.f.format)
+			return exitUsage
+		case c.f.unordered:
+			// 不按顺序写出时没有之前的行都已写出的位置
+			c.log.Errorf("-checkpoint can not be used with -unordered")
+			return exitUsage
+		case c.f.compress != "" || filepath.Ext(c.f.output) == ".gz" || filepath.Ext(c.f.output) == ".zst" || c.f.splitRows > 0 || c.f.splitSize != "" || c.f.chunking != "rows" || c.f.shardBy != "" || c.f.index != "":
+			// 只有未压缩的单个输出文件可以截断到检查点后继续写入
+			c.log.Errorf("-checkpoint requires a single uncompressed -o, it can not be used with -compress, -split-rows, -split-size, -chunking, -shard-by or -index")
+			return exitUsage
+		case c.f.dedupeKey != "" || c.f.emitContract != "" || c.f.reportPath != "" || c.opts.sample != nil:
+			// 已经出现的键、契约和报告的统计、抽样的随机数不会保存在检查点中
+			c.log.Errorf("-checkpoint can not be used with -dedupe-key, -emit-contract, -report, -sample or -sample-n")
+			return exitUsage
+		}
+		if c.resume, err = loadCheckpoint(c.f.checkpointPath); err != nil {
+			c.log.Errorf("load checkpoint failed: %v", err)
+			return 1
+		}
+		if c.resume != nil && (c.resume.Input != c.f.input || c.resume.Output != c.f.output) {
+			c.log.Errorf("checkpoint %s records the conversion of %s to %s, not of %s to %s", c.f.checkpointPath, c.resume.Input, c.resume.Output, c.f.input, c.f.output)
+			return exitUsage
+		}
+	}
+	return 0
+}
+
+// formatOptions 检查 -format 和 -template，创建改写输出格式的 writer
+func (c *conversion) formatOptions() int {
+	var err error
+	switch c.f.format {
+	case "jsonl":
+	case "sql":
+		_, ok := sqlDialects[c.f.sqlDialect]
+		switch {
+		case c.f.table == "":
+			c.log.Errorf("-format sql requires -table")
+			return exitUsage
+		case !ok:
+			c.log.Errorf("unknown sql-dialect %s, expected ansi or mysql", c.f.sqlDialect)
+			return exitUsage
+		case c.f.sqlBatch < 1:
+			c.log.Errorf("-sql-batch must be positive")
+			return exitUsage
+		case c.f.dictionaryEncode != "" || c.f.shardBy != "":
+			c.log.Errorf("-format sql can not be used with -dictionary-encode or -shard-by")
+			return exitUsage
+		}
+		c.sqlOut = newSQLWriter(c.f.table, c.f.sqlDialect, c.f.sqlBatch, c.f.nested)
+		c.reformat = c.sqlOut
+	case "es-bulk":
+		switch {
+		case c.f.esIndex == "":
+			c.log.Errorf("-format es-bulk requires -es-index")
+			return exitUsage
+		case c.f.pretty:
+			// _bulk 的每个文档只能占一行
+			c.log.Errorf("-format es-bulk can not be used with -pretty")
+			return exitUsage
+		case c.f.dictionaryEncode != "" || c.f.shardBy != "":
+			c.log.Errorf("-format es-bulk can not be used with -dictionary-encode or -shard-by")
+			return exitUsage
+		}
+		if err := validateESIndex(c.f.esIndex); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+		c.reformat = newESBulkWriter(c.f.esIndex, c.f.esIDColumn)
+	case "parquet":
+		_, ok := parquetCodecs[c.f.parquetCompression]
+		switch {
+		case !ok:
+			c.log.Errorf("unknown parquet-compression %s, expected snappy, gzip, zstd or none", c.f.parquetCompression)
+			return exitUsage
+		case c.f.parquetRowGroup < 1:
+			c.log.Errorf("-parquet-row-group must be positive")
+			return exitUsage
+		case c.f.compress != "" || c.f.zstdDictTrain != "":
+			// 页在文件内压缩，整个文件再压缩后不能直接查询
+			c.log.Errorf("-format parquet can not be used with -compress or -zstd-dict-train, use -parquet-compression")
+			return exitUsage
+		case c.f.pretty || c.f.dictionaryEncode != "" || c.f.flatten || c.f.eosRecord != "":
+			c.log.Errorf("-format parquet can not be used with -pretty, -dictionary-encode, -flatten or -eos-record")
+			return exitUsage
+		case c.f.splitRows > 0 || c.f.splitSize != "" || c.f.chunking == "cdc" || c.f.shardBy != "" || c.f.index != "" || c.f.checkpointPath != "":
+			// 文件尾的元数据在最后写出，不能切分或继续写入
+			c.log.Errorf("-format parquet can not be used with -split-rows, -split-size, -chunking cdc, -shard-by, -index or -checkpoint")
+			return exitUsage
+		}
+		if c.parquetOut, err = newParquetWriter(c.f.parquetCompression, c.f.parquetRowGroup, c.f.nested); err != nil {
+			c.log.Errorf("%v", err)
+			return 1
+		}
+		c.reformat = c.parquetOut
+	case "msgpack", "cbor":
+		switch {
+		case !binaryFramings[c.f.binaryFraming]:
+			c.log.Errorf("unknown binary-framing %s, expected concat or length", c.f.binaryFraming)
+			return exitUsage
+		case c.f.pretty || c.f.dictionaryEncode != "" || c.f.shardBy != "":
+			c.log.Errorf("-format %s can not be used with -pretty, -dictionary-encode or -shard-by", c.f.format)
+			return exitUsage
+		}
+		c.reformat = newBinaryWriter(c.f.format, c.f.binaryFraming)
+	default:
+		c.log.Errorf("unknown format %s, expected jsonl, sql, es-bulk, parquet, msgpack or cbor", c.f.format)
+		return exitUsage
+	}
+	if c.f.tmpl != "" {
+		if c.f.emitContract != "" || c.f.lineage != "" {
+			// 契约和血缘描述的是模板渲染前的记录
+			c.log.Errorf("-template can not be used with -emit-contract or -lineage")
+			return exitUsage
+		}
+		if c.opts.template, err = sink.ParseTemplate(c.f.tmpl); err != nil {
+			c.log.Errorf("parse template failed: %v", err)
+			return exitUsage
+		}
+	}
+	return 0
+}
+
+// protectOptions 按 -classify、-policy、-mask 和 -hash-column 设置需要保护的列
+func (c *conversion) protectOptions() int {
+	var err error
+	if (c.f.classify == "") != (c.f.policyPath == "") {
+		c.log.Errorf("-classify and -policy must be used together")
+		return exitUsage
+	}
+	if c.f.classify != "" {
+		if c.f.dictionaryEncode != "" {
+			// 字典在转换前写出，其中是原值
+			c.log.Errorf("-classify can not be used with -dictionary-encode")
+			return exitUsage
+		}
+		classes, err := parseClassify(c.f.classify)
+		if err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+		p, err := loadPolicy(c.f.policyPath)
+		if err != nil {
+			c.log.Errorf("load policy failed: %v", err)
+			return 1
+		}
+		if c.opts.protections, err = p.protections(classes); err != nil {
+			c.log.Errorf("%v", err)
+			return 1
+		}
+	}
+	if c.f.mask != "" || len(c.f.hashColumns) > 0 {
+		if c.f.dictionaryEncode != "" {
+			c.log.Errorf("-mask and -hash-column can not be used with -dictionary-encode")
+			return exitUsage
+		}
+		masked, hashed := map[string]convert.Protection{}, map[string]convert.Protection{}
+		if c.f.mask != "" {
+			if masked, err = parseMask(c.f.mask); err != nil {
+				c.log.Errorf("%v", err)
+				return exitUsage
+			}
+		}
+		if hashed, err = parseHashColumns(c.f.hashColumns, c.f.hash); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+		for _, protections := range []map[string]convert.Protection{masked, hashed} {
+			if c.opts.protections, err = mergeProtections(c.opts.protections, protections); err != nil {
+				c.log.Errorf("%v", err)
+				return exitUsage
+			}
+		}
+	}
+	return 0
+}
+
+// presetOptions 应用配置文件和预设中的选项以及日期列
+func (c *conversion) presetOptions() int {
+	if c.config != nil {
+		// 配置文件的重命名和类型优先于预设
+		c.config.preset.apply(&c.opts)
+	}
+	if c.f.preset != "" {
+		p, err := loadPreset(c.f.preset)
+		if err != nil {
+			c.log.Errorf("load preset failed: %v", err)
+			return 1
+		}
+		p.apply(&c.opts)
+	}
+	c.opts.dateLayouts = c.f.dateFormats
+	if c.f.dateColumns != "" {
+		// 命令行指定的日期列优先于 schema 和预设
+		types := map[string]string{}
+		for col, typ := range c.opts.types {
+			types[col] = typ
+		}
+		for _, col := range strings.Split(c.f.dateColumns, ",") {
+			types[col] = convert.TypeDate
+		}
+		c.opts.types = types
+		c.opts.dateOutput = convert.DateRFC3339
+	}
+	if c.f.epoch {
+		c.opts.dateOutput = convert.DateEpoch
+	}
+	return 0
+}
+
+// separatorOptions 解析分隔符，未指定 -delimiter 时从输入中检测
+func (c *conversion) separatorOptions() int {
+	var err error
+	if c.f.recordSeparator != "" {
+		if c.opts.recordRegexp, err = parseSeparatorRegexp(c.f.recordSeparator); err != nil {
+			c.log.Errorf("invalid record separator %v", err)
+			return exitUsage
+		} else if c.opts.recordRegexp == nil {
+			if c.opts.recordSep, err = parseSeparator(c.f.recordSeparator); err != nil {
+				c.log.Errorf("invalid record separator %v", err)
+				return exitUsage
+			}
+		}
+	}
+	if c.f.delimiter != "" {
+		if err := c.opts.setDelimiter(c.f.delimiter); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+	} else if c.opts.fieldSep == "" && c.opts.fieldRegexp == nil {
+		// 预设的多个字符或正则表达式的分隔符同 -delimiter，不检测输入
+		detected, code := detectInput(c.f.inputFormat, c.f.input, c.opts.delimiter, &c.stdin, c.f.inputEncoding, c.log)
+		if code != 0 {
+			return code
+		}
+		c.opts.delimiter = detected.delimiter
+	}
+	if c.opts.fieldSep != "" || c.opts.recordSep != "" || c.opts.fieldRegexp != nil || c.opts.recordRegexp != nil {
+		switch {
+		case strings.ContainsAny(c.opts.fieldSep, "\"\r\n") || strings.Contains(c.opts.recordSep, `"`):
+			c.log.Errorf("-delimiter can not contain quotes or line breaks, -record-separator can not contain quotes")
+			return exitUsage
+		case c.opts.recordRegexp != nil && c.opts.fieldRegexp != nil && c.opts.recordRegexp.String() == c.opts.fieldRegexp.String(),
+			c.opts.recordSep != "" && (c.opts.recordSep == c.opts.fieldSep || c.opts.recordSep == string(c.opts.delimiter)):
+			c.log.Errorf("-record-separator must differ from -delimiter")
+			return exitUsage
+		case c.f.checkpointPath != "":
+			// 检查点的字节偏移按替换后的输入计算，不能用于定位原始的输入
+			c.log.Errorf("-checkpoint can not be used with a multi-character or regular expression -delimiter or -record-separator")
+			return exitUsage
+		}
+	}
+	return 0
+}
+
+// errorOptions 按 -on-error 设置格式错误的行的处理方式
+func (c *conversion) errorOptions() int {
+	var err error
+	if c.f.onError == "collect" {
+		if len(c.opts.protections) > 0 {
+			// 格式错误的行的字段与列对应不上，无法按列保护，原样写出会泄露敏感的值
+			c.log.Errorf("-on-error collect can not be used with -classify, -mask or -hash-column, malformed rows would be written unprotected; use -on-error skip")
+			return exitUsage
+		}
+		if c.f.errorFile == "" {
+			if c.f.output == "" || isObjectURL(c.f.output) {
+				c.log.Errorf("-on-error collect requires -error-file or a local -o")
+				return exitUsage
+			}
+			base := trimCompressionExt(c.f.output)
+			c.f.errorFile = strings.TrimSuffix(base, filepath.Ext(base)) + ".errors.jsonl"
+		}
+		// 检查参数后才创建，参数错误时不清空已有的文件
+		c.errorOut = &lazyFile{path: c.f.errorFile}
+		c.onClose(func() { c.errorOut.Close() })
+	}
+	var errorWriter io.Writer
+	if c.errorOut != nil {
+		errorWriter = c.errorOut
+	}
+	if c.opts.onError, err = newErrorHandler(c.f.onError, errorWriter); err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	return 0
+}
+
+// inferenceOptions 检查类型推断和 schema 演进的参数
+func (c *conversion) inferenceOptions() int {
+	var err error
+	switch c.f.inferConfidence {
+	case "strict", "lenient":
+		c.opts.confidence = c.f.inferConfidence
+	default:
+		c.log.Errorf("unknown infer-confidence %s, expected strict or lenient", c.f.inferConfidence)
+		return exitUsage
+	}
+	switch {
+	case c.f.inferSample < 0:
+		c.log.Errorf("-infer-sample must be positive")
+		return exitUsage
+	case c.f.inferSample > 0 && c.f.twoPass:
+		c.log.Errorf("-infer-sample can not be used with -two-pass")
+		return exitUsage
+	}
+	c.inferOpts = convert.InferOptions{Lenient: c.f.inferConfidence == "lenient", NoHeader: c.opts.noHeader, Header: c.opts.header, TrimSpace: c.opts.trimSpace, StripControlChars: c.opts.stripControl}
+	if c.f.priorSchema != "" {
+		c.evolution = &schemaEvolution{mode: c.f.evolutionMode, priorPath: c.f.priorSchema, migrationPath: c.f.migrationFile}
+		switch {
+		case !schemaEvolutions[c.f.evolutionMode]:
+			c.log.Errorf("unknown schema-evolution %s, expected warn, fail or emit-migration", c.f.evolutionMode)
+			return exitUsage
+		case !c.f.twoPass && c.f.inferSample == 0:
+			c.log.Errorf("-prior-schema compares the types inferred by -two-pass or -infer-sample, use one of them")
+			return exitUsage
+		case c.f.evolutionMode == "emit-migration" && c.f.migrationFile == "":
+			if c.f.output == "" || isObjectURL(c.f.output) {
+				c.log.Errorf("-schema-evolution emit-migration requires -migration-file or a local -o")
+				return exitUsage
+			}
+			c.evolution.migrationPath = c.f.output + ".migration.json"
+		}
+		if c.evolution.prior, err = loadSchema(c.f.priorSchema); err != nil {
+			c.log.Errorf("load prior schema failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// prepareInput 需要先读一遍输入时读取输入，推断类型、创建字典和 k-匿名的分组
+func (c *conversion) prepareInput() int {
+	tmpReserveBytes, err := parseSize(c.f.tmpReserve)
+	if err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	var maxTempDiskBytes int64
+	if c.f.maxTempDisk != "" {
+		if maxTempDiskBytes, err = parseSize(c.f.maxTempDisk); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+	}
+	c.source = c.f.input
+	if (c.f.dictionaryEncode != "" || c.f.twoPass || c.f.kAnonymity > 0) && (c.f.input == "" || c.f.input == "-" || isRemoteInput(c.f.input)) {
+		// 字典、类型推断和 k-匿名需要先读一遍输入，标准输入和远程的输入先写入临时文件
+		spill, err := newSpillDir(c.f.tmpDir, tmpReserveBytes, maxTempDiskBytes)
+		if err != nil {
+			c.log.Errorf("create temporary directory failed: %v", err)
+			return 1
+		}
+		c.onClose(func() { spill.Close() })
+		var src io.Reader = c.stdin
+		if isRemoteInput(c.f.input) {
+			body, err := openRemote(c.f.input)
+			if err != nil {
+				c.log.Errorf("open file failed: %v", err)
+				return 1
+			}
+			c.onClose(func() { body.Close() })
+			src = body
+		}
+		if c.f.input, err = spill.spool(src); err != nil {
+			c.log.Errorf("spool input failed: %v", err)
+			return 1
+		}
+	}
+	if c.f.twoPass {
+		if c.opts.schema, err = c.opts.inferSchema(c.f.input, c.f.inputEncoding, c.inferOpts); err != nil {
+			c.log.Errorf("infer schema failed: %v", err)
+			return 1
+		}
+		c.opts.inference = "two-pass"
+		logSchema(c.opts.schema, c.opts.inference, c.log)
+		if c.evolution != nil {
+			if code := c.evolution.check(c.opts.schema, c.source, c.log); code != 0 {
+				return code
+			}
+		}
+	}
+	if c.f.dictionaryEncode != "" {
+		if c.opts.dictionary, err = c.opts.buildDictionary(c.f.input, c.f.inputEncoding, strings.Split(c.f.dictionaryEncode, ",")); err != nil {
+			c.log.Errorf("build dictionary failed: %v", err)
+			return 1
+		}
+	}
+	if c.f.kAnonymity > 0 {
+		if c.opts.kAnonymity, err = c.opts.buildKAnonymity(c.f.input, c.f.inputEncoding, strings.Split(c.f.quasiIdentifiers, ","), c.f.kAnonymity); err != nil {
+			c.log.Errorf("build k-anonymity failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// installObservers 安装观察写出的记录的契约、校验、报告、进度、心跳和控制
+func (c *conversion) installObservers() int {
+	if c.f.emitContract != "" {
+		c.collector = newContractCollector(&c.opts)
+		c.opts.lineage = c.collector.onLineage(c.opts.lineage)
+		c.opts.observe = c.collector.observe
+	}
+	if c.sqlOut != nil && c.opts.template == nil {
+		c.opts.lineage = c.sqlOut.onLineage(&c.opts, c.opts.lineage)
+	}
+	if c.parquetOut != nil && c.opts.template == nil {
+		c.opts.lineage = c.parquetOut.onLineage(&c.opts, c.opts.lineage)
+	}
+	if c.f.validate {
+		c.checker = newValidator(c.opts.nested)
+		c.opts.lineage = c.checker.onLineage(c.opts.lineage)
+		// 跳过并记录格式错误的行，以便校验整个输入
+		c.opts.onError = c.checker.onError(c.opts.onError)
+		observe := c.opts.observe
+		c.opts.observe = func(record interface{}) {
+			c.checker.observe(record)
+			if observe != nil {
+				observe(record)
+			}
+		}
+	}
+	if c.f.reportPath != "" {
+		c.reporter = newReportCollector()
+		if c.opts.onError != nil {
+			c.opts.onError = c.reporter.onError(c.opts.onError)
+		}
+		observe := c.opts.observe
+		c.opts.observe = func(record interface{}) {
+			c.reporter.observe(record)
+			if observe != nil {
+				observe(record)
+			}
+		}
+	}
+
+	if c.f.output != "" && c.f.showProgress && isTerminal(c.stderr) {
+		var total int64
+		if fi, err := os.Stat(c.f.input); err == nil && fi.Mode().IsRegular() {
+			total = fi.Size()
+		}
+		c.bar = newProgress(c.stderr, total, c.log)
+		observe := c.opts.observe
+		c.opts.observe = func(record interface{}) {
+			c.bar.observe(record)
+			if observe != nil {
+				observe(record)
+			}
+		}
+	}
+
+	if c.f.heartbeatFile != "" {
+		if c.f.heartbeatInterval <= 0 {
+			c.log.Errorf("-heartbeat-interval must be positive")
+			return exitUsage
+		}
+		c.hb = newHeartbeat(c.f.heartbeatFile, c.f.heartbeatInterval)
+		observe := c.opts.observe
+		c.opts.observe = func(record interface{}) {
+			c.hb.observe(record)
+			if observe != nil {
+				observe(record)
+			}
+		}
+	}
+
+	if c.f.controlSocket != "" {
+		if c.f.controlSocket == "-" && (c.f.input == "" || c.f.input == "-" || c.f.output == "") {
+			// 标准输入和标准输出用于命令和回复
+			c.log.Errorf("-control-socket - requires -i and -o")
+			return exitUsage
+		}
+		c.ctl = newController()
+		observe := c.opts.observe
+		c.opts.observe = func(record interface{}) {
+			c.ctl.observe(record)
+			if observe != nil {
+				observe(record)
+			}
+		}
+	}
+
+	if c.bar != nil {
+		c.counter = &c.bar.bytes
+	}
+	if c.hb != nil {
+		if c.counter != nil {
+			c.hb.bytes = c.counter
+		} else {
+			c.counter = c.hb.bytes
+		}
+	}
+	if c.ctl != nil {
+		if c.counter != nil {
+			c.ctl.bytes = c.counter
+		} else {
+			c.counter = c.ctl.bytes
+		}
+	}
+	return 0
+}
+
+// openInput 打开输入，按样本推断类型并检查表头
+func (c *conversion) openInput() int {
+	var err error
+	if c.f.follow {
+		stop := make(chan struct{})
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		c.onClose(func() { signal.Stop(sig) })
+		var timeout <-chan time.Time
+		if c.f.maxRuntime > 0 {
+			timeout = time.After(time.Until(c.started.Add(c.f.maxRuntime)))
+		}
+		go func() {
+			select {
+			case <-sig:
+				c.log.Infof("follow: stopping")
+			case <-timeout:
+				c.log.Infof("follow: max runtime of %v reached, stopping", c.f.maxRuntime)
+			}
+			close(stop)
+		}()
+		c.in, err = openFollowed(c.f.input, !c.opts.noHeader, stop)
+	} else {
+		c.in, err = openCountedInput(c.f.input, c.stdin, c.counter)
+	}
+	if err != nil {
+		c.log.Errorf("open file failed: %v", err)
+		return 1
+	}
+	in := c.in
+	c.onClose(func() { in.Close() })
+	if c.in, err = decodeInput(c.in, c.f.inputEncoding); err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	c.in = c.opts.separate(c.in)
+	if c.f.inferSample > 0 {
+		// 推断读取的数据保存在内存中，转换时重新读取，不需要写入临时文件
+		c.inferOpts.Sample = c.f.inferSample
+		if c.opts.schema, c.in, err = sampleSchema(c.in, c.opts.delimiter, c.inferOpts); err != nil {
+			c.log.Errorf("infer schema failed: %v", err)
+			return 1
+		}
+		c.opts.inference = "sample"
+		logSchema(c.opts.schema, c.opts.inference, c.log)
+		if c.evolution != nil {
+			if code := c.evolution.check(c.opts.schema, c.source, c.log); code != 0 {
+				return code
+			}
+		}
+	}
+	// 创建输出前按表头检查参数，参数与输入不符时不清空已有的输出
+	if c.in, err = c.opts.checkHeader(c.in); err != nil {
+		c.log.Errorf("%v", err)
+		return exitUsage
+	}
+	if c.errorOut != nil {
+		if err := c.errorOut.create(); err != nil {
+			c.log.Errorf("open error file failed: %v", err)
+			return 1
+		}
+	}
+
+	if c.f.maxRuntime > 0 && !c.f.follow {
+		c.deadline = &deadlineReader{ReadCloser: c.in, deadline: c.started.Add(c.f.maxRuntime)}
+		c.in = c.deadline
+	}
+	if c.ctl != nil {
+		c.in = c.ctl.reader(c.in)
+	}
+	return 0
+}
+
+// outputLayout 检查输出的切分、分区和压缩
+func (c *conversion) outputLayout() int {
+	var err error
+	if c.f.splitSize != "" {
+		if c.maxPartSize, err = parseSize(c.f.splitSize); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+	}
+	switch c.f.chunking {
+	case "rows":
+	case "cdc":
+		if c.f.splitRows > 0 || c.maxPartSize > 0 {
+			c.log.Errorf("-split-rows and -split-size can not be used with -chunking cdc")
+			return exitUsage
+		}
+	default:
+		c.log.Errorf("unknown chunking %s", c.f.chunking)
+		return exitUsage
+	}
+
+	if (c.f.shardBy == "") != (c.f.shards <= 0) {
+		c.log.Errorf("-shard-by and -shards must be used together")
+		return exitUsage
+	}
+	if c.f.shardBy != "" {
+		switch {
+		case c.f.output == "":
+			c.log.Errorf("-shard-by requires -o")
+			return exitUsage
+		case isObjectURL(c.f.output):
+			// 每个分区同时缓存一段上传的数据
+			c.log.Errorf("-shard-by can not write to object storage")
+			return exitUsage
+		case c.f.splitRows > 0 || c.maxPartSize > 0 || c.f.chunking == "cdc" || c.f.zstdDictTrain != "":
+			c.log.Errorf("-shard-by can not be used with -split-rows, -split-size, -chunking cdc or -zstd-dict-train")
+			return exitUsage
+		case len(c.opts.columns) == 1:
+			c.log.Errorf("-shard-by requires records as objects, select more than one column")
+			return exitUsage
+		}
+		if err := checkOpenFiles(c.f.shards, c.f.maxOpenFiles); err != nil {
+			c.log.Errorf("%v", err)
+			return exitUsage
+		}
+		for col := range c.opts.dictionary {
+			if c.opts.key(col) == c.opts.shardField {
+				// 字典的序号随输入变化，不能保证相同的值写入同一个分区
+				c.log.Errorf("-shard-by field %s can not be dictionary encoded", c.f.shardBy)
+				return exitUsage
+			}
+		}
+	}
+
+	if c.f.compress != "" {
+		ext, ok := outputCompressions[c.f.compress]
+		if !ok {
+			c.log.Errorf("unknown compression %s", c.f.compress)
+			return exitUsage
+		}
+		if c.f.output != "" && !strings.HasSuffix(c.f.output, ext) {
+			c.f.output += ext
+		}
+	}
+	return 0
+}
+
+// openOutput 创建输出，写出字典并打开第一个输出文件
+func (c *conversion) openOutput() int {
+	var err error
+	if c.f.output == "" {
+		if c.f.splitRows > 0 || c.maxPartSize > 0 || c.f.chunking == "cdc" || c.f.index != "" {
+			c.log.Errorf("-split-rows, -split-size, -chunking cdc and -index require -o")
+			return exitUsage
+		}
+		c.w = c.stdout
+		if c.f.compress != "" {
+			c.comp, _ = newCompressor(c.stdout, outputCompressions[c.f.compress], nil)
+			c.w = c.comp
+		}
+		if c.checker != nil {
+			// 标准输出只写出校验结果
+			c.w = io.Discard
+		} else if c.f.flushInterval > 0 || c.f.flushRows > 0 {
+			// 压缩时先刷新压缩的缓冲，再刷新标准输出（如 HTTP 响应）
+			c.flusher = newFlushWriter(c.w, c.f.flushRows, c.f.flushInterval, c.stdout)
+			c.w = c.flusher
+		}
+	} else if c.f.checkpointPath != "" {
+		if c.ckpt, err = openCheckpointWriter(c.f.checkpointPath, c.f.input, c.f.output, c.resume); err != nil {
+			c.log.Errorf("open file failed: %v", err)
+			return 1
+		}
+		c.onClose(func() { c.ckpt.Close() })
+		c.w = c.ckpt
+		c.opts.checkpointRows, c.opts.onCheckpoint = c.f.checkpointRows, c.ckpt.checkpoint
+		if c.resume != nil {
+			c.opts.resume = &c.resume.Checkpoint
+			c.log.Infof("resuming from checkpoint %s at line %d after %d rows", c.f.checkpointPath, c.resume.Line, c.resume.Rows)
+		}
+	} else if c.f.shardBy != "" {
+		c.sharded = newShardWriter(c.f.output, c.opts.shardField, c.f.shards, c.f.hash)
+		c.onClose(func() { c.sharded.Close() })
+		c.w = c.sharded
+	} else {
+		// 输出文件以 .gz 或 .zst 结尾时使用 gzip 或 zstd 压缩
+		c.out = newSplitWriter(c.f.output, c.f.splitRows)
+		c.out.splitSize = c.maxPartSize
+		if c.f.chunking == "cdc" {
+			c.out.chunker = newCDCChunker(c.f.chunkSize)
+		}
+		c.onClose(func() { c.out.Close() })
+		c.w = c.out
+	}
+
+	if c.opts.dictionary != nil {
+		preamble, err := c.opts.dictionaryPreamble()
+		if err != nil {
+			c.log.Errorf("encode dictionary failed: %v", err)
+			return 1
+		}
+		if c.out != nil {
+			c.out.preamble = preamble
+		} else if c.sharded != nil {
+			c.sharded.preamble = preamble
+		} else if c.resume != nil {
+			// 继续转换时字典已经写在输出的开头
+		} else if _, err := c.w.Write(preamble); err != nil {
+			c.log.Errorf("write dictionary failed: %v", err)
+			return 1
+		}
+	}
+
+	if c.f.zstdDictTrain != "" || c.f.zstdDict != "" {
+		if !strings.HasSuffix(c.f.output, ".zst") {
+			c.log.Errorf("-zstd-dict-train and -zstd-dict require a .zst output")
+			return exitUsage
+		}
+		if c.f.zstdDict != "" {
+			dict, err := loadZstdDict(c.f.zstdDict)
+			if err != nil {
+				c.log.Errorf("load zstd dictionary failed: %v", err)
+				return 1
+			}
+			if c.sharded != nil {
+				c.sharded.zstdDict = dict
+			} else {
+				c.out.zstdDict = dict
+			}
+		} else {
+			// 训练完成后才能创建输出文件
+			c.trainer = newDictTrainer(c.out, c.f.zstdDictTrain, c.f.zstdDictSamples)
+			c.w = c.trainer
+		}
+	}
+	if c.out != nil && c.trainer == nil {
+		if err := c.out.openNext(); err != nil {
+			c.log.Errorf("open file failed: %v", err)
+			return 1
+		}
+	}
+	if c.sharded != nil {
+		if err := c.sharded.open(); err != nil {
+			c.log.Errorf("open file failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// wrapOutput 改写输出的格式，使用 -control-socket 时开始接收命令
+func (c *conversion) wrapOutput() int {
+	if c.reformat != nil {
+		c.w = c.reformat.wrap(c.w)
+	}
+	if c.ctl != nil {
+		// 由外向内刷新：改写格式的缓冲、定时刷新的缓冲、压缩器
+		if c.sqlOut != nil {
+			c.ctl.onFlush(c.sqlOut.flush)
+		}
+		if c.parquetOut != nil {
+			c.ctl.onFlush(c.parquetOut.flush)
+		}
+		if c.flusher != nil {
+			c.ctl.onFlush(c.flusher.Flush)
+		}
+		if f, ok := c.comp.(interface{ Flush() error }); ok {
+			c.ctl.onFlush(f.Flush)
+		}
+		if c.out != nil {
+			c.ctl.onFlush(c.out.Flush)
+		}
+		c.w = c.ctl.writer(c.w)
+		if err := c.ctl.serve(c.f.controlSocket, c.stdin, c.stdout); err != nil {
+			c.log.Errorf("control: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// run 执行转换，返回转换的错误
+func (c *conversion) run() error {
+	conv := c.opts.converter()
+	start := time.Now()
+	if c.bar != nil {
+		c.bar.run()
+	}
+	if c.hb != nil {
+		c.hb.run()
+	}
+	err := conv.Convert(c.in, c.w)
+	if err == nil && c.eosRecord != nil {
+		// 只有完整结束的转换写出结束标记，分区时每个文件都写出
+		if c.sharded != nil {
+			err = c.sharded.writeAll(c.eosRecord)
+		} else {
+			_, err = c.w.Write(c.eosRecord)
+		}
+	}
+	if c.reformat != nil {
+		// 转换失败时也写出已经转换的行
+		if closeErr := c.reformat.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if c.flusher != nil {
+		if closeErr := c.flusher.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if c.bar != nil {
+		c.bar.finish()
+	}
+	if c.hb != nil {
+		c.hb.finish(err)
+	}
+	if c.ctl != nil {
+		c.ctl.finish()
+	}
+	c.stats, c.elapsed = conv.Stats(), time.Since(start)
+	return err
+}
+
+// finish 按转换的结果写出校验结果、中止或完成输出，记录转换的摘要
+func (c *conversion) finish(err error) int {
+	if c.notify != nil {
+		c.notify.stats = c.stats
+	}
+	if c.checker != nil {
+		src := c.f.input
+		if src == "" {
+			src = "-"
+		}
+		enc := json.NewEncoder(c.stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(c.checker.report(src, c.stats, err)); err != nil {
+			c.log.Errorf("write report failed: %v", err)
+			return 1
+		}
+	}
+	if err != nil && c.out != nil {
+		// 不完整的输出不上传到对象存储
+		c.out.Abort()
+	}
+	if err != nil && c.deadline != nil && c.deadline.exceeded.Load() {
+		reason := fmt.Sprintf("max runtime of %v exceeded", c.f.maxRuntime)
+		c.log.Errorf("convert aborted: %s after %d rows, the output is partial", reason, c.stats.Rows)
+		if c.f.output != "" && !isObjectURL(c.f.output) {
+			if err := markPartial(c.f.output, reason, c.stats.Rows, c.stats.Emitted); err != nil {
+				c.log.Errorf("mark partial output failed: %v", err)
+			}
+		}
+		if c.ckpt != nil {
+			c.ckpt.logResume()
+		}
+		return 1
+	}
+	if err != nil {
+		c.log.Errorf("convert failed: %v", err)
+		if c.ckpt != nil {
+			c.ckpt.logResume()
+		}
+		var rowErr *convert.RowError
+		if errors.As(err, &rowErr) {
+			return exitParseErrors
+		}
+		return 1
+	}
+	if c.f.output != "" && !isObjectURL(c.f.output) {
+		// 删除之前中止的转换留下的标记
+		os.Remove(c.f.output + partialSuffix)
+	}
+	if c.ckpt != nil {
+		if err := c.ckpt.Close(); err != nil {
+			c.log.Errorf("close file failed: %v", err)
+			return 1
+		}
+		// 转换已经完成，下次转换重新开始
+		os.Remove(c.f.checkpointPath)
+	}
+	if c.f.output != "" {
+		warnings := 0
+		for _, n := range c.stats.Warnings {
+			warnings += n
+		}
+		c.log.Infof("summary: %d rows read, %d emitted, %d skipped, %d errors, %d warnings in %v (%.0f rows/s)",
+			c.stats.Rows, c.stats.Emitted, c.stats.Rows-c.stats.Emitted, c.stats.Malformed, warnings,
+			c.elapsed.Round(time.Millisecond), float64(c.stats.Rows)/c.elapsed.Seconds())
+	}
+	return 0
+}
+
+// closeOutput 关闭输出并写出索引
+func (c *conversion) closeOutput() int {
+	if c.comp != nil {
+		if err := c.comp.Close(); err != nil {
+			c.log.Errorf("close output failed: %v", err)
+			return 1
+		}
+	}
+
+	if c.trainer != nil {
+		if err := c.trainer.Close(); err != nil {
+			c.log.Errorf("train zstd dictionary failed: %v", err)
+			return 1
+		}
+	}
+
+	if c.out != nil {
+		if err := c.out.Close(); err != nil {
+			c.log.Errorf("close file failed: %v", err)
+			return 1
+		}
+		if c.f.index != "" {
+			if err := c.out.writeIndex(c.f.index, c.deprecated); err != nil {
+				c.log.Errorf("write index failed: %v", err)
+				return 1
+			}
+		}
+	}
+
+	if c.sharded != nil {
+		if err := c.sharded.Close(); err != nil {
+			c.log.Errorf("close file failed: %v", err)
+			return 1
+		}
+		if c.f.index != "" {
+			if err := c.sharded.writeIndex(c.f.index, c.deprecated); err != nil {
+				c.log.Errorf("write index failed: %v", err)
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// writeReports 写出契约和报告
+func (c *conversion) writeReports() int {
+	if c.source == "" {
+		c.source = "-"
+	}
+	if c.collector != nil {
+		if err := writeContract(c.f.emitContract, c.collector.contract(c.f.contractVersion, c.source)); err != nil {
+			c.log.Errorf("write contract failed: %v", err)
+			return 1
+		}
+	}
+
+	if c.reporter != nil {
+		r := c.reporter.report(c.fs, c.stats, c.elapsed)
+		r.Source, r.Output = c.source, c.f.output
+		r.Deprecations = c.deprecated
+		if r.Output == "" {
+			r.Output = "-"
+		}
+		if err := writeReport(c.f.reportPath, r); err != nil {
+			c.log.Errorf("write report failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// deprecation 废弃的命令行参数及其替代
+type deprecation struct {
+	Flag string `json:"flag"`
+	// Since 开始废弃的版本
+	Since       string `json:"since"`
+	Replacement string `json:"replacement"`
+}
+
+// deprecations 转换的废弃参数，仍然可以使用，-strict-flags 时报错
+var deprecations = []deprecation{
+	{Flag: "logger_level", Since: "2.0.0", Replacement: "-log-level"},
+	{Flag: "decode-entities-columns", Since: "2.0.0", Replacement: "-transform <column>:html_unescape"},
+}
+
+func (d deprecation) String() string {
+	return fmt.Sprintf("-%s is deprecated since %s, use %s instead", d.Flag, d.Since, d.Replacement)
+}
+
+// usedDeprecations 返回命令行中使用的废弃参数
+func usedDeprecations(fs *flag.FlagSet) []deprecation {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var used []deprecation
+	for _, d := range deprecations {
+		if set[d.Flag] {
+			used = append(used, d)
+		}
+	}
+	return used
+}
+
+// checkDeprecations 按字段输出使用的废弃参数，strict 时作为错误输出并返回 false
+func checkDeprecations(used []deprecation, strict bool, logger log.FieldLogger) bool {
+	for _, d := range used {
+		entry := logger.WithFields(log.Fields{"deprecated": "-" + d.Flag, "since": d.Since, "replacement": d.Replacement})
+		if strict {
+			entry.Errorf("%v", d)
+		} else {
+			entry.Warnf("%v", d)
+		}
+	}
+	return !strict || len(used) == 0
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// inputEncodings 支持的输入字符集，utf-16 按 BOM 判断字节序，没有 BOM 时为小端
+var inputEncodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"gbk":          simplifiedchinese.GBK,
+	"gb18030":      simplifiedchinese.GB18030,
+	"latin1":       charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"shift-jis":    japanese.ShiftJIS,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+}
+
+// encodingNames 返回支持的字符集名称
+func encodingNames() []string {
+	names := make([]string, 0, len(inputEncodings))
+	for name := range inputEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodedReader 将输入从其他字符集转换为 UTF-8，关闭时关闭原始输入
+type decodedReader struct {
+	io.Reader
+	io.Closer
+}
+
+// decodeInput 将字符集为 name 的输入转换为 UTF-8，name 为空或 utf-8 时原样返回
+func decodeInput(in io.ReadCloser, name string) (io.ReadCloser, error) {
+	if name == "" || name == "utf-8" {
+		return in, nil
+	}
+	enc, ok := inputEncodings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %s", name)
+	}
+	return decodedReader{Reader: transform.NewReader(in, enc.NewDecoder()), Closer: in}, nil
+}
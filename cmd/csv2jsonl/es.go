@@ -0,0 +1,124 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// esAction Elasticsearch bulk API 中每条文档之前的操作行
+type esAction struct {
+	Index esMeta `json:"index"`
+}
+
+type esMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+// esBulkWriter 在每条 JSON 记录前写出 _bulk 的操作行
+type esBulkWriter struct {
+	w       io.Writer
+	index   string
+	idField string
+}
+
+func newESBulkWriter(index, idField string) *esBulkWriter {
+	return &esBulkWriter{index: index, idField: idField}
+}
+
+// validateESIndex 检查 Elasticsearch 的索引名
+func validateESIndex(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("invalid es-index %q", name)
+	case strings.ToLower(name) != name:
+		return fmt.Errorf("es-index %s must be lowercase", name)
+	case strings.ContainsAny(name, `\/*?"<>| ,#:`):
+		return fmt.Errorf(`es-index %s can not contain \, /, *, ?, ", <, >, |, space, comma, # or :`, name)
+	case strings.IndexAny(name, "-_+") == 0:
+		return fmt.Errorf("es-index %s can not start with -, _ or +", name)
+	}
+	return nil
+}
+
+func (e *esBulkWriter) wrap(w io.Writer) io.Writer {
+	e.w = w
+	return e
+}
+
+// BeginRecord 转发给底层的 Writer，操作行和文档写入同一个文件
+func (e *esBulkWriter) BeginRecord() error {
+	if rw, ok := e.w.(interface{ BeginRecord() error }); ok {
+		return rw.BeginRecord()
+	}
+	return nil
+}
+
+// Write 接收一条 JSON 记录，写出操作行和记录
+func (e *esBulkWriter) Write(p []byte) (int, error) {
+	action := esAction{Index: esMeta{Index: e.index}}
+	if e.idField != "" {
+		id, err := e.id(p)
+		if err != nil {
+			return 0, err
+		}
+		action.Index.ID = id
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(action); err != nil {
+		return 0, err
+	}
+	buf.Write(p)
+	if _, err := e.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// id 返回记录中 idField 字段的文本，字段不存在或为空时报错
+func (e *esBulkWriter) id(record []byte) (string, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(record, &m); err != nil {
+		return "", fmt.Errorf("es-id-column requires records as objects: %v", err)
+	}
+	raw := lookupRaw(m, e.idField)
+	var id string
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+	case raw[0] == '"':
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return "", err
+		}
+	default:
+		id = string(raw)
+	}
+	if id == "" {
+		return "", fmt.Errorf("es-bulk: record without the es-id-column field %s", e.idField)
+	}
+	return id, nil
+}
+
+// Close 没有缓存的数据
+func (e *esBulkWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,444 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+)
+
+// stringsFlag 可重复指定的命令行参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// convertFlags 转换的命令行参数
+type convertFlags struct {
+	input  string
+	output string
+
+	loggerLevel        string
+	strictFlags        bool
+	limit              int
+	skip               int
+	sampleRate         float64
+	sampleN            int
+	sampleSeed         int64
+	workers            int
+	unordered          bool
+	pretty             bool
+	asciiOnly          bool
+	nested             bool
+	emptyAsNull        bool
+	omitEmpty          bool
+	trimSpace          bool
+	stripControl       bool
+	noHeader           bool
+	header             string
+	ignoreCase         bool
+	columns            string
+	transforms         stringsFlag
+	valueMaps          stringsFlag
+	defaults           stringsFlag
+	keyCase            string
+	mapFile            string
+	mapCache           string
+	decodeEntities     string
+	schema             string
+	dictionaryEncode   string
+	twoPass            bool
+	inferSample        int
+	inferConfidence    string
+	priorSchema        string
+	evolutionMode      string
+	migrationFile      string
+	dateColumns        string
+	dateFormats        stringsFlag
+	epoch              bool
+	parseJSONColumns   string
+	flatten            bool
+	flattenPrefix      bool
+	inferTypes         bool
+	addLineNumber      string
+	addMeta            string
+	positionField      string
+	detectLang         string
+	parseUA            string
+	preset             string
+	configPath         string
+	profile            string
+	whereDate          string
+	filter             string
+	format             string
+	table              string
+	sqlBatch           int
+	sqlDialect         string
+	esIndex            string
+	esIDColumn         string
+	parquetRowGroup    int
+	binaryFraming      string
+	parquetCompression string
+	tmpl               string
+	kAnonymity         int
+	quasiIdentifiers   string
+	classify           string
+	policyPath         string
+	mask               string
+	hashColumns        stringsFlag
+	dedupeKey          string
+	dedupeMode         string
+	dedupeCapacity     int
+	dedupeRate         float64
+	assertSorted       string
+	assertSortedDesc   bool
+	assertSortedMode   string
+	splitRows          int
+	splitSize          string
+	shardBy            string
+	shards             int
+	hash               string
+	chunking           string
+	chunkSize          int64
+	compress           string
+	validate           bool
+	reportPath         string
+	emitContract       string
+	contractVersion    string
+	lineage            string
+	index              string
+	zstdDictTrain      string
+	zstdDictSamples    int
+	zstdDict           string
+	inputEncoding      string
+	inputFormat        string
+	delimiter          string
+	recordSeparator    string
+
+	onError       string
+	strictColumns bool
+	warnLimit     int
+	errorFile     string
+
+	showProgress      bool
+	heartbeatFile     string
+	controlSocket     string
+	heartbeatInterval time.Duration
+
+	notifyWebhook string
+	notifyEmail   string
+	notifySMTP    string
+	notifyFrom    string
+
+	tmpDir         string
+	tmpReserve     string
+	maxTempDisk    string
+	lock           bool
+	waitLock       time.Duration
+	maxRuntime     time.Duration
+	maxOpenFiles   int
+	eosRecord      string
+	flushInterval  time.Duration
+	flushRows      int
+	stream         bool
+	checkpointPath string
+	checkpointRows int
+	follow         bool
+
+	serve string
+
+	help bool
+}
+
+// newConvertFlags 定义转换的命令行参数
+func newConvertFlags(stderr io.Writer) (*flag.FlagSet, *convertFlags) {
+	fs := flag.NewFlagSet("csv2jsonl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	f := &convertFlags{}
+	fs.StringVar(&f.input, "i", "", "input csv file, - or empty for stdin, an http(s) url or an object storage url: s3://bucket/key with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, gs://bucket/object with GOOGLE_OAUTH_ACCESS_TOKEN or STORAGE_EMULATOR_HOST, az://account/container/blob with AZURE_STORAGE_SAS_TOKEN")
+	fs.StringVar(&f.output, "o", "", "output jsonl file, or an object storage url streamed by multipart upload: s3://bucket/key, gs://bucket/object or az://account/container/blob")
+
+	fs.StringVar(&f.loggerLevel, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&f.loggerLevel, "logger_level", "info", "deprecated, use -log-level")
+	fs.BoolVar(&f.strictFlags, "strict-flags", false, "fail instead of warning when deprecated flags are used, e.g. in CI")
+	fs.IntVar(&f.limit, "limit", 0, "limit")
+	fs.IntVar(&f.skip, "skip", 0, "skip the first n data rows, e.g. to resume a conversion")
+	fs.IntVar(&f.skip, "offset", 0, "alias of -skip")
+	fs.Float64Var(&f.sampleRate, "sample", 0, "convert a random sample of the rows, each kept with this probability, e.g. 0.01")
+	fs.IntVar(&f.sampleN, "sample-n", 0, "convert a uniform random sample of n rows in input order, held in memory until the input is read")
+	fs.Int64Var(&f.sampleSeed, "sample-seed", 0, "seed of -sample and -sample-n selecting the same rows on every run, random by default")
+	fs.IntVar(&f.workers, "workers", 1, "number of goroutines converting rows, the output keeps the input order")
+	fs.BoolVar(&f.unordered, "unordered", false, "with -workers, write records as soon as they are converted instead of in the input order")
+	fs.BoolVar(&f.pretty, "pretty", false, "output format pretty")
+	fs.BoolVar(&f.asciiOnly, "ascii-only", false, "escape all non-ascii characters as \\uXXXX")
+	fs.BoolVar(&f.nested, "nested", false, "write dotted column names such as user.address.city as nested objects")
+	fs.BoolVar(&f.emptyAsNull, "empty-as-null", false, "write empty cells as null instead of empty strings")
+	fs.BoolVar(&f.omitEmpty, "omit-empty", false, "leave the keys of empty cells out of the records")
+	fs.BoolVar(&f.trimSpace, "trim-space", false, "remove leading and trailing white space, including non-breaking spaces, from the cells")
+	fs.BoolVar(&f.stripControl, "strip-control-chars", false, "remove control characters other than tab and newlines, and zero-width characters, from the cells")
+	fs.BoolVar(&f.noHeader, "no-header", false, "read the first row as data, the columns are named col1, col2, ... or by -header")
+	fs.StringVar(&f.header, "header", "", "comma separated column names of input without a header row, requires -no-header")
+	fs.BoolVar(&f.ignoreCase, "ignore-case-columns", false, "match the column names given to all options ignoring case")
+	fs.StringVar(&f.columns, "columns", "", "comma separated columns to print, by name, #n, /regexp/ or wildcard such as metric_*, default as all")
+	fs.Var(&f.transforms, "transform", "apply transforms to a column as column:transform[,transform...], may be repeated; transforms: "+strings.Join(transform.Names(), ", "))
+	fs.Var(&f.valueMaps, "map", "rewrite coded values of a column as column=code:value[,code:value...], e.g. status=0:inactive,1:active, may be repeated")
+	fs.Var(&f.defaults, "default", "fill empty cells of a column with a default value as column=value[,column=value...], e.g. country=US,active=true, may be repeated")
+	fs.StringVar(&f.keyCase, "key-case", "", "write the keys of columns that are not renamed as snake_case, camelCase, kebab-case or lower case: snake, camel, kebab or lower")
+	fs.StringVar(&f.mapFile, "map-file", "", "yaml or json file of the -map lookup tables of each column, e.g. {\"status\": {\"0\": \"inactive\"}}")
+	fs.StringVar(&f.mapCache, "map-cache", "", "directory caching the parsed -map-file tables by the path, size and modification time of the file, shared by repeated and concurrent runs")
+	fs.StringVar(&f.decodeEntities, "decode-entities-columns", "", "deprecated, use -transform column:html_unescape")
+	fs.StringVar(&f.schema, "schema", "", "json file mapping column names to types: string, int, float, bool, date, json or null-if-empty")
+	fs.StringVar(&f.dictionaryEncode, "dictionary-encode", "", "write repetitive values of these comma separated columns as indexes into a dictionary written once at the start of each output file")
+	fs.BoolVar(&f.twoPass, "two-pass", false, "read the whole input first to infer the exact type of each column, then convert with these types")
+	fs.IntVar(&f.inferSample, "infer-sample", 0, "infer the type of each column from the first n rows, then convert with these types; a faster alternative to -two-pass")
+	fs.StringVar(&f.inferConfidence, "infer-confidence", "strict", "types inferred by -two-pass and -infer-sample: strict requires all non-empty cells of a column to have the type, lenient 95% of them")
+	fs.StringVar(&f.priorSchema, "prior-schema", "", "schema file of the previous delivery, in the -schema format, to compare the types inferred by -two-pass or -infer-sample with")
+	fs.StringVar(&f.evolutionMode, "schema-evolution", "warn", "when the inferred types differ from -prior-schema: warn, fail, or emit-migration to also write the added, removed and retyped columns to -migration-file")
+	fs.StringVar(&f.migrationFile, "migration-file", "", "json file of -schema-evolution emit-migration, default <output>.migration.json")
+	fs.StringVar(&f.dateColumns, "date-columns", "", "parse the dates of these comma separated columns and write them as RFC 3339, e.g. 2024-01-02T00:00:00Z")
+	fs.Var(&f.dateFormats, "date-format", "go time layout of the dates of date columns, e.g. 01/02/2006 or '02.01.2006 15:04', may be repeated; ISO 8601 dates are always recognized")
+	fs.BoolVar(&f.epoch, "epoch", false, "write the dates of date columns as unix seconds")
+	fs.StringVar(&f.parseJSONColumns, "parse-json-columns", "", "parse the cells of these comma separated columns as embedded json, other cells are no longer parsed because they look like json objects")
+	fs.BoolVar(&f.flatten, "flatten", false, "merge the keys of objects parsed from JSON cells into the record as <column>_<key>, nested keys joined with _")
+	fs.BoolVar(&f.flattenPrefix, "flatten-prefix", true, "prefix the keys merged by -flatten with the column, -flatten-prefix=false merges them as they are")
+	fs.BoolVar(&f.inferTypes, "infer-types", false, "convert numeric and boolean cells to json numbers and booleans")
+	fs.StringVar(&f.addLineNumber, "add-line-number", "", "add the number of each data row in the input, counting from 1, as this field, e.g. _row")
+	fs.StringVar(&f.addMeta, "add-meta", "", "add comma separated metadata to each record: source (the input file name) as _source and timestamp (the conversion start time) as _timestamp, or as another field with e.g. source=_file")
+	fs.StringVar(&f.positionField, "position-field", "", "add the line number and byte offset of each row in the input as this field, e.g. _pos")
+	fs.StringVar(&f.detectLang, "detect-lang", "", "append the detected ISO 639-1 language code of these comma separated columns as <column>_lang")
+	fs.StringVar(&f.parseUA, "parse-ua", "", "append the browser, os and device parsed from these comma separated user agent columns as <column>_ua")
+	fs.StringVar(&f.preset, "preset", "", "named conversion preset, bundled or from ~/.config/csv2jsonl/presets")
+	fs.StringVar(&f.configPath, "config", "", "yaml or json file of option values keyed by flag name, plus renames and types; flags on the command line take precedence")
+	fs.StringVar(&f.profile, "profile", "", "named profile of -config whose values override the top-level ones")
+	fs.StringVar(&f.whereDate, "where-date", "", "only convert rows matching date conditions, e.g. 'created_at >= 2024-01-01 and created_at < 2024-02-01'")
+	fs.StringVar(&f.filter, "filter", "", "only convert rows matching the expression, e.g. 'age > 30 && city == \"London\"'")
+	fs.StringVar(&f.format, "format", "jsonl", "output format: jsonl, sql for INSERT statements into -table, es-bulk for the elasticsearch _bulk api, parquet, or msgpack or cbor binary records")
+	fs.StringVar(&f.table, "table", "", "table of the -format sql INSERT statements, e.g. users or public.users")
+	fs.IntVar(&f.sqlBatch, "sql-batch", 1, "number of rows per -format sql INSERT statement")
+	fs.StringVar(&f.sqlDialect, "sql-dialect", "ansi", "quoting of -format sql: ansi for postgres, sqlite and others, or mysql")
+	fs.StringVar(&f.esIndex, "es-index", "", "index of the -format es-bulk actions")
+	fs.StringVar(&f.esIDColumn, "es-id-column", "", "field of the records used as the document _id of -format es-bulk, default generated by elasticsearch")
+	fs.IntVar(&f.parquetRowGroup, "parquet-row-group", 100000, "number of rows of each -format parquet row group, held in memory until written")
+	fs.StringVar(&f.binaryFraming, "binary-framing", "concat", "how -format msgpack and cbor records are delimited: concat, or length for a 4-byte big-endian length before each record")
+	fs.StringVar(&f.parquetCompression, "parquet-compression", "snappy", "compression of the -format parquet pages: snappy, gzip, zstd or none")
+	fs.StringVar(&f.tmpl, "template", "", "write each record rendered by this go text/template as json instead, e.g. '{\"full_name\":\"{{.first}} {{.last}}\"}'; json, lower, upper and trim are available as functions")
+	fs.IntVar(&f.kAnonymity, "k-anonymity", 0, "write the -quasi-identifiers of rows whose combination of values is shared by fewer than k rows as null")
+	fs.StringVar(&f.quasiIdentifiers, "quasi-identifiers", "", "comma separated quasi-identifier columns of -k-anonymity, e.g. zip,birth_year,gender")
+	fs.StringVar(&f.classify, "classify", "", "classify sensitive columns as comma separated column=classification, e.g. email=PII,salary=confidential, protected as -policy dictates")
+	fs.StringVar(&f.policyPath, "policy", "", "yaml policy mapping the classifications of -classify to mask, encrypt, drop or hash")
+	fs.StringVar(&f.mask, "mask", "", "replace each character of the cells of these comma separated columns with *, e.g. email,phone")
+	fs.Var(&f.hashColumns, "hash-column", "write the cells of a column as their hex encoded digest as column[:algorithm[:salt]], e.g. ssn:sha256:s3cret, the algorithm defaulting to -hash and the salt prepended to each cell; may be repeated")
+	fs.StringVar(&f.dedupeKey, "dedupe-key", "", "drop rows whose values of these comma separated key columns were seen before, keeping the first")
+	fs.StringVar(&f.dedupeMode, "dedupe-mode", "exact", "how -dedupe-key remembers keys: exact, or bloom for a fixed-size bloom filter with rare false positives")
+	fs.IntVar(&f.dedupeCapacity, "dedupe-capacity", convert.DefaultDedupeCapacity, "expected number of distinct keys sizing the -dedupe-mode bloom filter")
+	fs.Float64Var(&f.dedupeRate, "dedupe-false-positive-rate", convert.DefaultDedupeFalsePositiveRate, "false positive rate of the -dedupe-mode bloom filter at -dedupe-capacity keys")
+	fs.StringVar(&f.assertSorted, "assert-sorted", "", "verify the input is sorted by this column")
+	fs.BoolVar(&f.assertSortedDesc, "assert-sorted-desc", false, "verify a descending order for -assert-sorted")
+	fs.StringVar(&f.assertSortedMode, "assert-sorted-mode", "fail", "on out-of-order rows: fail or warn")
+	fs.IntVar(&f.splitRows, "split-rows", 0, "rotate the output file every n rows, requires -o")
+	fs.StringVar(&f.splitSize, "split-size", "", "rotate the output file before it exceeds this size, e.g. 256MB, 1GiB or bytes, requires -o")
+	fs.StringVar(&f.shardBy, "shard-by", "", "write each record to one of -shards files by the hash of this field, records with the same value share a file")
+	fs.IntVar(&f.shards, "shards", 0, "number of -shard-by files, <output>-0.jsonl to <output>-<shards-1>.jsonl")
+	fs.StringVar(&f.hash, "hash", transform.HashFNV, "hash algorithm of -shard-by, the -dedupe-mode bloom filter, hashed -policy columns and -hash-column without an algorithm: fnv, xxh3, sha256 or murmur3")
+	fs.StringVar(&f.chunking, "chunking", "rows", "how to split the output: rows (by -split-rows) or cdc (content-defined boundaries)")
+	fs.Int64Var(&f.chunkSize, "chunk-size", 1<<20, "average output chunk size in bytes of -chunking cdc")
+	fs.StringVar(&f.compress, "compress", "", "compress the output: gzip or zstd, default detected by the -o extension (.gz, .zst)")
+	fs.BoolVar(&f.validate, "validate", false, "parse the whole input and apply the checks without writing output, then print a json report of the row counts, field fill rates and malformed rows")
+	fs.StringVar(&f.reportPath, "report", "", "write a html report of the row counts, errors, field profiles, sample records and options to this path")
+	fs.StringVar(&f.emitContract, "emit-contract", "", "write a yaml data contract of the output fields, their types and nullability to this path")
+	fs.StringVar(&f.contractVersion, "contract-version", "1.0.0", "version written to the -emit-contract data contract")
+	fs.StringVar(&f.lineage, "lineage", "", "write the source columns and operations of each output field to this json file")
+	fs.StringVar(&f.index, "index", "", "write an index of the output files to this path, requires -o")
+	fs.StringVar(&f.zstdDictTrain, "zstd-dict-train", "", "train a zstd dictionary from sampled records, save it to this path and compress the .zst output with it")
+	fs.IntVar(&f.zstdDictSamples, "zstd-dict-samples", 1000, "number of records sampled to train the zstd dictionary")
+	fs.StringVar(&f.zstdDict, "zstd-dict", "", "compress the .zst output with a previously trained zstd dictionary")
+	fs.StringVar(&f.inputEncoding, "encoding", "", "character set of the input: "+strings.Join(encodingNames(), ", ")+", default utf-8")
+	fs.StringVar(&f.inputFormat, "input-format", "", "input format: csv, tsv or psv, default detected by file extension or content")
+	fs.StringVar(&f.delimiter, "delimiter", "", "field delimiter, e.g. ';', '|' or '\\t', several characters such as '||' or a regular expression such as '/\\s*\\|\\s*/', overrides -input-format")
+	fs.StringVar(&f.recordSeparator, "record-separator", "", "record separator other than a line feed or CRLF, e.g. '\\r' for old Mac line endings, '~\\n' or a regular expression such as '/~+\\n/'")
+
+	fs.StringVar(&f.onError, "on-error", "strict", "on malformed rows: strict (stop with an error), skip or collect (skip and write them to -error-file)")
+	fs.BoolVar(&f.strictColumns, "strict-columns", false, "stop at a row with more or fewer fields than the header even with -on-error skip or collect")
+	fs.IntVar(&f.warnLimit, "warn-limit", convert.DefaultWarnLimit, "log the first n occurrences of each kind of row warning, e.g. malformed rows or cells not matching their type, then only periodic counts and the totals")
+	fs.StringVar(&f.errorFile, "error-file", "", "file collecting the malformed rows of -on-error collect, default <output>.errors.jsonl")
+
+	fs.BoolVar(&f.showProgress, "progress", true, "show a progress bar on the terminal while writing to -o")
+	fs.StringVar(&f.heartbeatFile, "heartbeat-file", "", "write the state, row count and time of the last progress to this json file every -heartbeat-interval, so that supervisors can detect a stuck conversion")
+	fs.StringVar(&f.controlSocket, "control-socket", "", "accept pause, resume, flush and stats json commands on this unix socket during the conversion, or - to read them from stdin and reply on stdout, which requires -i and -o")
+	fs.DurationVar(&f.heartbeatInterval, "heartbeat-interval", 10*time.Second, "interval between two -heartbeat-file updates")
+
+	fs.StringVar(&f.notifyWebhook, "notify-webhook", "", "post a json notification with the stats summary to this url when the conversion completes or fails")
+	fs.StringVar(&f.notifyEmail, "notify-email", "", "email a notification with the stats summary to these comma separated addresses when the conversion completes or fails")
+	fs.StringVar(&f.notifySMTP, "notify-smtp", "localhost:25", "smtp server sending -notify-email")
+	fs.StringVar(&f.notifyFrom, "notify-from", "", "sender of -notify-email, default csv2jsonl@<hostname>")
+
+	fs.StringVar(&f.tmpDir, "tmp-dir", "", "directory of temporary files such as spooled stdin, default as the system temporary directory")
+	fs.StringVar(&f.tmpReserve, "tmp-reserve", defaultTmpReserve, "stop writing temporary files when less than this space is left on their disk")
+	fs.StringVar(&f.maxTempDisk, "max-temp-disk", "", "fail when temporary files exceed this size, e.g. 10GB")
+	fs.BoolVar(&f.lock, "lock", false, "take an advisory lock on -o (as <o>.lock) so concurrent runs writing it fail instead of interleaving")
+	fs.DurationVar(&f.waitLock, "wait-lock", 0, "like -lock, but wait up to this time, e.g. 30s, for another run to release the lock")
+	fs.DurationVar(&f.maxRuntime, "max-runtime", 0, "abort the conversion after this time, e.g. 2h, marking the output as partial")
+	fs.IntVar(&f.maxOpenFiles, "max-open-files", 0, "budget of open files checked before writing -shards, default as the open file limit of the process")
+	fs.StringVar(&f.eosRecord, "eos-record", "", "append this json record as the last line when the conversion completes, e.g. '{\"_eos\":true}', so that streaming consumers can detect completion")
+	fs.DurationVar(&f.flushInterval, "flush-interval", 0, "buffer records written to stdout and flush them at most this long after the first, e.g. 500ms; by default records are written as converted")
+	fs.IntVar(&f.flushRows, "flush-rows", 0, "buffer records written to stdout and flush them every n records")
+	fs.BoolVar(&f.stream, "stream", false, "low-latency mode for live pipelines: write and flush every record to stdout as soon as its row is read, rejecting options that read ahead or write in batches")
+	fs.StringVar(&f.checkpointPath, "checkpoint", "", "record the progress in this json file every -checkpoint-rows rows and, if it exists, resume the conversion from it appending to -o")
+	fs.IntVar(&f.checkpointRows, "checkpoint-rows", 100000, "number of rows read between two -checkpoint records")
+	fs.BoolVar(&f.follow, "follow", false, "keep reading -i as rows are appended like tail -f, reopening it when truncated or rotated, until interrupted")
+
+	fs.StringVar(&f.serve, "serve", "", "serve conversions over http on this address, e.g. :8080, see POST /convert")
+
+	fs.BoolVar(&f.help, "help", false, "print help")
+	return fs, f
+}
+
+// parseTransforms 解析形如 column:transform[,transform...] 的转换，
+// 带参数的转换形如 column:dp_laplace(0.5,100)
+func parseTransforms(specs []string) (map[string][]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	transforms := map[string][]string{}
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 || i == len(spec)-1 {
+			return nil, fmt.Errorf("invalid transform %q, expected column:transform[,transform...]", spec)
+		}
+		col := spec[:i]
+		transforms[col] = append(transforms[col], splitTransforms(spec[i+1:])...)
+	}
+	return transforms, nil
+}
+
+// splitTransforms 按括号外的逗号分隔转换，如 trim,dp_gaussian(1,1e-5)
+func splitTransforms(s string) []string {
+	var (
+		names []string
+		depth int
+		start int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				names = append(names, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(names, s[start:])
+}
+
+// parseValueMaps 解析形如 column=code:value[,code:value...] 的查找表，
+// 同一列可以重复指定
+func parseValueMaps(specs []string) (map[string]map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	maps := map[string]map[string]string{}
+	for _, spec := range specs {
+		col, pairs, ok := strings.Cut(spec, "=")
+		if !ok || col == "" || pairs == "" {
+			return nil, fmt.Errorf("invalid map %q, expected column=code:value[,code:value...]", spec)
+		}
+		if maps[col] == nil {
+			maps[col] = map[string]string{}
+		}
+		for _, pair := range strings.Split(pairs, ",") {
+			code, value, ok := strings.Cut(pair, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid map %q: %q is not code:value", spec, pair)
+			}
+			maps[col][code] = value
+		}
+	}
+	return maps, nil
+}
+
+// parseDefaults 解析形如 column=value[,column=value...] 的默认值，可以重复指定
+func parseDefaults(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	defaults := map[string]string{}
+	for _, spec := range specs {
+		for _, pair := range strings.Split(spec, ",") {
+			col, value, ok := strings.Cut(pair, "=")
+			if !ok || col == "" {
+				return nil, fmt.Errorf("invalid default %q, expected column=value[,column=value...]", pair)
+			}
+			defaults[col] = value
+		}
+	}
+	return defaults, nil
+}
+
+// parseEOSRecord 解析结束标记记录，返回压缩为一行的 JSON
+func parseEOSRecord(value string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(value)); err != nil {
+		return nil, fmt.Errorf("invalid eos-record %q: %v", value, err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// sizeUnits 大小单位，KB、MB、GB 为 1000 进制，KiB、MiB、GiB 为 1024 进制
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9},
+	{"b", 1},
+}
+
+// parseSize 解析形如 256MB、1GiB 或字节数的大小
+func parseSize(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 || n*float64(unit) > 1<<62 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 256MB, 1GiB or a number of bytes", value)
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// flushWriter 缓冲写出的记录，满 rows 条或最早的一条等待了 interval 时一起写出
+// 并刷新下游，在延迟和吞吐量之间取舍。targets 为依次刷新的下游，如压缩和 HTTP 响应
+type flushWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	targets  []io.Writer
+	rows     int
+	interval time.Duration
+	buf      bytes.Buffer
+	pending  int
+	timer    *time.Timer
+	err      error
+}
+
+func newFlushWriter(w io.Writer, rows int, interval time.Duration, targets ...io.Writer) *flushWriter {
+	return &flushWriter{w: w, targets: append([]io.Writer{w}, targets...), rows: rows, interval: interval}
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.buf.Write(p)
+	f.pending++
+	switch {
+	case f.rows > 0 && f.pending >= f.rows:
+		f.flushLocked()
+	case f.interval > 0 && f.timer == nil:
+		f.timer = time.AfterFunc(f.interval, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.flushLocked()
+		})
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	return len(p), nil
+}
+
+// flushLocked 写出缓冲的记录并刷新下游，错误在下一次写入时返回
+func (f *flushWriter) flushLocked() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.buf.Len() == 0 || f.err != nil {
+		return
+	}
+	_, f.err = f.w.Write(f.buf.Bytes())
+	f.buf.Reset()
+	f.pending = 0
+	for _, target := range f.targets {
+		if f.err != nil {
+			return
+		}
+		switch t := target.(type) {
+		case interface{ Flush() error }:
+			f.err = t.Flush()
+		case http.Flusher:
+			t.Flush()
+		}
+	}
+}
+
+// Flush 立即写出缓冲的记录并刷新下游
+func (f *flushWriter) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushLocked()
+	return f.err
+}
+
+// Close 写出剩余的记录，不关闭下游
+func (f *flushWriter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushLocked()
+	return f.err
+}
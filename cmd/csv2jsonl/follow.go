@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// followInterval 读到文件结尾后检查新数据的间隔
+const followInterval = 250 * time.Millisecond
+
+// followReader 以 tail -f 的方式读取不断追加的文件，读到结尾时等待新数据，
+// 文件被截断或轮转时从头读取新文件，stop 关闭后返回 io.EOF
+type followReader struct {
+	path   string
+	f      *os.File
+	offset int64
+	// header 输入有表头，从头读取时跳过新文件的表头
+	header   bool
+	skipLine bool
+	// drained 轮转后已再次读到旧文件的结尾
+	drained bool
+	stop    <-chan struct{}
+}
+
+func openFollowed(path string, header bool, stop <-chan struct{}) (*followReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &followReader{path: path, f: f, header: header, stop: stop}, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.offset += int64(n)
+		if r.skipLine && n > 0 {
+			if i := bytes.IndexByte(p[:n], '\n'); i >= 0 {
+				r.skipLine = false
+				n = copy(p, p[i+1:n])
+			} else {
+				n = 0
+			}
+		}
+		if n > 0 {
+			r.drained = false
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		reopened, err := r.reopen()
+		if err != nil {
+			return 0, err
+		}
+		if reopened {
+			continue
+		}
+		select {
+		case <-r.stop:
+			return 0, io.EOF
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+// reopen 在读到结尾时检查文件是否被截断或轮转，需要从头读取时返回 true
+func (r *followReader) reopen() (bool, error) {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		// 轮转过程中文件可能暂时不存在
+		return false, nil
+	}
+	cur, err := r.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case !os.SameFile(fi, cur):
+		if !r.drained {
+			// 再读一次旧文件，避免丢失轮转前追加的数据
+			r.drained = true
+			return true, nil
+		}
+		f, err := os.Open(r.path)
+		if err != nil {
+			return false, nil
+		}
+		r.f.Close()
+		r.f = f
+		log.Infof("follow: %s was rotated, reading the new file", r.path)
+	case fi.Size() < r.offset:
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		log.Infof("follow: %s was truncated, reading from the start", r.path)
+	default:
+		return false, nil
+	}
+	r.offset, r.drained, r.skipLine = 0, false, r.header
+	return true, nil
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
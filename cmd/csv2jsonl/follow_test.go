@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appendFile 在 path 的结尾追加 data
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.csv")
+	appendFile(t, path, "id,name\n1,a\n")
+	stop := make(chan struct{})
+	r, err := openFollowed(path, true, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("read %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	expect("id,name\n")
+	expect("1,a\n")
+	appendFile(t, path, "2,b\n")
+	expect("2,b\n")
+
+	// 轮转时先读完旧文件中追加的数据，再从新文件的表头之后读取
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "3,c\n")
+	appendFile(t, path, "id,name\n4,d\n")
+	expect("3,c\n")
+	expect("4,d\n")
+
+	// 截断后从表头之后重新读取
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * followInterval)
+	appendFile(t, path, "id,name\n5,e\n")
+	expect("5,e\n")
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("read after stop returned %v, want io.EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader did not stop")
+	}
+}
+
+func TestFollowMaxRuntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.csv")
+	appendFile(t, path, "id,name\n1,a\n2,b\n")
+	var stdout bytes.Buffer
+	started := time.Now()
+	// -follow 在达到 max-runtime 时正常结束
+	if code := Run([]string{"-log-level", "error", "-i", path, "-follow", "-max-runtime", "300ms"}, nil, &stdout, io.Discard); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond {
+		t.Errorf("follow stopped after %v, before the max runtime", elapsed)
+	}
+	if want := "{\"id\":\"1\",\"name\":\"a\"}\n{\"id\":\"2\",\"name\":\"b\"}\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 输入格式及其分隔符
+var inputFormats = map[string]rune{
+	"csv": ',',
+	"tsv": '\t',
+	"psv": '|',
+}
+
+// 文件扩展名对应的输入格式
+var formatExtensions = map[string]string{
+	".csv": "csv",
+	".tsv": "tsv",
+	".tab": "tsv",
+	".psv": "psv",
+}
+
+// formatWriter 将转换器写出的 JSON 记录改写为 -format 指定的输出格式
+type formatWriter interface {
+	io.WriteCloser
+	// wrap 设置改写后写入的 Writer，返回转换器写入的 Writer
+	wrap(w io.Writer) io.Writer
+}
+
+// formatDelimiter 返回输入格式对应的分隔符
+func formatDelimiter(format string) (rune, error) {
+	delimiter, ok := inputFormats[strings.ToLower(format)]
+	if !ok {
+		return 0, fmt.Errorf("unknown input format %s", format)
+	}
+	return delimiter, nil
+}
+
+// parseSeparator 解析命令行指定的分隔符，可以有多个字符，支持 \t、\r 等转义及 tab 的写法
+func parseSeparator(s string) (string, error) {
+	if strings.EqualFold(s, "tab") {
+		return "\t", nil
+	}
+	if strings.Contains(s, `\`) {
+		unquoted, err := strconv.Unquote(`"` + s + `"`)
+		if err != nil {
+			return "", fmt.Errorf("%q", s)
+		}
+		s = unquoted
+	}
+	return s, nil
+}
+
+// parseSeparatorRegexp 解析 /.../ 形式的正则表达式分隔符，不是这种形式时返回 nil
+func parseSeparatorRegexp(s string) (*regexp.Regexp, error) {
+	if len(s) < 3 || s[0] != '/' || s[len(s)-1] != '/' {
+		return nil, nil
+	}
+	re, err := regexp.Compile(s[1 : len(s)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", s, err)
+	}
+	if re.MatchString("") {
+		return nil, fmt.Errorf("%q matches an empty string", s)
+	}
+	return re, nil
+}
+
+// detectInputFormat 根据文件扩展名判断输入格式，忽略 .gz 等压缩扩展名，无法判断时返回空
+func detectInputFormat(path string) string {
+	return formatExtensions[strings.ToLower(filepath.Ext(trimCompressionExt(inputPath(path))))]
+}
+
+// parseDelimiter 解析命令行指定的分隔符，支持 \t 等转义及 tab 的写法
+func parseDelimiter(s string) (rune, error) {
+	s, err := parseSeparator(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delimiter %v", err)
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("delimiter %q must be a single character", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// resolveDelimiter 确定输入的分隔符，同 negotiateInput，但不检查输入的内容
+func resolveDelimiter(format, path string, delimiter rune) (rune, error) {
+	d, err := negotiateInput(format, path, delimiter, nil)
+	return d.delimiter, err
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	log "github.com/sirupsen/logrus"
+	xencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 合成数据的列类型
+const (
+	genSeq    = "seq"
+	genInt    = "int"
+	genFloat  = "float"
+	genBool   = "bool"
+	genDate   = "date"
+	genJSON   = "json"
+	genString = "string"
+	genText   = "text"
+)
+
+// 合成数据的编码
+const (
+	encUTF8    = "utf-8"
+	encUTF8BOM = "utf-8-bom"
+	encUTF16LE = "utf-16le"
+	encUTF16BE = "utf-16be"
+	encLatin1  = "latin1"
+	encGBK     = "gbk"
+)
+
+const genLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// text 类型使用的字符，包含分隔符、引号、换行及多字节字符等边界情况
+var genTextAlphabet = []rune("abcXYZ019 ,;|\t\"'\n{}[]中文éß😀")
+
+type genColumn struct {
+	name string
+	typ  string
+}
+
+// parseGenColumns 解析 name:type 形式的列定义，类型缺省为 string
+func parseGenColumns(spec string) ([]genColumn, error) {
+	var columns []genColumn
+	for _, field := range strings.Split(spec, ",") {
+		name, typ, found := strings.Cut(field, ":")
+		if !found {
+			typ = genString
+		}
+		switch typ {
+		case genSeq, genInt, genFloat, genBool, genDate, genJSON, genString, genText:
+		default:
+			return nil, fmt.Errorf("unknown column type %s of %s", typ, name)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty column name in %q", spec)
+		}
+		columns = append(columns, genColumn{name: name, typ: typ})
+	}
+	return columns, nil
+}
+
+// generator 生成合成 CSV 数据
+type generator struct {
+	rng       *rand.Rand
+	columns   []genColumn
+	errorRate float64
+}
+
+func (g *generator) header() []string {
+	header := make([]string, len(g.columns))
+	for i, col := range g.columns {
+		header[i] = col.name
+	}
+	return header
+}
+
+func (g *generator) randomString(alphabet []rune, max int) string {
+	n := g.rng.Intn(max)
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteRune(alphabet[g.rng.Intn(len(alphabet))])
+	}
+	return sb.String()
+}
+
+func (g *generator) value(typ string, row int) string {
+	switch typ {
+	case genSeq:
+		return strconv.Itoa(row + 1)
+	case genInt:
+		return strconv.Itoa(g.rng.Intn(2000000) - 1000000)
+	case genFloat:
+		return strconv.FormatFloat(g.rng.NormFloat64()*1000, 'f', 2, 64)
+	case genBool:
+		return strconv.FormatBool(g.rng.Intn(2) == 1)
+	case genDate:
+		base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		return base.Add(time.Duration(g.rng.Int63n(int64(5 * 365 * 24 * time.Hour)))).Format(time.RFC3339)
+	case genJSON:
+		return fmt.Sprintf(`{"k":%d,"v":"%s"}`, g.rng.Intn(100), g.randomString([]rune(genLetters), 8))
+	case genText:
+		return g.randomString(genTextAlphabet, 12)
+	default:
+		return g.randomString([]rune(genLetters), 12)
+	}
+}
+
+// record 生成一行数据，按 errorRate 的概率注入错误：类型不符、缺少或多出字段
+func (g *generator) record(row int) []string {
+	record := make([]string, len(g.columns))
+	for i, col := range g.columns {
+		record[i] = g.value(col.typ, row)
+	}
+
+	if g.errorRate <= 0 || g.rng.Float64() >= g.errorRate {
+		return record
+	}
+	switch g.rng.Intn(3) {
+	case 0:
+		record[g.rng.Intn(len(record))] = "N/A"
+	case 1:
+		if len(record) > 1 {
+			record = record[:len(record)-1]
+		}
+	default:
+		record = append(record, "extra")
+	}
+	return record
+}
+
+// encodeText 按指定编码转换 UTF-8 文本
+func encodeText(encoding string, text []byte) ([]byte, error) {
+	switch encoding {
+	case encUTF8, encUTF8BOM:
+		return text, nil
+	case encUTF16LE, encUTF16BE:
+		units := utf16.Encode([]rune(string(text)))
+		out := make([]byte, 2*len(units))
+		for i, u := range units {
+			if encoding == encUTF16LE {
+				binary.LittleEndian.PutUint16(out[2*i:], u)
+			} else {
+				binary.BigEndian.PutUint16(out[2*i:], u)
+			}
+		}
+		return out, nil
+	case encLatin1:
+		out := make([]byte, 0, len(text))
+		for len(text) > 0 {
+			r, size := utf8.DecodeRune(text)
+			text = text[size:]
+			if r > 0xff {
+				r = '?'
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	case encGBK:
+		// GBK 不能表示的字符写为替换字符
+		return xencoding.ReplaceUnsupported(simplifiedchinese.GBK.NewEncoder()).Bytes(text)
+	}
+	return nil, fmt.Errorf("unsupported encoding %s", encoding)
+}
+
+// byteOrderMark 返回编码对应的 BOM
+func byteOrderMark(encoding string) []byte {
+	switch encoding {
+	case encUTF8BOM:
+		return []byte(source.BOM)
+	case encUTF16LE:
+		return []byte{0xff, 0xfe}
+	case encUTF16BE:
+		return []byte{0xfe, 0xff}
+	}
+	return nil
+}
+
+// writeSyntheticCsv 将表头和 rows 行数据按指定分隔符和编码写入 w
+func writeSyntheticCsv(w io.Writer, encoding string, delimiter rune, header []string, rows int, record func(row int) []string) error {
+	if _, err := encodeText(encoding, nil); err != nil {
+		return err
+	}
+	if _, err := w.Write(byteOrderMark(encoding)); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if delimiter != 0 {
+		cw.Comma = delimiter
+	}
+	write := func(fields []string) error {
+		buf.Reset()
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		text, err := encodeText(encoding, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(text)
+		return err
+	}
+
+	if err := write(header); err != nil {
+		return err
+	}
+	for i := 0; i < rows; i++ {
+		if err := write(record(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGenerate 生成合成 CSV 文件，返回进程退出码
+func runGenerate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	o := fs.String("o", "", "output csv file, default as stdout")
+	columns := fs.String("columns", "id:seq,name:string,age:int,score:float,active:bool,created_at:date",
+		"columns as name:type, types are seq, int, float, bool, date, json, string and text")
+	rows := fs.Int("rows", 100, "number of rows")
+	delimiter := fs.String("delimiter", ",", "field delimiter")
+	encoding := fs.String("encoding", encUTF8, "output encoding: utf-8, utf-8-bom, utf-16le, utf-16be, latin1, gbk")
+	errorRate := fs.Float64("error-rate", 0, "probability of injecting an error into a row")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cols, err := parseGenColumns(*columns)
+	if err != nil {
+		log.Errorf("parse columns failed: %v", err)
+		return 1
+	}
+	delim, err := parseDelimiter(*delimiter)
+	if err != nil {
+		log.Errorf("%v", err)
+		return exitUsage
+	}
+
+	w := stdout
+	if *o != "" {
+		f, err := os.OpenFile(*o, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			log.Errorf("open file failed: %v", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	g := &generator{rng: rand.New(rand.NewSource(*seed)), columns: cols, errorRate: *errorRate}
+	bw := bufio.NewWriter(w)
+	if err := writeSyntheticCsv(bw, *encoding, delim, g.header(), *rows, g.record); err != nil {
+		log.Errorf("write csv failed: %v", err)
+		return 1
+	}
+	if err := bw.Flush(); err != nil {
+		log.Errorf("write csv failed: %v", err)
+		return 1
+	}
+	return 0
+}
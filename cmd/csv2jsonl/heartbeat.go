@@ -0,0 +1,109 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// heartbeatRecord -heartbeat-file 的内容。Updated 在进程存活时每个间隔更新，
+// Progress 只在读取了输入或写出了记录时更新，两者相差过大说明转换卡住，如输出阻塞
+type heartbeatRecord struct {
+	PID       int       `json:"pid"`
+	State     string    `json:"state"`
+	Started   time.Time `json:"started"`
+	Updated   time.Time `json:"updated"`
+	Progress  time.Time `json:"progress"`
+	Rows      int64     `json:"rows"`
+	BytesRead int64     `json:"bytes_read"`
+}
+
+// heartbeat 定时将转换的进度写入 -heartbeat-file，供外部的监控判断进程是否存活和卡住
+type heartbeat struct {
+	path     string
+	interval time.Duration
+	record   heartbeatRecord
+	rows     atomic.Int64
+	// bytes 已读取的输入字节数，与进度条共用
+	bytes *atomic.Int64
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newHeartbeat(path string, interval time.Duration) *heartbeat {
+	now := time.Now()
+	return &heartbeat{
+		path:     path,
+		interval: interval,
+		record:   heartbeatRecord{PID: os.Getpid(), State: "running", Started: now, Progress: now},
+		bytes:    new(atomic.Int64),
+		stop:     make(chan struct{}),
+	}
+}
+
+// observe 统计一条输出记录
+func (h *heartbeat) observe(interface{}) {
+	h.rows.Add(1)
+}
+
+// run 立即写入一次，之后每个间隔写入直到 finish
+func (h *heartbeat) run() {
+	h.beat()
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.beat()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// finish 停止定时写入，并写入最终的状态 completed 或 failed
+func (h *heartbeat) finish(err error) {
+	close(h.stop)
+	h.wg.Wait()
+	h.record.State = "completed"
+	if err != nil {
+		h.record.State = "failed"
+	}
+	h.beat()
+}
+
+// beat 更新并写入心跳，写入失败只输出警告，不影响转换
+func (h *heartbeat) beat() {
+	r := &h.record
+	r.Updated = time.Now()
+	if rows, n := h.rows.Load(), h.bytes.Load(); rows != r.Rows || n != r.BytesRead {
+		r.Rows, r.BytesRead, r.Progress = rows, n, r.Updated
+	}
+	data, _ := json.Marshal(r)
+	if err := writeFileAtomic(h.path, append(data, '\n')); err != nil {
+		log.Warnf("write heartbeat file failed: %v", err)
+	}
+}
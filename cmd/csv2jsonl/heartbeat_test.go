@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHeartbeatFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(input, []byte("id,name\n1,a\n2,b\n3,c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		code  int
+		state string
+		rows  int64
+	}{
+		{name: "completed", code: 0, state: "completed", rows: 3},
+		{name: "filtered", args: []string{"-filter", "id >= 2", "-limit", "1"}, code: 0, state: "completed", rows: 1},
+		{name: "failed conversion", args: []string{"-assert-sorted", "name", "-assert-sorted-desc"}, code: 1, state: "failed"},
+	} {
+		heartbeat := filepath.Join(dir, tc.name+".json")
+		args := append([]string{"-log-level", "error", "-i", input, "-o", filepath.Join(dir, tc.name+".jsonl"), "-heartbeat-file", heartbeat}, tc.args...)
+		if code := Run(args, nil, io.Discard, io.Discard); code != tc.code {
+			t.Errorf("%s: exit code = %d, want %d", tc.name, code, tc.code)
+		}
+		data, err := os.ReadFile(heartbeat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record heartbeatRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			t.Fatalf("%s: %q: %v", tc.name, data, err)
+		}
+		if record.PID != os.Getpid() || record.State != tc.state || record.Started.IsZero() || record.Updated.Before(record.Started) {
+			t.Errorf("%s: heartbeat = %+v, want state %s", tc.name, record, tc.state)
+		}
+		if tc.state == "completed" && (record.Rows != tc.rows || record.BytesRead != 20 || record.Progress.IsZero()) {
+			t.Errorf("%s: heartbeat has %d rows and %d bytes read, want %d rows and 20 bytes", tc.name, record.Rows, record.BytesRead, tc.rows)
+		}
+	}
+}
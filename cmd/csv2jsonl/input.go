@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 压缩格式的扩展名及文件头
+var (
+	compressionExtensions = map[string]string{
+		".gz":  "gzip",
+		".zst": "zstd",
+		".bz2": "bzip2",
+	}
+	compressionMagic = []struct {
+		name  string
+		magic []byte
+	}{
+		{"gzip", []byte{0x1f, 0x8b}},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{"bzip2", []byte("BZh")},
+	}
+)
+
+// trimCompressionExt 去掉路径末尾的压缩扩展名，如 data.tsv.gz 返回 data.tsv
+func trimCompressionExt(path string) string {
+	if _, ok := compressionExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// detectCompression 根据扩展名判断压缩格式，无法判断时检查文件头
+func detectCompression(path string, r *bufio.Reader) string {
+	if name, ok := compressionExtensions[strings.ToLower(filepath.Ext(inputPath(path)))]; ok {
+		return name
+	}
+	head, _ := r.Peek(4)
+	for _, c := range compressionMagic {
+		if bytes.HasPrefix(head, c.magic) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// decompressedReader 关闭时同时关闭解压器和底层文件
+type decompressedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressedReader) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// decompress 返回 in 解压后的数据，未压缩时原样读取
+func decompress(path string, in io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(in)
+	d := &decompressedReader{Reader: br}
+	switch detectCompression(path, br) {
+	case "gzip":
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		d.Reader, d.closers = zr, append(d.closers, zr)
+	case "zstd":
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		d.Reader, d.closers = zr, append(d.closers, zr.IOReadCloser())
+	case "bzip2":
+		d.Reader = bzip2.NewReader(br)
+	}
+	d.closers = append(d.closers, in)
+	if f, ok := in.(io.ReadSeeker); ok && d.Reader == br {
+		return &seekableReader{decompressedReader: d, br: br, seeker: f}, nil
+	}
+	return d, nil
+}
+
+// seekableReader 未压缩的文件，支持向后跳过，用于继续转换时跳过已经转换的行
+type seekableReader struct {
+	*decompressedReader
+	br     *bufio.Reader
+	seeker io.ReadSeeker
+}
+
+// Seek 只支持相对当前位置的跳转，跳过缓冲中的数据后移动文件位置
+func (s *seekableReader) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent || offset < 0 {
+		return 0, errors.New("seek: only skipping forward is supported")
+	}
+	if buffered := int64(s.br.Buffered()); offset > buffered {
+		if _, err := s.seeker.Seek(offset-buffered, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		s.br.Reset(s.seeker)
+	} else if _, err := s.br.Discard(int(offset)); err != nil {
+		return 0, err
+	}
+	pos, err := s.seeker.Seek(0, io.SeekCurrent)
+	return pos - int64(s.br.Buffered()), err
+}
+
+// isRemoteInput 判断输入是否为 http(s) 或对象存储的地址
+func isRemoteInput(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") || isObjectURL(path)
+}
+
+// inputPath 返回用于判断格式和压缩的路径，地址去掉查询参数，
+// 如预签名地址 https://host/export.csv.gz?X-Amz-Signature=... 返回 /export.csv.gz
+func inputPath(path string) string {
+	if !isRemoteInput(path) {
+		return path
+	}
+	if u, err := url.Parse(path); err == nil {
+		return u.Path
+	}
+	return path
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	log "github.com/sirupsen/logrus"
+)
+
+type columnProfile struct {
+	Name       string  `json:"name"`
+	Distinct   int     `json:"distinct"`
+	Empty      int     `json:"empty"`
+	Uniqueness float64 `json:"uniqueness"`
+}
+
+// dependency 函数依赖 From -> To：From 的每个值只对应 To 的一个值，
+// Confidence 为符合该对应关系的行所占比例
+type dependency struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Confidence float64 `json:"confidence"`
+}
+
+type inspectReport struct {
+	Rows          int             `json:"rows"`
+	RaggedRows    int             `json:"ragged_rows,omitempty"`
+	Columns       []columnProfile `json:"columns"`
+	SuggestedKeys [][]string      `json:"suggested_keys,omitempty"`
+	Dependencies  []dependency    `json:"dependencies,omitempty"`
+}
+
+// readSample 读取至多 limit 行数据，缺失的单元格按空值处理，多余的单元格忽略，
+// 返回字段数与表头不同的行数。strict 时遇到这样的行返回错误
+func readSample(r io.Reader, delimiter rune, limit int, strict bool) ([]string, [][]string, int, error) {
+	csvReader, columns, err := source.NewCSVReader(r, delimiter)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	csvReader.FieldsPerRecord = -1
+
+	var (
+		rows   [][]string
+		ragged int
+	)
+	for limit <= 0 || len(rows) < limit {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(row) != len(columns) {
+			if err := checkFieldCount(csvReader, row, len(columns), strict); err != nil {
+				return nil, nil, 0, err
+			}
+			ragged++
+		}
+		if len(row) < len(columns) {
+			row = append(row, make([]string, len(columns)-len(row))...)
+		}
+		rows = append(rows, row[:len(columns)])
+	}
+	return columns, rows, ragged, nil
+}
+
+// checkFieldCount strict 时返回字段数与表头不同的行的错误，否则记录警告
+func checkFieldCount(csvReader *csv.Reader, row []string, expected int, strict bool) error {
+	line, _ := csvReader.FieldPos(0)
+	if strict {
+		return fmt.Errorf("line %d: %v: row has %d fields, expected %d", line, csv.ErrFieldCount, len(row), expected)
+	}
+	log.Debugf("line %d has %d fields, expected %d", line, len(row), expected)
+	return nil
+}
+
+func profileColumns(columns []string, rows [][]string) []columnProfile {
+	profiles := make([]columnProfile, len(columns))
+	for i, col := range columns {
+		distinct := map[string]struct{}{}
+		profile := columnProfile{Name: col}
+		for _, row := range rows {
+			if row[i] == "" {
+				profile.Empty++
+			}
+			distinct[row[i]] = struct{}{}
+		}
+		profile.Distinct = len(distinct)
+		if len(rows) > 0 {
+			profile.Uniqueness = float64(profile.Distinct) / float64(len(rows))
+		}
+		profiles[i] = profile
+	}
+	return profiles
+}
+
+// isKey 判断列组合的值是否在所有行中唯一且不为空
+func isKey(combo []int, rows [][]string) bool {
+	seen := make(map[string]struct{}, len(rows))
+	parts := make([]string, len(combo))
+	for _, row := range rows {
+		for j, idx := range combo {
+			if row[idx] == "" {
+				return false
+			}
+			parts[j] = row[idx]
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := seen[key]; ok {
+			return false
+		}
+		seen[key] = struct{}{}
+	}
+	return true
+}
+
+// suggestKeys 按列数从少到多枚举列组合，返回最小的候选主键，
+// 已是主键的组合的超集不再考虑
+func suggestKeys(columns []string, rows [][]string, maxColumns int) [][]string {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var (
+		keys  [][]int
+		combo []int
+	)
+	containsKey := func(combo []int) bool {
+		for _, key := range keys {
+			matched := 0
+			for _, k := range key {
+				for _, c := range combo {
+					if k == c {
+						matched++
+					}
+				}
+			}
+			if matched == len(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var walk func(start, size int)
+	walk = func(start, size int) {
+		if len(combo) == size {
+			if !containsKey(combo) && isKey(combo, rows) {
+				keys = append(keys, append([]int(nil), combo...))
+			}
+			return
+		}
+		for i := start; i < len(columns); i++ {
+			combo = append(combo, i)
+			walk(i+1, size)
+			combo = combo[:len(combo)-1]
+		}
+	}
+	for size := 1; size <= maxColumns && size <= len(columns); size++ {
+		walk(0, size)
+	}
+
+	suggested := make([][]string, len(keys))
+	for i, key := range keys {
+		for _, idx := range key {
+			suggested[i] = append(suggested[i], columns[idx])
+		}
+	}
+	return suggested
+}
+
+// findDependencies 找出置信度不低于 threshold 的单列函数依赖。唯一列决定
+// 所有列、常量列被所有列决定，这些平凡的依赖不会被报告
+func findDependencies(columns []string, rows [][]string, profiles []columnProfile, threshold float64) []dependency {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var deps []dependency
+	for from := range columns {
+		if profiles[from].Distinct == len(rows) {
+			continue
+		}
+		for to := range columns {
+			if to == from || profiles[to].Distinct <= 1 {
+				continue
+			}
+			// 统计 from 的每个值对应的 to 的各个值出现的次数
+			counts := map[string]map[string]int{}
+			for _, row := range rows {
+				m, ok := counts[row[from]]
+				if !ok {
+					m = map[string]int{}
+					counts[row[from]] = m
+				}
+				m[row[to]]++
+			}
+			consistent := 0
+			for _, m := range counts {
+				best := 0
+				for _, n := range m {
+					if n > best {
+						best = n
+					}
+				}
+				consistent += best
+			}
+			confidence := float64(consistent) / float64(len(rows))
+			if confidence >= threshold {
+				deps = append(deps, dependency{From: columns[from], To: columns[to], Confidence: confidence})
+			}
+		}
+	}
+	return deps
+}
+
+// runInspect 分析 CSV 文件的列，返回进程退出码
+func runInspect(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	i := fs.String("i", "", "input csv file, - or empty for stdin")
+	inputFormat := fs.String("input-format", "", "input format: csv, tsv or psv, default detected by file extension or content")
+	delimiter := fs.String("delimiter", "", "field delimiter, e.g. ';', '|' or '\\t', overrides -input-format")
+	sample := fs.Int("sample", 100000, "number of rows to analyze, 0 as all")
+	suggest := fs.Bool("suggest-keys", false, "suggest candidate primary keys")
+	maxKeyColumns := fs.Int("max-key-columns", 2, "max number of columns of a suggested key")
+	dependencies := fs.Bool("dependencies", false, "report columns functionally determined by another column")
+	minConfidence := fs.Float64("min-confidence", 1, "min fraction of sampled rows a reported dependency must hold for")
+	strictColumns := fs.Bool("strict-columns", false, "fail at a row with more or fewer fields than the header instead of padding or truncating it")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	var delim rune
+	if *delimiter != "" {
+		var err error
+		if delim, err = parseDelimiter(*delimiter); err != nil {
+			log.Errorf("%v", err)
+			return exitUsage
+		}
+	} else {
+		detected, code := detectInput(*inputFormat, *i, 0, &stdin, "", log.StandardLogger())
+		if code != 0 {
+			return code
+		}
+		delim = detected.delimiter
+	}
+
+	f, err := openInput(*i, stdin)
+	if err != nil {
+		log.Errorf("open file failed: %v", err)
+		return 1
+	}
+	defer f.Close()
+
+	columns, rows, ragged, err := readSample(f, delim, *sample, *strictColumns)
+	if err != nil {
+		log.Errorf("read csv failed: %v", err)
+		return 1
+	}
+
+	if ragged > 0 {
+		log.Warnf("%d sampled rows have more or fewer fields than the header", ragged)
+	}
+	report := inspectReport{
+		Rows:       len(rows),
+		RaggedRows: ragged,
+		Columns:    profileColumns(columns, rows),
+	}
+	if *suggest {
+		report.SuggestedKeys = suggestKeys(columns, rows, *maxKeyColumns)
+	}
+	if *dependencies {
+		report.Dependencies = findDependencies(columns, rows, report.Columns, *minConfidence)
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Errorf("write report failed: %v", err)
+		return 1
+	}
+	return 0
+}
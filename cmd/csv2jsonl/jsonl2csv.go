@@ -0,0 +1,241 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonlRecord 按出现顺序保存的 JSON 对象的键和值
+type jsonlRecord struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// decodeRecord 解析一个 JSON 对象，保留键的顺序
+func decodeRecord(raw json.RawMessage) (*jsonlRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("record %s is not a json object", raw)
+	}
+	rec := &jsonlRecord{values: map[string]json.RawMessage{}}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, ok := rec.values[key]; !ok {
+			rec.keys = append(rec.keys, key)
+		}
+		rec.values[key] = value
+	}
+	return rec, nil
+}
+
+// readRecords 依次读取 r 中的 JSON 对象，也支持多行格式化的输出
+func readRecords(r io.Reader, fn func(rec *jsonlRecord) error) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		rec, err := decodeRecord(raw)
+		if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// cellText 将 JSON 值转换为 CSV 单元格：字符串不带引号，null 输出为 null，
+// 对象和数组输出为紧凑的 JSON
+func cellText(value json.RawMessage, null string) (string, error) {
+	switch {
+	case value == nil:
+		return "", nil
+	case bytes.Equal(value, []byte("null")):
+		return null, nil
+	case value[0] == '"':
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	case value[0] == '{' || value[0] == '[':
+		var buf bytes.Buffer
+		err := json.Compact(&buf, value)
+		return buf.String(), err
+	}
+	return string(value), nil
+}
+
+// collectHeader 读取所有记录，按 order 合并各记录的键作为表头
+func collectHeader(r io.Reader, order string) ([]string, error) {
+	var header []string
+	seen := map[string]struct{}{}
+	err := readRecords(r, func(rec *jsonlRecord) error {
+		for _, key := range rec.keys {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				header = append(header, key)
+			}
+		}
+		return nil
+	})
+	if order == "sorted" {
+		sort.Strings(header)
+	}
+	return header, err
+}
+
+// runJsonl2csv 将 JSONL 转换为 CSV，返回进程退出码
+func runJsonl2csv(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("jsonl2csv", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	i := fs.String("i", "", "input jsonl file, - or empty for stdin")
+	o := fs.String("o", "", "output csv file, default as stdout")
+	columns := fs.String("columns", "", "columns to write in this order, default as the union of all keys")
+	order := fs.String("order", "first-seen", "order of the union of keys: first-seen or sorted")
+	null := fs.String("null", "", "text written for null values")
+	delimiter := fs.String("delimiter", ",", "field delimiter")
+	tmpDir := fs.String("tmp-dir", "", "directory of temporary files such as spooled stdin, default as the system temporary directory")
+	tmpReserve := fs.String("tmp-reserve", defaultTmpReserve, "stop writing temporary files when less than this space is left on their disk")
+	maxTempDisk := fs.String("max-temp-disk", "", "fail when temporary files exceed this size, e.g. 10GB")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *order != "first-seen" && *order != "sorted" {
+		log.Errorf("unknown order %s", *order)
+		return exitUsage
+	}
+	delim, err := parseDelimiter(*delimiter)
+	if err != nil {
+		log.Errorf("%v", err)
+		return exitUsage
+	}
+
+	var header []string
+	if *columns != "" {
+		header = strings.Split(*columns, ",")
+	} else {
+		// 表头需要先读一遍所有记录，标准输入先写入临时文件
+		if *i == "" || *i == "-" {
+			reserve, err := parseSize(*tmpReserve)
+			if err != nil {
+				log.Errorf("%v", err)
+				return exitUsage
+			}
+			var maxSize int64
+			if *maxTempDisk != "" {
+				if maxSize, err = parseSize(*maxTempDisk); err != nil {
+					log.Errorf("%v", err)
+					return exitUsage
+				}
+			}
+			spill, err := newSpillDir(*tmpDir, reserve, maxSize)
+			if err != nil {
+				log.Errorf("create temporary directory failed: %v", err)
+				return 1
+			}
+			defer spill.Close()
+			if *i, err = spill.spool(stdin); err != nil {
+				log.Errorf("spool stdin failed: %v", err)
+				return 1
+			}
+		}
+		in, err := openInput(*i, stdin)
+		if err != nil {
+			log.Errorf("open file failed: %v", err)
+			return 1
+		}
+		header, err = collectHeader(in, *order)
+		in.Close()
+		if err != nil {
+			log.Errorf("read jsonl failed: %v", err)
+			return 1
+		}
+	}
+
+	in, err := openInput(*i, stdin)
+	if err != nil {
+		log.Errorf("open file failed: %v", err)
+		return 1
+	}
+	defer in.Close()
+
+	w := stdout
+	if *o != "" {
+		f, err := os.OpenFile(*o, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			log.Errorf("open file failed: %v", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	cw.Comma = delim
+	if err := cw.Write(header); err != nil {
+		log.Errorf("write csv failed: %v", err)
+		return 1
+	}
+	row := make([]string, len(header))
+	err = readRecords(in, func(rec *jsonlRecord) error {
+		for j, col := range header {
+			cell, err := cellText(rec.values[col], *null)
+			if err != nil {
+				return fmt.Errorf("column %s: %v", col, err)
+			}
+			row[j] = cell
+		}
+		return cw.Write(row)
+	})
+	if err != nil {
+		log.Errorf("convert failed: %v", err)
+		return 1
+	}
+	cw.Flush()
+	if err := errors.Join(cw.Error(), bw.Flush()); err != nil {
+		log.Errorf("write csv failed: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema JSON Schema 的常用子集：type、enum、required、properties、
+// additionalProperties、items、minimum、maximum、exclusiveMinimum、
+// exclusiveMaximum、minLength、maxLength、pattern、minItems、maxItems、
+// format（date、date-time）和 anyOf，其他关键字被忽略
+type jsonSchema struct {
+	Type                 typeList               `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Format               string                 `json:"format"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+
+	pattern *regexp.Regexp
+}
+
+// typeList type 关键字，可以是一个类型或类型列表
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = typeList{name}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// additionalProperties 为 false 时不允许 properties 以外的字段，为 schema 时
+// 其他字段需要符合该 schema
+type additionalProperties struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (a *additionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(data, &a.schema)
+}
+
+// loadJSONSchema 读取并编译 JSON Schema 文件
+func loadJSONSchema(path string) (*jsonSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse json schema failed: %v", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// compile 检查类型并编译 pattern
+func (s *jsonSchema) compile() error {
+	for _, typ := range s.Type {
+		switch typ {
+		case "null", "boolean", "integer", "number", "string", "array", "object":
+		default:
+			return fmt.Errorf("json schema: unknown type %s", typ)
+		}
+	}
+	if s.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("json schema: invalid pattern %q: %v", s.Pattern, err)
+		}
+	}
+	children := append([]*jsonSchema{s.Items}, s.AnyOf...)
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	if s.AdditionalProperties != nil {
+		children = append(children, s.AdditionalProperties.schema)
+	}
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaType 返回 json.Decoder 使用 UseNumber 解析出的值的类型
+func schemaType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// validate 检查 v 是否符合 schema，返回第一个不符合的原因
+func (s *jsonSchema) validate(path string, v interface{}) error {
+	typ := schemaType(v)
+	if len(s.Type) > 0 {
+		ok := false
+		for _, want := range s.Type {
+			if want == typ || want == "number" && typ == "integer" {
+				ok = true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), typ)
+		}
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s: value is not one of the enum values", path)
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			if sub.validate(path, v) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value matches none of anyOf", path)
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		return s.validateNumber(path, v)
+	case string:
+		return s.validateString(path, v)
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	}
+	return nil
+}
+
+func (s *jsonSchema) inEnum(v interface{}) bool {
+	data, _ := json.Marshal(v)
+	for _, e := range s.Enum {
+		if want, _ := json.Marshal(e); string(want) == string(data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) validateNumber(path string, n json.Number) error {
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: invalid number %s", path, n)
+	}
+	switch {
+	case s.Minimum != nil && f < *s.Minimum:
+		return fmt.Errorf("%s: %s is less than the minimum %v", path, n, *s.Minimum)
+	case s.Maximum != nil && f > *s.Maximum:
+		return fmt.Errorf("%s: %s is greater than the maximum %v", path, n, *s.Maximum)
+	case s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum:
+		return fmt.Errorf("%s: %s is not greater than %v", path, n, *s.ExclusiveMinimum)
+	case s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum:
+		return fmt.Errorf("%s: %s is not less than %v", path, n, *s.ExclusiveMaximum)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateString(path, str string) error {
+	n := utf8.RuneCountInString(str)
+	switch {
+	case s.MinLength != nil && n < *s.MinLength:
+		return fmt.Errorf("%s: expected at least %d characters, got %d", path, *s.MinLength, n)
+	case s.MaxLength != nil && n > *s.MaxLength:
+		return fmt.Errorf("%s: expected at most %d characters, got %d", path, *s.MaxLength, n)
+	case s.pattern != nil && !s.pattern.MatchString(str):
+		return fmt.Errorf("%s: %q does not match the pattern %s", path, str, s.Pattern)
+	}
+	switch s.Format {
+	case "date":
+		if !dateFormat.MatchString(str) {
+			return fmt.Errorf("%s: %q is not a date", path, str)
+		}
+	case "date-time":
+		if !dateTimeFormat.MatchString(str) {
+			return fmt.Errorf("%s: %q is not a date-time", path, str)
+		}
+	}
+	return nil
+}
+
+var (
+	dateFormat     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	dateTimeFormat = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})$`)
+)
+
+func (s *jsonSchema) validateObject(path string, m map[string]interface{}) error {
+	for _, key := range s.Required {
+		if _, ok := m[key]; !ok {
+			return fmt.Errorf("%s: missing required field %s", path, key)
+		}
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sub, ok := s.Properties[key]
+		if !ok && s.AdditionalProperties != nil {
+			if !s.AdditionalProperties.allowed {
+				return fmt.Errorf("%s: unexpected field %s", path, key)
+			}
+			sub = s.AdditionalProperties.schema
+		}
+		if sub == nil {
+			continue
+		}
+		if err := sub.validate(path+"."+key, m[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
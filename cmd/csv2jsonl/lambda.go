@@ -0,0 +1,289 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+// lambdaRuntimeAPI Lambda 自定义运行时接口的版本
+const lambdaRuntimeAPI = "2018-06-01"
+
+// s3Event S3 的事件通知，只解析需要的字段
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// lambdaOutput 一个转换后的对象，作为调用的结果返回
+type lambdaOutput struct {
+	Source    string `json:"source"`
+	Output    string `json:"output,omitempty"`
+	Rows      int    `json:"rows"`
+	Emitted   int    `json:"emitted"`
+	Malformed int    `json:"malformed,omitempty"`
+	Skipped   string `json:"skipped,omitempty"`
+}
+
+// lambdaHandler 将 S3 事件中的 CSV 对象转换为 JSON Lines 对象，配置来自环境变量
+type lambdaHandler struct {
+	client *s3Client
+	// bucket 输出的存储桶，为空时写入源对象的存储桶
+	bucket string
+	prefix string
+	// compress 输出的压缩扩展名 .gz 或 .zst，为空时不压缩
+	compress string
+	opts     convertOptions
+}
+
+// newLambdaHandler 读取 CSV2JSONL_ 开头的环境变量创建处理器
+func newLambdaHandler() (*lambdaHandler, error) {
+	client, err := newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	h := &lambdaHandler{client: client, bucket: os.Getenv("CSV2JSONL_OUTPUT_BUCKET"), prefix: "jsonl/"}
+	if prefix, ok := os.LookupEnv("CSV2JSONL_OUTPUT_PREFIX"); ok {
+		h.prefix = prefix
+	}
+	if name := os.Getenv("CSV2JSONL_COMPRESS"); name != "" {
+		if h.compress = outputCompressions[name]; h.compress == "" {
+			return nil, fmt.Errorf("CSV2JSONL_COMPRESS: unknown compression %s, expected gzip or zstd", name)
+		}
+	}
+	if s := os.Getenv("CSV2JSONL_DELIMITER"); s != "" {
+		if err = h.opts.setDelimiter(s); err != nil {
+			return nil, fmt.Errorf("CSV2JSONL_DELIMITER: %v", err)
+		}
+	}
+	if s := os.Getenv("CSV2JSONL_COLUMNS"); s != "" {
+		h.opts.columns = strings.Split(s, ",")
+	}
+	for name, value := range map[string]*bool{
+		"CSV2JSONL_INFER_TYPES":   &h.opts.inferTypes,
+		"CSV2JSONL_EMPTY_AS_NULL": &h.opts.emptyAsNull,
+		"CSV2JSONL_OMIT_EMPTY":    &h.opts.omitEmpty,
+		"CSV2JSONL_NESTED":        &h.opts.nested,
+	} {
+		if s := os.Getenv(name); s != "" {
+			if *value, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("%s: invalid boolean %s", name, s)
+			}
+		}
+	}
+	if policy := os.Getenv("CSV2JSONL_ON_ERROR"); policy != "" {
+		if policy == "collect" {
+			return nil, fmt.Errorf("CSV2JSONL_ON_ERROR: collect is not supported, use strict or skip")
+		}
+		if h.opts.onError, err = newErrorHandler(policy, nil); err != nil {
+			return nil, fmt.Errorf("CSV2JSONL_ON_ERROR: %v", err)
+		}
+	}
+	// 预设只补充环境变量没有指定的选项
+	if name := os.Getenv("CSV2JSONL_PRESET"); name != "" {
+		p, err := loadPreset(name)
+		if err != nil {
+			return nil, err
+		}
+		p.apply(&h.opts)
+	}
+	return h, nil
+}
+
+// outputKey 返回源对象转换后的对象名，如 uploads/users.csv.gz 转换为 jsonl/uploads/users.jsonl
+func (h *lambdaHandler) outputKey(key string) string {
+	base := trimCompressionExt(key)
+	if detectInputFormat(base) != "" {
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+	return h.prefix + base + ".jsonl" + h.compress
+}
+
+// handle 依次转换事件中的对象，任一对象失败时返回错误，Lambda 按重试策略重新调用
+func (h *lambdaHandler) handle(payload []byte) ([]lambdaOutput, error) {
+	var event s3Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("parse event failed: %v", err)
+	}
+	if len(event.Records) == 0 {
+		return nil, fmt.Errorf("event has no S3 records")
+	}
+	outputs := make([]lambdaOutput, 0, len(event.Records))
+	for _, record := range event.Records {
+		bucket := record.S3.Bucket.Name
+		// 事件中的对象名按表单编码，空格为 +
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return outputs, fmt.Errorf("invalid object key %s: %v", record.S3.Object.Key, err)
+		}
+		out := lambdaOutput{Source: "s3://" + bucket + "/" + key}
+		outBucket := h.bucket
+		if outBucket == "" {
+			outBucket = bucket
+		}
+		switch {
+		case !strings.HasPrefix(record.EventName, "ObjectCreated:"):
+			out.Skipped = "not an ObjectCreated event"
+		case outBucket == bucket && h.prefix != "" && strings.HasPrefix(key, h.prefix):
+			// 写入同一个存储桶时，输出的对象会再次触发函数
+			out.Skipped = "object is under the output prefix"
+		default:
+			outKey := h.outputKey(key)
+			out.Output = "s3://" + outBucket + "/" + outKey
+			stats, err := h.convert(bucket, key, outBucket, outKey)
+			if err != nil {
+				return outputs, fmt.Errorf("convert %s failed: %v", out.Source, err)
+			}
+			out.Rows, out.Emitted, out.Malformed = stats.Rows, stats.Emitted, stats.Malformed
+			log.Infof("converted %s to %s: %d rows", out.Source, out.Output, stats.Rows)
+		}
+		if out.Skipped != "" {
+			log.Infof("skip %s: %s", out.Source, out.Skipped)
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// convert 边下载边转换一个对象，分段上传转换的结果，失败时取消上传
+func (h *lambdaHandler) convert(bucket, key, outBucket, outKey string) (convert.Stats, error) {
+	resp, err := h.client.do(http.MethodGet, bucket, key, nil, nil)
+	if err != nil {
+		return convert.Stats{}, err
+	}
+	in, err := decompress(key, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return convert.Stats{}, err
+	}
+	defer in.Close()
+
+	opts := h.opts
+	if opts.delimiter, err = resolveDelimiter("", key, opts.delimiter); err != nil {
+		return convert.Stats{}, err
+	}
+	w := newUploadWriter("s3://"+outBucket+"/"+outKey, &s3Uploader{client: h.client, bucket: outBucket, key: outKey})
+	var out io.Writer = w
+	compressor, err := newCompressor(w, h.compress, nil)
+	if err != nil {
+		w.Abort()
+		return convert.Stats{}, err
+	}
+	if compressor != nil {
+		out = compressor
+	}
+	c := opts.converter()
+	if err = c.Convert(opts.separate(in), out); err == nil && compressor != nil {
+		err = compressor.Close()
+	}
+	if err != nil {
+		w.Abort()
+		return c.Stats(), err
+	}
+	return c.Stats(), w.Close()
+}
+
+// runLambda 作为 Lambda 自定义运行时，循环获取调用事件并返回转换结果
+func runLambda(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lambda", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	loggerLevel := fs.String("log-level", "info", "log level")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	level, err := log.ParseLevel(*loggerLevel)
+	if err != nil {
+		log.Errorf("invalid log level %s", *loggerLevel)
+		return exitUsage
+	}
+	log.SetLevel(level)
+
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		log.Errorf("lambda: AWS_LAMBDA_RUNTIME_API is not set, the lambda command runs inside an AWS Lambda custom runtime")
+		return exitUsage
+	}
+	base := "http://" + api + "/" + lambdaRuntimeAPI + "/runtime"
+	h, err := newLambdaHandler()
+	if err != nil {
+		log.Errorf("lambda: %v", err)
+		postLambdaError(base+"/init/error", err)
+		return 1
+	}
+	for {
+		resp, err := http.Get(base + "/invocation/next")
+		if err != nil {
+			log.Errorf("lambda: get next invocation failed: %v", err)
+			return 1
+		}
+		payload, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			log.Errorf("lambda: read invocation failed: %v", err)
+			return 1
+		}
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		outputs, err := h.handle(payload)
+		if err != nil {
+			log.Errorf("lambda: %v", err)
+			postLambdaError(base+"/invocation/"+requestID+"/error", err)
+			continue
+		}
+		body, _ := json.Marshal(struct {
+			Outputs []lambdaOutput `json:"outputs"`
+		}{outputs})
+		resp, err = http.Post(base+"/invocation/"+requestID+"/response", "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Errorf("lambda: post response failed: %v", err)
+			return 1
+		}
+		resp.Body.Close()
+	}
+}
+
+// postLambdaError 向运行时接口报告初始化或调用的错误
+func postLambdaError(target string, err error) {
+	body, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "ConversionError"})
+	resp, perr := http.Post(target, "application/json", bytes.NewReader(body))
+	if perr != nil {
+		log.Errorf("lambda: report error failed: %v", perr)
+		return
+	}
+	resp.Body.Close()
+}
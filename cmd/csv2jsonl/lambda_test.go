@@ -0,0 +1,122 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lambdaEvent 返回一个对象的 ObjectCreated 事件
+func lambdaEvent(bucket, key string) string {
+	return fmt.Sprintf(`{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":%q},"object":{"key":%q}}}]}`, bucket, key)
+}
+
+func TestRunLambda(t *testing.T) {
+	// 假的 S3，保存上传的对象
+	var mu sync.Mutex
+	objects := map[string]string{"/bucket/uploads/users.csv": "id,name\n1,Alice\n2,Bob\n"}
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, data)
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(data)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer s3.Close()
+
+	// 假的运行时接口，依次返回两个调用，之后断开连接结束 runLambda
+	events := []string{lambdaEvent("bucket", "uploads/users.csv"), lambdaEvent("bucket", "missing.csv")}
+	results := map[string]string{}
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		const prefix = "/" + lambdaRuntimeAPI + "/runtime/invocation/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if name == "next" {
+			if len(events) == 0 {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", fmt.Sprintf("request-%d", len(results)+1))
+			io.WriteString(w, events[0])
+			events = events[1:]
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		results[name] = string(data)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer runtime.Close()
+
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", strings.TrimPrefix(runtime.URL, "http://"))
+	t.Setenv("AWS_ENDPOINT_URL_S3", s3.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("CSV2JSONL_INFER_TYPES", "true")
+
+	if code := runLambda([]string{"-log-level", "error"}, io.Discard); code != 1 {
+		t.Errorf("runLambda returned %d after the runtime closed the connection, want 1", code)
+	}
+
+	if got := objects["/bucket/jsonl/uploads/users.jsonl"]; got != "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":\"Bob\"}\n" {
+		t.Errorf("converted object = %q", got)
+	}
+	var response struct {
+		Outputs []lambdaOutput `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(results["request-1/response"]), &response); err != nil {
+		t.Fatalf("response %q: %v", results["request-1/response"], err)
+	}
+	want := lambdaOutput{Source: "s3://bucket/uploads/users.csv", Output: "s3://bucket/jsonl/uploads/users.jsonl", Rows: 2, Emitted: 2}
+	if len(response.Outputs) != 1 || response.Outputs[0] != want {
+		t.Errorf("response outputs = %+v, want %+v", response.Outputs, want)
+	}
+
+	var lambdaErr struct {
+		ErrorMessage string `json:"errorMessage"`
+		ErrorType    string `json:"errorType"`
+	}
+	if err := json.Unmarshal([]byte(results["request-2/error"]), &lambdaErr); err != nil {
+		t.Fatalf("error %q: %v", results["request-2/error"], err)
+	}
+	if lambdaErr.ErrorType != "ConversionError" || !strings.Contains(lambdaErr.ErrorMessage, "convert s3://bucket/missing.csv failed") || !strings.Contains(lambdaErr.ErrorMessage, "404") {
+		t.Errorf("invocation error = %+v", lambdaErr)
+	}
+	if _, ok := objects["/bucket/jsonl/missing.jsonl"]; ok || len(results) != 2 {
+		t.Errorf("results %v, objects %v", results, objects)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// reservedFiles 分区文件之外需要的文件描述符，如标准输入输出、输入文件、错误文件
+const reservedFiles = 16
+
+// partialSuffix 转换因超出资源限制中止时，在输出文件旁写入的标记文件的后缀
+const partialSuffix = ".partial"
+
+// deadlineReader 超过 deadline 后读取失败，用于 -max-runtime 中止转换
+type deadlineReader struct {
+	io.ReadCloser
+	deadline time.Time
+	exceeded atomic.Bool
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if time.Now().After(r.deadline) {
+		r.exceeded.Store(true)
+		return 0, fmt.Errorf("max runtime exceeded")
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// checkOpenFiles 检查同时打开 files 个输出文件不超过 budget，budget 为 0 时
+// 使用进程的打开文件数限制，无法获取时不检查
+func checkOpenFiles(files, budget int) error {
+	if budget <= 0 {
+		if budget = openFileLimit(); budget <= 0 {
+			return nil
+		}
+	}
+	if files+reservedFiles > budget {
+		return fmt.Errorf("%d output files and %d other files exceed the budget of %d open files, use fewer shards or raise -max-open-files", files, reservedFiles, budget)
+	}
+	return nil
+}
+
+// partialMarker 标记文件的内容
+type partialMarker struct {
+	Reason  string    `json:"reason"`
+	Rows    int       `json:"rows"`
+	Emitted int       `json:"emitted"`
+	Aborted time.Time `json:"aborted"`
+}
+
+// markPartial 在输出文件旁写入 <output>.partial，说明输出不完整的原因
+func markPartial(output, reason string, rows, emitted int) error {
+	data, err := json.MarshalIndent(partialMarker{Reason: reason, Rows: rows, Emitted: emitted, Aborted: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output+partialSuffix, append(data, '\n'), 0o644)
+}
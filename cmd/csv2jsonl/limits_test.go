@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxRuntimePartial(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.jsonl")
+	pr, pw := io.Pipe()
+	go func() {
+		// 第二行在超时之后才到达
+		io.WriteString(pw, "id,name\n1,a\n")
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(pw, "2,b\n")
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(pw, "3,c\n")
+		pw.Close()
+	}()
+	if code := Run([]string{"-log-level", "error", "-o", output, "-max-runtime", "100ms"}, pr, io.Discard, io.Discard); code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	pr.Close()
+
+	data, err := os.ReadFile(output + partialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marker partialMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		t.Fatal(err)
+	}
+	if marker.Reason != "max runtime of 100ms exceeded" || marker.Rows < 1 || marker.Rows > 2 || marker.Aborted.IsZero() {
+		t.Errorf("partial marker = %+v", marker)
+	}
+
+	// 之后成功的转换删除标记
+	if code := Run([]string{"-log-level", "error", "-o", output}, strings.NewReader("id,name\n1,a\n"), io.Discard, io.Discard); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if _, err := os.Stat(output + partialSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial marker still exists after a successful conversion: %v", err)
+	}
+}
+
+func TestCheckOpenFiles(t *testing.T) {
+	if err := checkOpenFiles(10, 10+reservedFiles); err != nil {
+		t.Errorf("10 files within a budget of %d: %v", 10+reservedFiles, err)
+	}
+	if err := checkOpenFiles(11, 10+reservedFiles); err == nil {
+		t.Errorf("11 files exceed a budget of %d", 10+reservedFiles)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockRetryInterval 等待输出的锁时重试的间隔
+const lockRetryInterval = 100 * time.Millisecond
+
+// outputLock 输出文件的建议锁。锁住的是输出旁边的 <o>.lock 文件，
+// 以免在取得锁之前就截断了输出；该文件不会删除，删除后等待的进程可能锁住已删除的文件
+type outputLock struct {
+	f *os.File
+}
+
+// lockOutput 锁住输出 path，已被其他进程锁住时最多等待 wait，wait 为 0 时不等待
+func lockOutput(path string, wait time.Duration) (*outputLock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %v", f.Name(), err)
+		}
+		if locked {
+			return &outputLock{f: f}, nil
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			if wait > 0 {
+				return nil, fmt.Errorf("%s is still locked by another run after %v", path, wait)
+			}
+			return nil, fmt.Errorf("%s is locked by another run, use -wait-lock to wait for it", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Close 释放锁
+func (l *outputLock) Close() error {
+	unlockFile(l.f)
+	return l.f.Close()
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockOutput(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.jsonl")
+	if err := os.WriteFile(output, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join("testdata", "people.csv")
+	first, err := lockOutput(output, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他运行持有锁时失败，不截断输出
+	if code := Run([]string{"-log-level", "error", "-i", input, "-o", output, "-lock"}, nil, io.Discard, io.Discard); code != 1 {
+		t.Errorf("exit code = %d while the output is locked, want 1", code)
+	}
+	if data, err := os.ReadFile(output); err != nil || string(data) != "previous\n" {
+		t.Errorf("output = %q, %v, want it unchanged", data, err)
+	}
+
+	// -wait-lock 等到锁释放后转换
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		first.Close()
+	}()
+	started := time.Now()
+	if code := Run([]string{"-log-level", "error", "-i", input, "-o", output, "-wait-lock", "5s"}, nil, io.Discard, io.Discard); code != 0 {
+		t.Errorf("exit code = %d after waiting for the lock, want 0", code)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("conversion did not wait for the lock, finished after %v", elapsed)
+	}
+	if data, err := os.ReadFile(output); err != nil || len(data) == 0 || string(data) == "previous\n" {
+		t.Errorf("output = %q, %v, want the converted records", data, err)
+	}
+
+	// 锁在转换结束后释放
+	lock, err := lockOutput(output, 0)
+	if err != nil {
+		t.Fatalf("output is still locked after the conversion: %v", err)
+	}
+	lock.Close()
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	args := os.Args[1:]
+	// Lambda 自定义运行时不带参数启动名为 bootstrap 的程序
+	if filepath.Base(os.Args[0]) == "bootstrap" && os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		args = append([]string{"lambda"}, args...)
+	}
+	os.Exit(Run(args, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// openInput 打开输入文件，路径为空或 - 时读取标准输入，http(s) 和对象存储的地址
+// 边下载边读取，gzip、zstd、bzip2 压缩的输入会被自动解压
+func openInput(path string, stdin io.Reader) (io.ReadCloser, error) {
+	return openCountedInput(path, stdin, nil)
+}
+
+// openCountedInput 同 openInput，counter 不为空时统计解压前读取的字节数
+func openCountedInput(path string, stdin io.Reader, counter *atomic.Int64) (io.ReadCloser, error) {
+	raw, err := openRaw(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	if path == "-" {
+		path = ""
+	}
+	if counter != nil {
+		raw = countingReader{ReadCloser: raw, n: counter}
+	}
+	in, err := decompress(path, raw)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return in, nil
+}
+
+// openRaw 打开未解压的输入，路径为空或 - 时读取标准输入
+func openRaw(path string, stdin io.Reader) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	if isRemoteInput(path) {
+		return openRemote(path)
+	}
+	return os.OpenFile(path, os.O_RDONLY, 0o644) // 打开文件，只读模式，权限为0o644
+}
+
+// Run 执行命令行，返回进程退出码
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	log.SetOutput(stderr)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "selftest":
+			return runSelftest(args[1:], stdout, stderr)
+		case "generate":
+			return runGenerate(args[1:], stdout, stderr)
+		case "inspect":
+			return runInspect(args[1:], stdin, stdout, stderr)
+		case "jsonl2csv":
+			return runJsonl2csv(args[1:], stdin, stdout, stderr)
+		case "query":
+			return runQuery(args[1:], stdin, stdout, stderr)
+		case "verify":
+			return runVerify(args[1:], stdin, stdout, stderr)
+		case "lambda":
+			return runLambda(args[1:], stderr)
+		}
+	}
+	return runConvert(args, stdin, stdout, stderr)
+}
+
+// 转换的退出码：0 成功，1 读写失败等错误
+const (
+	// exitParseErrors 输入有格式错误的行，-on-error strict 时停止转换，skip、collect 时跳过
+	exitParseErrors = 2
+	// exitNoRows 转换完成但没有写出任何行，包括空的输入
+	exitNoRows = 3
+	// exitUsage 参数错误，与 sysexits.h 的 EX_USAGE 相同，各子命令通用
+	exitUsage = 64
+)
+
+// runConvert 将 CSV 转换为 JSONL，返回进程退出码
+func runConvert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return runConversion(args, stdin, stdout, stderr, log.StandardLogger())
+}
+
+// runConversion 同 runConvert，日志输出到 logger，如 HTTP 服务为每个请求创建的 logger
+func runConversion(args []string, stdin io.Reader, stdout, stderr io.Writer, logger *log.Logger) (code int) {
+	fs, f := newConvertFlags(stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	if f.help {
+		fs.Usage()
+		return 0
+	}
+
+	var config *convertConfig
+	if f.configPath != "" {
+		var err error
+		if config, err = loadConfig(f.configPath, f.profile); err != nil {
+			logger.Errorf("load config failed: %v", err)
+			return exitUsage
+		}
+		if err = config.apply(fs); err != nil {
+			logger.Errorf("%v", err)
+			return exitUsage
+		}
+	} else if f.profile != "" {
+		logger.Errorf("-profile requires -config")
+		return exitUsage
+	}
+
+	level, err := log.ParseLevel(f.loggerLevel)
+	if err != nil {
+		level = log.InfoLevel
+	}
+	logger.SetLevel(level)
+
+	deprecated := usedDeprecations(fs)
+	if !checkDeprecations(deprecated, f.strictFlags, logger) {
+		return exitUsage
+	}
+
+	if f.serve != "" {
+		return runServer(f.serve)
+	}
+
+	c := &conversion{f: f, fs: fs, log: logger, stdin: stdin, stdout: stdout, stderr: stderr, started: time.Now(), config: config, deprecated: deprecated}
+	if c.notify, err = newNotifier(f.notifyWebhook, f.notifyEmail, f.notifySMTP, f.notifyFrom); err != nil {
+		logger.Errorf("%v", err)
+		return exitUsage
+	}
+	if c.notify != nil {
+		c.notify.source, c.notify.output = f.input, f.output
+		if c.notify.source == "" {
+			c.notify.source = "-"
+		}
+		if c.notify.output == "" {
+			c.notify.output = "-"
+		}
+		restore := c.notify.install(logger)
+		defer func() {
+			restore()
+			c.notify.send(code)
+		}()
+	}
+	defer c.close()
+
+	// 先检查参数并创建选项，再打开输入和输出
+	steps := []func() int{
+		c.newOptions, c.checkModes, c.recordOptions, c.outputOptions, c.lockOutput, c.loadCheckpoint,
+		c.formatOptions, c.protectOptions, c.presetOptions, c.separatorOptions, c.errorOptions, c.inferenceOptions,
+		c.prepareInput, c.installObservers, c.openInput, c.outputLayout, c.openOutput, c.wrapOutput,
+	}
+	for _, step := range steps {
+		if code := step(); code != 0 {
+			return code
+		}
+	}
+	if code := c.finish(c.run()); code != 0 {
+		return code
+	}
+	if code := c.closeOutput(); code != 0 {
+		return code
+	}
+	if code := c.writeReports(); code != 0 {
+		return code
+	}
+	return outcomeCode(c.stats)
+}
+
+// outcomeCode 返回完成的转换的退出码：跳过了格式错误的行时为 exitParseErrors，
+// 没有写出任何行时为 exitNoRows，否则为 0
+func outcomeCode(stats convert.Stats) int {
+	switch {
+	case stats.Malformed > 0:
+		log.Infof("exit code %d: %d malformed rows skipped", exitParseErrors, stats.Malformed)
+		return exitParseErrors
+	case stats.Emitted == 0:
+		log.Warnf("exit code %d: no rows emitted", exitNoRows)
+		return exitNoRows
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestGolden 运行 testdata/golden 下的每个用例：
+//
+//	args   命令行参数，每行一个
+//	stdin  可选，标准输入
+//	stdout 期望的标准输出
+//	code   可选，期望的退出码，缺省为 0
+//	build  可选，full 或 slim，用例只在指定的构建中运行
+//	files  可选，期望写出的文件的目录
+//
+// 参数中的 $TMP 替换为用例的临时目录，运行后临时目录中的每个文件与 files 下
+// 相同路径的文件比较，标准输出和文件内容中的临时目录路径替换回 $TMP
+func TestGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "golden", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no golden cases found")
+	}
+
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			if data, err := os.ReadFile(filepath.Join(dir, "build")); err == nil {
+				// sqlDriver 只在 full 构建中设置
+				build := "slim"
+				if sqlDriver != "" {
+					build = "full"
+				}
+				if want := strings.TrimSpace(string(data)); want != build {
+					t.Skipf("only runs in the %s build", want)
+				}
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmp := t.TempDir()
+			var args []string
+			for _, arg := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+				if arg != "" {
+					args = append(args, strings.ReplaceAll(arg, "$TMP", tmp))
+				}
+			}
+
+			stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			wantCode := 0
+			if data, err := os.ReadFile(filepath.Join(dir, "code")); err == nil {
+				if wantCode, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+			if code != wantCode {
+				t.Errorf("exit code = %d, want %d, stderr:\n%s", code, wantCode, stderr.String())
+			}
+
+			got := strings.ReplaceAll(stdout.String(), tmp, "$TMP")
+			golden := filepath.Join(dir, "stdout")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				updateGoldenFiles(t, tmp, filepath.Join(dir, "files"))
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("stdout mismatch\ngot:\n%s\nwant:\n%s", got, want)
+			}
+
+			gotFiles, wantFiles := readGoldenFiles(t, tmp), readGoldenFiles(t, filepath.Join(dir, "files"))
+			for name, want := range wantFiles {
+				got, ok := gotFiles[name]
+				if !ok {
+					t.Errorf("file %s was not written", name)
+				} else if got = strings.ReplaceAll(got, tmp, "$TMP"); got != want {
+					t.Errorf("file %s mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+				}
+			}
+			for name := range gotFiles {
+				if _, ok := wantFiles[name]; !ok {
+					t.Errorf("unexpected file %s was written", name)
+				}
+			}
+		})
+	}
+}
+
+// readGoldenFiles 读取 dir 下的所有文件，以相对 dir 的路径为键，dir 不存在时返回空
+func readGoldenFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		files[filepath.ToSlash(name)] = string(data)
+		return err
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// updateGoldenFiles 将用例写出的文件保存为 golden 目录下的 files
+func updateGoldenFiles(t *testing.T, tmp, dir string) {
+	t.Helper()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range readGoldenFiles(t, tmp) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(data, tmp, "$TMP")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestInvalidOptionsKeepOutput 参数与输入不符时退出码为 exitUsage，已有的输出不被清空
+func TestInvalidOptionsKeepOutput(t *testing.T) {
+	for _, args := range [][]string{
+		{"-filter", "age >"},
+		{"-where-date", "age >= yesterday"},
+		{"-columns", "/^phone/"},
+		{"-filter", "phone == 1"},
+		{"-transform", "phone:upper"},
+	} {
+		dir := t.TempDir()
+		output := filepath.Join(dir, "out.jsonl")
+		errorFile := filepath.Join(dir, "errors.jsonl")
+		for _, path := range []string{output, errorFile} {
+			if err := os.WriteFile(path, []byte("previous\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		args = append(args, "-i", filepath.Join("testdata", "people.csv"), "-o", output, "-on-error", "collect", "-error-file", errorFile)
+		var stderr bytes.Buffer
+		if code := Run(args, nil, io.Discard, &stderr); code != exitUsage {
+			t.Errorf("%v: exit code = %d, want %d, stderr:\n%s", args, code, exitUsage, stderr.String())
+		}
+		for _, path := range []string{output, errorFile} {
+			if data, err := os.ReadFile(path); err != nil || string(data) != "previous\n" {
+				t.Errorf("%v: %s = %q, %v, want it unchanged", args, filepath.Base(path), data, err)
+			}
+		}
+	}
+}
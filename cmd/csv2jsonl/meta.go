@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// metaFieldNames -add-meta 的各项元数据默认的字段名
+var metaFieldNames = map[string]string{
+	"source":    "_source",
+	"timestamp": "_timestamp",
+}
+
+// parseMeta 解析 -add-meta 的逗号分隔的列表，每项为 source 或 timestamp，
+// 可以用 name=field 指定字段名。source 为输入的文件名，标准输入为 -，
+// timestamp 为转换开始的 UTC 时间，所有记录相同
+func parseMeta(spec, source string, started time.Time) (map[string]interface{}, error) {
+	if source == "" {
+		source = "-"
+	}
+	values := map[string]interface{}{
+		"source":    source,
+		"timestamp": started.UTC().Format(time.RFC3339),
+	}
+	fields := map[string]interface{}{}
+	for _, item := range strings.Split(spec, ",") {
+		name, field, renamed := strings.Cut(strings.TrimSpace(item), "=")
+		if !renamed {
+			field = metaFieldNames[name]
+		}
+		value, ok := values[name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("unknown metadata %q, expected source or timestamp", name)
+		case field == "":
+			return nil, fmt.Errorf("metadata %s has an empty field name", name)
+		}
+		if _, ok := fields[field]; ok {
+			return nil, fmt.Errorf("metadata field %s is given twice", field)
+		}
+		fields[field] = value
+	}
+	return fields, nil
+}
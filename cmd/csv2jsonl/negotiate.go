@@ -0,0 +1,252 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sniffSize 按内容判断格式时读取的输入开头的字节数
+const sniffSize = 64 << 10
+
+// sniffLines 按内容判断分隔符时最多检查的行数
+const sniffLines = 20
+
+// 可以识别但不能转换的格式的扩展名
+var unsupportedExtensions = map[string]string{
+	".xlsx":    "xlsx",
+	".xls":     "xls",
+	".json":    "json",
+	".jsonl":   "jsonl",
+	".ndjson":  "jsonl",
+	".parquet": "parquet",
+}
+
+// 可以识别但不能转换的格式的文件头
+var unsupportedMagic = []struct {
+	name  string
+	magic []byte
+}{
+	{"xlsx", []byte("PK\x03\x04")},
+	{"xls", []byte{0xd0, 0xcf, 0x11, 0xe0}},
+	{"parquet", []byte("PAR1")},
+}
+
+// sniffDelimiters 按内容判断时的候选分隔符，及其对应的格式名称
+var sniffDelimiters = []struct {
+	delimiter rune
+	format    string
+}{
+	{',', "csv"},
+	{'\t', "tsv"},
+	{'|', "psv"},
+	{';', "csv"},
+}
+
+// inputDetection 输入格式的判断结果
+type inputDetection struct {
+	format      string
+	delimiter   rune
+	compression string
+	// by 判断的依据：-input-format、option（-delimiter 或预设）、extension、content 或 default
+	by string
+}
+
+func (d inputDetection) String() string {
+	var b strings.Builder
+	if d.format != "" {
+		b.WriteString(d.format)
+	} else {
+		b.WriteString("delimited")
+	}
+	if d.delimiter != 0 && d.delimiter != inputFormats[d.format] {
+		fmt.Fprintf(&b, " with delimiter %q", d.delimiter)
+	}
+	if d.compression != "" {
+		b.WriteString(", " + d.compression + " compressed")
+	}
+	b.WriteString(", by " + d.by)
+	return b.String()
+}
+
+// negotiateInput 确定输入的格式：-input-format 指定的格式优先，其次为已有的分隔符
+// （如来自 -delimiter 或预设），然后是扩展名，最后由 sniff 读取输入开头的数据按内容判断。
+// sniff 为空时不检查内容，都无法判断时按 CSV 读取。能识别但不能转换的格式返回错误
+func negotiateInput(format, path string, delimiter rune, sniff func() ([]byte, string, error)) (inputDetection, error) {
+	if format != "" {
+		delimiter, err := formatDelimiter(format)
+		return inputDetection{format: strings.ToLower(format), delimiter: delimiter, by: "-input-format"}, err
+	}
+	if delimiter != 0 {
+		return inputDetection{delimiter: delimiter, by: "option"}, nil
+	}
+	name := inputPath(path)
+	compression := compressionExtensions[strings.ToLower(filepath.Ext(name))]
+	ext := strings.ToLower(filepath.Ext(trimCompressionExt(name)))
+	if format, ok := formatExtensions[ext]; ok {
+		return inputDetection{format: format, delimiter: inputFormats[format], compression: compression, by: "extension"}, nil
+	}
+	if format, ok := unsupportedExtensions[ext]; ok {
+		return inputDetection{}, unsupportedFormatError(format, "extension")
+	}
+	if sniff != nil {
+		head, compression, err := sniff()
+		if err != nil {
+			return inputDetection{}, err
+		}
+		for _, m := range unsupportedMagic {
+			if bytes.HasPrefix(head, m.magic) {
+				return inputDetection{}, unsupportedFormatError(m.name, "content")
+			}
+		}
+		if trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\ufeff")), " \t\r\n"); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return inputDetection{}, unsupportedFormatError("json", "content")
+		}
+		if format, delimiter := sniffDelimiter(head); delimiter != 0 {
+			return inputDetection{format: format, delimiter: delimiter, compression: compression, by: "content"}, nil
+		}
+		return inputDetection{format: "csv", delimiter: ',', compression: compression, by: "default"}, nil
+	}
+	return inputDetection{format: "csv", delimiter: ',', compression: compression, by: "default"}, nil
+}
+
+// detectInput 按 negotiateInput 确定输入的格式并输出判断的结果，需要时读取输入的开头。
+// 返回的退出码在读取输入出错时为 1，格式不能转换或无效时为 exitUsage
+func detectInput(format, path string, delimiter rune, stdin *io.Reader, encoding string, logger log.FieldLogger) (inputDetection, int) {
+	var sniffErr error
+	detected, err := negotiateInput(format, path, delimiter, func() ([]byte, string, error) {
+		head, compression, err := sniffInput(path, stdin, encoding)
+		sniffErr = err
+		return head, compression, err
+	})
+	switch {
+	case sniffErr != nil:
+		logger.Errorf("open file failed: %v", sniffErr)
+		return detected, 1
+	case err != nil:
+		logger.Errorf("%v", err)
+		return detected, exitUsage
+	}
+	logger.Infof("input format: %s", detected)
+	return detected, 0
+}
+
+func unsupportedFormatError(format, by string) error {
+	return fmt.Errorf("input looks like %s (by %s), which can not be converted; export it as CSV, or use -input-format or -delimiter if it is delimited text", format, by)
+}
+
+// sniffDelimiter 在开头的完整行中统计各候选分隔符在引号外出现的次数，
+// 每行次数相同且最多的分隔符优先，没有时取出现最多的，都没有出现时返回 0
+func sniffDelimiter(head []byte) (string, rune) {
+	lines := bytes.Split(head, []byte("\n"))
+	if len(lines) > 1 {
+		// 最后一行可能不完整，以换行结尾时为空
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > sniffLines {
+		lines = lines[:sniffLines]
+	}
+	bestFormat, best, bestScore := "", rune(0), 0
+	for _, cand := range sniffDelimiters {
+		total, first, consistent := 0, -1, true
+		for _, line := range lines {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			n := countUnquoted(line, cand.delimiter)
+			if first < 0 {
+				first = n
+			} else if n != first {
+				consistent = false
+			}
+			total += n
+		}
+		score := total
+		if consistent && first > 0 {
+			// 每行次数相同的分隔符优先于只是出现次数多的
+			score += 1 << 30
+		}
+		if total > 0 && score > bestScore {
+			bestFormat, best, bestScore = cand.format, cand.delimiter, score
+		}
+	}
+	return bestFormat, best
+}
+
+// countUnquoted 统计分隔符在双引号以外出现的次数
+func countUnquoted(line []byte, delimiter rune) int {
+	n, quoted := 0, false
+	for _, r := range string(line) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == delimiter && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// sniffInput 读取输入解压、解码后开头最多 sniffSize 字节，返回数据及压缩格式。
+// 标准输入只读取到第一个换行，以免等待持续写入的输入，读取的数据放回 *stdin 的开头
+func sniffInput(path string, stdin *io.Reader, encoding string) ([]byte, string, error) {
+	src := *stdin
+	if path == "" || path == "-" {
+		raw := make([]byte, 0, sniffSize)
+		for len(raw) < cap(raw) && bytes.IndexByte(raw, '\n') < 0 {
+			n, err := (*stdin).Read(raw[len(raw):cap(raw)])
+			raw = raw[:len(raw)+n]
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		src = bytes.NewReader(raw)
+		*stdin = io.MultiReader(bytes.NewReader(raw), *stdin)
+		path = ""
+	}
+	raw, err := openRaw(path, src)
+	if err != nil {
+		return nil, "", err
+	}
+	br := bufio.NewReader(raw)
+	compression := detectCompression(path, br)
+	in, err := decompress(path, struct {
+		io.Reader
+		io.Closer
+	}{br, raw})
+	if err != nil {
+		raw.Close()
+		return nil, "", err
+	}
+	defer in.Close()
+	if in, err = decodeInput(in, encoding); err != nil {
+		return nil, "", err
+	}
+	head := make([]byte, sniffSize)
+	// 标准输入只读取了压缩数据的开头，解压到结尾时的错误可以忽略
+	n, _ := io.ReadFull(in, head)
+	return head[:n], compression, nil
+}
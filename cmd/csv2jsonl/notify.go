@@ -0,0 +1,189 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+// notifyTimeout 发送通知的超时时间
+const notifyTimeout = 10 * time.Second
+
+// notification 转换结束后发送的通知
+type notification struct {
+	Status   string    `json:"status"` // succeeded 或 failed
+	Source   string    `json:"source"`
+	Output   string    `json:"output"`
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Elapsed  float64   `json:"elapsed_seconds"`
+	Rows     int       `json:"rows"`
+	Emitted  int       `json:"emitted"`
+	Skipped  int       `json:"skipped"`
+	Errors   int       `json:"errors"`
+}
+
+// notifier 在转换结束或失败时发送 webhook 和邮件通知，作为 logrus 的 hook
+// 记录最后一条错误日志作为失败原因
+type notifier struct {
+	webhook string
+	email   []string
+	smtp    string
+	from    string
+
+	source, output string
+	started        time.Time
+	stats          convert.Stats
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// newNotifier 校验通知的目标，没有指定目标时返回 nil
+func newNotifier(webhook, email, smtpAddr, from string) (*notifier, error) {
+	if webhook == "" && email == "" {
+		return nil, nil
+	}
+	n := &notifier{webhook: webhook, smtp: smtpAddr, from: from, started: time.Now()}
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid notify-webhook %s, expected an http or https url", webhook)
+		}
+	}
+	if email != "" {
+		addrs, err := mail.ParseAddressList(email)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notify-email %s: %v", email, err)
+		}
+		for _, addr := range addrs {
+			n.email = append(n.email, addr.Address)
+		}
+		if n.from == "" {
+			host, _ := os.Hostname()
+			n.from = "csv2jsonl@" + host
+		}
+	}
+	return n, nil
+}
+
+func (n *notifier) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+func (n *notifier) Fire(e *log.Entry) error {
+	n.mu.Lock()
+	n.lastError = e.Message
+	n.mu.Unlock()
+	return nil
+}
+
+// install 在 logger 上注册 hook，返回恢复原有 hook 的函数
+func (n *notifier) install(logger *log.Logger) func() {
+	hooks := make(log.LevelHooks)
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append([]log.Hook(nil), levelHooks...)
+	}
+	logger.AddHook(n)
+	return func() { logger.ReplaceHooks(hooks) }
+}
+
+// notification 根据退出码生成通知
+func (n *notifier) notification(code int) *notification {
+	msg := &notification{
+		Status:   "succeeded",
+		Source:   n.source,
+		Output:   n.output,
+		ExitCode: code,
+		Started:  n.started,
+		Elapsed:  time.Since(n.started).Seconds(),
+		Rows:     n.stats.Rows,
+		Emitted:  n.stats.Emitted,
+		Skipped:  n.stats.Rows - n.stats.Emitted,
+		Errors:   n.stats.Malformed,
+	}
+	if code != 0 {
+		msg.Status = "failed"
+		n.mu.Lock()
+		msg.Error = n.lastError
+		n.mu.Unlock()
+	}
+	return msg
+}
+
+// send 发送通知，失败只记录日志，不影响退出码
+func (n *notifier) send(code int) {
+	msg := n.notification(code)
+	if n.webhook != "" {
+		if err := postWebhook(n.webhook, msg); err != nil {
+			log.Warnf("notify webhook failed: %v", err)
+		}
+	}
+	if len(n.email) > 0 {
+		if err := smtp.SendMail(n.smtp, nil, n.from, n.email, emailMessage(n.from, n.email, msg)); err != nil {
+			log.Warnf("notify email failed: %v", err)
+		}
+	}
+}
+
+// postWebhook 将通知以 JSON POST 到 url
+func postWebhook(url string, msg *notification) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// emailMessage 生成纯文本的通知邮件
+func emailMessage(from string, to []string, msg *notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: csv2jsonl: conversion of %s %s\r\n", msg.Source, msg.Status)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "Conversion of %s to %s %s with exit code %d.\r\n", msg.Source, msg.Output, msg.Status, msg.ExitCode)
+	if msg.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\r\n", msg.Error)
+	}
+	fmt.Fprintf(&b, "\r\nStarted: %s\r\nElapsed: %.3fs\r\n", msg.Started.Format(time.RFC3339), msg.Elapsed)
+	fmt.Fprintf(&b, "Rows read: %d\r\nEmitted: %d\r\nSkipped: %d\r\nErrors: %d\r\n", msg.Rows, msg.Emitted, msg.Skipped, msg.Errors)
+	return []byte(b.String())
+}
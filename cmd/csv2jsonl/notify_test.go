@@ -0,0 +1,85 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotifyWebhook(t *testing.T) {
+	var got []notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notification
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		got = append(got, msg)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(input, []byte("id,name\n1,a\n2,b,extra\n3,c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.jsonl")
+	for _, tc := range []struct {
+		onError string
+		code    int
+		want    notification
+	}{
+		{onError: "skip", code: exitParseErrors, want: notification{Status: "failed", Source: input, Output: output, ExitCode: exitParseErrors, Rows: 2, Emitted: 2, Errors: 1}},
+		{onError: "strict", code: exitParseErrors, want: notification{Status: "failed", Source: input, Output: output, ExitCode: exitParseErrors, Rows: 1, Emitted: 1}},
+	} {
+		got = nil
+		args := []string{"-log-level", "error", "-i", input, "-o", output, "-on-error", tc.onError, "-notify-webhook", srv.URL}
+		if code := Run(args, nil, io.Discard, io.Discard); code != tc.code {
+			t.Errorf("%s: exit code = %d, want %d", tc.onError, code, tc.code)
+		}
+		if len(got) != 1 {
+			t.Fatalf("%s: got %d notifications, want 1", tc.onError, len(got))
+		}
+		msg := got[0]
+		if msg.Started.IsZero() || msg.Elapsed < 0 {
+			t.Errorf("%s: notification started %v, elapsed %v", tc.onError, msg.Started, msg.Elapsed)
+		}
+		if tc.onError == "strict" && !strings.Contains(msg.Error, "wrong number of fields") {
+			t.Errorf("%s: notification error = %q, want the conversion error", tc.onError, msg.Error)
+		}
+		msg.Started, msg.Elapsed, msg.Error = tc.want.Started, tc.want.Elapsed, tc.want.Error
+		if msg != tc.want {
+			t.Errorf("%s: notification = %+v, want %+v", tc.onError, msg, tc.want)
+		}
+	}
+
+	got = nil
+	if err := os.WriteFile(input, []byte("id,name\n1,a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := Run([]string{"-log-level", "error", "-i", input, "-o", output, "-notify-webhook", srv.URL}, nil, io.Discard, io.Discard); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+	if len(got) != 1 || got[0].Status != "succeeded" || got[0].ExitCode != 0 || got[0].Error != "" || got[0].Emitted != 1 {
+		t.Errorf("notifications = %+v, want a single success", got)
+	}
+}
@@ -0,0 +1,587 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// objectPartSize 分段上传每段的大小，S3 要求除最后一段外不小于 5MiB，
+// GCS 要求为 256KiB 的倍数
+const objectPartSize = 8 << 20
+
+// objectUploader 一个对象的分段上传
+type objectUploader interface {
+	// uploadPart 按顺序上传第 n 段，n 从 1 开始，last 表示最后一段，只有对象为空时为空
+	uploadPart(n int, data []byte, last bool) error
+	// complete 在所有分段上传后完成上传
+	complete() error
+	abort()
+}
+
+// objectPart 等待上传的一段
+type objectPart struct {
+	n    int
+	data []byte
+	last bool
+}
+
+// objectWriter 将写入的数据按 objectPartSize 分段，在后台协程中依次上传，
+// 上传一段的同时可以继续写入下一段
+type objectWriter struct {
+	url      string
+	uploader objectUploader
+	buf      []byte
+	n        int
+	parts    chan objectPart
+	done     chan error
+	closed   bool
+
+	mu  sync.Mutex
+	err error // 上传失败的错误
+}
+
+func newObjectWriter(rawURL string) (*objectWriter, error) {
+	uploader, err := newObjectUploader(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return newUploadWriter(rawURL, uploader), nil
+}
+
+// newUploadWriter 创建写入 uploader 的 objectWriter，name 用于错误信息
+func newUploadWriter(name string, uploader objectUploader) *objectWriter {
+	w := &objectWriter{url: name, uploader: uploader, parts: make(chan objectPart, 1), done: make(chan error, 1)}
+	go w.run()
+	return w
+}
+
+// run 依次上传各段，失败后丢弃之后的分段
+func (w *objectWriter) run() {
+	var err error
+	for p := range w.parts {
+		if err != nil {
+			continue
+		}
+		if err = w.uploader.uploadPart(p.n, p.data, p.last); err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+		}
+	}
+	w.done <- err
+}
+
+func (w *objectWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	if err := w.failed(); err != nil {
+		return 0, fmt.Errorf("upload %s failed: %v", w.url, err)
+	}
+	written := len(p)
+	for len(p) > 0 {
+		// 写满的一段在有更多数据时才上传，否则由 Close 作为最后一段上传，
+		// 输出正好是整段时不会多出一个空的最后一段
+		if len(w.buf) == objectPartSize {
+			w.n++
+			w.parts <- objectPart{n: w.n, data: w.buf}
+			w.buf = nil
+		}
+		if w.buf == nil {
+			w.buf = make([]byte, 0, objectPartSize)
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf, p = w.buf[:len(w.buf)+n], p[n:]
+	}
+	return written, nil
+}
+
+// Close 上传最后一段并完成上传，失败时取消上传
+func (w *objectWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.failed() == nil {
+		w.n++
+		w.parts <- objectPart{n: w.n, data: w.buf, last: true}
+	}
+	close(w.parts)
+	err := <-w.done
+	if err == nil {
+		err = w.uploader.complete()
+	}
+	if err != nil {
+		w.uploader.abort()
+		return fmt.Errorf("upload %s failed: %v", w.url, err)
+	}
+	return nil
+}
+
+// Abort 取消上传，已经上传的分段被丢弃，不会创建对象
+func (w *objectWriter) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.parts)
+	<-w.done
+	w.uploader.abort()
+}
+
+// parseObjectURL 解析对象存储的地址，返回地址和去掉开头 / 的对象名
+func parseObjectURL(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, "", fmt.Errorf("invalid object url %s, expected s3://bucket/key, gs://bucket/object or az://account/container/blob", rawURL)
+	}
+	return u, key, nil
+}
+
+// newObjectUploader 按地址的协议创建分段上传
+func newObjectUploader(rawURL string) (objectUploader, error) {
+	u, key, err := parseObjectURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		client, err := newS3Client()
+		if err != nil {
+			return nil, err
+		}
+		return &s3Uploader{client: client, bucket: u.Host, key: key}, nil
+	case "gs":
+		return newGCSUploader(u.Host, key)
+	case "az":
+		return newAzureUploader(u.Host, key)
+	}
+	return nil, fmt.Errorf("unsupported object url %s", rawURL)
+}
+
+// checkResponse 检查响应的状态码，不是 2xx 或 want 中的状态码时关闭响应并返回
+// 包含响应内容的错误
+func checkResponse(resp *http.Response, want ...int) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	for _, code := range want {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	// 查询参数可能包含签名或 SAS 令牌
+	u := *resp.Request.URL
+	u.RawQuery = ""
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, u.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+}
+
+// s3Client 按 AWS 签名版本 4 签名的 S3 请求，凭据和区域来自环境变量
+type s3Client struct {
+	accessKey, secretKey, sessionToken string
+	region                             string
+	// endpoint 兼容 S3 的服务的地址，如 MinIO，按路径访问存储桶；为空时访问 AWS
+	endpoint *url.URL
+}
+
+func newS3Client() (*s3Client, error) {
+	c := &s3Client{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       os.Getenv("AWS_REGION"),
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("s3: invalid endpoint %s", endpoint)
+		}
+		c.endpoint = u
+	}
+	return c, nil
+}
+
+// do 发送签名的请求，响应的状态码不是 2xx 时返回错误，否则由调用方关闭响应
+func (c *s3Client) do(method, bucket, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3." + c.region + ".amazonaws.com", Path: "/" + key}
+	if c.endpoint != nil {
+		u = &url.URL{Scheme: c.endpoint.Scheme, Host: c.endpoint.Host, Path: strings.TrimSuffix(c.endpoint.Path, "/") + "/" + bucket + "/" + key}
+	}
+	u.RawPath = awsEscape(u.Path, true)
+	u.RawQuery = awsQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sign 按 AWS 签名版本 4 签名请求
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := map[string]string{"host": req.URL.Host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+		headers["x-amz-security-token"] = c.sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, part := range []string{date, c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape 按 AWS 签名的规则编码 URI，只保留非保留字符，keepSlash 时保留 /
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || keepSlash && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsQuery 按名称排序编码查询参数，同时用作签名的规范查询串
+func awsQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			params = append(params, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3Uploader S3 的分段上传，只有一段时直接上传对象
+type s3Uploader struct {
+	client      *s3Client
+	bucket, key string
+	uploadID    string
+	etags       []string
+}
+
+func (u *s3Uploader) uploadPart(n int, data []byte, last bool) error {
+	if n == 1 && last {
+		resp, err := u.client.do(http.MethodPut, u.bucket, u.key, nil, data)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if n == 1 {
+		resp, err := u.client.do(http.MethodPost, u.bucket, u.key, url.Values{"uploads": {""}}, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("s3: create multipart upload: %v", err)
+		}
+		u.uploadID = result.UploadID
+	}
+	query := url.Values{"partNumber": {fmt.Sprint(n)}, "uploadId": {u.uploadID}}
+	resp, err := u.client.do(http.MethodPut, u.bucket, u.key, query, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	u.etags = append(u.etags, resp.Header.Get("ETag"))
+	return nil
+}
+
+func (u *s3Uploader) complete() error {
+	if u.uploadID == "" {
+		return nil
+	}
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var body struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+	for i, etag := range u.etags {
+		body.Parts = append(body.Parts, part{PartNumber: i + 1, ETag: etag})
+	}
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.do(http.MethodPost, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 完成分段上传失败时也可能返回 200，错误在响应内容中
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3: complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+func (u *s3Uploader) abort() {
+	if u.uploadID == "" {
+		return
+	}
+	if resp, err := u.client.do(http.MethodDelete, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// gcsUploader GCS 的可续传上传，访问令牌来自 GOOGLE_OAUTH_ACCESS_TOKEN，
+// STORAGE_EMULATOR_HOST 指定模拟器的地址
+type gcsUploader struct {
+	endpoint       string
+	token          string
+	bucket, object string
+	session        string // 可续传上传的会话地址
+	offset         int64
+}
+
+func newGCSUploader(bucket, object string) (*gcsUploader, error) {
+	u := &gcsUploader{endpoint: "https://storage.googleapis.com", token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"), bucket: bucket, object: object}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		u.endpoint = host
+		if !strings.Contains(host, "://") {
+			u.endpoint = "http://" + host
+		}
+	} else if u.token == "" {
+		return nil, fmt.Errorf("gs: GOOGLE_OAUTH_ACCESS_TOKEN must be set, e.g. to $(gcloud auth print-access-token)")
+	}
+	return u, nil
+}
+
+func (u *gcsUploader) do(method, target string, body []byte, header http.Header, want ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, want...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (u *gcsUploader) uploadPart(n int, data []byte, last bool) error {
+	if n == 1 {
+		target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", u.endpoint, url.PathEscape(u.bucket), url.QueryEscape(u.object))
+		resp, err := u.do(http.MethodPost, target, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if u.session = resp.Header.Get("Location"); u.session == "" {
+			return fmt.Errorf("gs: no resumable upload session for %s", u.object)
+		}
+	}
+	end := u.offset + int64(len(data))
+	total := "*"
+	if last {
+		total = fmt.Sprint(end)
+	}
+	contentRange := fmt.Sprintf("bytes %d-%d/%s", u.offset, end-1, total)
+	if len(data) == 0 {
+		contentRange = "bytes */" + total
+	}
+	// 中间的分段返回 308 Resume Incomplete
+	resp, err := u.do(http.MethodPut, u.session, data, http.Header{"Content-Range": {contentRange}}, http.StatusPermanentRedirect)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	u.offset = end
+	return nil
+}
+
+func (u *gcsUploader) complete() error {
+	return nil
+}
+
+func (u *gcsUploader) abort() {
+	if u.session == "" {
+		return
+	}
+	// 取消的会话返回 499
+	if resp, err := u.do(http.MethodDelete, u.session, nil, nil, 499); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// azureUploader Azure Blob 的分块上传，SAS 令牌来自 AZURE_STORAGE_SAS_TOKEN
+type azureUploader struct {
+	blobURL  string // https://account.blob.core.windows.net/container/blob
+	sas      string
+	blockIDs []string
+}
+
+func newAzureUploader(account, path string) (*azureUploader, error) {
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if sas == "" {
+		return nil, fmt.Errorf("az: AZURE_STORAGE_SAS_TOKEN must be set")
+	}
+	if !strings.Contains(path, "/") {
+		return nil, fmt.Errorf("invalid object url az://%s/%s, expected az://account/container/blob", account, path)
+	}
+	u := &url.URL{Scheme: "https", Host: account + ".blob.core.windows.net", Path: "/" + path}
+	return &azureUploader{blobURL: u.String(), sas: sas}, nil
+}
+
+func (u *azureUploader) put(query string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, u.blobURL+"?"+query+"&"+u.sas, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-version", "2020-10-02")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (u *azureUploader) uploadPart(n int, data []byte, last bool) error {
+	if len(data) == 0 {
+		return nil
+	}
+	// 同一个 blob 的块 ID 长度必须相同
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", n)))
+	if err := u.put("comp=block&blockid="+url.QueryEscape(id), data); err != nil {
+		return err
+	}
+	u.blockIDs = append(u.blockIDs, id)
+	return nil
+}
+
+func (u *azureUploader) complete() error {
+	var body struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}
+	body.Latest = u.blockIDs
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return u.put("comp=blocklist", append([]byte(xml.Header), data...))
+}
+
+// abort 未提交的块由 Azure 在一周后删除
+func (u *azureUploader) abort() {}
@@ -0,0 +1,426 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	log "github.com/sirupsen/logrus"
+)
+
+// convertOptions 命令行、预设等来源收集的转换选项
+type convertOptions struct {
+	columns   []string
+	limit     int
+	skip      int
+	workers   int
+	unordered bool
+	onError   convert.ErrorHandler
+	pretty    bool
+	asciiOnly bool
+	nested    bool
+	delimiter rune
+	// noHeader 输入没有表头，header 为指定的列名
+	noHeader   bool
+	header     []string
+	renames    map[string]string
+	types      map[string]string
+	transforms map[string][]string
+	// valueMaps -map、-map-file 各列代码到可读值的查找表
+	valueMaps map[string]map[string]string
+	// defaults -default 各列空单元格的默认值
+	defaults   map[string]string
+	keyCase    string
+	inferTypes bool
+	// jsonColumns -parse-json-columns 按 JSON 解析的列
+	jsonColumns []string
+	// flatten -flatten 将 JSON 单元格的对象合并到记录中，flattenPrefix 时键以列为前缀
+	flatten       bool
+	flattenPrefix bool
+	// dateLayouts、dateOutput 日期列的解析格式和输出方式
+	dateLayouts []string
+	dateOutput  string
+	// schema -two-pass、-infer-sample 推断的各列类型
+	schema *convert.Schema
+	// inference 推断类型的方式 two-pass 或 sample，confidence 为 strict 或 lenient
+	inference  string
+	confidence string
+	dictionary convert.Dictionary
+	whereDate  string
+	filter     string
+	detectLang []string
+	parseUA    []string
+	lineage    func(*convert.Lineage) error
+	position   string
+	observe    func(record interface{})
+	// semantics 契约中各列的语义说明，来自预设
+	semantics map[string]string
+	// fieldSep、recordSep 读取前替换的多字符字段分隔符和记录分隔符，
+	// fieldRegexp、recordRegexp 为正则表达式的分隔符，见 separate
+	fieldSep     string
+	recordSep    string
+	fieldRegexp  *regexp.Regexp
+	recordRegexp *regexp.Regexp
+	// rowNumber 写入行序号的字段名，meta 写入每条记录的元数据字段
+	rowNumber string
+	meta      map[string]interface{}
+
+	emptyAsNull  bool
+	omitEmpty    bool
+	trimSpace    bool
+	stripControl bool
+	foldCase     bool
+	assertSorted *convert.SortAssertion
+	dedupe       *convert.Dedupe
+	// protections -classify 分类的列按 -policy 的保护方式，及 -mask 和 -hash-column 保护的列
+	protections map[string]convert.Protection
+	template    *template.Template
+	// kAnonymity -k-anonymity 预先统计的少见准标识符组合
+	kAnonymity *convert.KAnonymity
+	// strictColumns 字段数与表头不同的行总是停止转换
+	strictColumns bool
+	// warnLimit 每种行的警告输出的次数
+	warnLimit int
+	// hash 布隆过滤器、哈希保护所用的哈希算法
+	hash string
+	// checkpointRows 每读取多少行调用一次 onCheckpoint，resume 为继续转换的检查点
+	checkpointRows int
+	onCheckpoint   func(convert.Checkpoint) error
+	resume         *convert.Checkpoint
+	// sample -sample、-sample-n 抽取的行
+	sample *convert.Sample
+	// shardBy -shard-by 的列引用，shardField 为 checkHeader 按表头解析出的输出字段名
+	shardBy    string
+	shardField string
+	// logger 转换过程的日志，为 nil 时使用全局的 logger
+	logger log.FieldLogger
+}
+
+// key 返回列在输出中的字段名
+func (o convertOptions) key(col string) string {
+	if renamed, ok := o.renames[col]; ok {
+		return renamed
+	}
+	return transform.KeyCase(o.keyCase, col)
+}
+
+// converter 根据选项创建转换器
+func (o convertOptions) converter() *convert.Converter {
+	opts := []convert.Option{
+		convert.WithColumns(o.columns...),
+		convert.WithLimit(o.limit),
+		convert.WithSkip(o.skip),
+		convert.WithWorkers(o.workers),
+		convert.WithUnordered(o.unordered),
+		convert.WithErrorHandler(o.onError),
+		convert.WithPretty(o.pretty),
+		convert.WithASCIIOnly(o.asciiOnly),
+		convert.WithNested(o.nested),
+		convert.WithEmptyAsNull(o.emptyAsNull),
+		convert.WithOmitEmpty(o.omitEmpty),
+		convert.WithTrimSpace(o.trimSpace),
+		convert.WithStripControlChars(o.stripControl),
+		convert.WithStrictColumns(o.strictColumns),
+		convert.WithWarnLimit(o.warnLimit),
+		convert.WithHash(o.hash),
+		convert.WithDelimiter(o.delimiter),
+		convert.WithCaseInsensitiveColumns(o.foldCase),
+		convert.WithRenames(o.renames),
+		convert.WithKeyCase(o.keyCase),
+		convert.WithTypes(o.types),
+		convert.WithDateLayouts(o.dateLayouts...),
+		convert.WithDateOutput(o.dateOutput),
+		convert.WithTransforms(o.transforms),
+		convert.WithValueMaps(o.valueMaps),
+		convert.WithDefaults(o.defaults),
+		convert.WithDictionary(o.dictionary),
+		convert.WithWhereDate(o.whereDate),
+		convert.WithFilter(o.filter),
+	}
+	switch {
+	case o.schema != nil:
+		opts = append(opts, convert.WithValueParser(convert.SchemaParser(o.schema)))
+	case o.inferTypes:
+		opts = append(opts, convert.WithValueParser(convert.InferTypes))
+	}
+	if o.noHeader {
+		opts = append(opts, convert.WithNoHeader(o.header...))
+	}
+	if len(o.jsonColumns) > 0 {
+		opts = append(opts, convert.WithJSONColumns(o.jsonColumns...))
+	}
+	if o.flatten {
+		opts = append(opts, convert.WithFlatten(o.flattenPrefix))
+	}
+	if len(o.detectLang) > 0 {
+		opts = append(opts, convert.WithDetectLang(o.detectLang...))
+	}
+	if len(o.parseUA) > 0 {
+		opts = append(opts, convert.WithParseUserAgent(o.parseUA...))
+	}
+	if o.lineage != nil {
+		opts = append(opts, convert.WithLineage(o.lineage))
+	}
+	if o.position != "" {
+		opts = append(opts, convert.WithPositionField(o.position))
+	}
+	if o.rowNumber != "" {
+		opts = append(opts, convert.WithRowNumberField(o.rowNumber))
+	}
+	if len(o.meta) > 0 {
+		opts = append(opts, convert.WithMetaFields(o.meta))
+	}
+	if o.observe != nil {
+		opts = append(opts, convert.WithObserver(o.observe))
+	}
+	if o.kAnonymity != nil {
+		opts = append(opts, convert.WithKAnonymity(o.kAnonymity))
+	}
+	if o.template != nil {
+		opts = append(opts, convert.WithTemplate(o.template))
+	}
+	if o.protections != nil {
+		opts = append(opts, convert.WithProtections(o.protections))
+	}
+	if o.dedupe != nil {
+		opts = append(opts, convert.WithDedupe(*o.dedupe))
+	}
+	if o.assertSorted != nil {
+		opts = append(opts, convert.WithAssertSorted(*o.assertSorted))
+	}
+	if o.sample != nil {
+		opts = append(opts, convert.WithSample(*o.sample))
+	}
+	if o.onCheckpoint != nil {
+		opts = append(opts, convert.WithCheckpoint(o.checkpointRows, o.onCheckpoint))
+	}
+	if o.resume != nil {
+		opts = append(opts, convert.WithResume(*o.resume))
+	}
+	if o.logger != nil {
+		opts = append(opts, convert.WithLogger(o.logger))
+	}
+	return convert.NewConverter(opts...)
+}
+
+// rowErrorRecord 写入错误文件的一行
+type rowErrorRecord struct {
+	Line   int      `json:"line"`
+	Offset int64    `json:"offset"`
+	Error  string   `json:"error"`
+	Row    []string `json:"row,omitempty"`
+}
+
+// newErrorHandler 按 -on-error 策略创建错误处理：strict 返回 nil 即遇到错误停止，
+// skip 跳过错误行，collect 将错误行写入 w
+func newErrorHandler(policy string, w io.Writer) (convert.ErrorHandler, error) {
+	switch policy {
+	case "strict":
+		return nil, nil
+	case "skip":
+		return func(e *convert.RowError) error {
+			log.Debugf("skip malformed row: %v", e)
+			return nil
+		}, nil
+	case "collect":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return func(e *convert.RowError) error {
+			return enc.Encode(rowErrorRecord{Line: e.Line, Offset: e.Offset, Error: e.Err.Error(), Row: e.Row})
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown on-error policy %s", policy)
+}
+
+// writeLineage 返回将字段来源写入 path 的回调
+func writeLineage(path string) func(*convert.Lineage) error {
+	return func(l *convert.Lineage) error {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("write lineage failed: %v", err)
+		}
+		return nil
+	}
+}
+
+// dictionaryPreamble 返回写在输出开头的字典行，键为输出的列名
+func (o convertOptions) dictionaryPreamble() ([]byte, error) {
+	dict := map[string][]string{}
+	for col, values := range o.dictionary {
+		dict[o.key(col)] = values
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]interface{}{"$dictionary": dict}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkHeader 读取输入的表头，按表头检查选项的列引用、过滤表达式和转换等并解析 -shard-by，
+// 返回重新包含已读取数据的输入。读取表头出错时不检查，由转换报告错误
+func (o *convertOptions) checkHeader(in io.ReadCloser) (io.ReadCloser, error) {
+	var head bytes.Buffer
+	tee := io.TeeReader(in, &head)
+	var (
+		columns []string
+		err     error
+	)
+	if o.noHeader {
+		_, columns, err = source.NewHeaderlessCSVReader(tee, o.delimiter, o.header)
+	} else {
+		_, columns, err = source.NewCSVReader(tee, o.delimiter)
+	}
+	replayed := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&head, in), in}
+	if err != nil {
+		return replayed, nil
+	}
+	conv := o.converter()
+	if err := conv.CheckHeader(columns); err != nil {
+		return replayed, err
+	}
+	if o.shardBy != "" {
+		if o.shardField, err = conv.Field(columns, o.shardBy); err != nil {
+			return replayed, fmt.Errorf("shard-by: %v", err)
+		}
+	}
+	return replayed, nil
+}
+
+// openDecoded 打开字符集为 encoding 的输入文件，转换为 UTF-8 并替换多字符的分隔符
+func (o convertOptions) openDecoded(path, encoding string) (io.ReadCloser, error) {
+	in, err := openInput(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeInput(in, encoding)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return o.separate(decoded), nil
+}
+
+// setDelimiter 按 -delimiter 的写法设置分隔字段的字符：/.../ 为正则表达式，encoding/csv
+// 只支持单个字符的分隔符，正则表达式和多个字符的分隔符读取前替换为 source.SeparatorDelimiter
+func (o *convertOptions) setDelimiter(s string) error {
+	re, err := parseSeparatorRegexp(s)
+	if err != nil {
+		return fmt.Errorf("invalid delimiter %v", err)
+	}
+	if re != nil {
+		o.fieldRegexp, o.fieldSep, o.delimiter = re, "", source.SeparatorDelimiter
+		return nil
+	}
+	sep, err := parseSeparator(s)
+	if err != nil {
+		return fmt.Errorf("invalid delimiter %v", err)
+	}
+	if utf8.RuneCountInString(sep) > 1 {
+		o.fieldRegexp, o.fieldSep, o.delimiter = nil, sep, source.SeparatorDelimiter
+		return nil
+	}
+	delimiter, err := parseDelimiter(s)
+	if err != nil {
+		return err
+	}
+	o.fieldRegexp, o.fieldSep, o.delimiter = nil, "", delimiter
+	return nil
+}
+
+// separate 指定了多字符或正则表达式的字段分隔符或记录分隔符时，将输入中的分隔符替换为
+// source.SeparatorDelimiter 和换行
+func (o convertOptions) separate(in io.ReadCloser) io.ReadCloser {
+	if o.fieldSep == "" && o.recordSep == "" && o.fieldRegexp == nil && o.recordRegexp == nil {
+		return in
+	}
+	dialect := source.Dialect{
+		Delimiter:    o.delimiter,
+		Field:        o.fieldSep,
+		Record:       o.recordSep,
+		FieldRegexp:  o.fieldRegexp,
+		RecordRegexp: o.recordRegexp,
+	}
+	return decodedReader{Reader: source.NewDialectReader(in, dialect), Closer: in}
+}
+
+// buildDictionary 读取字符集为 encoding 的输入文件，统计各列重复的值
+func (o convertOptions) buildDictionary(path, encoding string, columns []string) (convert.Dictionary, error) {
+	in, err := o.openDecoded(path, encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return convert.BuildDictionary(in, o.delimiter, columns)
+}
+
+// buildKAnonymity 读取字符集为 encoding 的输入文件，按转换的选项统计少于 k 行共有的准标识符组合
+func (o convertOptions) buildKAnonymity(path, encoding string, columns []string, k int) (*convert.KAnonymity, error) {
+	in, err := o.openDecoded(path, encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return o.converter().BuildKAnonymity(in, columns, k)
+}
+
+// inferSchema 读取字符集为 encoding 的整个输入文件推断各列的类型
+func (o convertOptions) inferSchema(path, encoding string, opts convert.InferOptions) (*convert.Schema, error) {
+	in, err := o.openDecoded(path, encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return convert.InferSchema(in, o.delimiter, opts)
+}
+
+// sampleSchema 读取输入的前 opts.Sample 行推断各列的类型，返回的 io.ReadCloser 从头重新读取输入
+func sampleSchema(in io.ReadCloser, delimiter rune, opts convert.InferOptions) (*convert.Schema, io.ReadCloser, error) {
+	var sampled bytes.Buffer
+	schema, err := convert.InferSchema(io.TeeReader(in, &sampled), delimiter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema, decodedReader{Reader: io.MultiReader(&sampled, in), Closer: in}, nil
+}
+
+// logSchema 输出推断的各列类型及依据
+func logSchema(schema *convert.Schema, inference string, logger log.FieldLogger) {
+	logger.Infof("%s: inferred types from %d rows", inference, schema.Rows)
+	for _, col := range schema.Columns {
+		logger.Infof("%s: column %s is %s (confidence %.2f), nullable %v, max length %d", inference, col.Name, col.Type, col.Confidence, col.Nullable, col.MaxLength)
+	}
+}
@@ -0,0 +1,392 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// isObjectURL 判断路径是否为对象存储的地址：s3://bucket/key、gs://bucket/object
+// 或 az://account/container/blob
+func isObjectURL(path string) bool {
+	scheme, _, ok := strings.Cut(path, "://")
+	if !ok {
+		return false
+	}
+	switch scheme {
+	case "s3", "gs", "az":
+		return true
+	}
+	return false
+}
+
+// createOutput 创建输出文件，对象存储的地址分段上传
+func createOutput(path string) (io.WriteCloser, error) {
+	if isObjectURL(path) {
+		return newObjectWriter(path)
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+}
+
+// aborter 可以放弃的输出，例如取消未完成的分段上传，以免留下不完整的对象
+type aborter interface {
+	Abort()
+}
+
+// lazyFile 第一次写入或调用 create 时才创建的文件
+type lazyFile struct {
+	path string
+	f    *os.File
+}
+
+func (l *lazyFile) create() error {
+	if l.f != nil {
+		return nil
+	}
+	f, err := os.Create(l.path)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+func (l *lazyFile) Write(p []byte) (int, error) {
+	if err := l.create(); err != nil {
+		return 0, err
+	}
+	return l.f.Write(p)
+}
+
+func (l *lazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// partInfo 记录一个输出文件的信息
+type partInfo struct {
+	Path     string `json:"path"`
+	FirstRow int    `json:"first_row"`
+	LastRow  int    `json:"last_row"`
+	Bytes    int64  `json:"bytes"`
+	SHA256   string `json:"sha256"`
+}
+
+// outputIndex 输出文件索引
+type outputIndex struct {
+	Rows  int        `json:"rows"`
+	Parts []partInfo `json:"parts"`
+	// Deprecations 转换使用的废弃参数
+	Deprecations []deprecation `json:"deprecations,omitempty"`
+}
+
+// outputPart 正在写入的输出文件，以 .gz 或 .zst 结尾时使用 gzip 或 zstd 压缩
+type outputPart struct {
+	info  partInfo
+	file  io.WriteCloser
+	comp  io.WriteCloser
+	w     io.Writer
+	hash  hash.Hash
+	count *countingWriter
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// 输出压缩格式及其扩展名
+var outputCompressions = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// newCompressor 按扩展名 .gz 或 .zst 创建压缩器，其他扩展名返回 nil
+func newCompressor(w io.Writer, ext string, zstdDict []byte) (io.WriteCloser, error) {
+	switch ext {
+	case ".gz":
+		return gzip.NewWriter(w), nil
+	case ".zst":
+		var opts []zstd.EOption
+		if zstdDict != nil {
+			opts = append(opts, zstd.WithEncoderDict(zstdDict))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+	return nil, nil
+}
+
+func openPart(path string, firstRow int, zstdDict []byte) (*outputPart, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &outputPart{
+		info:  partInfo{Path: path, FirstRow: firstRow},
+		file:  f,
+		hash:  sha256.New(),
+		count: &countingWriter{},
+	}
+	// 索引记录落盘的字节数和校验和，即压缩后的数据
+	p.w = io.MultiWriter(f, p.hash, p.count)
+	if p.comp, err = newCompressor(p.w, filepath.Ext(path), zstdDict); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if p.comp != nil {
+		p.w = p.comp
+	}
+	return p, nil
+}
+
+func (p *outputPart) Close() error {
+	if p.comp != nil {
+		if err := p.comp.Close(); err != nil {
+			p.file.Close()
+			return err
+		}
+	}
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	p.info.Bytes = p.count.n
+	p.info.SHA256 = hex.EncodeToString(p.hash.Sum(nil))
+	return nil
+}
+
+// abort 放弃对象存储的分段上传，返回 false 表示输出是本地文件，不能放弃
+func (p *outputPart) abort() bool {
+	a, ok := p.file.(aborter)
+	if ok {
+		a.Abort()
+	}
+	return ok
+}
+
+// splitWriter 将输出写入文件，splitRows 大于 0 时按行数、splitSize 大于 0 时
+// 按大小、chunker 不为空时按内容切分为 output-0001.jsonl、output-0002.jsonl ...
+type splitWriter struct {
+	path      string
+	splitRows int
+	// splitSize 每个分片压缩前的最大字节数，单条记录超过时单独成为一个分片
+	splitSize int64
+	size      int64 // 当前分片压缩前的字节数
+	// recordStart 下一次 Write 是一条新记录的开始
+	recordStart bool
+	chunker     *cdcChunker
+	rows        int
+	current     *outputPart
+	parts       []partInfo
+	// zstdDict 压缩 .zst 分片使用的字典
+	zstdDict []byte
+	// preamble 写在每个分片开头，例如 -dictionary-encode 的字典
+	preamble []byte
+	// aborted 转换失败后放弃了上传的分片
+	aborted bool
+}
+
+func newSplitWriter(path string, splitRows int) *splitWriter {
+	return &splitWriter{path: path, splitRows: splitRows}
+}
+
+// partPath 返回第 n 个分片的文件名，扩展名（包括 .gz、.zst）保留在序号之后
+func (s *splitWriter) partPath(n int) string {
+	if s.splitRows <= 0 && s.splitSize <= 0 && s.chunker == nil {
+		return s.path
+	}
+	base, ext := splitExt(s.path)
+	return fmt.Sprintf("%s-%04d%s", base, n, ext)
+}
+
+// splitExt 将路径拆分为文件名和扩展名，扩展名包括 .gz、.zst 压缩后缀
+func splitExt(path string) (base, ext string) {
+	for _, suffix := range []string{".gz", ".zst"} {
+		if strings.HasSuffix(path, suffix) {
+			ext = suffix
+			path = strings.TrimSuffix(path, ext)
+		}
+	}
+	ext = filepath.Ext(path) + ext
+	return path[:len(path)-len(filepath.Ext(path))], ext
+}
+
+func (s *splitWriter) openNext() error {
+	p, err := openPart(s.partPath(len(s.parts)+1), s.rows+1, s.zstdDict)
+	if err != nil {
+		return err
+	}
+	s.current = p
+	s.size = int64(len(s.preamble))
+	if len(s.preamble) > 0 {
+		if _, err := p.w.Write(s.preamble); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BeginRecord 在写入一条记录前调用，当前分片写满时切换到新的分片
+func (s *splitWriter) BeginRecord() error {
+	if s.current != nil && s.full() {
+		if err := s.closePart(); err != nil {
+			return err
+		}
+	}
+	if s.current == nil {
+		if err := s.openNext(); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	s.recordStart = true
+	return nil
+}
+
+// full 判断当前分片是否需要切换
+func (s *splitWriter) full() bool {
+	if s.splitRows > 0 && s.rows-s.current.info.FirstRow+1 >= s.splitRows {
+		return true
+	}
+	return s.chunker != nil && s.chunker.shouldCut()
+}
+
+func (s *splitWriter) Write(p []byte) (int, error) {
+	if s.current == nil {
+		if err := s.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	if s.recordStart {
+		s.recordStart = false
+		// 写入整条记录前判断是否超过大小，超过时从这条记录开始新的分片
+		if s.splitSize > 0 && s.rows > s.current.info.FirstRow && s.size+int64(len(p)) > s.splitSize {
+			s.rows--
+			if err := s.closePart(); err != nil {
+				return 0, err
+			}
+			if err := s.openNext(); err != nil {
+				return 0, err
+			}
+			s.rows++
+		}
+	}
+	if s.chunker != nil {
+		s.chunker.write(p)
+	}
+	s.size += int64(len(p))
+	return s.current.w.Write(p)
+}
+
+func (s *splitWriter) closePart() error {
+	if s.current == nil {
+		return nil
+	}
+	s.current.info.LastRow = s.rows
+	if err := s.current.Close(); err != nil {
+		return err
+	}
+	s.parts = append(s.parts, s.current.info)
+	s.current = nil
+	if s.chunker != nil {
+		s.chunker.reset()
+	}
+	return nil
+}
+
+// Flush 刷新当前分片压缩器的缓冲，使已写出的记录可以从文件中读取
+func (s *splitWriter) Flush() error {
+	if s.current == nil || s.current.comp == nil {
+		return nil
+	}
+	if f, ok := s.current.comp.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Abort 在转换失败时放弃正在上传到对象存储的分片，本地文件照常保留
+func (s *splitWriter) Abort() {
+	if s.current != nil && s.current.abort() {
+		s.current, s.aborted = nil, true
+	}
+}
+
+// Close 关闭当前分片，没有任何记录时也会创建一个空文件
+func (s *splitWriter) Close() error {
+	if s.aborted {
+		return nil
+	}
+	if s.current == nil && len(s.parts) == 0 {
+		if err := s.openNext(); err != nil {
+			return err
+		}
+	}
+	return s.closePart()
+}
+
+// writeIndex 写入各分片的路径、行范围、大小和校验和，以及转换使用的废弃参数，
+// 路径相对于索引文件所在的目录
+func (s *splitWriter) writeIndex(path string, deprecated []deprecation) error {
+	parts := make([]partInfo, len(s.parts))
+	for i, part := range s.parts {
+		parts[i] = part
+		parts[i].Path = indexedPath(path, part.Path)
+	}
+	data, err := json.MarshalIndent(outputIndex{Rows: s.rows, Parts: parts, Deprecations: deprecated}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// indexedPath 返回输出文件相对于索引文件所在目录的路径，下游从索引所在的目录或其他
+// 工作目录读取时都能找到；无法计算相对路径时保留原路径
+func indexedPath(index, path string) string {
+	if isObjectURL(path) {
+		return path
+	}
+	dir, err := filepath.Abs(filepath.Dir(index))
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitGzipIndex(t *testing.T) {
+	dir := t.TempDir()
+	var want bytes.Buffer
+	if code := Run([]string{"-log-level", "error", "-i", filepath.Join("testdata", "people.csv")}, nil, &want, io.Discard); code != 0 {
+		t.Fatalf("convert to stdout: exit code %d", code)
+	}
+
+	args := []string{"-log-level", "error", "-i", filepath.Join("testdata", "people.csv"), "-o", filepath.Join(dir, "people.jsonl.gz"), "-split-rows", "2", "-index", filepath.Join(dir, "index.json")}
+	if code := Run(args, nil, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("%v: exit code %d", args, code)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index outputIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Rows != 5 || len(index.Parts) != 3 {
+		t.Fatalf("index has %d rows in %d parts, want 5 rows in 3 parts", index.Rows, len(index.Parts))
+	}
+
+	// 每个分段单独压缩，索引记录的是压缩后文件的大小和校验和
+	var got []byte
+	for i, part := range index.Parts {
+		want := []partInfo{
+			{Path: "people-0001.jsonl.gz", FirstRow: 1, LastRow: 2},
+			{Path: "people-0002.jsonl.gz", FirstRow: 3, LastRow: 4},
+			{Path: "people-0003.jsonl.gz", FirstRow: 5, LastRow: 5},
+		}[i]
+		if part.Path != want.Path || part.FirstRow != want.FirstRow || part.LastRow != want.LastRow {
+			t.Errorf("part %d is %s with rows %d-%d, want %s with rows %d-%d", i+1, part.Path, part.FirstRow, part.LastRow, want.Path, want.FirstRow, want.LastRow)
+		}
+		// 索引中的路径相对于索引文件所在的目录
+		data, err := os.ReadFile(filepath.Join(dir, part.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if part.Bytes != int64(len(data)) || part.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("part %d: index records %d bytes and sha256 %s, the file has %d bytes", i+1, part.Bytes, part.SHA256, len(data))
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("part %d is not gzip compressed: %v", i+1, err)
+		}
+		zr.Multistream(false)
+		records, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, records...)
+	}
+	if string(got) != want.String() {
+		t.Errorf("parts contain\n%s\nwant\n%s", got, want.String())
+	}
+}
+
+func TestIndexedPath(t *testing.T) {
+	for _, tt := range []struct {
+		index, path, want string
+	}{
+		{"index.json", "out-0001.jsonl", "out-0001.jsonl"},
+		{"/data/index.json", "/data/out-0001.jsonl", "out-0001.jsonl"},
+		{"/data/index.json", "/data/parts/out-0001.jsonl", "parts/out-0001.jsonl"},
+		{"/data/meta/index.json", "/data/out-0001.jsonl", "../out-0001.jsonl"},
+		{"meta/index.json", "out-0001.jsonl", "../out-0001.jsonl"},
+		{"/data/index.json", "s3://bucket/out-0001.jsonl", "s3://bucket/out-0001.jsonl"},
+	} {
+		if got := indexedPath(tt.index, tt.path); got != tt.want {
+			t.Errorf("indexedPath(%q, %q) = %q, want %q", tt.index, tt.path, got, tt.want)
+		}
+	}
+}
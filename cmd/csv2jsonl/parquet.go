@@ -0,0 +1,622 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// parquetMagic Parquet 文件开头和结尾的标记
+const parquetMagic = "PAR1"
+
+// Parquet 的物理类型
+const (
+	parquetBoolean   int32 = 0
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet 的 ConvertedType，标记 BYTE_ARRAY 的内容
+const (
+	parquetUTF8 int32 = 0
+	parquetJSON int32 = 19
+)
+
+// Parquet 的编码
+const (
+	parquetPlain int32 = 0
+	parquetRLE   int32 = 3
+)
+
+// parquetCodecs -parquet-compression 的压缩格式
+var parquetCodecs = map[string]int32{
+	"none":   0,
+	"snappy": 1,
+	"gzip":   2,
+	"zstd":   6,
+}
+
+// parquetTypes 转换器的列类型对应的物理类型，其他类型写为 UTF8 字符串
+var parquetTypes = map[string]int32{
+	convert.TypeInt:   parquetInt64,
+	convert.TypeFloat: parquetDouble,
+	convert.TypeBool:  parquetBoolean,
+}
+
+// parquetColumn 输出的一列，所有列都是 OPTIONAL，null 的定义级别为 0
+type parquetColumn struct {
+	name  string
+	field string
+	// typ 物理类型，-1 表示由第一个行组的值推断
+	typ  int32
+	json bool
+}
+
+// parquetChunk 已写出的一个列块
+type parquetChunk struct {
+	offset       int64
+	values       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	size   int64
+	chunks []parquetChunk
+}
+
+// parquetWriter 将转换器写出的 JSON 记录按列缓存，每 rowGroupRows 行写出一个行组，
+// Close 时写出文件尾的元数据。列的类型来自 -schema、-two-pass 等确定的类型，
+// 其他列按第一个行组的值推断
+type parquetWriter struct {
+	w            io.Writer
+	codec        int32
+	rowGroupRows int
+	nested       bool
+	columns      []*parquetColumn
+	rows         [][]interface{}
+	// offset 已写出的字节数
+	offset    int64
+	rowGroups []parquetRowGroup
+	zstd      *zstd.Encoder
+}
+
+func newParquetWriter(codec string, rowGroupRows int, nested bool) (*parquetWriter, error) {
+	p := &parquetWriter{codec: parquetCodecs[codec], rowGroupRows: rowGroupRows, nested: nested}
+	if codec == "zstd" {
+		var err error
+		if p.zstd, err = zstd.NewWriter(nil); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// onLineage 按输出字段的顺序确定列及明确指定了类型的列的类型，之后调用 next
+func (p *parquetWriter) onLineage(opts *convertOptions, next func(*convert.Lineage) error) func(*convert.Lineage) error {
+	return func(l *convert.Lineage) error {
+		columns := make([]*parquetColumn, 0, len(l.Fields))
+		for _, f := range l.Fields {
+			col := &parquetColumn{name: f.Field, field: f.Field, typ: -1}
+			if col.name == "$" {
+				col.name = opts.key(f.Sources[0])
+			}
+			col.typ, col.json = parquetLineageType(opts, f)
+			columns = append(columns, col)
+		}
+		if len(p.rowGroups) > 0 && !sameParquetColumns(p.columns, columns) {
+			return fmt.Errorf("parquet: the columns of the input changed after row groups were written")
+		}
+		p.columns = columns
+		if next != nil {
+			return next(l)
+		}
+		return nil
+	}
+}
+
+// parquetLineageType 返回字段明确的类型，查找表改写的值和字典序号不一定符合列的类型，
+// 按值推断
+func parquetLineageType(opts *convertOptions, f convert.FieldLineage) (int32, bool) {
+	typ := ""
+	for _, step := range f.Steps {
+		switch {
+		case step == "map" || step == "dictionary" || strings.HasPrefix(step, "protect:"):
+			return -1, false
+		case strings.HasPrefix(step, "type:"):
+			typ = strings.TrimPrefix(step, "type:")
+		case step == "parse" && opts.schema != nil:
+			for _, col := range opts.schema.Columns {
+				if col.Name == f.Sources[0] {
+					typ = col.Type
+				}
+			}
+		}
+	}
+	switch typ {
+	case "":
+		return -1, false
+	case convert.TypeJSON:
+		return parquetByteArray, true
+	}
+	if t, ok := parquetTypes[typ]; ok {
+		return t, false
+	}
+	return parquetByteArray, false
+}
+
+func sameParquetColumns(a, b []*parquetColumn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || a[i].field != b[i].field {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parquetWriter) wrap(w io.Writer) io.Writer {
+	p.w = w
+	return p
+}
+
+// Write 接收一条 JSON 记录，凑满一个行组时写出
+func (p *parquetWriter) Write(b []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var record interface{}
+	if err := dec.Decode(&record); err != nil {
+		return 0, fmt.Errorf("parquet: decode record failed: %v", err)
+	}
+	if p.columns == nil {
+		// 模板渲染的记录没有字段来源，按第一条记录的字段确定列
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("parquet: records must be objects")
+		}
+		fields := make([]string, 0, len(m))
+		for key := range m {
+			fields = append(fields, key)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			p.columns = append(p.columns, &parquetColumn{name: field, field: field, typ: -1})
+		}
+	}
+
+	row := make([]interface{}, len(p.columns))
+	for i, col := range p.columns {
+		v, ok := record, true
+		if col.field != "$" {
+			v, ok = lookupField(record, col.field, p.nested)
+		}
+		if ok {
+			row[i] = v
+		}
+	}
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= p.rowGroupRows {
+		if err := p.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// write 写出数据并记录偏移量
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// flush 写出缓存的行组成的行组，第一个行组确定未指定类型的列的类型
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	rg := parquetRowGroup{rows: int64(len(p.rows))}
+	for i, col := range p.columns {
+		if col.typ < 0 {
+			col.typ, col.json = inferParquetType(p.rows, i)
+		}
+		chunk, err := p.writeChunk(col, i)
+		if err != nil {
+			return err
+		}
+		rg.size += chunk.uncompressed
+		rg.chunks = append(rg.chunks, chunk)
+	}
+	p.rowGroups = append(p.rowGroups, rg)
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// inferParquetType 按第 i 列的值推断类型：都是整数时为 INT64，都是数字时为 DOUBLE，
+// 都是布尔值时为 BOOLEAN，都是对象或数组时为 JSON，其他为 UTF8 字符串。
+// 空字符串不影响推断，在非字符串和 JSON 的列中写为 null
+func inferParquetType(rows [][]interface{}, i int) (int32, bool) {
+	ints, floats, bools, objects, total := 0, 0, 0, 0, 0
+	for _, row := range rows {
+		switch v := row[i].(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				ints++
+			}
+			floats++
+		case bool:
+			bools++
+		case map[string]interface{}, []interface{}:
+			objects++
+		}
+		total++
+	}
+	switch {
+	case total == 0:
+		return parquetByteArray, false
+	case ints == total:
+		return parquetInt64, false
+	case floats == total:
+		return parquetDouble, false
+	case bools == total:
+		return parquetBoolean, false
+	case objects == total:
+		return parquetByteArray, true
+	}
+	return parquetByteArray, false
+}
+
+// writeChunk 将第 i 列的值写为一个 PLAIN 编码的数据页
+func (p *parquetWriter) writeChunk(col *parquetColumn, i int) (parquetChunk, error) {
+	var values bytes.Buffer
+	defs := make([]byte, len(p.rows))
+	var bits []bool
+	for r, row := range p.rows {
+		v := row[i]
+		if v == nil || v == "" && (col.typ != parquetByteArray || col.json) {
+			continue
+		}
+		defs[r] = 1
+		if err := encodeParquetValue(&values, col, v, &bits); err != nil {
+			return parquetChunk{}, err
+		}
+	}
+	if col.typ == parquetBoolean {
+		values.Write(packBits(bits))
+	}
+
+	levels := encodeRLE(defs)
+	page := make([]byte, 4, 4+len(levels)+values.Len())
+	binary.LittleEndian.PutUint32(page, uint32(len(levels)))
+	page = append(append(page, levels...), values.Bytes()...)
+	compressed, err := p.compress(page)
+	if err != nil {
+		return parquetChunk{}, err
+	}
+
+	var h thriftWriter
+	h.structBody(func() {
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(compressed)))
+		h.structField(5, func() {
+			h.i32(1, int32(len(p.rows)))
+			h.i32(2, parquetPlain)
+			h.i32(3, parquetRLE)
+			h.i32(4, parquetRLE)
+		})
+	})
+	chunk := parquetChunk{
+		offset:       p.offset,
+		values:       int64(len(p.rows)),
+		uncompressed: int64(h.b.Len() + len(page)),
+		compressed:   int64(h.b.Len() + len(compressed)),
+	}
+	if err := p.write(h.b.Bytes()); err != nil {
+		return chunk, err
+	}
+	return chunk, p.write(compressed)
+}
+
+// encodeParquetValue 按 PLAIN 编码写出一个非空的值，布尔值收集到 bits 中按位写出
+func encodeParquetValue(buf *bytes.Buffer, col *parquetColumn, v interface{}, bits *[]bool) error {
+	mismatch := func() error {
+		return fmt.Errorf("parquet: field %s has the value %v not matching its column type %s, specify the type with -schema or infer it from more rows with -two-pass or a larger -parquet-row-group", col.name, v, parquetTypeName(col.typ))
+	}
+	switch col.typ {
+	case parquetInt64:
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return mismatch()
+		}
+		return binary.Write(buf, binary.LittleEndian, i)
+	case parquetDouble:
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return mismatch()
+		}
+		return binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+	case parquetBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		*bits = append(*bits, b)
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok || col.json {
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		s = strings.TrimSuffix(b.String(), "\n")
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+	return nil
+}
+
+func parquetTypeName(typ int32) string {
+	switch typ {
+	case parquetBoolean:
+		return "boolean"
+	case parquetInt64:
+		return "int64"
+	case parquetDouble:
+		return "double"
+	}
+	return "byte_array"
+}
+
+// packBits 将布尔值按位打包，低位在前
+func packBits(bits []bool) []byte {
+	b := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// encodeRLE 将位宽为 1 的定义级别编码为 RLE/bit-packing 混合编码中的 RLE 段
+func encodeRLE(levels []byte) []byte {
+	var b []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		b = append(b, levels[i])
+		i = j
+	}
+	return b
+}
+
+// compress 按列块的压缩格式压缩一个数据页
+func (p *parquetWriter) compress(page []byte) ([]byte, error) {
+	switch p.codec {
+	case parquetCodecs["snappy"]:
+		return s2.EncodeSnappy(nil, page), nil
+	case parquetCodecs["gzip"]:
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(page); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case parquetCodecs["zstd"]:
+		return p.zstd.EncodeAll(page, nil), nil
+	}
+	return page, nil
+}
+
+// Close 写出剩余的行组和文件尾的元数据
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	var rows int64
+	for _, rg := range p.rowGroups {
+		rows += rg.rows
+	}
+
+	var m thriftWriter
+	m.structBody(func() {
+		m.i32(1, 1)
+		m.listHeader(2, thriftStruct, len(p.columns)+1)
+		m.structBody(func() {
+			m.binary(4, "schema")
+			m.i32(5, int32(len(p.columns)))
+		})
+		for _, col := range p.columns {
+			col := col
+			if col.typ < 0 {
+				// 没有任何行时的列
+				col.typ = parquetByteArray
+			}
+			m.structBody(func() {
+				m.i32(1, col.typ)
+				m.i32(3, 1) // OPTIONAL
+				m.binary(4, col.name)
+				switch {
+				case col.json:
+					m.i32(6, parquetJSON)
+				case col.typ == parquetByteArray:
+					m.i32(6, parquetUTF8)
+				}
+			})
+		}
+		m.i64(3, rows)
+		m.listHeader(4, thriftStruct, len(p.rowGroups))
+		for _, rg := range p.rowGroups {
+			rg := rg
+			m.structBody(func() {
+				m.listHeader(1, thriftStruct, len(rg.chunks))
+				for i, chunk := range rg.chunks {
+					col, chunk := p.columns[i], chunk
+					m.structBody(func() {
+						m.i64(2, chunk.offset)
+						m.structField(3, func() {
+							m.i32(1, col.typ)
+							m.listHeader(2, thriftI32, 2)
+							m.varint(int64(parquetPlain))
+							m.varint(int64(parquetRLE))
+							m.listHeader(3, thriftBinary, 1)
+							m.uvarint(uint64(len(col.name)))
+							m.b.WriteString(col.name)
+							m.i32(4, p.codec)
+							m.i64(5, chunk.values)
+							m.i64(6, chunk.uncompressed)
+							m.i64(7, chunk.compressed)
+							m.i64(9, chunk.offset)
+						})
+					})
+				}
+				m.i64(2, rg.size)
+				m.i64(3, rg.rows)
+			})
+		}
+		m.binary(6, "csv2jsonl")
+	})
+	footer := m.b.Bytes()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return p.write(append(footer, parquetMagic...))
+}
+
+// thrift compact 协议中字段的类型
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter 按 thrift compact 协议编码 Parquet 的元数据
+type thriftWriter struct {
+	b bytes.Buffer
+	// last 当前结构体中上一个字段的编号
+	last int16
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	t.b.Write(binary.AppendUvarint(nil, v))
+}
+
+// varint 以 zigzag 编码写出有符号整数
+func (t *thriftWriter) varint(v int64) {
+	t.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// header 写出字段头，编号与上一个字段相差 1 到 15 时与类型合并为一个字节
+func (t *thriftWriter) header(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.b.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.b.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.header(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.header(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.header(id, thriftBinary)
+	t.uvarint(uint64(len(s)))
+	t.b.WriteString(s)
+}
+
+// listHeader 写出列表字段的头，之后依次写出 n 个元素
+func (t *thriftWriter) listHeader(id int16, elem byte, n int) {
+	t.header(id, thriftList)
+	if n < 15 {
+		t.b.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.b.WriteByte(0xf0 | elem)
+	t.uvarint(uint64(n))
+}
+
+func (t *thriftWriter) structField(id int16, body func()) {
+	t.header(id, thriftStruct)
+	t.structBody(body)
+}
+
+// structBody 写出结构体的字段和结束标记，字段编号从 0 开始计算
+func (t *thriftWriter) structBody(body func()) {
+	last := t.last
+	t.last = 0
+	body()
+	t.b.WriteByte(0)
+	t.last = last
+}
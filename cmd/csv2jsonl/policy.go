@@ -0,0 +1,175 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPolicyKeyEnv 默认保存加密密钥的环境变量
+const defaultPolicyKeyEnv = "CSV2JSONL_POLICY_KEY"
+
+// policy 各数据分类的保护方式，如
+//
+//	classifications:
+//	  PII: mask
+//	  confidential: encrypt
+//	key_env: CSV2JSONL_POLICY_KEY
+type policy struct {
+	Classifications map[string]string `yaml:"classifications"`
+	// KeyEnv 保存 encrypt 所用的十六进制 AES 密钥的环境变量
+	KeyEnv string `yaml:"key_env"`
+}
+
+// parseClassify 解析形如 email=PII,salary=confidential 的列分类
+func parseClassify(spec string) (map[string]string, error) {
+	classes := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		col, class, ok := strings.Cut(item, "=")
+		if !ok || col == "" || class == "" {
+			return nil, fmt.Errorf("invalid classification %q, expected column=classification", item)
+		}
+		classes[col] = class
+	}
+	return classes, nil
+}
+
+// loadPolicy 读取并检查策略文件
+func loadPolicy(path string) (*policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy %s failed: %v", path, err)
+	}
+	for class, action := range p.Classifications {
+		if !convert.IsValidProtection(action) {
+			return nil, fmt.Errorf("policy %s: unknown action %s of classification %s, expected mask, encrypt, drop or hash", path, action, class)
+		}
+	}
+	if p.KeyEnv == "" {
+		p.KeyEnv = defaultPolicyKeyEnv
+	}
+	return &p, nil
+}
+
+// protections 返回分类的列的保护方式，分类没有对应的保护方式时报错，
+// 以免敏感的列不受保护地写出
+func (p *policy) protections(classes map[string]string) (map[string]convert.Protection, error) {
+	cols := make([]string, 0, len(classes))
+	for col := range classes {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	var key []byte
+	protections := map[string]convert.Protection{}
+	for _, col := range cols {
+		class := classes[col]
+		action, ok := p.Classifications[class]
+		if !ok {
+			return nil, fmt.Errorf("column %s is classified %s, which has no action in the policy, it would be written unprotected", col, class)
+		}
+		protection := convert.Protection{Action: action}
+		if action == convert.ProtectEncrypt {
+			if key == nil {
+				var err error
+				if key, err = p.key(); err != nil {
+					return nil, err
+				}
+			}
+			protection.Key = key
+		}
+		protections[col] = protection
+	}
+	return protections, nil
+}
+
+// key 读取环境变量中的加密密钥
+func (p *policy) key() ([]byte, error) {
+	value := os.Getenv(p.KeyEnv)
+	if value == "" {
+		return nil, fmt.Errorf("encrypt requires a hex encoded AES key in $%s", p.KeyEnv)
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+		return nil, fmt.Errorf("$%s must be a hex encoded AES key of 16, 24 or 32 bytes", p.KeyEnv)
+	}
+	return key, nil
+}
+
+// parseMask 解析 -mask 的逗号分隔的列，各列按 mask 保护
+func parseMask(spec string) (map[string]convert.Protection, error) {
+	protections := map[string]convert.Protection{}
+	for _, col := range strings.Split(spec, ",") {
+		if col == "" {
+			return nil, fmt.Errorf("invalid -mask %q, expected comma separated columns", spec)
+		}
+		protections[col] = convert.Protection{Action: convert.ProtectMask}
+	}
+	return protections, nil
+}
+
+// parseHashColumns 解析形如 ssn[:sha256[:salt]] 的 -hash-column，省略或留空算法时使用 -hash 的算法，盐可以包含冒号
+func parseHashColumns(items []string, hash string) (map[string]convert.Protection, error) {
+	protections := map[string]convert.Protection{}
+	for _, item := range items {
+		parts := strings.SplitN(item, ":", 3)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("invalid -hash-column %q, expected column[:algorithm[:salt]]", item)
+		}
+		alg := hash
+		if len(parts) > 1 && parts[1] != "" {
+			alg = parts[1]
+		}
+		if !transform.IsValidHash(alg) {
+			return nil, fmt.Errorf("invalid -hash-column %q: unknown hash algorithm %s, expected fnv, xxh3, sha256 or murmur3", item, alg)
+		}
+		if _, ok := protections[parts[0]]; ok {
+			return nil, fmt.Errorf("column %s is given to -hash-column more than once", parts[0])
+		}
+		protection := convert.Protection{Action: convert.ProtectHash, Hash: alg}
+		if len(parts) == 3 {
+			protection.Salt = []byte(parts[2])
+		}
+		protections[parts[0]] = protection
+	}
+	return protections, nil
+}
+
+// mergeProtections 合并各选项指定的保护方式，同一列只能以一种方式保护
+func mergeProtections(dst, src map[string]convert.Protection) (map[string]convert.Protection, error) {
+	if dst == nil {
+		dst = map[string]convert.Protection{}
+	}
+	for col, p := range src {
+		if _, ok := dst[col]; ok {
+			return nil, fmt.Errorf("column %s is protected more than once by -classify, -mask or -hash-column", col)
+		}
+		dst[col] = p
+	}
+	return dst, nil
+}
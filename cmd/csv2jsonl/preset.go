@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+)
+
+//go:embed presets/*.json
+var bundledPresets embed.FS
+
+// preset 一种经常处理的供应商文件的转换选项
+type preset struct {
+	Delimiter  string              `json:"delimiter,omitempty"`
+	Columns    []string            `json:"columns,omitempty"`
+	Renames    map[string]string   `json:"renames,omitempty"`
+	Types      map[string]string   `json:"types,omitempty"`
+	Transforms map[string][]string `json:"transforms,omitempty"`
+	// Maps 替换列中的编码值，如 {"status": {"0": "inactive"}}
+	Maps map[string]map[string]string `json:"maps,omitempty"`
+	// Semantics 契约中各列的语义说明，如 "email" 或 "ISO 3166-1 alpha-2 country code"
+	Semantics map[string]string `json:"semantics,omitempty"`
+	// KeyCase 没有重命名的列的键的格式，如表头大小写不固定的供应商使用 snake
+	KeyCase string `json:"key_case,omitempty"`
+}
+
+// presetDir 返回用户自定义的预设所在的目录
+func presetDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "csv2jsonl", "presets"), nil
+}
+
+// validPresetName 判断 name 是否为预设目录中的预设，含有路径分隔符或 .. 的名称可能读取其他文件
+func validPresetName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
+// loadPreset 按名称查找预设，用户自定义的预设优先于内置的预设
+func loadPreset(name string) (*preset, error) {
+	if !validPresetName(name) {
+		return nil, fmt.Errorf("invalid preset name %q, expected a name such as salesforce-contacts", name)
+	}
+	var data []byte
+
+	if dir, err := presetDir(); err == nil {
+		data, err = os.ReadFile(filepath.Join(dir, name+".json"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if data == nil {
+		var err error
+		data, err = bundledPresets.ReadFile("presets/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("preset %s not found", name)
+		}
+	}
+
+	var p preset
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse preset %s failed: %v", name, err)
+	}
+	if p.Delimiter != "" {
+		// 同 -delimiter，可以是多个字符或正则表达式
+		if err := new(convertOptions).setDelimiter(p.Delimiter); err != nil {
+			return nil, fmt.Errorf("preset %s: %v", name, err)
+		}
+	}
+	if p.KeyCase != "" && !transform.IsValidKeyCase(p.KeyCase) {
+		return nil, fmt.Errorf("preset %s: unknown key case %s", name, p.KeyCase)
+	}
+	for col, typ := range p.Types {
+		if !convert.IsValidType(typ) {
+			return nil, fmt.Errorf("preset %s: unknown type %s of column %s", name, typ, col)
+		}
+	}
+	for col, transforms := range p.Transforms {
+		for _, t := range transforms {
+			if !transform.IsValid(t) {
+				return nil, fmt.Errorf("preset %s: unknown transform %s of column %s", name, t, col)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// apply 将预设合并到选项中，命令行指定的选项优先
+func (p *preset) apply(opts *convertOptions) {
+	if opts.delimiter == 0 && p.Delimiter != "" {
+		// loadPreset 已经检查过分隔符
+		opts.setDelimiter(p.Delimiter)
+	}
+	if len(opts.columns) == 0 {
+		opts.columns = p.Columns
+	}
+	if opts.renames == nil {
+		opts.renames = p.Renames
+	}
+	if opts.keyCase == "" {
+		opts.keyCase = p.KeyCase
+	}
+	if opts.types == nil {
+		opts.types = p.Types
+	}
+	if opts.transforms == nil {
+		opts.transforms = p.Transforms
+	}
+	if opts.valueMaps == nil {
+		opts.valueMaps = p.Maps
+	}
+	if opts.semantics == nil {
+		opts.semantics = p.Semantics
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// progressInterval 进度条刷新间隔
+const progressInterval = 200 * time.Millisecond
+
+// progressWidth 进度条的宽度
+const progressWidth = 30
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// progress 在终端上显示转换进度，total 为输入文件的大小，未知时为 0
+type progress struct {
+	w     io.Writer
+	total int64
+	start time.Time
+	bytes atomic.Int64 // 已读取的输入字节数，压缩输入为压缩后的字节数
+	rows  atomic.Int64 // 已输出的记录数
+	stop  chan struct{}
+	wg    sync.WaitGroup
+	mu    sync.Mutex // 进度条和日志交替写入 w
+	// logger 转换的日志，显示进度条期间经由 p 输出
+	logger *log.Logger
+}
+
+func newProgress(w io.Writer, total int64, logger *log.Logger) *progress {
+	return &progress{w: w, total: total, start: time.Now(), stop: make(chan struct{}), logger: logger}
+}
+
+// isTerminal 判断 w 是否为终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// observe 统计一条输出记录
+func (p *progress) observe(interface{}) {
+	p.rows.Add(1)
+}
+
+// Write 先清除进度条再写入日志，进度条在下次刷新时重新显示
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.w, "\r\x1b[K")
+	return p.w.Write(b)
+}
+
+// run 定时刷新进度条直到 finish，期间日志经由 p 输出。p 不是终端，
+// 日志保持终端下的彩色格式
+func (p *progress) run() {
+	p.logger.SetFormatter(&log.TextFormatter{ForceColors: true})
+	p.logger.SetOutput(p)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				fmt.Fprintf(p.w, "\r%s\x1b[K", p.line(time.Since(p.start)))
+				p.mu.Unlock()
+			case <-p.stop:
+				fmt.Fprint(p.w, "\r\x1b[K")
+				return
+			}
+		}
+	}()
+}
+
+// finish 停止刷新并清除进度条
+func (p *progress) finish() {
+	close(p.stop)
+	p.wg.Wait()
+	p.logger.SetOutput(p.w)
+}
+
+// line 返回进度条的一行，例如
+// [=========>          ] 33% 12.0MiB/36.0MiB 120000 rows 60000 rows/s ETA 4s
+func (p *progress) line(elapsed time.Duration) string {
+	var b strings.Builder
+	n, rows := p.bytes.Load(), p.rows.Load()
+	if p.total > 0 {
+		ratio := float64(n) / float64(p.total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		done := int(ratio * progressWidth)
+		bar := strings.Repeat("=", done)
+		if done < progressWidth {
+			bar += ">" + strings.Repeat(" ", progressWidth-done-1)
+		}
+		fmt.Fprintf(&b, "[%s] %3.0f%% %s/%s", bar, ratio*100, formatBytes(n), formatBytes(p.total))
+	} else {
+		b.WriteString(formatBytes(n))
+	}
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, " %d rows %.0f rows/s", rows, float64(rows)/seconds)
+	if p.total > 0 && n > 0 && n < p.total {
+		eta := time.Duration(float64(p.total-n) / float64(n) * float64(elapsed))
+		fmt.Fprintf(&b, " ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// formatBytes 以 1024 进制格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
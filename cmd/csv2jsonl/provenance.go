@@ -0,0 +1,110 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/samber/lo"
+)
+
+// provenanceField 写入记录的来源字段的名称
+const provenanceField = "_prov"
+
+// queryProvenance 查询结果的各字段来自哪个源文件。SQL 不能得到结果列的来源，
+// 字段按名称与各表的列匹配：只有一个表有同名的列时来自该表的文件，
+// 多个表有同名的列时（如 JOIN 的键）不能确定，列出所有的表，
+// 计算或改名的字段没有同名的列，来源未知
+type queryProvenance struct {
+	// Sources 各表的源文件，标准输入为 -
+	Sources map[string]string `json:"sources"`
+	// Fields 各字段可能来自的表，来源未知的字段为空
+	Fields map[string][]string `json:"fields"`
+
+	columns map[string][]string // 各表的列
+}
+
+// newQueryProvenance 记录载入的各表的源文件和列，需要在查询之前调用
+func newQueryProvenance(db *sql.DB, names, paths []string) (*queryProvenance, error) {
+	p := &queryProvenance{Sources: map[string]string{}, columns: map[string][]string{}}
+	for j, name := range names {
+		source := paths[j]
+		if source == "" {
+			source = "-"
+		}
+		p.Sources[name] = source
+		rows, err := db.Query("SELECT name FROM pragma_table_info(?)", name)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var col string
+			if err := rows.Scan(&col); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			p.columns[name] = append(p.columns[name], col)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// match 按名称匹配查询结果的字段与各表的列
+func (p *queryProvenance) match(fields []string) {
+	p.Fields = make(map[string][]string, len(fields))
+	for _, field := range fields {
+		tables := []string{}
+		for name, cols := range p.columns {
+			if lo.Contains(cols, field) {
+				tables = append(tables, name)
+			}
+		}
+		sort.Strings(tables)
+		p.Fields[field] = tables
+	}
+}
+
+// record 返回写入每条记录的 _prov 字段，包含所有的字段：只有一个来源的字段
+// 为其源文件，不能确定来源的字段为所有可能的源文件的数组，来源未知的字段为 null
+func (p *queryProvenance) record() ([]byte, error) {
+	files := make(map[string]interface{}, len(p.Fields))
+	for field, tables := range p.Fields {
+		switch len(tables) {
+		case 0:
+			files[field] = nil
+		case 1:
+			files[field] = p.Sources[tables[0]]
+		default:
+			files[field] = lo.Map(tables, func(table string, _ int) string { return p.Sources[table] })
+		}
+	}
+	return json.Marshal(files)
+}
+
+// write 将来源写入 path
+func (p *queryProvenance) write(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestQueryProvenanceRecord(t *testing.T) {
+	p := &queryProvenance{
+		Sources: map[string]string{"orders": "orders.csv", "users": "-"},
+		columns: map[string][]string{"orders": {"id", "user_id", "total"}, "users": {"id", "name"}},
+	}
+	p.match([]string{"id", "name", "total", "customer", "sum"})
+
+	wantFields := map[string][]string{
+		"id":       {"orders", "users"},
+		"name":     {"users"},
+		"total":    {"orders"},
+		"customer": {},
+		"sum":      {},
+	}
+	if !reflect.DeepEqual(p.Fields, wantFields) {
+		t.Errorf("fields = %v, want %v", p.Fields, wantFields)
+	}
+
+	data, err := p.record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"id":       []interface{}{"orders.csv", "-"},
+		"name":     "-",
+		"total":    "orders.csv",
+		"customer": nil,
+		"sum":      nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("_prov = %s, want %v", data, want)
+	}
+}
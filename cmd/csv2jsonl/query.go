@@ -0,0 +1,310 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+// quoteIdent 引用 SQL 标识符
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlValue 将单元格转换为插入的值：空值保存为 NULL，数字按数值保存以便
+// SQL 中按数值比较，其他的（包括以 0 开头的编号）按文本保存
+func sqlValue(cell string) interface{} {
+	if cell == "" {
+		return nil
+	}
+	switch v := convert.InferTypes("", cell).(type) {
+	case int64, float64:
+		return v
+	}
+	return cell
+}
+
+// loadTable 将 CSV 读入名为 name 的表，返回行数。字段数与表头不同的行，
+// strict 时返回错误，否则缺失的单元格按 NULL 处理，多余的单元格忽略
+func loadTable(db *sql.DB, name string, r io.Reader, delimiter rune, strict bool) (int, error) {
+	csvReader, columns, err := source.NewCSVReader(r, delimiter)
+	if err != nil {
+		return 0, err
+	}
+	csvReader.FieldsPerRecord = -1
+
+	// 不声明列类型，SQLite 按插入的值保存数字或文本
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = quoteIdent(col)
+	}
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(name), strings.Join(defs, ", "))); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)",
+		quoteIdent(name), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rows, ragged := 0, 0
+	values := make([]interface{}, len(columns))
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if len(row) != len(columns) {
+			if err := checkFieldCount(csvReader, row, len(columns), strict); err != nil {
+				return rows, err
+			}
+			ragged++
+		}
+		for i := range values {
+			values[i] = nil
+			if i < len(row) {
+				values[i] = sqlValue(row[i])
+			}
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	if ragged > 0 {
+		log.Warnf("%d rows of table %s have more or fewer fields than the header", ragged, name)
+	}
+	return rows, tx.Commit()
+}
+
+// writeQueryResult 将查询结果按列的顺序逐行写为 JSON 对象，prov 不为空时
+// 在每条记录的最后写入 _prov 字段
+func writeQueryResult(rows *sql.Rows, w io.Writer, prov []byte) (int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	keys := make([][]byte, len(columns))
+	for i, col := range columns {
+		if keys[i], err = json.Marshal(col); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		n      int
+		buf    bytes.Buffer
+		values = make([]interface{}, len(columns))
+		ptrs   = make([]interface{}, len(columns))
+	)
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(keys[i])
+			buf.WriteByte(':')
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			if err := enc.Encode(v); err != nil {
+				return n, err
+			}
+			buf.Truncate(buf.Len() - 1) // 去掉 Encode 追加的换行
+		}
+		if prov != nil {
+			buf.WriteString(`,"` + provenanceField + `":`)
+			buf.Write(prov)
+		}
+		buf.WriteString("}\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// loadSource 确定分隔符并将 CSV 文件载入表，返回进程退出码
+func loadSource(db *sql.DB, name, path, inputFormat, delimiter string, strict bool, stdin io.Reader) int {
+	var delim rune
+	if delimiter != "" {
+		var err error
+		if delim, err = parseDelimiter(delimiter); err != nil {
+			log.Errorf("%v", err)
+			return exitUsage
+		}
+	} else {
+		detected, code := detectInput(inputFormat, path, 0, &stdin, "", log.StandardLogger())
+		if code != 0 {
+			return code
+		}
+		delim = detected.delimiter
+	}
+
+	in, err := openInput(path, stdin)
+	if err != nil {
+		log.Errorf("open file failed: %v", err)
+		return 1
+	}
+	defer in.Close()
+	n, err := loadTable(db, name, in, delim, strict)
+	if err != nil {
+		log.Errorf("load table %s failed: %v", name, err)
+		return 1
+	}
+	log.Infof("loaded %d rows into table %s", n, name)
+	return 0
+}
+
+// runQuery 将 CSV 载入 SQLite 并以 JSONL 输出查询结果，返回进程退出码
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	i := fs.String("i", "", "input csv file loaded as table input, - or empty for stdin")
+	var tables stringsFlag
+	fs.Var(&tables, "table", "load a csv file as a table, as name=path, may be repeated")
+	query := fs.String("sql", "", "sql query, e.g. 'SELECT name, count(*) c FROM input GROUP BY 1'")
+	inputFormat := fs.String("input-format", "", "input format: csv, tsv or psv, default detected by file extension or content")
+	delimiter := fs.String("delimiter", "", "field delimiter, e.g. ';', '|' or '\\t', overrides -input-format")
+	strictColumns := fs.Bool("strict-columns", false, "fail at a row with more or fewer fields than the header instead of padding or truncating it")
+	provenancePath := fs.String("provenance", "", "write the source file of each result field, matched by column name, to this json file")
+	provenanceRecords := fs.Bool("provenance-field", false, "add a _prov object mapping each result field to its source file, the files of all tables with a column of its name or null, to every record")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *query == "" {
+		log.Errorf("-sql is required")
+		return exitUsage
+	}
+	if sqlDriver == "" {
+		log.Errorf("query mode is not available in this build, rebuild with -tags full")
+		return 1
+	}
+
+	db, err := sql.Open(sqlDriver, ":memory:")
+	if err != nil {
+		log.Errorf("open database failed: %v", err)
+		return 1
+	}
+	defer db.Close()
+	// 内存数据库只在同一个连接中可见
+	db.SetMaxOpenConns(1)
+
+	// 未指定 -table 时 -i（默认为标准输入）作为 input 表
+	var names, paths []string
+	if *i != "" || len(tables) == 0 {
+		names, paths = append(names, "input"), append(paths, *i)
+	}
+	for _, table := range tables {
+		name, path, ok := strings.Cut(table, "=")
+		if !ok || name == "" || path == "" {
+			log.Errorf("invalid table %q, expected name=path", table)
+			return exitUsage
+		}
+		names, paths = append(names, name), append(paths, path)
+	}
+	for j := range names {
+		if code := loadSource(db, names[j], paths[j], *inputFormat, *delimiter, *strictColumns, stdin); code != 0 {
+			return code
+		}
+	}
+
+	var prov *queryProvenance
+	if *provenancePath != "" || *provenanceRecords {
+		// 查询结果读完之前连接被占用，先读取各表的列
+		if prov, err = newQueryProvenance(db, names, paths); err != nil {
+			log.Errorf("read table columns failed: %v", err)
+			return 1
+		}
+	}
+
+	rows, err := db.Query(*query)
+	if err != nil {
+		log.Errorf("query failed: %v", err)
+		return 1
+	}
+	defer rows.Close()
+
+	var provRecord []byte
+	if prov != nil {
+		fields, err := rows.Columns()
+		if err != nil {
+			log.Errorf("query failed: %v", err)
+			return 1
+		}
+		prov.match(fields)
+		if *provenanceRecords {
+			if lo.Contains(fields, provenanceField) {
+				log.Errorf("-provenance-field: the query already has a %s column", provenanceField)
+				return exitUsage
+			}
+			if provRecord, err = prov.record(); err != nil {
+				log.Errorf("%v", err)
+				return 1
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(stdout)
+	n, err := writeQueryResult(rows, bw, provRecord)
+	if err = errors.Join(err, bw.Flush()); err != nil {
+		log.Errorf("write result failed: %v", err)
+		return 1
+	}
+	log.Infof("query returned %d rows", n)
+	if *provenancePath != "" {
+		if err := prov.write(*provenancePath); err != nil {
+			log.Errorf("write provenance failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+//go:build full
+
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runQueryCase 以 args 和 stdin 运行 query 子命令，返回退出码和标准输出的各行
+func runQueryCase(t *testing.T, stdin string, args ...string) (int, []string) {
+	t.Helper()
+	var stdout bytes.Buffer
+	code := runQuery(args, strings.NewReader(stdin), &stdout, os.Stderr)
+	return code, strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+}
+
+func TestQuerySingleFile(t *testing.T) {
+	stdin := "name,city,age\nalice,paris,30\nbob,rome,25\ncarol,paris,41\n"
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "select",
+			sql:  "SELECT name, age FROM input WHERE city = 'paris' ORDER BY name",
+			want: []string{`{"name":"alice","age":30}`, `{"name":"carol","age":41}`},
+		},
+		{
+			name: "aggregate",
+			sql:  "SELECT city, count(*) AS n, max(age) AS oldest FROM input GROUP BY city ORDER BY city",
+			want: []string{`{"city":"paris","n":2,"oldest":41}`, `{"city":"rome","n":1,"oldest":25}`},
+		},
+	} {
+		code, got := runQueryCase(t, stdin, "-sql", tc.sql)
+		if code != 0 {
+			t.Fatalf("%s: exit code %d", tc.name, code)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+}
+
+func TestQueryJoin(t *testing.T) {
+	dir := t.TempDir()
+	users := filepath.Join(dir, "users.csv")
+	orders := filepath.Join(dir, "orders.tsv")
+	if err := os.WriteFile(users, []byte("id,name\n1,alice\n2,bob\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orders, []byte("id\tuser_id\ttotal\n10\t1\t5\n11\t1\t7\n12\t2\t3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, got := runQueryCase(t, "",
+		"-table", "users="+users,
+		"-table", "orders="+orders,
+		"-sql", "SELECT u.id, u.name, sum(o.total) AS spent FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.id ORDER BY u.id",
+		"-provenance-field",
+	)
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2: %q", len(got), got)
+	}
+
+	var record struct {
+		ID    int                    `json:"id"`
+		Name  string                 `json:"name"`
+		Spent int                    `json:"spent"`
+		Prov  map[string]interface{} `json:"_prov"`
+	}
+	if err := json.Unmarshal([]byte(got[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID != 1 || record.Name != "alice" || record.Spent != 12 {
+		t.Errorf("got %s, want alice with 12 spent", got[0])
+	}
+	// id 两个表都有，不能确定来源；spent 为计算的字段，来源未知
+	if files, ok := record.Prov["id"].([]interface{}); !ok || len(files) != 2 {
+		t.Errorf("_prov.id = %v, want both files", record.Prov["id"])
+	}
+	if record.Prov["name"] != users {
+		t.Errorf("_prov.name = %v, want %s", record.Prov["name"], users)
+	}
+	if v, ok := record.Prov["spent"]; !ok || v != nil {
+		t.Errorf("_prov.spent = %v, want null", v)
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "missing sql", args: nil, want: exitUsage},
+		{name: "invalid table", args: []string{"-table", "users", "-sql", "SELECT 1"}, want: exitUsage},
+		{name: "syntax error", args: []string{"-sql", "SELEC 1"}, want: 1},
+	} {
+		if code, _ := runQueryCase(t, "a\n1\n", tc.args...); code != tc.want {
+			t.Errorf("%s: exit code %d, want %d", tc.name, code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// openRemote 打开 http(s) 或对象存储地址的输入，响应内容边读边下载，不保存到本地
+func openRemote(rawURL string) (io.ReadCloser, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	if isObjectURL(rawURL) {
+		resp, err = getObject(rawURL)
+	} else {
+		resp, err = http.Get(rawURL)
+		if err == nil {
+			err = checkResponse(resp)
+		}
+	}
+	if err != nil {
+		return nil, redactURLError(err)
+	}
+	return resp.Body, nil
+}
+
+// getObject 下载对象存储中的对象，凭据与 -o 写入对象存储时相同
+func getObject(rawURL string) (*http.Response, error) {
+	u, key, err := parseObjectURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		client, err := newS3Client()
+		if err != nil {
+			return nil, err
+		}
+		return client.do(http.MethodGet, u.Host, key, nil, nil)
+	case "gs":
+		g, err := newGCSUploader(u.Host, key)
+		if err != nil {
+			return nil, err
+		}
+		target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint, url.PathEscape(g.bucket), url.PathEscape(g.object))
+		return g.do(http.MethodGet, target, nil, nil)
+	case "az":
+		a, err := newAzureUploader(u.Host, key)
+		if err != nil {
+			return nil, err
+		}
+		return a.get()
+	}
+	return nil, fmt.Errorf("unsupported object url %s", rawURL)
+}
+
+// get 下载 blob，SAS 令牌需要读取权限
+func (u *azureUploader) get() (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u.blobURL+"?"+u.sas, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", "2020-10-02")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// redactURLError 去掉请求错误中地址的查询参数，预签名地址和 SAS 令牌不应出现在日志中
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if u, perr := url.Parse(urlErr.URL); perr == nil {
+		u.RawQuery = ""
+		urlErr.URL = u.Redacted()
+	}
+	return err
+}
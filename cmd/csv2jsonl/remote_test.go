@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenRemoteGCS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Authorization = %s", r.Header.Get("Authorization"))
+		}
+		if r.URL.EscapedPath() != "/storage/v1/b/bucket/o/dir%2Fin.csv" || r.URL.RawQuery != "alt=media" {
+			http.Error(w, "No such object", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, "a,b\n1,2\n")
+	}))
+	defer srv.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+
+	in, err := openRemote("gs://bucket/dir/in.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(in)
+	in.Close()
+	if err != nil || string(data) != "a,b\n1,2\n" {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	if _, err := openRemote("gs://bucket/missing.csv"); err == nil || !strings.Contains(err.Error(), "404 Not Found: No such object") {
+		t.Errorf("openRemote of a missing object returned %v", err)
+	}
+}
+
+func TestAzureGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-ms-version") == "" {
+			t.Error("missing x-ms-version")
+		}
+		if r.URL.Query().Get("sig") != "secret" {
+			http.Error(w, "AuthenticationFailed", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/container/dir/in.csv" {
+			http.Error(w, "BlobNotFound", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, "a,b\n1,2\n")
+	}))
+	defer srv.Close()
+
+	resp, err := (&azureUploader{blobURL: srv.URL + "/container/dir/in.csv", sas: "sv=2020-10-02&sig=secret"}).get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(data) != "a,b\n1,2\n" {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	// 错误中不包含 SAS 令牌
+	_, err = (&azureUploader{blobURL: srv.URL + "/container/dir/in.csv", sas: "sv=2020-10-02&sig=wrong"}).get()
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: AuthenticationFailed") || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("get with a wrong SAS token returned %v", err)
+	}
+}
+
+func TestOpenRemoteRedactsQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "expired", http.StatusForbidden)
+	}))
+	target := srv.URL + "/in.csv?X-Amz-Signature=secret"
+
+	// 错误响应和连接失败时，预签名地址的签名都不出现在错误中
+	if _, err := openRemote(target); err == nil || !strings.Contains(err.Error(), "403 Forbidden") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("openRemote returned %v", err)
+	}
+	srv.Close()
+	if _, err := openRemote(target); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("openRemote returned %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+)
+
+const (
+	// reportSamples 报告中的示例记录数
+	reportSamples = 5
+	// reportErrors 报告中列出的错误数
+	reportErrors = 20
+	// reportDistinct 统计不同值的上限，超过时显示为 >上限
+	reportDistinct = 1000
+)
+
+//go:embed templates/report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// report HTML 报告的内容
+type report struct {
+	Source        string
+	Output        string
+	Generated     time.Time
+	Elapsed       time.Duration
+	RowsPerSecond float64
+	Stats         convert.Stats
+	Skipped       int
+	Errors        []reportError
+	MoreErrors    int
+	Columns       []columnReport
+	Samples       []string
+	Config        []reportOption
+	Deprecations  []deprecation
+}
+
+type reportError struct {
+	convert.Position
+	Error string
+	Row   string
+}
+
+type columnReport struct {
+	Name, Types                string
+	Values, Nulls              int
+	Distinct, Min, Max, Length string
+}
+
+type reportOption struct {
+	Name, Value string
+}
+
+// fieldProfile 一个输出字段的统计
+type fieldProfile struct {
+	types      map[string]bool
+	values     int
+	distinct   map[string]struct{}
+	overflow   bool // 不同值超过 reportDistinct
+	hasNum     bool
+	min, max   float64
+	minLen     int
+	maxLen     int
+	hasStrings bool
+}
+
+// reportCollector 收集报告所需的错误、字段统计和示例记录
+type reportCollector struct {
+	records  int
+	profiles map[string]*fieldProfile
+	samples  []string
+	errors   []reportError
+	failed   int
+}
+
+func newReportCollector() *reportCollector {
+	return &reportCollector{profiles: map[string]*fieldProfile{}}
+}
+
+// onError 记录格式错误的行，再交给 next 处理
+func (c *reportCollector) onError(next convert.ErrorHandler) convert.ErrorHandler {
+	return func(e *convert.RowError) error {
+		c.failed++
+		if len(c.errors) < reportErrors {
+			c.errors = append(c.errors, reportError{Position: e.Position, Error: e.Err.Error(), Row: strings.Join(e.Row, ",")})
+		}
+		return next(e)
+	}
+}
+
+// observe 统计一条输出记录，只输出一列时字段名为 $
+func (c *reportCollector) observe(record interface{}) {
+	c.records++
+	if len(c.samples) < reportSamples {
+		// 模板负责 HTML 转义，示例按输出的格式编码
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err == nil {
+			c.samples = append(c.samples, strings.TrimSuffix(buf.String(), "\n"))
+		}
+	}
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		fields = map[string]interface{}{"$": record}
+	}
+	for name, v := range fields {
+		p := c.profiles[name]
+		if p == nil {
+			p = &fieldProfile{types: map[string]bool{}, distinct: map[string]struct{}{}}
+			c.profiles[name] = p
+		}
+		p.add(v)
+	}
+}
+
+func (p *fieldProfile) add(v interface{}) {
+	if v == nil || v == "" {
+		return
+	}
+	p.values++
+	p.types[jsonType(v)] = true
+	if !p.overflow {
+		key, _ := json.Marshal(v)
+		p.distinct[string(key)] = struct{}{}
+		if len(p.distinct) > reportDistinct {
+			p.overflow, p.distinct = true, nil
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if !p.hasStrings || n < p.minLen {
+			p.minLen = n
+		}
+		if !p.hasStrings || n > p.maxLen {
+			p.maxLen = n
+		}
+		p.hasStrings = true
+	case int64, int, float64:
+		f := toFloat(v)
+		if !p.hasNum || f < p.min {
+			p.min = f
+		}
+		if !p.hasNum || f > p.max {
+			p.max = f
+		}
+		p.hasNum = true
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return v.(float64)
+}
+
+// columns 按字段名排序返回各字段的统计，缺失、null 和空字符串计为空值
+func (c *reportCollector) columns() []columnReport {
+	names := make([]string, 0, len(c.profiles))
+	for name := range c.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]columnReport, 0, len(names))
+	for _, name := range names {
+		p := c.profiles[name]
+		types := make([]string, 0, len(p.types))
+		for typ := range p.types {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		col := columnReport{Name: name, Types: strings.Join(types, ", "), Values: p.values, Nulls: c.records - p.values}
+		col.Distinct = fmt.Sprint(len(p.distinct))
+		if p.overflow {
+			col.Distinct = fmt.Sprintf(">%d", reportDistinct)
+		}
+		if p.hasNum {
+			col.Min, col.Max = fmt.Sprint(p.min), fmt.Sprint(p.max)
+		}
+		if p.hasStrings {
+			col.Length = fmt.Sprintf("%d-%d", p.minLen, p.maxLen)
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// report 根据转换统计和命令行中指定的选项生成报告
+func (c *reportCollector) report(fs *flag.FlagSet, stats convert.Stats, elapsed time.Duration) *report {
+	r := &report{
+		Generated:     time.Now(),
+		Elapsed:       elapsed.Round(time.Millisecond),
+		RowsPerSecond: float64(stats.Rows) / elapsed.Seconds(),
+		Stats:         stats,
+		Skipped:       stats.Rows - stats.Emitted,
+		Errors:        c.errors,
+		MoreErrors:    c.failed - len(c.errors),
+		Columns:       c.columns(),
+		Samples:       c.samples,
+	}
+	fs.Visit(func(f *flag.Flag) {
+		r.Config = append(r.Config, reportOption{Name: f.Name, Value: f.Value.String()})
+	})
+	return r
+}
+
+// writeReport 将报告以 HTML 写入 path
+func writeReport(path string, r *report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("render report failed: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(input, []byte("name,age\nAlice,30\n<b>Bob</b>,45\nbad\nCarol,x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.html")
+	args := []string{"-log-level", "error", "-i", input, "-o", filepath.Join(dir, "out.jsonl"), "-on-error", "skip", "-infer-types", "-report", report}
+	if code := Run(args, nil, io.Discard, io.Discard); code != exitParseErrors {
+		t.Fatalf("exit code = %d, want %d", code, exitParseErrors)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, want := range []string{
+		`<tr><th>Read</th><td class="num">3</td></tr>`,
+		`<tr><th>Errors</th><td class="num">1</td></tr>`,
+		// 跳过的畸形行及其位置
+		`<tr><td class="num">4</td><td class="num">32</td><td class="error">wrong number of fields</td><td><pre>bad</pre></td></tr>`,
+		// 各字段的概况
+		`<tr><td>age</td><td>integer, string</td><td class="num">3</td><td class="num">0</td><td class="num">3</td><td>30</td><td>45</td><td>1-1</td></tr>`,
+		// 数据中的 HTML 被转义
+		`&lt;b&gt;Bob&lt;/b&gt;`,
+		`<tr><td>-on-error</td><td>skip</td></tr>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %s", want)
+		}
+	}
+	if strings.Contains(html, "<b>Bob") {
+		t.Error("report contains unescaped data")
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+// loadSchema 读取列名到类型的映射，如 {"zip": "string", "age": "int"}
+func loadSchema(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]string
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parse schema %s failed: %v", path, err)
+	}
+	for col, typ := range schema {
+		if !convert.IsValidType(typ) {
+			return nil, fmt.Errorf("schema %s: unknown type %s of column %s", path, typ, col)
+		}
+	}
+	return schema, nil
+}
+
+// schemaEvolutions -schema-evolution 的处理方式
+var schemaEvolutions = map[string]bool{"warn": true, "fail": true, "emit-migration": true}
+
+// schemaChange 一列推断的类型相对 -prior-schema 的变化
+type schemaChange struct {
+	// Change 为 added、removed 或 retyped
+	Change   string `json:"change"`
+	Column   string `json:"column"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Nullable bool   `json:"nullable,omitempty"`
+	// Breaking 按之前的 schema 建的表不能直接写入新的数据，或者下游依赖的列不再提供
+	Breaking bool `json:"breaking"`
+}
+
+// schemaMigration -schema-evolution emit-migration 写出的迁移描述
+type schemaMigration struct {
+	Prior    string         `json:"prior"`
+	Source   string         `json:"source"`
+	Rows     int            `json:"rows"`
+	Breaking bool           `json:"breaking"`
+	Changes  []schemaChange `json:"changes"`
+	// Schema 推断的类型，格式与 -schema 相同，可以作为下一次转换的 -prior-schema
+	Schema map[string]string `json:"schema"`
+}
+
+// schemaEvolution 比较推断的类型与之前交付时的 schema
+type schemaEvolution struct {
+	mode      string
+	priorPath string
+	prior     map[string]string
+	// migrationPath emit-migration 写出迁移描述的路径
+	migrationPath string
+}
+
+// comparableType 推断只得到 int、float、bool 和 string，其他类型按 string 比较
+func comparableType(typ string) string {
+	switch typ {
+	case convert.TypeInt, convert.TypeFloat, convert.TypeBool:
+		return typ
+	}
+	return convert.TypeString
+}
+
+// diffSchema 按推断的列的顺序返回新增和改变类型的列，之后为按名称排序的删除的列
+func diffSchema(prior map[string]string, schema *convert.Schema) []schemaChange {
+	changes := []schemaChange{}
+	inferred := make(map[string]bool, len(schema.Columns))
+	for _, col := range schema.Columns {
+		inferred[col.Name] = true
+		typ, ok := prior[col.Name]
+		switch {
+		case !ok:
+			changes = append(changes, schemaChange{Change: "added", Column: col.Name, To: col.Type, Nullable: col.Nullable})
+		case comparableType(typ) != col.Type:
+			// 字符串的列可以写入任何值，浮点数的列可以写入整数
+			from := comparableType(typ)
+			breaking := from != convert.TypeString && !(from == convert.TypeFloat && col.Type == convert.TypeInt)
+			changes = append(changes, schemaChange{Change: "retyped", Column: col.Name, From: typ, To: col.Type, Nullable: col.Nullable, Breaking: breaking})
+		}
+	}
+	var removed []string
+	for col := range prior {
+		if !inferred[col] {
+			removed = append(removed, col)
+		}
+	}
+	sort.Strings(removed)
+	for _, col := range removed {
+		changes = append(changes, schemaChange{Change: "removed", Column: col, From: prior[col], Breaking: true})
+	}
+	return changes
+}
+
+func (c schemaChange) String() string {
+	switch c.Change {
+	case "added":
+		return fmt.Sprintf("column %s was added as %s", c.Column, c.To)
+	case "removed":
+		return fmt.Sprintf("column %s (%s) was removed", c.Column, c.From)
+	}
+	return fmt.Sprintf("column %s changed from %s to %s", c.Column, c.From, c.To)
+}
+
+// check 比较推断的类型，返回退出码：fail 时有变化返回 1
+func (e *schemaEvolution) check(schema *convert.Schema, source string, logger log.FieldLogger) int {
+	changes := diffSchema(e.prior, schema)
+	m := schemaMigration{Prior: e.priorPath, Source: source, Rows: schema.Rows, Changes: changes, Schema: map[string]string{}}
+	for _, col := range schema.Columns {
+		m.Schema[col.Name] = col.Type
+		if typ, ok := e.prior[col.Name]; ok && comparableType(typ) == col.Type {
+			// 保留之前指定的 date、json 等推断不出的类型
+			m.Schema[col.Name] = typ
+		}
+	}
+	for _, c := range changes {
+		m.Breaking = m.Breaking || c.Breaking
+		if e.mode == "fail" {
+			logger.Errorf("schema-evolution: %s", c)
+		} else {
+			logger.Warnf("schema-evolution: %s", c)
+		}
+	}
+	if len(changes) == 0 {
+		logger.Infof("schema-evolution: the inferred types match %s", e.priorPath)
+	}
+	switch {
+	case e.mode == "fail" && len(changes) > 0:
+		logger.Errorf("schema-evolution: the inferred types differ from %s in %d columns", e.priorPath, len(changes))
+		return 1
+	case e.mode == "emit-migration":
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err == nil {
+			err = os.WriteFile(e.migrationPath, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			logger.Errorf("write migration failed: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
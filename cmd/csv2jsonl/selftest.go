@@ -0,0 +1,240 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	log "github.com/sirupsen/logrus"
+)
+
+type selftestCase struct {
+	name string
+	opts convertOptions
+	// encoding 合成数据的编码，charset 转换时按其解码输入的字符集，
+	// alphabet 为 text 列使用的字符，需要能以 encoding 表示
+	encoding string
+	charset  string
+	alphabet string
+	columns  []string
+	rows     int
+	// expect 返回一行数据期望的输出
+	expect func(record map[string]string) interface{}
+}
+
+func selftestCases() []selftestCase {
+	all := func(record map[string]string) interface{} {
+		data := map[string]interface{}{}
+		for k, v := range record {
+			data[k] = v
+		}
+		return data
+	}
+
+	return []selftestCase{
+		{name: "comma", columns: []string{"id", "name", "note"}, rows: 50, expect: all},
+		{name: "semicolon", opts: convertOptions{delimiter: ';'}, columns: []string{"id", "name", "note"}, rows: 50, expect: all},
+		{name: "tab", opts: convertOptions{delimiter: '\t'}, columns: []string{"id", "name", "note"}, rows: 50, expect: all},
+		{name: "pipe", opts: convertOptions{delimiter: '|'}, columns: []string{"id", "name", "note"}, rows: 50, expect: all},
+		{name: "bom", encoding: encUTF8BOM, columns: []string{"id", "name"}, rows: 10, expect: all},
+		{name: "unicode-header", columns: []string{"编号", "名称"}, rows: 10, expect: all},
+		{name: "utf-16le", encoding: encUTF16LE, charset: "utf-16", columns: []string{"编号", "名称"}, rows: 20, expect: all},
+		{name: "utf-16be", encoding: encUTF16BE, charset: "utf-16", columns: []string{"编号", "名称"}, rows: 20, expect: all},
+		{
+			name:     "gbk",
+			encoding: encGBK,
+			charset:  "gbk",
+			alphabet: "abcXYZ019 ,;|\t\"'\n{}[]中文编码，。",
+			columns:  []string{"编号", "名称", "备注"},
+			rows:     20,
+			expect:   all,
+		},
+		{
+			name:     "latin1",
+			opts:     convertOptions{delimiter: ';'},
+			encoding: encLatin1,
+			charset:  "latin1",
+			alphabet: "abcXYZ019 ,;|\t\"'\n{}[]éßüÆ£",
+			columns:  []string{"id", "nom", "remarque"},
+			rows:     20,
+			expect:   all,
+		},
+		{
+			name:    "limit",
+			opts:    convertOptions{limit: 5},
+			columns: []string{"id", "name"},
+			rows:    10,
+			expect:  all,
+		},
+		{
+			name:    "select-columns",
+			opts:    convertOptions{columns: []string{"id", "note"}},
+			columns: []string{"id", "name", "note"},
+			rows:    20,
+			expect: func(record map[string]string) interface{} {
+				return map[string]interface{}{"id": record["id"], "note": record["note"]}
+			},
+		},
+		{
+			name:    "single-column",
+			opts:    convertOptions{columns: []string{"id"}},
+			columns: []string{"id", "name"},
+			rows:    20,
+			expect: func(record map[string]string) interface{} {
+				return record["id"]
+			},
+		},
+		{
+			name: "renames-and-types",
+			opts: convertOptions{
+				renames: map[string]string{"id": "ID"},
+				types:   map[string]string{"id": convert.TypeInt},
+			},
+			columns: []string{"id", "name"},
+			rows:    20,
+			expect: func(record map[string]string) interface{} {
+				id, _ := strconv.Atoi(record["id"])
+				return map[string]interface{}{"ID": id, "name": record["name"]}
+			},
+		},
+	}
+}
+
+func encodeJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c selftestCase) run(rng *rand.Rand, logger log.FieldLogger) error {
+	// 首列为行号，保证不出现空行，其余列使用包含边界字符的 text 类型
+	g := &generator{rng: rng}
+	for i, col := range c.columns {
+		typ := genText
+		if i == 0 {
+			typ = genSeq
+		}
+		g.columns = append(g.columns, genColumn{name: col, typ: typ})
+	}
+	records := make([][]string, c.rows)
+	for i := range records {
+		records[i] = g.record(i)
+		if c.alphabet != "" {
+			for j := 1; j < len(records[i]); j++ {
+				records[i][j] = g.randomString([]rune(c.alphabet), 12)
+			}
+		}
+	}
+
+	encoding := c.encoding
+	if encoding == "" {
+		encoding = encUTF8
+	}
+	var input bytes.Buffer
+	err := writeSyntheticCsv(&input, encoding, c.opts.delimiter, g.header(), len(records), func(row int) []string {
+		return records[row]
+	})
+	if err != nil {
+		return err
+	}
+
+	in, err := decodeInput(io.NopCloser(&input), c.charset)
+	if err != nil {
+		return err
+	}
+	opts := c.opts
+	opts.logger = logger
+	var output bytes.Buffer
+	if err := opts.converter().Convert(in, &output); err != nil {
+		return fmt.Errorf("convert failed: %v", err)
+	}
+	got := strings.SplitAfter(output.String(), "\n")
+	got = got[:len(got)-1]
+
+	var want []string
+	for i, record := range records {
+		if c.opts.limit > 0 && i >= c.opts.limit {
+			break
+		}
+		m := map[string]string{}
+		for j, col := range c.columns {
+			m[col] = record[j]
+		}
+		s, err := encodeJSON(c.expect(m))
+		if err != nil {
+			return err
+		}
+		want = append(want, s)
+	}
+
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return fmt.Errorf("record %d: got %q, want %q", i+1, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+// runSelftest 生成合成数据并验证转换结果，返回进程退出码
+func runSelftest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	seed := fs.Int64("seed", 1, "random seed of the synthetic data")
+	verbose := fs.Bool("v", false, "print pipeline logs")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	// 使用单独的 logger，不修改全局 logger 的级别
+	logger := log.New()
+	logger.SetOutput(stderr)
+	if !*verbose {
+		logger.SetLevel(log.WarnLevel)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	failed := 0
+	for _, c := range selftestCases() {
+		if err := c.run(rng, logger); err != nil {
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "ok   %s\n", c.name)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(stdout, "selftest failed: %d case(s)\n", failed)
+		return 1
+	}
+	fmt.Fprintln(stdout, "selftest passed")
+	return 0
+}
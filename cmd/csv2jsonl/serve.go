@@ -0,0 +1,227 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveFlags 可以通过查询参数指定的转换选项，不包括读写服务器上文件的选项
+var serveFlags = map[string]bool{
+	"columns": true, "limit": true, "skip": true, "offset": true, "workers": true, "unordered": true,
+	"pretty": true, "ascii-only": true, "nested": true, "empty-as-null": true, "omit-empty": true, "trim-space": true, "strip-control-chars": true,
+	"transform": true, "map": true, "default": true, "key-case": true, "decode-entities-columns": true, "strict-flags": true, "infer-types": true, "parse-json-columns": true, "flatten": true, "flatten-prefix": true, "two-pass": true,
+	"infer-sample": true, "infer-confidence": true, "no-header": true, "header": true,
+	"date-columns": true, "date-format": true, "epoch": true, "max-runtime": true,
+	"dedupe-key": true, "dedupe-mode": true, "dedupe-capacity": true, "dedupe-false-positive-rate": true,
+	"dictionary-encode": true, "detect-lang": true, "parse-ua": true, "position-field": true, "add-line-number": true, "add-meta": true,
+	"preset": true, "where-date": true, "filter": true, "template": true,
+	"k-anonymity": true, "quasi-identifiers": true, "mask": true, "hash-column": true, "flush-interval": true, "flush-rows": true, "stream": true, "eos-record": true,
+	"assert-sorted": true, "assert-sorted-desc": true, "assert-sorted-mode": true,
+	"compress": true, "input-format": true, "delimiter": true, "record-separator": true, "encoding": true, "on-error": true, "strict-columns": true, "warn-limit": true, "hash": true,
+	"sample": true, "sample-n": true, "sample-seed": true,
+}
+
+// conversionErrorTrailer 输出开始后转换失败时，通过该 trailer 返回错误
+const conversionErrorTrailer = "X-Conversion-Error"
+
+// serveArgs 将查询参数转换为命令行参数，不支持的参数返回错误
+func serveArgs(query map[string][]string) ([]string, error) {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{"-log-level=" + log.GetLevel().String()}
+	for _, name := range names {
+		if !serveFlags[name] {
+			return nil, fmt.Errorf("unsupported option %s", name)
+		}
+		for _, value := range query[name] {
+			if name == "preset" && !validPresetName(value) {
+				// 预设名称不能指向预设目录以外的文件
+				return nil, fmt.Errorf("invalid preset name %q", value)
+			}
+			if value == "" {
+				// 布尔选项可以只写名称，例如 ?pretty
+				args = append(args, "-"+name)
+				continue
+			}
+			args = append(args, "-"+name+"="+value)
+		}
+	}
+	return args, nil
+}
+
+// responseWriter 在第一次写入时发送响应头，记录是否已经开始输出
+type responseWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (r *responseWriter) Write(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.w.Header().Set("Content-Type", r.contentType)
+		r.w.WriteHeader(http.StatusOK)
+	}
+	return r.w.Write(p)
+}
+
+// Flush 将已经写出的数据发送给客户端，用于 -flush-interval 和 -flush-rows
+func (r *responseWriter) Flush() {
+	if f, ok := r.w.(http.Flusher); ok && r.started {
+		f.Flush()
+	}
+}
+
+// requestBody 返回请求中的 CSV，multipart 上传时为名为 file 的文件，
+// 没有时为第一个文件
+func requestBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no file in the multipart upload")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" || part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// handleConvert 处理 POST /convert，请求体为 CSV，返回转换后的 JSONL
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	args, err := serveArgs(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := requestBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Has("flush-interval") || r.URL.Query().Has("flush-rows") {
+		// HTTP/1.x 的服务端默认在响应开始后不再读取请求体，
+		// 边接收 CSV 边刷新记录需要同时读写
+		if fd, ok := w.(interface{ EnableFullDuplex() error }); ok {
+			if err := fd.EnableFullDuplex(); err != nil {
+				log.Warnf("enable full duplex failed: %v", err)
+			}
+		}
+	}
+	out := &responseWriter{w: w, contentType: "application/x-ndjson"}
+	switch r.URL.Query().Get("compress") {
+	case "gzip":
+		out.contentType = "application/gzip"
+	case "zstd":
+		out.contentType = "application/zstd"
+	}
+	w.Header().Set("Trailer", conversionErrorTrailer)
+
+	// 参数错误输出到 stderr；每个请求使用自己的 logger，日志仍然输出到服务的日志，
+	// 错误同时返回给客户端
+	var stderr bytes.Buffer
+	errs := &errorMessages{}
+	logger := log.New()
+	logger.SetOutput(log.StandardLogger().Out)
+	logger.SetFormatter(log.StandardLogger().Formatter)
+	logger.AddHook(errs)
+	code := runConversion(args, body, out, &stderr, logger)
+	switch {
+	case code == 0 || code == exitNoRows:
+		// 没有行时返回空的结果，不是服务的错误
+		if !out.started {
+			w.Header().Set("Content-Type", out.contentType)
+		}
+	case out.started:
+		w.Header().Set(conversionErrorTrailer, fmt.Sprintf("conversion failed with exit code %d", code))
+	default:
+		msg := strings.TrimSpace(strings.Join(append([]string{stderr.String()}, errs.messages()...), "\n"))
+		if msg == "" {
+			msg = fmt.Sprintf("conversion failed with exit code %d, see the server log", code)
+		}
+		status := http.StatusInternalServerError
+		if code == exitUsage || code == exitParseErrors {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, msg, status)
+	}
+}
+
+// errorMessages 收集一个请求的转换输出的错误日志
+type errorMessages struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (m *errorMessages) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+func (m *errorMessages) Fire(e *log.Entry) error {
+	m.mu.Lock()
+	m.msgs = append(m.msgs, e.Message)
+	m.mu.Unlock()
+	return nil
+}
+
+// messages 返回已经收集的错误
+func (m *errorMessages) messages() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.msgs...)
+}
+
+// runServer 在 addr 上提供 HTTP 转换服务，返回进程退出码
+func runServer(addr string) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", handleConvert)
+	log.Infof("serving conversions on %s, POST /convert", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("serve failed: %v", err)
+		return 1
+	}
+	return 0
+}
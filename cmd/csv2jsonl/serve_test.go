@@ -0,0 +1,197 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServeArgs(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: "columns=id,name&pretty", wantErr: false},
+		{query: "preset=salesforce-contacts", wantErr: false},
+		{query: "preset=../../../tmp/x", wantErr: true},
+		{query: "preset=..", wantErr: true},
+		{query: "o=out.jsonl", wantErr: true},
+		{query: "config=/etc/passwd", wantErr: true},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := serveArgs(query); (err != nil) != tc.wantErr {
+			t.Errorf("serveArgs(%s) error = %v, want error %v", tc.query, err, tc.wantErr)
+		}
+	}
+}
+
+// serveConvert 将 body 以 query 的选项 POST 给 handleConvert，返回响应
+func serveConvert(t *testing.T, query, body string) *http.Response {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(handleConvert))
+	t.Cleanup(srv.Close)
+	resp, err := http.Post(srv.URL+"/convert?"+query, "text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeNoRows(t *testing.T) {
+	for _, tc := range []struct {
+		name, query, body string
+	}{
+		{name: "header only", body: "id,name\n"},
+		{name: "empty body"},
+		{name: "filter without matches", query: "filter=" + url.QueryEscape("id > 5"), body: "id,name\n1,a\n"},
+	} {
+		resp := serveConvert(t, tc.query, tc.body)
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || len(body) != 0 {
+			t.Errorf("%s: got %d %q, want 200 and an empty body", tc.name, resp.StatusCode, body)
+		}
+		if got := resp.Trailer.Get(conversionErrorTrailer); got != "" {
+			t.Errorf("%s: got trailer %s %q, want none", tc.name, conversionErrorTrailer, got)
+		}
+	}
+}
+
+func TestServeConvert(t *testing.T) {
+	resp := serveConvert(t, "infer-types&columns=id,name", "id,name,email\n1,Alice,a@example.com\n2,Bob,b@example.com\n")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("got %d %s, want 200 application/x-ndjson", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if want := "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":\"Bob\"}\n"; string(body) != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+	if got := resp.Trailer.Get(conversionErrorTrailer); got != "" {
+		t.Errorf("got trailer %s %q, want none", conversionErrorTrailer, got)
+	}
+}
+
+func TestServeMultipart(t *testing.T) {
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("comment", "not the file")
+	fw, err := mw.CreateFormFile("file", "users.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "id,name\n1,Alice\n")
+	mw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(handleConvert))
+	defer srv.Close()
+	resp, err := http.Post(srv.URL+"/convert", mw.FormDataContentType(), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "{\"id\":\"1\",\"name\":\"Alice\"}\n" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestServeBadRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name, query, body, msg string
+	}{
+		{name: "malformed body", body: "id,name\n1\n", msg: "line 2 (byte 8): wrong number of fields"},
+		{name: "unsupported flag", query: "o=out.jsonl", body: "id\n1\n", msg: "unsupported option o"},
+		{name: "config file", query: "config=/etc/passwd", body: "id\n1\n", msg: "unsupported option config"},
+		{name: "preset outside the preset directory", query: "preset=../../../tmp/x", body: "id\n1\n", msg: "invalid preset name"},
+		{name: "invalid flag value", query: "limit=many", body: "id\n1\n", msg: "invalid value \"many\" for flag -limit"},
+		{name: "invalid on-error policy", query: "on-error=ignore", body: "id\n1\n", msg: "unknown on-error policy ignore"},
+		{name: "invalid key case", query: "key-case=bogus", body: "id\n1\n", msg: "unknown key-case bogus"},
+		{name: "unknown filter column", query: "filter=zz==1", body: "id\n1\n", msg: "filter: column zz not found"},
+	} {
+		resp := serveConvert(t, tc.query, tc.body)
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), tc.msg) {
+			t.Errorf("%s: got %d %q, want 400 and %q", tc.name, resp.StatusCode, body, tc.msg)
+		}
+	}
+}
+
+// 并发的请求各自返回自己的错误
+func TestServeConcurrentErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleConvert))
+	defer srv.Close()
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+	for i := 0; i < 16; i++ {
+		column := fmt.Sprintf("c%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(srv.URL+"/convert?filter="+url.QueryEscape(column+"==1"), "text/csv", strings.NewReader("id\n1\n"))
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if want := "filter: column " + column + " not found\n"; resp.StatusCode != http.StatusBadRequest || string(body) != want {
+				errs <- fmt.Sprintf("got %d %q, want 400 and %q", resp.StatusCode, body, want)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestServeMethodNotAllowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleConvert))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("got %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+)
+
+// shardInfo 记录一个分区文件的信息
+type shardInfo struct {
+	Shard  int    `json:"shard"`
+	Path   string `json:"path"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// shardIndex 分区文件索引
+type shardIndex struct {
+	Rows int `json:"rows"`
+	// Hash 分区所用的哈希算法，用于按相同的算法查找键所在的分区
+	Hash   string      `json:"hash"`
+	Shards []shardInfo `json:"shards"`
+	// Deprecations 转换使用的废弃参数
+	Deprecations []deprecation `json:"deprecations,omitempty"`
+}
+
+// shardWriter 按记录中 key 字段的哈希将记录写入 output-0.jsonl、output-1.jsonl ...，
+// 相同 key 的记录总是写入同一个文件
+type shardWriter struct {
+	path  string
+	key   string
+	hash  string
+	parts []*outputPart
+	rows  []int
+	infos []shardInfo // 已关闭的分区
+	// zstdDict 压缩 .zst 文件使用的字典
+	zstdDict []byte
+	// preamble 写在每个文件开头，例如 -dictionary-encode 的字典
+	preamble []byte
+}
+
+func newShardWriter(path, key string, shards int, hash string) *shardWriter {
+	return &shardWriter{path: path, key: key, hash: hash, parts: make([]*outputPart, shards), rows: make([]int, shards)}
+}
+
+// open 创建所有分区文件，没有记录的分区也会创建一个空文件
+func (s *shardWriter) open() error {
+	base, ext := splitExt(s.path)
+	for n := range s.parts {
+		p, err := openPart(fmt.Sprintf("%s-%d%s", base, n, ext), 0, s.zstdDict)
+		if err != nil {
+			return err
+		}
+		s.parts[n] = p
+		if _, err := p.w.Write(s.preamble); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write 写入一条完整的记录
+func (s *shardWriter) Write(p []byte) (int, error) {
+	key, err := shardKey(p, s.key)
+	if err != nil {
+		return 0, err
+	}
+	n := shardOf(key, len(s.parts), s.hash)
+	s.rows[n]++
+	return s.parts[n].w.Write(p)
+}
+
+// shardOf 返回 key 所在的分区，即 key 的哈希对分区数取模。FNV 沿用
+// 32 位 FNV-1a 哈希，其他算法为 transform.Sum64
+func shardOf(key string, shards int, hash string) int {
+	if hash == transform.HashFNV {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return int(h.Sum32() % uint32(shards))
+	}
+	return int(transform.Sum64(hash, []byte(key)) % uint64(shards))
+}
+
+// writeAll 将 p 写入每个分区文件，如结束标记，不计入记录数
+func (s *shardWriter) writeAll(p []byte) error {
+	for _, part := range s.parts {
+		if _, err := part.w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardKey 返回记录中字段 field 的文本，字符串为其内容，数字等为 JSON 文本，
+// 字段不存在或为 null 时为空字符串。嵌套的字段按点号逐层查找
+func shardKey(record []byte, field string) (string, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(record, &m); err != nil {
+		return "", fmt.Errorf("shard-by requires records as objects: %v", err)
+	}
+	raw := lookupRaw(m, field)
+	var key string
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+	case raw[0] == '"':
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return "", err
+		}
+	default:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err != nil {
+			return "", err
+		}
+		key = buf.String()
+	}
+	return key, nil
+}
+
+// lookupRaw 查找字段，不存在时按点号查找嵌套的字段
+func lookupRaw(m map[string]json.RawMessage, field string) json.RawMessage {
+	if raw, ok := m[field]; ok {
+		return raw
+	}
+	head, rest, found := strings.Cut(field, ".")
+	if !found {
+		return nil
+	}
+	var sub map[string]json.RawMessage
+	if err := json.Unmarshal(m[head], &sub); err != nil {
+		return nil
+	}
+	return lookupRaw(sub, rest)
+}
+
+// Close 关闭所有分区文件，可以重复调用
+func (s *shardWriter) Close() error {
+	var first error
+	for n, p := range s.parts {
+		if p == nil {
+			continue
+		}
+		if err := p.Close(); err != nil && first == nil {
+			first = err
+		}
+		s.parts[n] = nil
+		s.infos = append(s.infos, shardInfo{Shard: n, Path: p.info.Path, Rows: s.rows[n], Bytes: p.info.Bytes, SHA256: p.info.SHA256})
+	}
+	return first
+}
+
+// writeIndex 写入各分区的路径、行数、大小和校验和，以及转换使用的废弃参数
+func (s *shardWriter) writeIndex(path string, deprecated []deprecation) error {
+	index := shardIndex{Hash: s.hash, Shards: make([]shardInfo, len(s.infos)), Deprecations: deprecated}
+	for _, rows := range s.rows {
+		index.Rows += rows
+	}
+	for i, info := range s.infos {
+		index.Shards[i] = info
+		index.Shards[i].Path = indexedPath(path, info.Path)
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
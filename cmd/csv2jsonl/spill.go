@@ -0,0 +1,132 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// spillPrefix 临时目录的前缀，目录名为 csv2jsonl-spill-<pid>-<随机数>
+	spillPrefix = "csv2jsonl-spill-"
+	// spillCheckInterval 写入临时文件时检查剩余空间的间隔
+	spillCheckInterval = 64 << 20
+	// defaultTmpReserve 临时目录所在磁盘至少保留的空间
+	defaultTmpReserve = "1GiB"
+)
+
+// spillDir 本进程的临时目录，保存需要读两遍的标准输入等临时文件，
+// Close 时删除。进程崩溃或被杀死时遗留的目录由之后的运行删除
+type spillDir struct {
+	path    string
+	reserve int64 // 磁盘剩余空间低于 reserve 时停止写入
+	maxSize int64 // 临时文件的总大小上限，0 表示不限制
+	size    int64
+}
+
+// newSpillDir 在 parent 中创建临时目录，parent 为空时使用系统临时目录。
+// 创建前删除遗留的临时目录并检查剩余空间
+func newSpillDir(parent string, reserve, maxSize int64) (*spillDir, error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	removeStaleSpills(parent)
+	if err := checkFreeSpace(parent, reserve); err != nil {
+		return nil, err
+	}
+	path, err := os.MkdirTemp(parent, fmt.Sprintf("%s%d-*", spillPrefix, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	return &spillDir{path: path, reserve: reserve, maxSize: maxSize}, nil
+}
+
+// removeStaleSpills 删除已经退出的进程遗留的临时目录
+func removeStaleSpills(parent string) {
+	matches, _ := filepath.Glob(filepath.Join(parent, spillPrefix+"*"))
+	for _, path := range matches {
+		pidText, _, _ := strings.Cut(strings.TrimPrefix(filepath.Base(path), spillPrefix), "-")
+		pid, err := strconv.Atoi(pidText)
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Warnf("remove stale spill directory %s failed: %v", path, err)
+			continue
+		}
+		log.Infof("removed stale spill directory %s", path)
+	}
+}
+
+// checkFreeSpace 检查 dir 所在磁盘的剩余空间不低于 reserve，无法获取时不检查
+func checkFreeSpace(dir string, reserve int64) error {
+	free, err := freeSpace(dir)
+	if err != nil || free < 0 {
+		return nil
+	}
+	if free < reserve {
+		return fmt.Errorf("%s has %d bytes free, less than the %d bytes reserved by -tmp-reserve", dir, free, reserve)
+	}
+	return nil
+}
+
+// spool 将 r 写入临时文件，返回文件路径
+func (d *spillDir) spool(r io.Reader) (string, error) {
+	f, err := os.CreateTemp(d.path, "spool-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(&spillWriter{w: f, dir: d}, r); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Close 删除临时目录及其中的文件
+func (d *spillDir) Close() error {
+	return os.RemoveAll(d.path)
+}
+
+// spillWriter 统计写入临时目录的字节数，超过 maxSize 时写入失败，
+// 每写入 spillCheckInterval 字节检查一次剩余空间
+type spillWriter struct {
+	w   io.Writer
+	dir *spillDir
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	d := w.dir
+	if d.maxSize > 0 && d.size+int64(len(p)) > d.maxSize {
+		return 0, fmt.Errorf("temporary files exceed the %d bytes of -max-temp-disk", d.maxSize)
+	}
+	if d.size/spillCheckInterval != (d.size+int64(len(p)))/spillCheckInterval {
+		if err := checkFreeSpace(d.path, d.reserve); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.w.Write(p)
+	d.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+// freeSpace 无法获取剩余空间，返回 -1
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
+
+// processAlive 无法判断进程是否存在，视为存在，遗留的目录不会被删除
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+)
+
+// sqlDialects 各 SQL 方言引用标识符的字符，mysql 的字符串中反斜杠也需要转义
+var sqlDialects = map[string]byte{
+	"ansi":  '"',
+	"mysql": '`',
+}
+
+// sqlWriter 将转换器写出的每条 JSON 记录改写为 INSERT 语句，
+// batch 条记录合并为一条多行的语句
+type sqlWriter struct {
+	w       io.Writer
+	table   string
+	dialect string
+	batch   int
+	nested  bool
+	// columns 输出的列名，fields 为记录中对应的字段，"$" 表示只输出一列时的值
+	columns []string
+	fields  []string
+	rows    []string
+}
+
+func newSQLWriter(table, dialect string, batch int, nested bool) *sqlWriter {
+	return &sqlWriter{table: table, dialect: dialect, batch: batch, nested: nested}
+}
+
+// onLineage 按输出字段的顺序确定列，之后调用 next
+func (s *sqlWriter) onLineage(opts *convertOptions, next func(*convert.Lineage) error) func(*convert.Lineage) error {
+	return func(l *convert.Lineage) error {
+		s.columns, s.fields = nil, nil
+		for _, f := range l.Fields {
+			column := f.Field
+			if column == "$" {
+				column = opts.key(f.Sources[0])
+			}
+			s.columns = append(s.columns, column)
+			s.fields = append(s.fields, f.Field)
+		}
+		if next != nil {
+			return next(l)
+		}
+		return nil
+	}
+}
+
+func (s *sqlWriter) wrap(w io.Writer) io.Writer {
+	s.w = w
+	return s
+}
+
+// Write 接收一条 JSON 记录，凑满 batch 条时写出语句
+func (s *sqlWriter) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var record interface{}
+	if err := dec.Decode(&record); err != nil {
+		return 0, fmt.Errorf("sql: decode record failed: %v", err)
+	}
+	if s.fields == nil {
+		// 模板渲染的记录没有字段来源，按第一条记录的字段确定列
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("sql: records must be objects")
+		}
+		for key := range m {
+			s.fields = append(s.fields, key)
+		}
+		sort.Strings(s.fields)
+		s.columns = s.fields
+	}
+
+	values := make([]string, len(s.fields))
+	for i, field := range s.fields {
+		v, ok := record, true
+		if field != "$" {
+			v, ok = lookupField(record, field, s.nested)
+		}
+		if !ok {
+			v = nil
+		}
+		values[i] = s.literal(v)
+	}
+	s.rows = append(s.rows, "("+strings.Join(values, ", ")+")")
+	if len(s.rows) >= s.batch {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush 写出缓存的行，底层的 Writer 在每条语句前换文件
+func (s *sqlWriter) flush() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+	if rw, ok := s.w.(interface{ BeginRecord() error }); ok {
+		if err := rw.BeginRecord(); err != nil {
+			return err
+		}
+	}
+	columns := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		columns[i] = s.identifier(col)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES", s.tableName(), strings.Join(columns, ", "))
+	if len(s.rows) > 1 {
+		b.WriteString("\n")
+	} else {
+		b.WriteString(" ")
+	}
+	b.WriteString(strings.Join(s.rows, ",\n"))
+	b.WriteString(";\n")
+	s.rows = s.rows[:0]
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+// Close 写出剩余的行
+func (s *sqlWriter) Close() error {
+	return s.flush()
+}
+
+// tableName 引用表名，schema.table 的每一部分分别引用
+func (s *sqlWriter) tableName() string {
+	parts := strings.Split(s.table, ".")
+	for i, part := range parts {
+		parts[i] = s.identifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// identifier 引用标识符，其中的引号重复一次
+func (s *sqlWriter) identifier(name string) string {
+	q := string(sqlDialects[s.dialect])
+	return q + strings.ReplaceAll(name, q, q+q) + q
+}
+
+// literal 返回值的 SQL 字面量，对象和数组写为 JSON 文本
+func (s *sqlWriter) literal(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case json.Number:
+		return v.String()
+	case string:
+		return s.quote(v)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return s.quote(strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// quote 引用字符串，单引号重复一次，mysql 中反斜杠也需要转义
+func (s *sqlWriter) quote(text string) string {
+	if s.dialect == "mysql" {
+		text = strings.ReplaceAll(text, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"math"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+)
+
+// validateErrors 校验报告中列出的格式错误的行数
+const validateErrors = 20
+
+// validationReport -validate 写出的校验结果
+type validationReport struct {
+	Source    string `json:"source"`
+	Valid     bool   `json:"valid"`
+	Rows      int    `json:"rows"`
+	Emitted   int    `json:"emitted"`
+	Malformed int    `json:"malformed"`
+	// Error 使转换停止的错误，如 -assert-sorted 或 -strict-columns 的检查失败
+	Error   string             `json:"error,omitempty"`
+	Columns []validationColumn `json:"columns"`
+	Errors  []validationError  `json:"errors,omitempty"`
+}
+
+// validationColumn 一个输出字段的填充率，保留三位小数，null 和空字符串不计为填充
+type validationColumn struct {
+	Name     string  `json:"name"`
+	Filled   int     `json:"filled"`
+	FillRate float64 `json:"fill_rate"`
+}
+
+type validationError struct {
+	convert.Position
+	Error string `json:"error"`
+}
+
+// validator 转换但不写出结果，统计各字段的填充数并记录格式错误的行
+type validator struct {
+	nested  bool
+	records int
+	fields  []string
+	filled  map[string]int
+	errors  []validationError
+}
+
+func newValidator(nested bool) *validator {
+	return &validator{nested: nested, filled: map[string]int{}}
+}
+
+// onLineage 按输出字段的顺序记录字段，next 不为空时继续调用
+func (v *validator) onLineage(next func(*convert.Lineage) error) func(*convert.Lineage) error {
+	return func(l *convert.Lineage) error {
+		v.fields = v.fields[:0]
+		for _, f := range l.Fields {
+			v.fields = append(v.fields, f.Field)
+		}
+		if next != nil {
+			return next(l)
+		}
+		return nil
+	}
+}
+
+// onError 记录格式错误的行，next 为空时跳过该行，以便校验整个输入
+func (v *validator) onError(next convert.ErrorHandler) convert.ErrorHandler {
+	return func(e *convert.RowError) error {
+		if len(v.errors) < validateErrors {
+			v.errors = append(v.errors, validationError{Position: e.Position, Error: e.Err.Error()})
+		}
+		if next != nil {
+			return next(e)
+		}
+		return nil
+	}
+}
+
+// observe 统计一条输出记录中填充的字段
+func (v *validator) observe(record interface{}) {
+	v.records++
+	for _, field := range v.fields {
+		value, ok := record, true
+		if field != "$" {
+			value, ok = lookupField(record, field, v.nested)
+		}
+		if ok && value != nil && value != "" {
+			v.filled[field]++
+		}
+	}
+}
+
+// report 根据转换的统计和错误生成校验结果，有格式错误的行或转换失败时无效
+func (v *validator) report(source string, stats convert.Stats, err error) *validationReport {
+	r := &validationReport{
+		Source:    source,
+		Valid:     err == nil && stats.Malformed == 0,
+		Rows:      stats.Rows,
+		Emitted:   stats.Emitted,
+		Malformed: stats.Malformed,
+		Columns:   make([]validationColumn, 0, len(v.fields)),
+		Errors:    v.errors,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, field := range v.fields {
+		c := validationColumn{Name: field, Filled: v.filled[field]}
+		if v.records > 0 {
+			c.FillRate = math.Round(float64(c.Filled)/float64(v.records)*1000) / 1000
+		}
+		r.Columns = append(r.Columns, c)
+	}
+	return r
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// loadValueMaps 读取各列代码到可读值的查找表，YAML 或 JSON 格式，如
+//
+//	status:
+//	  "0": inactive
+//	  "1": active
+//
+// cacheDir 不为空时，解析后的查找表以 gob 编码缓存在其中，以文件的绝对路径、大小和
+// 修改时间的 SHA-256 命名，命中缓存时不必读取文件，文件修改后自然失效，批量的短任务
+// 不必每次读取和解析大的 YAML 文件
+func loadValueMaps(path, cacheDir string) (map[string]map[string]string, error) {
+	var cachePath string
+	var info os.FileInfo
+	if cacheDir != "" {
+		var err error
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+		cachePath, err = valueMapCachePath(cacheDir, path, info)
+		if err != nil {
+			return nil, err
+		}
+		maps, err := readValueMapCache(cachePath)
+		if err == nil {
+			log.Debugf("load map file %s from cache %s", path, cachePath)
+			return maps, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("read map cache %s failed, parse %s again: %v", cachePath, path, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var maps map[string]map[string]string
+	if err := yaml.Unmarshal(data, &maps); err != nil {
+		return nil, fmt.Errorf("parse map file %s failed: %v", path, err)
+	}
+	if cachePath != "" {
+		// 读取期间文件被修改时，内容不一定对应缓存的名字，不写入缓存
+		if now, err := os.Stat(path); err != nil || now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime()) {
+			log.Warnf("map file %s changed while reading, not cached", path)
+			return maps, nil
+		}
+		// 缓存写入失败不影响转换
+		if err := writeValueMapCache(cachePath, maps); err != nil {
+			log.Warnf("write map cache %s failed: %v", cachePath, err)
+		}
+	}
+	return maps, nil
+}
+
+// valueMapCachePath 返回文件的缓存路径，路径、大小或修改时间不同的文件缓存在不同的文件中
+func valueMapCachePath(cacheDir, path string, info os.FileInfo) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", abs, info.Size(), info.ModTime().UnixNano())))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".gob"), nil
+}
+
+func readValueMapCache(path string) (map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var maps map[string]map[string]string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&maps); err != nil {
+		return nil, err
+	}
+	return maps, nil
+}
+
+// writeValueMapCache 先写入临时文件再重命名，并发的任务不会读到不完整的缓存
+func writeValueMapCache(path string, maps map[string]map[string]string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(maps); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// mergeValueMaps 将 overrides 合并到 maps 中，相同的代码以 overrides 为准
+func mergeValueMaps(maps, overrides map[string]map[string]string) map[string]map[string]string {
+	if maps == nil {
+		return overrides
+	}
+	for col, codes := range overrides {
+		if maps[col] == nil {
+			maps[col] = map[string]string{}
+		}
+		for code, value := range codes {
+			maps[col][code] = value
+		}
+	}
+	return maps
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadValueMapsCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	path := filepath.Join(dir, "maps.yaml")
+	if err := os.WriteFile(path, []byte("status:\n  \"0\": inactive\n  \"1\": active\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{"status": {"0": "inactive", "1": "active"}}
+
+	// 并发的第一次运行都解析文件并写入同一个缓存
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if maps, err := loadValueMaps(path, cacheDir); err != nil || !reflect.DeepEqual(maps, want) {
+				t.Errorf("loadValueMaps = %v, %v", maps, err)
+			}
+		}()
+	}
+	wg.Wait()
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || filepath.Ext(entries[0].Name()) != ".gob" {
+		t.Fatalf("cache entries = %v, want a single .gob file without temporary files", entries)
+	}
+	cachePath := filepath.Join(cacheDir, entries[0].Name())
+
+	// 之后的运行读取缓存，替换缓存的内容可以看出没有再解析文件
+	cached := map[string]map[string]string{"status": {"0": "from cache"}}
+	if err := writeValueMapCache(cachePath, cached); err != nil {
+		t.Fatal(err)
+	}
+	if maps, err := loadValueMaps(path, cacheDir); err != nil || !reflect.DeepEqual(maps, cached) {
+		t.Errorf("loadValueMaps = %v, %v, want the cached tables", maps, err)
+	}
+
+	// 损坏的缓存被忽略并重新写入
+	if err := os.WriteFile(cachePath, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if maps, err := loadValueMaps(path, cacheDir); err != nil || !reflect.DeepEqual(maps, want) {
+		t.Errorf("loadValueMaps = %v, %v with a corrupt cache", maps, err)
+	}
+	if maps, err := readValueMapCache(cachePath); err != nil || !reflect.DeepEqual(maps, want) {
+		t.Errorf("rewritten cache = %v, %v", maps, err)
+	}
+
+	// 文件修改后以新的大小和修改时间缓存，大小相同时以修改时间区分
+	if err := os.WriteFile(path, []byte("status:\n  \"0\": disabled\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if maps, err := loadValueMaps(path, cacheDir); err != nil || maps["status"]["0"] != "disabled" {
+		t.Errorf("loadValueMaps = %v, %v after the file changed", maps, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("status:\n  \"0\": inactive\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if maps, err := loadValueMaps(path, cacheDir); err != nil || maps["status"]["0"] != "inactive" {
+		t.Errorf("loadValueMaps = %v, %v after the file changed to the same size", maps, err)
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 3 {
+		t.Errorf("cache entries = %v, want one per file version", entries)
+	}
+}
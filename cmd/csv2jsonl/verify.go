@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// verifyError 一行不符合要求的原因，Line 为 0 时针对整个文件
+type verifyError struct {
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error"`
+}
+
+// verifyReport verify 子命令输出的报告
+type verifyReport struct {
+	File         string `json:"file"`
+	Rows         int    `json:"rows"`
+	ExpectedRows *int   `json:"expected_rows,omitempty"`
+	// Dictionary 文件以 -dictionary-encode 的字典开头
+	Dictionary  bool          `json:"dictionary,omitempty"`
+	Valid       bool          `json:"valid"`
+	InvalidRows int           `json:"invalid_rows"`
+	Errors      []verifyError `json:"errors,omitempty"`
+}
+
+// parseLine 解析一行 JSON，数字保留为 json.Number
+func parseLine(line []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil, fmt.Errorf("empty line")
+	}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid json: unexpected data after the value")
+	}
+	return v, nil
+}
+
+// isDictionary 判断记录是否为 -dictionary-encode 的字典
+func isDictionary(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return false
+	}
+	_, ok = m["$dictionary"]
+	return ok
+}
+
+// verifyRecords 逐行检查 r，最多记录 maxErrors 个错误
+func verifyRecords(r io.Reader, schema *jsonSchema, maxErrors int, report *verifyReport) error {
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err == io.EOF && len(data) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		data = bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+
+		v, verr := parseLine(data)
+		if line == 1 && verr == nil && isDictionary(v) {
+			report.Dictionary = true
+			continue
+		}
+		if verr == nil && schema != nil {
+			verr = schema.validate("$", v)
+		}
+		report.Rows++
+		if verr != nil {
+			report.InvalidRows++
+			if len(report.Errors) < maxErrors {
+				report.Errors = append(report.Errors, verifyError{Line: line, Error: verr.Error()})
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// runVerify 检查已有的 JSONL 文件，返回进程退出码
+func runVerify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	i := fs.String("i", "", "input jsonl file, - or empty for stdin")
+	schemaPath := fs.String("schema", "", "json schema file every record must match")
+	rows := fs.Int("rows", -1, "expected number of records, -1 as any")
+	maxErrors := fs.Int("max-errors", 10, "max number of errors listed in the report")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	var schema *jsonSchema
+	if *schemaPath != "" {
+		var err error
+		if schema, err = loadJSONSchema(*schemaPath); err != nil {
+			log.Errorf("load json schema failed: %v", err)
+			return exitUsage
+		}
+	}
+
+	in, err := openInput(*i, stdin)
+	if err != nil {
+		log.Errorf("open file failed: %v", err)
+		return 1
+	}
+	defer in.Close()
+
+	report := verifyReport{File: *i}
+	if report.File == "" {
+		report.File = "-"
+	}
+	if err := verifyRecords(in, schema, *maxErrors, &report); err != nil {
+		log.Errorf("read file failed: %v", err)
+		return 1
+	}
+	if *rows >= 0 {
+		report.ExpectedRows = rows
+		if report.Rows != *rows {
+			report.Errors = append(report.Errors, verifyError{Error: fmt.Sprintf("expected %d records, got %d", *rows, report.Rows)})
+		}
+	}
+	report.Valid = report.InvalidRows == 0 && (*rows < 0 || report.Rows == *rows)
+
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Errorf("write report failed: %v", err)
+		return 1
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
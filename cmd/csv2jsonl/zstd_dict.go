@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	zstddict "github.com/klauspost/compress/dict"
+	log "github.com/sirupsen/logrus"
+)
+
+// zstd 字典历史数据的最大长度
+const zstdDictHistorySize = 112 << 10
+
+// dictTrainer 缓存前 samples 条记录训练 zstd 字典，训练完成后将字典
+// 写入 path，并用该字典压缩全部输出
+type dictTrainer struct {
+	out     *splitWriter
+	path    string
+	samples int
+	records [][]byte
+	trained bool
+}
+
+func newDictTrainer(out *splitWriter, path string, samples int) *dictTrainer {
+	return &dictTrainer{out: out, path: path, samples: samples}
+}
+
+func (t *dictTrainer) BeginRecord() error {
+	if !t.trained && len(t.records) >= t.samples {
+		if err := t.train(); err != nil {
+			return err
+		}
+	}
+	if t.trained {
+		return t.out.BeginRecord()
+	}
+	t.records = append(t.records, nil)
+	return nil
+}
+
+func (t *dictTrainer) Write(p []byte) (int, error) {
+	if t.trained {
+		return t.out.Write(p)
+	}
+	if len(t.records) == 0 {
+		t.records = append(t.records, nil)
+	}
+	last := len(t.records) - 1
+	t.records[last] = append(t.records[last], p...)
+	return len(p), nil
+}
+
+// Close 在记录数不足 samples 时使用已缓存的记录训练字典
+func (t *dictTrainer) Close() error {
+	if t.trained {
+		return nil
+	}
+	return t.train()
+}
+
+// buildZstdDict 使用样本训练字典，历史数据由样本中重复出现的片段组成。
+// 字典 ID 取自样本的校验和，相同的样本训练出相同的字典
+func buildZstdDict(samples [][]byte) (dict []byte, err error) {
+	// 样本完全由重复的片段组成、没有字面量时 zstd 统计编码表会除以零
+	defer func() {
+		if r := recover(); r != nil {
+			dict, err = nil, fmt.Errorf("samples are too repetitive: %v", r)
+		}
+	}()
+
+	crc := crc32.NewIEEE()
+	for _, sample := range samples {
+		crc.Write(sample)
+	}
+	return zstddict.BuildZstdDict(samples, zstddict.Options{
+		MaxDictSize: zstdDictHistorySize,
+		HashBytes:   6,
+		// 小于 32768 的 ID 是保留的
+		ZstdDictID: 32768 + crc.Sum32()%(1<<31-32768),
+		// 与 zstd 1.5.5 及更早的命令行工具兼容
+		ZstdDictCompat: true,
+	})
+}
+
+func (t *dictTrainer) train() error {
+	t.trained = true
+
+	dict, err := buildZstdDict(t.records)
+	if err != nil {
+		// 样本过少时无法训练，退化为不使用字典的压缩
+		log.Warnf("train zstd dictionary failed, compress without dictionary: %v", err)
+	} else {
+		if err := os.WriteFile(t.path, dict, 0o644); err != nil {
+			return fmt.Errorf("write zstd dictionary failed: %v", err)
+		}
+		log.Infof("trained zstd dictionary of %d bytes from %d records", len(dict), len(t.records))
+		t.out.zstdDict = dict
+	}
+
+	for _, record := range t.records {
+		if err := t.out.BeginRecord(); err != nil {
+			return err
+		}
+		if _, err := t.out.Write(record); err != nil {
+			return err
+		}
+	}
+	t.records = nil
+	return nil
+}
+
+// loadZstdDict 读取已训练的字典
+func loadZstdDict(path string) ([]byte, error) {
+	dict, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(dict, []byte{0x37, 0xa4, 0x30, 0xec}) {
+		return nil, fmt.Errorf("%s is not a zstd dictionary", path)
+	}
+	return dict, nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestBuildZstdDictRepetitive(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id":%d,"event":"page_view","status":"active"}`+"\n", i%10)))
+	}
+	// 样本几乎都是重复的片段时也能训练出字典
+	dict, err := buildZstdDict(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	data := bytes.Join(samples, nil)
+	if got, err := d.DecodeAll(e.EncodeAll(data, nil), nil); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("round trip with the dictionary = %q, %v", got, err)
+	}
+}
+
+func TestZstdDictTrain(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "events.csv")
+	var csv bytes.Buffer
+	csv.WriteString("id,user,event,country,amount\n")
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&csv, "%d,user%x,%s,%s,%d.%02d\n", i, i*7919%10007, []string{"page_view", "click", "purchase"}[i%3], []string{"US", "DE", "FR", "JP"}[i%4], i*31%997, i%100)
+	}
+	if err := os.WriteFile(input, csv.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if code := Run([]string{"-log-level", "error", "-i", input}, nil, &want, io.Discard); code != 0 {
+		t.Fatalf("convert without compression: exit code %d", code)
+	}
+
+	dictPath := filepath.Join(dir, "events.dict")
+	args := []string{"-log-level", "error", "-i", input, "-o", filepath.Join(dir, "train.jsonl.zst"), "-split-rows", "100", "-zstd-dict-train", dictPath, "-zstd-dict-samples", "200"}
+	if code := Run(args, nil, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("%v: exit code %d", args, code)
+	}
+	dict, err := loadZstdDict(dictPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeZstdParts(t, filepath.Join(dir, "train-*.jsonl.zst"), 4, dict); got != want.String() {
+		t.Errorf("parts compressed with the trained dictionary decode to\n%s\nwant\n%s", got, want.String())
+	}
+
+	// 训练的字典可以用于之后的转换
+	args = []string{"-log-level", "error", "-i", input, "-o", filepath.Join(dir, "reuse.jsonl.zst"), "-split-rows", "200", "-zstd-dict", dictPath}
+	if code := Run(args, nil, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("%v: exit code %d", args, code)
+	}
+	if got := decodeZstdParts(t, filepath.Join(dir, "reuse-*.jsonl.zst"), 2, dict); got != want.String() {
+		t.Errorf("parts compressed with a reused dictionary decode to\n%s\nwant\n%s", got, want.String())
+	}
+
+	// 没有字典时无法解压
+	parts, _ := filepath.Glob(filepath.Join(dir, "reuse-*.jsonl.zst"))
+	data, err := os.ReadFile(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.DecodeAll(data, nil); err == nil {
+		t.Error("a part compressed with the dictionary decoded without it")
+	}
+}
+
+// decodeZstdParts 用字典 dict 依次解压匹配 pattern 的 n 个文件，返回拼接的内容
+func decodeZstdParts(t *testing.T, pattern string, n int, dict []byte) string {
+	t.Helper()
+	parts, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != n {
+		t.Fatalf("%s matches %d files, want %d", pattern, len(parts), n)
+	}
+	d, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	var out []byte
+	for _, part := range parts {
+		data, err := os.ReadFile(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err = d.DecodeAll(data, out); err != nil {
+			t.Fatalf("decode %s: %v", part, err)
+		}
+	}
+	return string(out)
+}
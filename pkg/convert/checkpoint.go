@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+)
+
+// Checkpoint is the progress of a conversion between two rows, see
+// WithCheckpoint and WithResume.
+type Checkpoint struct {
+	// DataOffset is the byte offset of the first row after the header.
+	DataOffset int64 `json:"data_offset"`
+	// Offset and Line are the byte offset and the line number of the next
+	// row, counted as in Position.
+	Offset int64 `json:"offset"`
+	Line   int   `json:"line"`
+	// Rows, Emitted and Malformed are the Stats of the conversion so far.
+	Rows      int `json:"rows"`
+	Emitted   int `json:"emitted"`
+	Malformed int `json:"malformed"`
+}
+
+// checkpointMarker 与记录一起按顺序传给 Convert，此前的记录写出后调用 onCheckpoint
+type checkpointMarker Checkpoint
+
+// WithCheckpoint calls fn with the progress of the conversion about every n
+// rows read, once the records of these rows have been written. An error
+// returned by fn stops the conversion.
+func WithCheckpoint(n int, fn func(Checkpoint) error) Option {
+	return func(c *Converter) {
+		c.checkpointRows, c.onCheckpoint = n, fn
+	}
+}
+
+// WithResume continues a conversion of the same input with the same
+// options from cp, usually the last Checkpoint of a conversion that failed:
+// the header is read, the rows before cp.Offset are skipped, seeking if r
+// implements io.Seeker, and the records of the rows after it are written.
+// Positions, Stats, WithSkip and WithLimit count from the start of the
+// input as if the conversion had not been interrupted.
+func WithResume(cp Checkpoint) Option {
+	return func(c *Converter) {
+		c.resume = &cp
+	}
+}
+
+// resumeReader 读取 keep 个字节（表头）后跳过 skip 个字节（已经转换的行）
+type resumeReader struct {
+	r          io.Reader
+	keep, skip int64
+	// bom 无表头时位置不计开头的字节序标记，跳过前先去掉该标记
+	bom     bool
+	pending []byte
+}
+
+func (c *Converter) newResumeReader(r io.Reader) io.Reader {
+	if c.resume == nil {
+		return r
+	}
+	return &resumeReader{r: r, keep: c.resume.DataOffset, skip: c.resume.Offset - c.resume.DataOffset, bom: c.noHeader}
+}
+
+func (r *resumeReader) Read(p []byte) (int, error) {
+	if r.keep <= 0 && r.skip > 0 {
+		if err := r.skipRows(); err != nil {
+			return 0, err
+		}
+	}
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	if r.keep > 0 && int64(len(p)) > r.keep {
+		p = p[:r.keep]
+	}
+	n, err := r.r.Read(p)
+	r.keep -= int64(n)
+	return n, err
+}
+
+func (r *resumeReader) skipRows() error {
+	skip := r.skip
+	r.skip = 0
+	if r.bom {
+		head := make([]byte, len(source.BOM))
+		n, err := io.ReadFull(r.r, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if n < len(head) || string(head) != source.BOM {
+			// 不是字节序标记，读出的字节属于已经转换的行或之后的数据
+			if int64(n) > skip {
+				r.pending = head[skip:n]
+				return nil
+			}
+			skip -= int64(n)
+		}
+	}
+	if s, ok := r.r.(io.Seeker); ok {
+		_, err := s.Seek(skip, io.SeekCurrent)
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, r.r, skip); err != io.EOF {
+		return err
+	}
+	return errors.New("resume: the input ends before the checkpoint")
+}
+
+// endLine 返回读取的一行结束后下一行的行号，引号内的换行计入行数
+func endLine(csvReader *csv.Reader, row []string) int {
+	line, _ := csvReader.FieldPos(len(row) - 1)
+	return line + strings.Count(row[len(row)-1], "\n") + 1
+}
@@ -0,0 +1,527 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"io"
+	"text/template"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/sink"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	log "github.com/sirupsen/logrus"
+)
+
+// Converter converts CSV read from an io.Reader to JSON Lines.
+type Converter struct {
+	columns    []string
+	limit      int
+	skip       int
+	pretty     bool
+	asciiOnly  bool
+	nested     bool
+	delimiter  rune
+	noHeader   bool
+	header     []string
+	renames    map[string]string
+	types      map[string]string
+	parser     ValueParser
+	transforms map[string][]string
+	// valueMaps 各列代码到可读值的查找表
+	valueMaps map[string]map[string]string
+	// defaults 各列空单元格的默认值
+	defaults   map[string]string
+	dictionary map[string]map[string]int
+	whereDate  string
+	filter     string
+
+	workers    int
+	onError    ErrorHandler
+	detectLang []string
+	parseUA    []string
+	onLineage  func(*Lineage) error
+	// positionField 写入行在输入中位置的字段名，为空时不写入
+	positionField string
+	observe       func(record interface{})
+	stats         Stats
+	assertSorted  *SortAssertion
+	dedupe        *Dedupe
+	emptyAsNull   bool
+	omitEmpty     bool
+	strictColumns bool
+	// hash 分区以外按键哈希所用的算法，见 WithHash
+	hash string
+	// keyCase 没有重命名的列的键的格式，见 WithKeyCase
+	keyCase string
+	// trimSpace、stripControl 读取单元格后清理空白和控制字符，见 WithTrimSpace
+	trimSpace    bool
+	stripControl bool
+	// rowNumberField 写入行序号的字段名，metaFields 写入每条记录的固定字段
+	rowNumberField string
+	metaFields     map[string]interface{}
+	// unordered 多个协程转换时按完成的顺序写出记录，见 WithUnordered
+	unordered bool
+	// checkpointRows 每读取多少行调用一次 onCheckpoint，resume 为继续转换的位置
+	checkpointRows int
+	onCheckpoint   func(Checkpoint) error
+	resume         *Checkpoint
+	sample         *Sample
+	// protections 各列的保护方式，protectors 为读取表头后创建的保护函数
+	protections map[string]Protection
+	protectors  map[string]protector
+	// kAnonymity 隐去少见的准标识符组合，quasiIndexes 为读取表头后准标识符列的序号
+	kAnonymity   *KAnonymity
+	quasiIndexes []int
+	// transformFuncs 读取表头后按 transforms 创建的转换
+	transformFuncs map[string][]transform.Func
+	// template 渲染每条记录的模板，见 sink.ParseTemplate
+	template *template.Template
+	// dateLayouts、dateOutput TypeDate 列的解析格式和输出方式
+	dateLayouts []string
+	dateOutput  string
+	// jsonColumns 按 JSON 解析的列，指定后不再按前缀猜测其他列是否为 JSON
+	jsonColumns []string
+	// flatten 将 JSON 单元格的对象合并到记录中，flattenPrefix 时键以字段名为前缀
+	flatten       bool
+	flattenPrefix bool
+	// warnLimit 每种行的警告输出的次数，warnings 为每次转换统计警告
+	warnLimit int
+	warnings  *warnThrottle
+	// foldCase 列引用忽略大小写，resolver 为按表头解析列引用后设置
+	foldCase bool
+	resolver *ColumnResolver
+	// logger 输出转换过程的日志，见 WithLogger
+	logger log.FieldLogger
+}
+
+// Option configures a Converter.
+type Option func(*Converter)
+
+// WithColumns selects the columns to convert, all columns are converted by
+// default. If only one column is selected, its value is written as is
+// instead of an object.
+//
+// Options taking columns accept column references, e.g. #2 for the second
+// column or /^addr_/ for the columns matching a regular expression, see
+// ColumnResolver.
+func WithColumns(columns ...string) Option {
+	return func(c *Converter) {
+		c.columns = columns
+	}
+}
+
+// WithCaseInsensitiveColumns resolves the column references of all options
+// ignoring case, see ColumnResolver.
+func WithCaseInsensitiveColumns(foldCase bool) Option {
+	return func(c *Converter) {
+		c.foldCase = foldCase
+	}
+}
+
+// WithLimit stops the conversion after limit rows, 0 means no limit.
+func WithLimit(limit int) Option {
+	return func(c *Converter) {
+		c.limit = limit
+	}
+}
+
+// WithSkip skips the first n data rows before filtering, e.g. to resume a
+// conversion or to convert a large file in chunks together with WithLimit.
+func WithSkip(n int) Option {
+	return func(c *Converter) {
+		c.skip = n
+	}
+}
+
+// WithPretty indents the output and parses cells holding JSON objects.
+func WithPretty(pretty bool) Option {
+	return func(c *Converter) {
+		c.pretty = pretty
+	}
+}
+
+// WithASCIIOnly escapes all non-ASCII characters in the output as \uXXXX,
+// characters outside the Basic Multilingual Plane as surrogate pairs.
+func WithASCIIOnly(asciiOnly bool) Option {
+	return func(c *Converter) {
+		c.asciiOnly = asciiOnly
+	}
+}
+
+// WithNested writes columns with dotted names such as user.address.city as
+// nested objects. A column whose path conflicts with another column, e.g.
+// user.name next to user, keeps its flat name.
+func WithNested(nested bool) Option {
+	return func(c *Converter) {
+		c.nested = nested
+	}
+}
+
+// WithEmptyAsNull writes empty cells as null instead of empty strings.
+func WithEmptyAsNull(emptyAsNull bool) Option {
+	return func(c *Converter) {
+		c.emptyAsNull = emptyAsNull
+	}
+}
+
+// WithOmitEmpty leaves the keys of empty cells out of the records instead
+// of writing empty strings. It has no effect when a single column is
+// selected.
+func WithOmitEmpty(omitEmpty bool) Option {
+	return func(c *Converter) {
+		c.omitEmpty = omitEmpty
+	}
+}
+
+// WithDelimiter sets the field delimiter, comma by default.
+func WithDelimiter(delimiter rune) Option {
+	return func(c *Converter) {
+		c.delimiter = delimiter
+	}
+}
+
+// WithNoHeader reads the first row of the input as data instead of the
+// header. The columns are named header, or col1, col2, ... by default, see
+// source.NewHeaderlessCSVReader.
+func WithNoHeader(header ...string) Option {
+	return func(c *Converter) {
+		c.noHeader = true
+		c.header = header
+	}
+}
+
+// WithRenames maps column names to the keys written in the output.
+func WithRenames(renames map[string]string) Option {
+	return func(c *Converter) {
+		c.renames = renames
+	}
+}
+
+// WithTypes converts the cells of the given columns to the given types,
+// see TypeString and the other Type constants.
+func WithTypes(types map[string]string) Option {
+	return func(c *Converter) {
+		c.types = types
+	}
+}
+
+// WithDateLayouts parses the cells of TypeDate columns with the given Go
+// time layouts, e.g. "01/02/2006", before the ISO 8601 layouts recognized by
+// default. It also applies to WithWhereDate. Dates without a time zone are
+// in UTC.
+func WithDateLayouts(layouts ...string) Option {
+	return func(c *Converter) {
+		c.dateLayouts = layouts
+	}
+}
+
+// WithDateOutput sets how the cells of TypeDate columns are written, see
+// DateAuto, DateRFC3339 and DateEpoch.
+func WithDateOutput(output string) Option {
+	return func(c *Converter) {
+		c.dateOutput = output
+	}
+}
+
+// WithTransforms applies named transforms in order to the cells of the
+// given columns before their types, e.g. {"description": {"html_unescape"}}
+// or {"salary": {"dp_laplace(0.5,1000)"}}. See transform.Names for the
+// supported transforms.
+func WithTransforms(transforms map[string][]string) Option {
+	return func(c *Converter) {
+		c.transforms = transforms
+	}
+}
+
+// WithJSONColumns parses the cells of the given columns as embedded JSON
+// documents, objects, arrays or scalars, as if their type were TypeJSON
+// unless WithTypes gives them another type. Cells that are not valid JSON
+// are written as strings. Once set, the cells of the other columns are no
+// longer parsed by WithPretty or as the single selected column because they
+// look like JSON objects, e.g. a title such as "{draft}".
+func WithJSONColumns(columns ...string) Option {
+	return func(c *Converter) {
+		c.jsonColumns = columns
+	}
+}
+
+// WithValueParser converts cells with parser instead of writing them as
+// strings, e.g. WithValueParser(InferTypes).
+func WithValueParser(parser ValueParser) Option {
+	return func(c *Converter) {
+		c.parser = parser
+	}
+}
+
+// WithDictionary writes the cells of the dictionary columns found in the
+// dictionary as the index of their value, see BuildDictionary. The
+// dictionary itself is not written.
+func WithDictionary(d Dictionary) Option {
+	return func(c *Converter) {
+		c.dictionary = d.index()
+	}
+}
+
+// WithWhereDate only converts rows matching date conditions joined by and,
+// e.g. "created_at >= 2024-01-01 and created_at < 2024-02-01". Cells are
+// parsed as dates, rows with unparsable dates do not match.
+func WithWhereDate(expr string) Option {
+	return func(c *Converter) {
+		c.whereDate = expr
+	}
+}
+
+// WithWorkers converts and serializes rows with n goroutines, the output
+// keeps the input order. Reading the CSV stays sequential.
+func WithWorkers(n int) Option {
+	return func(c *Converter) {
+		c.workers = n
+	}
+}
+
+// WithUnordered writes the records converted by the WithWorkers goroutines
+// as soon as a batch is done instead of in the input order, so a slow batch
+// does not hold back the others. Records within a batch keep their order.
+// Checkpoints are not taken, as earlier rows may not have been written yet.
+func WithUnordered(unordered bool) Option {
+	return func(c *Converter) {
+		c.unordered = unordered
+	}
+}
+
+// WithErrorHandler handles malformed rows with h instead of stopping the
+// conversion, see ErrorHandler.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(c *Converter) {
+		c.onError = h
+	}
+}
+
+// WithStrictColumns stops the conversion at a row with more or fewer
+// fields than the header even if an ErrorHandler is set, the handler still
+// receives the other malformed rows.
+func WithStrictColumns(strict bool) Option {
+	return func(c *Converter) {
+		c.strictColumns = strict
+	}
+}
+
+// WithHash selects the hash algorithm of the bloom filter of WithDedupe and
+// of the ProtectHash cells, transform.HashFNV by default.
+func WithHash(name string) Option {
+	return func(c *Converter) {
+		c.hash = name
+	}
+}
+
+// WithDetectLang appends the ISO 639-1 language code of each of the columns
+// to the records as a "<column>_lang" field, see transform.DetectLanguage. It has no
+// effect when a single column is selected.
+func WithDetectLang(columns ...string) Option {
+	return func(c *Converter) {
+		c.detectLang = columns
+	}
+}
+
+// WithFilter only converts rows matching the expression, e.g.
+// `age > 30 && city == "London"`. Comparisons are numeric when both sides
+// are numbers, chronological when both are dates and lexical otherwise;
+// conditions combine with &&, ||, ! and parentheses. Column names with
+// spaces or operators are quoted with backquotes.
+func WithFilter(expr string) Option {
+	return func(c *Converter) {
+		c.filter = expr
+	}
+}
+
+// WithParseUserAgent appends the browser, operating system and device
+// parsed from each of the User-Agent columns to the records as a
+// "<column>_ua" object, see transform.ParseUserAgent. It has no effect when a single
+// column is selected.
+func WithParseUserAgent(columns ...string) Option {
+	return func(c *Converter) {
+		c.parseUA = columns
+	}
+}
+
+// WithLineage calls fn with the source columns and the chain of operations
+// of each output field once the header has been read. The conversion fails
+// if fn returns an error.
+func WithLineage(fn func(*Lineage) error) Option {
+	return func(c *Converter) {
+		c.onLineage = fn
+	}
+}
+
+// WithPositionField adds the Position of each row in the input, i.e. its
+// line number and byte offset, to the records as the given field, e.g.
+// {"_pos":{"line":2,"offset":23}}. It has no effect when a single column is
+// selected.
+func WithPositionField(name string) Option {
+	return func(c *Converter) {
+		c.positionField = name
+	}
+}
+
+// WithRowNumberField adds the number of each row among the data rows of the
+// input, counting from 1 and including skipped rows, to the records as the
+// given field, e.g. {"_row":3}. Unlike the line of WithPositionField it does
+// not depend on line breaks in quoted fields. It has no effect when a single
+// column is selected.
+func WithRowNumberField(name string) Option {
+	return func(c *Converter) {
+		c.rowNumberField = name
+	}
+}
+
+// WithMetaFields adds the given fields with the same values to every record,
+// e.g. {"_source":"users.csv"} to record where the data came from. It has no
+// effect when a single column is selected.
+func WithMetaFields(fields map[string]interface{}) Option {
+	return func(c *Converter) {
+		c.metaFields = fields
+	}
+}
+
+// WithObserver calls fn with each record written to the output, in output
+// order and from a single goroutine, e.g. to collect statistics.
+func WithObserver(fn func(record interface{})) Option {
+	return func(c *Converter) {
+		c.observe = fn
+	}
+}
+
+// WithAssertSorted verifies the input is sorted by a column while converting.
+func WithAssertSorted(assertion SortAssertion) Option {
+	return func(c *Converter) {
+		c.assertSorted = &assertion
+	}
+}
+
+// WithDedupe drops rows whose key columns have the values of a previous row
+// matching the filters, keeping the first occurrence.
+func WithDedupe(dedupe Dedupe) Option {
+	return func(c *Converter) {
+		c.dedupe = &dedupe
+	}
+}
+
+// WithProtections protects the cells of sensitive columns before they are
+// written, e.g. {"email": {Action: ProtectMask}}. Protected cells are written
+// as strings without transforms or types. The conversion fails if a
+// protected column would also be written unprotected, e.g. dictionary
+// encoded or by WithDetectLang.
+func WithProtections(protections map[string]Protection) Option {
+	return func(c *Converter) {
+		c.protections = protections
+	}
+}
+
+// WithKAnonymity writes the quasi-identifiers of the rows whose combination
+// is shared by fewer than ka.K rows as null, see BuildKAnonymity. The
+// Converter must select the same rows as the one that built ka.
+func WithKAnonymity(ka *KAnonymity) Option {
+	return func(c *Converter) {
+		c.kAnonymity = ka
+	}
+}
+
+// WithTemplate writes each record rendered by tmpl instead of the record,
+// see sink.ParseTemplate. The template is executed with the record as written
+// otherwise, after renames, types and nesting, and must render a JSON
+// document. The conversion fails at the first row it can not render.
+func WithTemplate(tmpl *template.Template) Option {
+	return func(c *Converter) {
+		c.template = tmpl
+	}
+}
+
+// Stats counts the rows of a conversion.
+type Stats struct {
+	// Rows is the number of data rows read, malformed rows excluded.
+	Rows int
+	// Emitted is the number of records written.
+	Emitted int
+	// Malformed is the number of malformed rows skipped by the ErrorHandler.
+	Malformed int
+	// Warnings counts the row warnings of each kind, e.g. "malformed row" or
+	// "column age: invalid int", see WithWarnLimit.
+	Warnings map[string]int
+}
+
+// Stats returns the statistics of the last conversion.
+func (c *Converter) Stats() Stats {
+	return c.stats
+}
+
+// WithLogger logs the progress and the row warnings of the conversions to
+// logger instead of the standard logrus logger.
+func WithLogger(logger log.FieldLogger) Option {
+	return func(c *Converter) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// NewConverter creates a Converter with the given options.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{logger: log.StandardLogger()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Convert reads CSV from r and writes one JSON document per row to w. An
+// empty input, like an input with only a header, writes nothing.
+//
+// If w is a sink.RecordWriter, its BeginRecord is called before each record
+// is written, which allows w to rotate its underlying files at record
+// boundaries.
+func (c *Converter) Convert(r io.Reader, w io.Writer) error {
+	stop := make(chan struct{})
+	lines, errc, err := c.readCsv(r, stop)
+	if err != nil {
+		return err
+	}
+	if lines == nil {
+		return nil
+	}
+
+	write := c.recordWriter(w)
+	for line := range lines {
+		if err := write(line); err != nil {
+			// 停止读取剩余的输入，等待读取协程退出后统计才完整
+			close(stop)
+			for range lines {
+			}
+			return err
+		}
+	}
+	return <-errc
+}
+
+// recordWriter 返回将记录编码写入 w 的函数，检查点标记在之前的记录写出后调用
+// onCheckpoint
+func (c *Converter) recordWriter(w io.Writer) func(record interface{}) error {
+	enc := sink.NewEncoder(w, c.pretty, c.asciiOnly)
+	return func(record interface{}) error {
+		if cp, ok := record.(checkpointMarker); ok {
+			return c.onCheckpoint(Checkpoint(cp))
+		}
+		return enc.Encode(record)
+	}
+}
@@ -0,0 +1,542 @@
+package convert
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/sink"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	jsonPrinter = func(colCell string) interface{} {
+		if strings.HasPrefix(colCell, "{") && strings.HasSuffix(colCell, "}") {
+			var data interface{}
+			if err := json.Unmarshal([]byte(colCell), &data); err != nil {
+				log.Debugf("json unmarshal %q failed: %v", colCell, err)
+				return colCell
+			}
+			return data
+		}
+		return colCell
+	}
+	rawPrinter = func(colCell string) interface{} {
+		return colCell
+	}
+)
+
+func (c *Converter) key(col string) string {
+	if renamed, ok := c.renames[col]; ok {
+		return renamed
+	}
+	return col
+}
+
+func (c *Converter) value(col, colCell string) interface{} {
+	if protect, ok := c.protectors[col]; ok {
+		return protect(colCell)
+	}
+	v, ok := c.transform(col, colCell)
+	if !ok {
+		return v
+	}
+	colCell = v.(string)
+	if mapped, ok := c.mapValue(col, colCell); ok {
+		return mapped
+	}
+	if index, ok := c.dictionary[col][colCell]; ok {
+		return index
+	}
+	if typ, ok := c.types[col]; ok {
+		return c.coerce(col, typ, colCell)
+	}
+	if c.parser != nil {
+		return c.parser(col, colCell)
+	}
+	if c.pretty && c.jsonColumns == nil {
+		return jsonPrinter(colCell)
+	}
+	return rawPrinter(colCell)
+}
+
+// setValue 将列的值写入记录，空单元格先填入默认值，仍为空时按 emptyAsNull、omitEmpty
+// 写入 null 或省略
+func (c *Converter) setValue(data map[string]interface{}, col, colCell string) {
+	colCell = c.fillDefault(col, colCell)
+	switch {
+	case colCell != "":
+	case c.omitEmpty:
+		return
+	case c.emptyAsNull:
+		data[c.key(col)] = nil
+		return
+	}
+	data[c.key(col)] = c.value(col, colCell)
+}
+
+// processRow 将一行数据转换为输出记录，ok 为 false 时该行没有需要输出的数据
+func (c *Converter) processRow(columns, row []string) (record interface{}, ok bool) {
+	requiredCols := c.columns
+
+	switch len(requiredCols) {
+	case 0:
+		data := map[string]interface{}{}
+		for i, colCell := range row {
+			if c.dropped(columns[i]) {
+				continue
+			}
+			c.setValue(data, columns[i], colCell)
+		}
+		return data, true
+	case 1:
+		// 只输出一列时直接输出该列的值
+		for i, colCell := range row {
+			if requiredCols[0] != columns[i] {
+				continue
+			}
+			colCell = c.fillDefault(columns[i], colCell)
+			if colCell == "" && c.emptyAsNull {
+				return nil, true
+			}
+			if protect, ok := c.protectors[columns[i]]; ok {
+				return protect(colCell), true
+			}
+			v, ok := c.transform(columns[i], colCell)
+			if !ok {
+				return v, true
+			}
+			colCell = v.(string)
+			if mapped, ok := c.mapValue(columns[i], colCell); ok {
+				return mapped, true
+			}
+			if index, ok := c.dictionary[columns[i]][colCell]; ok {
+				return index, true
+			}
+			if typ, ok := c.types[columns[i]]; ok {
+				return c.coerce(columns[i], typ, colCell), true
+			}
+			if c.parser != nil {
+				return c.parser(columns[i], colCell), true
+			}
+			if c.jsonColumns != nil {
+				return rawPrinter(colCell), true
+			}
+			return jsonPrinter(colCell), true
+		}
+		return nil, false
+	default:
+		data := map[string]interface{}{}
+		for i, colCell := range row {
+			if !lo.Contains(requiredCols, columns[i]) || c.dropped(columns[i]) {
+				continue
+			}
+			c.setValue(data, columns[i], colCell)
+		}
+		return data, true
+	}
+}
+
+// newCSVReader 创建读取输入的 csv.Reader，返回各列的列名
+func (c *Converter) newCSVReader(r io.Reader) (*csv.Reader, []string, error) {
+	r = c.newResumeReader(r)
+	if c.noHeader {
+		return source.NewHeaderlessCSVReader(r, c.delimiter, c.header)
+	}
+	return source.NewCSVReader(r, c.delimiter)
+}
+
+// rowReader 按顺序读取需要转换的行，完成排序检查、过滤等有状态的处理
+type rowReader struct {
+	csvReader *csv.Reader
+	filter    rowFilter
+	sorted    *sortChecker
+	dedupe    *dedupeChecker
+	numeric   *numericChecker
+	onError   ErrorHandler
+	skip      int
+	offset    int64 // 下一行开始的字节偏移
+	rows      int
+	skipped   int
+	err       error
+	stats     *Stats // 读取结束后写入统计
+	// strictColumns 字段数与表头不同的行不交给 onError 处理
+	strictColumns bool
+	// base 继续转换时输入中的位置与 csvReader 读取的位置之差
+	base Position
+	// dataOffset 表头之后第一行的字节偏移，line 为下一行的行号
+	dataOffset int64
+	line       int
+	sampler    *sampler
+	warnings   *warnThrottle
+	logger     log.FieldLogger
+	// sanitize 原地清理读取的单元格，为 nil 时不清理
+	sanitize func(row []string)
+}
+
+// next 返回下一行需要转换的数据及其位置，读取结束或出错时返回 nil
+func (r *rowReader) next() ([]string, Position) {
+	if r.sampler != nil && r.sampler.N > 0 {
+		return r.nextSampled()
+	}
+	return r.read()
+}
+
+// read 读取下一行通过检查和过滤的数据
+func (r *rowReader) read() ([]string, Position) {
+	for {
+		// 读取CSV文件的下一行数据，上一行的结尾即为这一行的开始
+		start := r.offset
+		row, err := r.csvReader.Read()
+		r.offset = r.base.Offset + r.csvReader.InputOffset()
+		if len(row) > 0 {
+			r.line = r.base.Line + endLine(r.csvReader, row)
+		}
+		if err == io.EOF {
+			return nil, Position{}
+		}
+		if err != nil && r.rows+r.skipped < r.skip {
+			// 跳过的行不检查格式
+			r.rows++
+			continue
+		}
+		if err != nil {
+			rowErr := newRowError(err, row, start)
+			if rowErr != nil {
+				rowErr.Line += r.base.Line
+			}
+			switch {
+			case rowErr == nil:
+				r.err = fmt.Errorf("read csv failed: %v", err)
+			case r.strictColumns && errors.Is(rowErr.Err, csv.ErrFieldCount):
+				rowErr.Err = fmt.Errorf("%w: row has %d fields, expected %d", csv.ErrFieldCount, len(row), r.csvReader.FieldsPerRecord)
+				r.err = rowErr
+			case r.onError == nil:
+				r.err = rowErr
+			default:
+				r.err = r.onError(rowErr)
+			}
+			if r.err != nil {
+				return nil, Position{}
+			}
+			r.warnings.warn("malformed row", "%v", rowErr)
+			r.skipped++
+			continue
+		}
+
+		if len(row) == 0 {
+			return nil, Position{}
+		}
+
+		r.rows++ // 增加行计数
+		if r.rows <= r.skip {
+			continue
+		}
+		if r.sanitize != nil {
+			r.sanitize(row)
+		}
+		line, _ := r.csvReader.FieldPos(0)
+		pos := Position{Line: r.base.Line + line, Offset: start, row: r.rows}
+		if r.sorted != nil {
+			if r.err = r.sorted.check(pos, row); r.err != nil {
+				return nil, Position{}
+			}
+		}
+		if r.filter != nil && !r.filter(row) {
+			continue
+		}
+		if r.dedupe != nil && r.dedupe.duplicate(row) {
+			continue
+		}
+		if r.sampler != nil && !r.sampler.keep() {
+			continue
+		}
+		if r.numeric != nil {
+			r.numeric.check(pos, row)
+		}
+		return row, pos
+	}
+}
+
+// finish 输出并记录读取结束后的统计
+func (r *rowReader) finish(emitted int) {
+	r.logger.Infof("read %d records, emitted %d", r.rows, emitted)
+	if r.skipped > 0 {
+		r.logger.Warnf("skipped %d malformed rows", r.skipped)
+	}
+	if r.sorted != nil && r.sorted.violations > 0 {
+		r.logger.Warnf("assert-sorted: %d rows out of order by %s", r.sorted.violations, r.sorted.Column)
+	}
+	if r.dedupe != nil {
+		r.dedupe.report(r.logger)
+	}
+	if r.numeric != nil {
+		r.numeric.report(r.logger)
+	}
+	*r.stats = Stats{Rows: r.rows, Emitted: emitted, Malformed: r.skipped, Warnings: r.warnings.totals()}
+}
+
+// progress 返回已经读取的行之后的位置和统计
+func (r *rowReader) progress(emitted int) Checkpoint {
+	return Checkpoint{DataOffset: r.dataOffset, Offset: r.offset, Line: r.line, Rows: r.rows, Emitted: emitted, Malformed: r.skipped}
+}
+
+// buildRecord 将位于 pos 的一行转换为输出记录并追加字段，有模板时返回渲染的结果
+func (c *Converter) buildRecord(columns, row []string, pos Position, enrich enricher) (interface{}, bool, error) {
+	record, ok := c.processRow(columns, row)
+	if ok {
+		record = c.suppress(row, record)
+	}
+	if data, isMap := record.(map[string]interface{}); isMap {
+		if c.flatten {
+			c.flattenObjects(data)
+		}
+		if enrich != nil {
+			enrich(row, data)
+		}
+		if c.positionField != "" {
+			data[c.positionField] = pos
+		}
+		if c.rowNumberField != "" {
+			data[c.rowNumberField] = pos.row
+		}
+		for name, value := range c.metaFields {
+			data[name] = value
+		}
+		if c.nested {
+			record = sink.NestKeys(data)
+		}
+	}
+	if ok && c.template != nil {
+		var err error
+		if record, err = sink.Render(c.template, record); err != nil {
+			return nil, false, fmt.Errorf("row at %v: %v", pos, err)
+		}
+	}
+	return record, ok, nil
+}
+
+// prepare 读取表头，返回解析列引用后的 Converter 副本和按顺序读取需要转换的行的
+// rowReader，输入没有表头时 columns 为空
+func (c *Converter) prepare(r io.Reader) (rc *Converter, rr *rowReader, columns []string, err error) {
+	csvReader, columns, err := c.newCSVReader(r)
+	if err == io.EOF {
+		// 空的输入与只有表头的输入一样没有行可以转换
+		return nil, nil, nil, nil
+	}
+	if err != nil || len(columns) == 0 {
+		return nil, nil, nil, err
+	}
+
+	// 统计写入原来的 Converter，其余的处理使用解析列引用后的副本
+	stats := &c.stats
+	if rc, err = c.setup(columns); err != nil {
+		return nil, nil, nil, err
+	}
+
+	rr = &rowReader{csvReader: csvReader, numeric: rc.newNumericChecker(columns), onError: rc.onError, strictColumns: rc.strictColumns, skip: rc.skip, offset: csvReader.InputOffset(), stats: stats, line: 1, warnings: rc.warnings, logger: rc.logger, sanitize: rc.sanitizer()}
+	if !rc.noHeader {
+		rr.dataOffset, rr.line = rr.offset, endLine(csvReader, columns)
+	}
+	if cp := rc.resume; cp != nil {
+		// 读取的是表头和 cp.Offset 之后的输入
+		rr.base = Position{Line: cp.Line - rr.line, Offset: cp.Offset - rr.offset}
+		rr.offset, rr.line = cp.Offset, cp.Line
+		rr.rows, rr.skipped = cp.Rows, cp.Malformed
+	}
+	if rr.filter, err = rc.newRowFilter(columns); err != nil {
+		return nil, nil, nil, err
+	}
+	if rr.sorted, err = rc.newSortChecker(columns); err != nil {
+		return nil, nil, nil, err
+	}
+	if rr.sorted != nil {
+		rr.sorted.warnings = rc.warnings
+	}
+	if rr.dedupe, err = rc.newDedupeChecker(columns); err != nil {
+		return nil, nil, nil, err
+	}
+	if rc.sample != nil && rc.checkpointRows > 0 {
+		// 继续转换时无法恢复随机数的状态，抽取的行会不同
+		return nil, nil, nil, errors.New("sample: a sampled conversion can not be checkpointed")
+	}
+	rr.sampler = rc.newSampler()
+	return rc, rr, columns, nil
+}
+
+// setup 返回按表头解析列引用，并编译了转换和保护函数的 Converter 副本
+func (c *Converter) setup(columns []string) (rc *Converter, err error) {
+	if rc, err = c.resolve(columns); err != nil {
+		return nil, err
+	}
+	if rc.logger == nil {
+		rc.logger = log.StandardLogger()
+	}
+	rc.warnings = newWarnThrottle(rc.warnLimit, rc.logger)
+
+	if rc.transformFuncs, err = rc.compileTransforms(columns); err != nil {
+		return nil, err
+	}
+	if rc.protectors, err = rc.newProtectors(); err != nil {
+		return nil, err
+	}
+	if rc.quasiIndexes, err = rc.newQuasiIndexes(columns); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// CheckHeader checks the options against the columns of a header, as
+// returned by source.NewCSVReader or source.NewHeaderlessCSVReader: it
+// resolves their column references and compiles the filters and transforms,
+// and returns the error Convert would return after reading this header. Callers can check
+// their options this way before creating any output.
+func (c *Converter) CheckHeader(columns []string) error {
+	rc, err := c.setup(columns)
+	if err != nil {
+		return err
+	}
+	if _, err := rc.newRowFilter(columns); err != nil {
+		return err
+	}
+	if _, err := rc.newSortChecker(columns); err != nil {
+		return err
+	}
+	if _, err := rc.newDedupeChecker(columns); err != nil {
+		return err
+	}
+	_, err = rc.newEnricher(columns)
+	return err
+}
+
+// Field returns the key written for the column ref refers to in an input
+// with the given header, dotted for nested fields, e.g. to find a column
+// in the written records. It fails if ref matches no column or the column
+// is not written.
+func (c *Converter) Field(columns []string, ref string) (string, error) {
+	rc, err := c.resolve(columns)
+	if err != nil {
+		return "", err
+	}
+	i, err := rc.resolver.Index(ref)
+	if err != nil {
+		return "", err
+	}
+	col := columns[i]
+	if len(rc.columns) > 0 && !lo.Contains(rc.columns, col) || rc.dropped(col) {
+		return "", fmt.Errorf("column %s is not written", ref)
+	}
+	return rc.key(col), nil
+}
+
+// start 读取表头，返回解析列引用后的 Converter 副本、按顺序读取需要转换的行的
+// rowReader 和追加字段的 enricher，输入为空时 columns 为空
+func (c *Converter) start(r io.Reader) (rc *Converter, rr *rowReader, columns []string, enrich enricher, err error) {
+	rc, rr, columns, err = c.prepare(r)
+	if err != nil || len(columns) == 0 {
+		return nil, nil, nil, nil, err
+	}
+
+	if enrich, err = rc.newEnricher(columns); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if rc.onLineage != nil {
+		if err := rc.onLineage(rc.lineage(columns)); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	switch len(rc.columns) {
+	case 0:
+		rc.logger.Infof("transfer all columns to json")
+	case 1:
+		rc.logger.Infof("transfer column %s to json", rc.columns[0])
+	default:
+		rc.logger.Infof("transfer columns %v to json", strings.Join(rc.columns, ","))
+	}
+	return rc, rr, columns, enrich, nil
+}
+
+// errStopped stop 关闭后读取协程返回的错误，Convert 返回的是写出的错误
+var errStopped = errors.New("conversion stopped")
+
+// readCsv 在协程中读取并转换每一行，转换结束后 errc 返回读取过程中的错误。
+// stop 关闭后不再读取，如写出失败时，之后关闭 lines
+func (c *Converter) readCsv(r io.Reader, stop <-chan struct{}) (lines chan interface{}, errc chan error, err error) {
+	c, rr, columns, enrich, err := c.start(r)
+	if err != nil || len(columns) == 0 {
+		return nil, nil, err
+	}
+
+	lines = make(chan interface{})
+	errc = make(chan error, 1)
+
+	if c.workers > 1 {
+		go c.convertParallel(rr, columns, enrich, lines, errc, stop)
+		return lines, errc, nil
+	}
+
+	go func() {
+		errc <- c.emitRows(rr, columns, enrich, func(record interface{}) error {
+			select {
+			case lines <- record:
+				return nil
+			case <-stop:
+				return errStopped
+			}
+		})
+		close(lines)
+	}()
+
+	return lines, errc, nil
+}
+
+// emitRows 按顺序转换 rr 读取的每一行，将记录和检查点标记交给 emit，
+// 返回读取、转换或 emit 的错误
+func (c *Converter) emitRows(rr *rowReader, columns []string, enrich enricher, emit func(interface{}) error) (err error) {
+	emitted, checkpointed := 0, 0
+	if c.resume != nil {
+		emitted, checkpointed = c.resume.Emitted, c.resume.Rows
+	}
+	defer func() {
+		// 先记录统计，返回时统计已经完整
+		rr.finish(emitted)
+		if err == nil {
+			err = rr.err
+		}
+	}()
+
+	for row, pos := rr.next(); row != nil; row, pos = rr.next() {
+		record, ok, err := c.buildRecord(columns, row, pos, enrich)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if c.observe != nil {
+				c.observe(record)
+			}
+			if err := emit(record); err != nil {
+				return err
+			}
+			emitted++
+		}
+
+		if c.limit > 0 && emitted >= c.limit {
+			// 如果限制大于0且输出行数达到限制，跳出循环
+			break
+		}
+		if c.checkpointRows > 0 && rr.rows-checkpointed >= c.checkpointRows {
+			if err := emit(checkpointMarker(rr.progress(emitted))); err != nil {
+				return err
+			}
+			checkpointed = rr.rows
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateLayouts 自动识别的日期格式，按顺序尝试，未带时区的按 UTC 处理
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"20060102",
+}
+
+// parseDate 按 dateLayouts 解析日期
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// formatDate 格式化日期，没有时间部分时只输出日期
+func formatDate(t time.Time) string {
+	if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Date outputs of WithDateOutput.
+const (
+	// DateAuto writes dates as 2006-01-02, or RFC 3339 if they have a time.
+	DateAuto = ""
+	// DateRFC3339 writes dates as RFC 3339 strings, e.g. 2024-01-02T00:00:00Z.
+	DateRFC3339 = "rfc3339"
+	// DateEpoch writes dates as the number of seconds since the Unix epoch.
+	DateEpoch = "epoch"
+)
+
+// parseDate 先按 WithDateLayouts 指定的格式解析日期，再按 dateLayouts 解析
+func (c *Converter) parseDate(s string) (time.Time, error) {
+	for _, layout := range c.dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return parseDate(s)
+}
+
+// coerce 同 coerceCell，日期按 WithDateLayouts 和 WithDateOutput 解析和输出，
+// 无法转换的单元格按列记录警告
+func (c *Converter) coerce(col, typ, colCell string) interface{} {
+	if typ != TypeDate || (len(c.dateLayouts) == 0 && c.dateOutput == DateAuto) {
+		v, err := convertCell(typ, colCell)
+		if err != nil {
+			c.warnings.warn(fmt.Sprintf("column %s: invalid %s", col, typ), "%q written as a string: %v", colCell, err)
+			return colCell
+		}
+		return v
+	}
+	t, err := c.parseDate(colCell)
+	if err != nil {
+		c.warnings.warn(fmt.Sprintf("column %s: invalid %s", col, typ), "%q written as a string: %v", colCell, err)
+		return colCell
+	}
+	switch c.dateOutput {
+	case DateRFC3339:
+		return t.Format(time.RFC3339Nano)
+	case DateEpoch:
+		return t.Unix()
+	}
+	return formatDate(t)
+}
+
+// dateCondition 形如 created_at >= 2024-01-01 的日期条件
+type dateCondition struct {
+	column string
+	op     string
+	value  time.Time
+	index  int
+}
+
+var (
+	dateConditionRe = regexp.MustCompile(`^\s*(.+?)\s*(>=|<=|!=|==|=|>|<)\s*(.+?)\s*$`)
+	dateAndRe       = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+// parseDateFilter 解析以 and 连接的日期条件
+func parseDateFilter(expr string) ([]dateCondition, error) {
+	var conds []dateCondition
+	for _, clause := range dateAndRe.Split(strings.TrimSpace(expr), -1) {
+		m := dateConditionRe.FindStringSubmatch(clause)
+		if m == nil {
+			return nil, fmt.Errorf("invalid date condition %q", clause)
+		}
+		value, err := parseDate(strings.Trim(m[3], `'"`))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date condition %q: %v", clause, err)
+		}
+		conds = append(conds, dateCondition{column: m[1], op: m[2], value: value})
+	}
+	return conds, nil
+}
+
+func (d dateCondition) match(t time.Time) bool {
+	switch d.op {
+	case ">=":
+		return !t.Before(d.value)
+	case "<=":
+		return !t.After(d.value)
+	case ">":
+		return t.After(d.value)
+	case "<":
+		return t.Before(d.value)
+	case "!=":
+		return !t.Equal(d.value)
+	default:
+		return t.Equal(d.value)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Default sizing of the bloom filter of Dedupe.
+const (
+	DefaultDedupeCapacity          = 10_000_000
+	DefaultDedupeFalsePositiveRate = 0.001
+)
+
+// Dedupe drops rows whose key was seen in a previous row.
+type Dedupe struct {
+	// Columns are the key columns, more than one for a composite key.
+	Columns []string
+	// Bloom remembers the keys in a bloom filter of fixed size instead of a
+	// set growing with the input. A row may then be dropped as a duplicate
+	// with the probability FalsePositiveRate although its key is new.
+	Bloom bool
+	// Capacity is the expected number of distinct keys sizing the bloom
+	// filter, DefaultDedupeCapacity if 0.
+	Capacity int
+	// FalsePositiveRate of the bloom filter at Capacity keys,
+	// DefaultDedupeFalsePositiveRate if 0.
+	FalsePositiveRate float64
+}
+
+// dedupeChecker 记录已出现的键，判断一行是否重复
+type dedupeChecker struct {
+	Dedupe
+	indexes    []int
+	seen       map[string]struct{}
+	bloom      *bloomFilter
+	duplicates int
+}
+
+func (c *Converter) newDedupeChecker(columns []string) (*dedupeChecker, error) {
+	if c.dedupe == nil {
+		return nil, nil
+	}
+	d := &dedupeChecker{Dedupe: *c.dedupe}
+	for _, col := range d.Columns {
+		index := lo.IndexOf(columns, col)
+		if index < 0 {
+			return nil, fmt.Errorf("dedupe: column %s not found", col)
+		}
+		d.indexes = append(d.indexes, index)
+	}
+	if d.Bloom {
+		capacity, rate := d.Capacity, d.FalsePositiveRate
+		if capacity <= 0 {
+			capacity = DefaultDedupeCapacity
+		}
+		if rate <= 0 || rate >= 1 {
+			rate = DefaultDedupeFalsePositiveRate
+		}
+		d.bloom = newBloomFilter(capacity, rate, c.hash)
+	} else {
+		d.seen = map[string]struct{}{}
+	}
+	return d, nil
+}
+
+// rowKey 返回行中位于 indexes 的单元格组成的键
+func rowKey(indexes []int, row []string) string {
+	parts := make([]string, len(indexes))
+	for i, index := range indexes {
+		if index < len(row) {
+			parts[i] = row[index]
+		}
+	}
+	// 以 \x00 分隔各列，避免 "a,b"+"c" 与 "a"+"b,c" 相同
+	return strings.Join(parts, "\x00")
+}
+
+// duplicate 判断行的键是否已经出现过，并记录该键
+func (d *dedupeChecker) duplicate(row []string) bool {
+	key := rowKey(d.indexes, row)
+
+	var dup bool
+	if d.bloom != nil {
+		dup = d.bloom.testAndAdd(key)
+	} else if _, dup = d.seen[key]; !dup {
+		d.seen[key] = struct{}{}
+	}
+	if dup {
+		d.duplicates++
+	}
+	return dup
+}
+
+func (d *dedupeChecker) report(logger log.FieldLogger) {
+	if d.duplicates == 0 {
+		return
+	}
+	if d.bloom != nil {
+		logger.Warnf("dedupe: dropped %d duplicate rows by %s (bloom filter, false positive rate %g)", d.duplicates, strings.Join(d.Columns, ","), d.bloom.rate)
+		return
+	}
+	logger.Warnf("dedupe: dropped %d duplicate rows by %s", d.duplicates, strings.Join(d.Columns, ","))
+}
+
+// bloomFilter 布隆过滤器，k 个哈希由键的 64 位哈希的高低 32 位组合得到
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+	rate float64
+	hash string
+}
+
+// newBloomFilter 创建容纳 n 个键、误判率为 p、按 hash 算法哈希键的布隆过滤器
+func newBloomFilter(n int, p float64, hash string) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k, rate: p, hash: hash}
+}
+
+// testAndAdd 返回键是否可能已经存在，并加入该键
+func (b *bloomFilter) testAndAdd(key string) bool {
+	sum := transform.Sum64(b.hash, []byte(key))
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	present := true
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			present = false
+			b.bits[word] |= mask
+		}
+	}
+	return present
+}
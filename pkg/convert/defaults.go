@@ -0,0 +1,38 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+// WithDefaults fills the empty cells of the given columns with a default
+// value, e.g. {"country": "US", "active": "true"}. The default replaces the
+// cell before any other processing, so it is transformed, mapped and typed
+// like a value read from the input and takes precedence over WithEmptyAsNull
+// and WithOmitEmpty.
+func WithDefaults(defaults map[string]string) Option {
+	return func(c *Converter) {
+		c.defaults = defaults
+	}
+}
+
+// fillDefault 返回空单元格所在列的默认值，没有默认值时原样返回
+func (c *Converter) fillDefault(col, colCell string) string {
+	if colCell != "" {
+		return colCell
+	}
+	if value, ok := c.defaults[col]; ok {
+		return value
+	}
+	return colCell
+}
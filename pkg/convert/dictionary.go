@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxDictionaryValues is the number of distinct values above which a column
+// is not dictionary encoded.
+const MaxDictionaryValues = 1 << 16
+
+// Dictionary maps column names to their repetitive values. A dictionary
+// encoded cell is written as the index of its value instead of the value.
+type Dictionary map[string][]string
+
+// BuildDictionary reads the CSV from r and collects the values of the
+// columns occurring more than once, most frequent first. Columns with more
+// than MaxDictionaryValues distinct values are left out. The columns are
+// column references resolved against the header, see ColumnResolver.
+func BuildDictionary(r io.Reader, delimiter rune, columns []string) (Dictionary, error) {
+	csvReader, header, err := source.NewCSVReader(r, delimiter)
+	if err == io.EOF {
+		// 空的输入没有需要编码的值
+		return Dictionary{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if columns, err = resolveList(NewColumnResolver(header, nil, false), columns, true); err != nil {
+		return nil, fmt.Errorf("dictionary-encode: %v", err)
+	}
+	counts := make([]map[string]int, len(columns))
+	indexes := make([]int, len(columns))
+	for i, col := range columns {
+		indexes[i] = lo.IndexOf(header, col)
+		counts[i] = map[string]int{}
+	}
+
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if newRowError(err, row, 0) == nil {
+				return nil, fmt.Errorf("read csv failed: %v", err)
+			}
+			// 格式错误的行由转换时的 -on-error 策略处理
+			continue
+		}
+		for i, index := range indexes {
+			if counts[i] == nil || index >= len(row) || row[index] == "" {
+				continue
+			}
+			counts[i][row[index]]++
+			if len(counts[i]) > MaxDictionaryValues {
+				log.Warnf("dictionary-encode: column %s has more than %d distinct values, not encoded", columns[i], MaxDictionaryValues)
+				counts[i] = nil
+			}
+		}
+	}
+
+	d := Dictionary{}
+	for i, col := range columns {
+		var values []string
+		for value, n := range counts[i] {
+			if n > 1 {
+				values = append(values, value)
+			}
+		}
+		sort.Slice(values, func(a, b int) bool {
+			if na, nb := counts[i][values[a]], counts[i][values[b]]; na != nb {
+				return na > nb
+			}
+			return values[a] < values[b]
+		})
+		if len(values) > 0 {
+			d[col] = values
+		}
+	}
+	return d, nil
+}
+
+// index 返回每列的值到序号的映射
+func (d Dictionary) index() map[string]map[string]int {
+	if len(d) == 0 {
+		return nil
+	}
+	index := make(map[string]map[string]int, len(d))
+	for col, values := range d {
+		index[col] = make(map[string]int, len(values))
+		for i, value := range values {
+			index[col][value] = i
+		}
+	}
+	return index
+}
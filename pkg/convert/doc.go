@@ -0,0 +1,24 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package convert converts CSV to JSON Lines with a Converter configured by
+// options: column selection, renames, types, filters, deduplication,
+// protection of sensitive columns and the shape of the records. It reads
+// the input with package source, rewrites cells with package transform and
+// writes the records with package sink.
+//
+// The package follows the compatibility rules of package csv2jsonl.
+package convert
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	"github.com/samber/lo"
+)
+
+// enricher 为输出记录追加由整行数据计算出的字段
+type enricher func(row []string, record map[string]interface{})
+
+// newEnricher 根据列名编译追加字段的规则，没有规则时返回 nil
+func (c *Converter) newEnricher(columns []string) (enricher, error) {
+	var enrichers []enricher
+
+	for _, col := range c.detectLang {
+		index := lo.IndexOf(columns, col)
+		if index < 0 {
+			return nil, fmt.Errorf("detect-lang: column %s not found", col)
+		}
+		key := c.key(col) + "_lang"
+		enrichers = append(enrichers, func(row []string, record map[string]interface{}) {
+			if index < len(row) {
+				record[key] = transform.DetectLanguage(row[index])
+			}
+		})
+	}
+
+	for _, col := range c.parseUA {
+		index := lo.IndexOf(columns, col)
+		if index < 0 {
+			return nil, fmt.Errorf("parse-ua: column %s not found", col)
+		}
+		key := c.key(col) + "_ua"
+		enrichers = append(enrichers, func(row []string, record map[string]interface{}) {
+			if index >= len(row) {
+				return
+			}
+			if ua := transform.ParseUserAgent(row[index]); ua != nil {
+				record[key] = ua
+			}
+		})
+	}
+
+	if len(enrichers) == 0 {
+		return nil, nil
+	}
+	return func(row []string, record map[string]interface{}) {
+		for _, e := range enrichers {
+			e(row, record)
+		}
+	}, nil
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+)
+
+// Position is the location of a row in the input.
+type Position struct {
+	// Line is the line number the row starts at, the header is line 1.
+	Line int `json:"line"`
+	// Offset is the byte offset the row starts at, counted in the
+	// decompressed input including the header.
+	Offset int64 `json:"offset"`
+	// row 行在数据行中的序号，从 1 开始，见 WithRowNumberField
+	row int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d (byte %d)", p.Line, p.Offset)
+}
+
+// RowError reports a malformed row of the input.
+type RowError struct {
+	Position
+	// Row holds the fields read from the row, nil if it could not be parsed.
+	Row []string
+	// Err is the parse error, e.g. csv.ErrFieldCount.
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Position, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler is called with each malformed row. Returning nil skips the
+// row and continues the conversion, returning an error stops it with that
+// error. Without a handler the conversion stops at the first malformed row.
+type ErrorHandler func(*RowError) error
+
+// newRowError 将 csv 的解析错误转换为 RowError，其他错误（如读取失败）返回 nil
+func newRowError(err error, row []string, offset int64) *RowError {
+	var perr *csv.ParseError
+	if !errors.As(err, &perr) {
+		return nil
+	}
+	return &RowError{Position: Position{Line: perr.StartLine, Offset: offset}, Row: row, Err: perr.Err}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 过滤表达式的词法单元
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokLiteral
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize 切分过滤表达式。列名可以用反引号括起来以包含空格等字符，
+// 字符串用单引号或双引号括起来，以数字开头的单词（如 30、2024-01-01）作为字面量
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	isWordEnd := func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("()=!<>&|'\"`", r)
+	}
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			kind := tokAnd
+			if r == '|' {
+				kind = tokOr
+			}
+			tokens = append(tokens, token{kind, string(runes[i : i+2]), i})
+			i += 2
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			switch op {
+			case "!":
+				tokens = append(tokens, token{tokNot, op, i})
+			case "=":
+				tokens = append(tokens, token{tokOp, "==", i})
+			default:
+				tokens = append(tokens, token{tokOp, op, i})
+			}
+			i += len(op)
+		case r == '\'' || r == '"' || r == '`':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated %c at %d", r, i)
+			}
+			kind := tokLiteral
+			if r == '`' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, token{kind, sb.String(), i})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !isWordEnd(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch {
+			case unicode.IsDigit(r) || r == '-' || r == '.':
+				tokens = append(tokens, token{tokLiteral, word, i})
+			case strings.EqualFold(word, "and"):
+				tokens = append(tokens, token{tokAnd, word, i})
+			case strings.EqualFold(word, "or"):
+				tokens = append(tokens, token{tokOr, word, i})
+			case strings.EqualFold(word, "not"):
+				tokens = append(tokens, token{tokNot, word, i})
+			default:
+				tokens = append(tokens, token{tokIdent, word, i})
+			}
+			i = j
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// exprParser 将过滤表达式编译为 rowFilter，语法为：
+//
+//	expr       = and { ("||" | "or") and }
+//	and        = unary { ("&&" | "and") unary }
+//	unary      = ("!" | "not") unary | "(" expr ")" | comparison
+//	comparison = operand ("==" | "=" | "!=" | "<" | "<=" | ">" | ">=") operand
+//	operand    = column | literal
+type exprParser struct {
+	tokens  []token
+	pos     int
+	columns *ColumnResolver
+}
+
+// compileFilter 编译过滤表达式，列引用由 columns 解析
+func compileFilter(expr string, columns *ColumnResolver) (rowFilter, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, columns: columns}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return f, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) parseOr() (rowFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row []string) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (rowFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row []string) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (rowFilter, error) {
+	switch t := p.peek(); t.kind {
+	case tokNot:
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(row []string) bool { return !f(row) }, nil
+	case tokLParen:
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at %d", t.pos)
+		}
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (rowFilter, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("expected comparison operator at %d", op.pos)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(row []string) bool {
+		a, b := left(row), right(row)
+		// 与 SQL 的 NULL 类似，空值不参与大小比较
+		if (a == "" || b == "") && op.text != "==" && op.text != "!=" {
+			return false
+		}
+		cmp := compareValues(a, b)
+		switch op.text {
+		case "==":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}, nil
+}
+
+// parseOperand 返回取值函数，缺失的单元格按空字符串处理
+func (p *exprParser) parseOperand() (func(row []string) string, error) {
+	switch t := p.next(); t.kind {
+	case tokIdent:
+		index, err := p.columns.Index(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []string) string {
+			if index >= len(row) {
+				return ""
+			}
+			return row[index]
+		}, nil
+	case tokLiteral:
+		return func([]string) string { return t.text }, nil
+	default:
+		if t.kind == tokEOF {
+			return nil, fmt.Errorf("unexpected end of expression")
+		}
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+}
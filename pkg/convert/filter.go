@@ -0,0 +1,74 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import "fmt"
+
+// rowFilter 判断一行数据是否需要输出
+type rowFilter func(row []string) bool
+
+// newRowFilter 根据列名编译行过滤条件，没有条件时返回 nil
+func (c *Converter) newRowFilter(columns []string) (rowFilter, error) {
+	var filters []rowFilter
+
+	if c.whereDate != "" {
+		conds, err := parseDateFilter(c.whereDate)
+		if err != nil {
+			return nil, fmt.Errorf("where-date: %v", err)
+		}
+		for i := range conds {
+			if conds[i].index, err = c.resolver.Index(conds[i].column); err != nil {
+				return nil, fmt.Errorf("where-date: %v", err)
+			}
+		}
+		filters = append(filters, func(row []string) bool {
+			for _, cond := range conds {
+				if cond.index >= len(row) {
+					return false
+				}
+				t, err := c.parseDate(row[cond.index])
+				if err != nil {
+					c.logger.Debugf("where-date: %v", err)
+					return false
+				}
+				if !cond.match(t) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	if c.filter != "" {
+		filter, err := compileFilter(c.filter, c.resolver)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %v", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return func(row []string) bool {
+		for _, filter := range filters {
+			if !filter(row) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import "sort"
+
+// WithFlatten merges the objects parsed from JSON cells, see WithJSONColumns
+// and TypeJSON, into the record instead of nesting them. The keys of nested
+// objects are joined with "_" and, if prefix is true, prefixed with the field
+// of the column, e.g. {"data": {"key": 1, "geo": {"lat": 2}}} becomes
+// {"data_key": 1, "data_geo_lat": 2}. Arrays are kept as values. A cell whose
+// keys conflict with another field is kept nested with a warning.
+func WithFlatten(prefix bool) Option {
+	return func(c *Converter) {
+		c.flatten = true
+		c.flattenPrefix = prefix
+	}
+}
+
+// flattenObjects 将记录中对象类型的值展开合并到记录中
+func (c *Converter) flattenObjects(data map[string]interface{}) {
+	var fields []string
+	for field, v := range data {
+		if _, ok := v.(map[string]interface{}); ok {
+			fields = append(fields, field)
+		}
+	}
+	// 按字段名顺序处理，冲突时保留嵌套的对象总是同一个
+	sort.Strings(fields)
+	for _, field := range fields {
+		prefix := ""
+		if c.flattenPrefix {
+			prefix = field + "_"
+		}
+		flat := map[string]interface{}{}
+		flattenInto(flat, prefix, data[field].(map[string]interface{}))
+		conflict := ""
+		for key := range flat {
+			if _, ok := data[key]; ok && key != field {
+				conflict = key
+				break
+			}
+		}
+		if conflict != "" {
+			c.warnings.warn("flatten: key conflict", "field %s kept nested, its key %s conflicts with another field", field, conflict)
+			continue
+		}
+		delete(data, field)
+		for key, v := range flat {
+			data[key] = v
+		}
+	}
+}
+
+// flattenInto 将对象的键加上前缀写入 flat，嵌套的对象以 _ 连接键
+func flattenInto(flat map[string]interface{}, prefix string, m map[string]interface{}) {
+	for key, v := range m {
+		if child, ok := v.(map[string]interface{}); ok && len(child) > 0 {
+			flattenInto(flat, prefix+key+"_", child)
+			continue
+		}
+		flat[prefix+key] = v
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var fuzzDelimiters = []rune{',', ';', '\t', '|'}
+
+// addCsvSeeds 将仓库 testdata 目录下的 CSV 文件加入语料
+func addCsvSeeds(f *testing.F, add func(data []byte)) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "cmd", "csv2jsonl", "testdata", "*.csv"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		add(data)
+	}
+}
+
+func FuzzReadCsv(f *testing.F) {
+	log.SetLevel(log.PanicLevel)
+	addCsvSeeds(f, func(data []byte) {
+		f.Add(data, uint8(0), false)
+		f.Add(data, uint8(1), true)
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte, delimiter uint8, pretty bool) {
+		c := NewConverter(
+			WithPretty(pretty),
+			WithDelimiter(fuzzDelimiters[int(delimiter)%len(fuzzDelimiters)]),
+		)
+		lines, _, err := c.readCsv(bytes.NewReader(data), nil)
+		if err != nil {
+			return
+		}
+		for line := range lines {
+			if _, err := json.Marshal(line); err != nil {
+				t.Errorf("marshal %v failed: %v", line, err)
+			}
+		}
+	})
+}
+
+func FuzzWorkers(f *testing.F) {
+	log.SetLevel(log.PanicLevel)
+	addCsvSeeds(f, func(data []byte) {
+		f.Add(data, uint8(0), uint8(0))
+		f.Add(data, uint8(3), uint8(2))
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte, delimiter, limit uint8) {
+		convert := func(workers int) (string, error) {
+			var buf bytes.Buffer
+			err := NewConverter(
+				WithDelimiter(fuzzDelimiters[int(delimiter)%len(fuzzDelimiters)]),
+				WithLimit(int(limit)),
+				WithWorkers(workers),
+			).Convert(bytes.NewReader(data), &buf)
+			return buf.String(), err
+		}
+		want, wantErr := convert(1)
+		got, err := convert(3)
+		if (err == nil) != (wantErr == nil) || got != want {
+			t.Errorf("workers output %q (%v), want %q (%v)", got, err, want, wantErr)
+		}
+	})
+}
+
+func FuzzJsonPrinter(f *testing.F) {
+	log.SetLevel(log.PanicLevel)
+	for _, seed := range []string{"", "{", "}", "{}", `{"a":1}`, "{broken}", "[draft]", `{"a":{"b":[1,2]}}`} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, colCell string) {
+		if _, err := json.Marshal(jsonPrinter(colCell)); err != nil {
+			t.Errorf("marshal %q failed: %v", colCell, err)
+		}
+	})
+}
+
+func FuzzTransforms(f *testing.F) {
+	log.SetLevel(log.PanicLevel)
+	for _, seed := range []string{"", "1", "-1", "3.14", "NaN", "+Inf", "1e400", "true", "T", `{"a":1}`, "[1,2]", "null"} {
+		f.Add(seed)
+	}
+
+	types := []string{TypeString, TypeInt, TypeFloat, TypeBool, TypeJSON, TypeDate, TypeNullIfEmpty}
+	f.Fuzz(func(t *testing.T, colCell string) {
+		for _, typ := range types {
+			v := coerceCell(typ, colCell)
+			if _, err := json.Marshal(v); err != nil {
+				t.Errorf("marshal %q as %s failed: %v", colCell, typ, err)
+			}
+		}
+	})
+}
+
+func FuzzFilter(f *testing.F) {
+	for _, seed := range []string{
+		`age > 30 && city == "London"`,
+		"!(a == b) or (a < 2024-01-01)",
+		"`a b` != 'x\\'y'",
+		"((a", "a ==", "&& ||", `"unterminated`,
+	} {
+		f.Add(seed, "30", "London")
+	}
+
+	columns := []string{"age", "city", "a", "b", "a b"}
+	f.Fuzz(func(t *testing.T, expr, age, city string) {
+		filter, err := compileFilter(expr, NewColumnResolver(columns, nil, false))
+		if err != nil {
+			return
+		}
+		filter([]string{age, city, age, city})
+	})
+}
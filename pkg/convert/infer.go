@@ -0,0 +1,206 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+)
+
+// LenientRatio is the minimum fraction of the non-empty cells of a column
+// that must have a type for InferOptions.Lenient to infer it.
+const LenientRatio = 0.95
+
+// InferOptions controls how InferSchema infers the column types.
+type InferOptions struct {
+	// Sample is the number of rows to read, 0 reads all rows.
+	Sample int
+	// Lenient infers a type if at least LenientRatio of the non-empty cells
+	// have it instead of all of them. The other cells are kept as strings.
+	Lenient bool
+	// NoHeader reads the input without a header row, see
+	// source.NewHeaderlessCSVReader. Header names its columns.
+	NoHeader bool
+	Header   []string
+	// TrimSpace and StripControlChars clean the cells before inferring
+	// their types, see WithTrimSpace and WithStripControlChars.
+	TrimSpace         bool
+	StripControlChars bool
+}
+
+// Schema is the schema of the columns inferred from the input.
+type Schema struct {
+	// Rows is the number of rows the schema is inferred from.
+	Rows    int            `json:"rows"`
+	Columns []ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema is the schema of a column inferred from its cells.
+type ColumnSchema struct {
+	Name string `json:"name"`
+	// Type is TypeInt, TypeFloat or TypeBool if the non-empty cells are
+	// converted to it by InferTypes, TypeString otherwise.
+	Type string `json:"type"`
+	// Confidence is the fraction of the non-empty cells having the type.
+	Confidence float64 `json:"confidence"`
+	// Nullable reports whether the column has empty cells.
+	Nullable bool `json:"nullable"`
+	// MaxLength is the length of the longest cell in characters.
+	MaxLength int `json:"max_length"`
+}
+
+// typeCounts 一列中各类型非空单元格的数量
+type typeCounts struct {
+	ints, floats, bools, total int
+}
+
+// InferSchema reads the CSV from r and infers the schema of each column.
+// Malformed rows are ignored, other read errors are returned. The schema of
+// an empty input has no columns.
+func InferSchema(r io.Reader, delimiter rune, opts InferOptions) (*Schema, error) {
+	var (
+		csvReader *csv.Reader
+		columns   []string
+		err       error
+	)
+	if opts.NoHeader {
+		csvReader, columns, err = source.NewHeaderlessCSVReader(r, delimiter, opts.Header)
+	} else {
+		csvReader, columns, err = source.NewCSVReader(r, delimiter)
+	}
+	if err == io.EOF {
+		// 空的输入没有列
+		return &Schema{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{Columns: make([]ColumnSchema, len(columns))}
+	counts := make([]typeCounts, len(columns))
+	for i, col := range columns {
+		schema.Columns[i] = ColumnSchema{Name: col}
+	}
+	for opts.Sample <= 0 || schema.Rows < opts.Sample {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if newRowError(err, row, 0) == nil {
+				return nil, fmt.Errorf("read csv failed: %v", err)
+			}
+			continue
+		}
+		schema.Rows++
+		if opts.TrimSpace || opts.StripControlChars {
+			for i := range row {
+				row[i] = transform.SanitizeCell(row[i], opts.TrimSpace, opts.StripControlChars)
+			}
+		}
+		for i := range schema.Columns {
+			col := &schema.Columns[i]
+			if i >= len(row) || row[i] == "" {
+				col.Nullable = true
+				continue
+			}
+			if n := utf8.RuneCountInString(row[i]); n > col.MaxLength {
+				col.MaxLength = n
+			}
+			counts[i].total++
+			switch InferTypes("", row[i]).(type) {
+			case int64:
+				counts[i].ints++
+			case float64:
+				counts[i].floats++
+			case bool:
+				counts[i].bools++
+			}
+		}
+	}
+
+	ratio := 1.0
+	if opts.Lenient {
+		ratio = LenientRatio
+	}
+	for i := range schema.Columns {
+		schema.Columns[i].Type, schema.Columns[i].Confidence = counts[i].infer(ratio)
+	}
+	return schema, nil
+}
+
+// infer 返回至少 ratio 的单元格具有的类型及其比例，整数也可以作为浮点数
+func (c typeCounts) infer(ratio float64) (string, float64) {
+	if c.total == 0 {
+		return TypeString, 1
+	}
+	total := float64(c.total)
+	for _, candidate := range []struct {
+		typ string
+		n   int
+	}{
+		{TypeInt, c.ints},
+		{TypeFloat, c.ints + c.floats},
+		{TypeBool, c.bools},
+	} {
+		if n := float64(candidate.n); n > 0 && n/total >= ratio {
+			return candidate.typ, n / total
+		}
+	}
+	return TypeString, 1
+}
+
+// SchemaParser returns a ValueParser converting the cells of each column to
+// the type of its schema, cells not having the type are kept as strings.
+// Empty cells of non-string columns are converted to null.
+func SchemaParser(schema *Schema) ValueParser {
+	types := make(map[string]string, len(schema.Columns))
+	for _, col := range schema.Columns {
+		types[col.Name] = col.Type
+	}
+	return func(column, cell string) interface{} {
+		typ := types[column]
+		if typ == TypeString || typ == "" {
+			return cell
+		}
+		if cell == "" {
+			return nil
+		}
+		switch v := InferTypes(column, cell).(type) {
+		case int64:
+			if typ == TypeFloat {
+				return float64(v)
+			}
+			if typ == TypeInt {
+				return v
+			}
+		case float64:
+			if typ == TypeFloat {
+				return v
+			}
+		case bool:
+			if typ == TypeBool {
+				return v
+			}
+		}
+		return cell
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// KAnonymity suppresses the quasi-identifiers of the rows whose combination
+// of quasi-identifier values is shared by fewer than K rows, so that each
+// record written is indistinguishable from at least K-1 others by these
+// columns. It is built by BuildKAnonymity.
+type KAnonymity struct {
+	// Columns are the quasi-identifier columns, e.g. zip code, birth year
+	// and gender.
+	Columns []string
+	// K is the minimum number of rows sharing the quasi-identifiers.
+	K int
+	// rare 少于 K 行共有的组合，键见 rowKey
+	rare map[string]struct{}
+}
+
+// BuildKAnonymity reads the CSV from r and finds the combinations of values
+// of the quasi-identifier columns shared by fewer than k of the rows the
+// Converter converts, i.e. after skipping, filtering, deduplication and the
+// limit. The columns are column references, see ColumnResolver.
+func (c *Converter) BuildKAnonymity(r io.Reader, columns []string, k int) (*KAnonymity, error) {
+	if k < 2 || len(columns) == 0 {
+		return nil, errors.New("k-anonymity: k must be at least 2 and quasi-identifier columns are required")
+	}
+	counter := *c
+	// 统计整个输入，包括继续转换时已经转换的行
+	counter.resume = nil
+	counter.kAnonymity = &KAnonymity{Columns: columns, K: k, rare: map[string]struct{}{}}
+	rc, rr, header, err := counter.prepare(r)
+	if err != nil || len(header) == 0 {
+		return nil, err
+	}
+	// 顺序检查和数值的警告只在转换时进行，格式错误的行在转换时再交给 ErrorHandler
+	rr.sorted, rr.numeric = nil, nil
+	if rr.onError != nil {
+		rr.onError = func(*RowError) error { return nil }
+	}
+
+	counts := map[string]int{}
+	rows := 0
+	for row, _ := rr.next(); row != nil && (c.limit <= 0 || rows < c.limit); row, _ = rr.next() {
+		counts[rowKey(rc.quasiIndexes, row)]++
+		rows++
+	}
+	if rr.err != nil {
+		return nil, rr.err
+	}
+
+	ka, suppressed := rc.kAnonymity, 0
+	for key, n := range counts {
+		if n < k {
+			ka.rare[key] = struct{}{}
+			suppressed += n
+		}
+	}
+	rc.logger.Infof("k-anonymity: suppressing %s of %d of %d rows shared by fewer than %d rows", strings.Join(ka.Columns, ","), suppressed, rows, k)
+	return ka, nil
+}
+
+// newQuasiIndexes 返回准标识符列的序号。准标识符不能由 detect-lang 等
+// 追加的字段间接写出
+func (c *Converter) newQuasiIndexes(columns []string) ([]int, error) {
+	if c.kAnonymity == nil {
+		return nil, nil
+	}
+	if c.kAnonymity.rare == nil {
+		return nil, errors.New("k-anonymity: not built, see BuildKAnonymity")
+	}
+	var indexes []int
+	for _, col := range c.kAnonymity.Columns {
+		switch {
+		case lo.Contains(c.detectLang, col):
+			return nil, fmt.Errorf("k-anonymity: quasi-identifier %s can not be used by detect-lang", col)
+		case lo.Contains(c.parseUA, col):
+			return nil, fmt.Errorf("k-anonymity: quasi-identifier %s can not be used by parse-ua", col)
+		}
+		index := lo.IndexOf(columns, col)
+		if index < 0 {
+			return nil, fmt.Errorf("k-anonymity: column %s not found", col)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// suppress 判断行的准标识符组合是否少于 K 行共有，是则在记录中将其写为 null
+func (c *Converter) suppress(row []string, record interface{}) interface{} {
+	if c.kAnonymity == nil {
+		return record
+	}
+	if _, rare := c.kAnonymity.rare[rowKey(c.quasiIndexes, row)]; !rare {
+		return record
+	}
+	if len(c.columns) == 1 {
+		// 只输出一列时该列即为记录
+		if lo.Contains(c.kAnonymity.Columns, c.columns[0]) {
+			return nil
+		}
+		return record
+	}
+	data := record.(map[string]interface{})
+	for _, col := range c.kAnonymity.Columns {
+		if _, ok := data[c.key(col)]; ok {
+			data[c.key(col)] = nil
+		}
+	}
+	return data
+}
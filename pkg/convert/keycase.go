@@ -0,0 +1,27 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+// WithKeyCase writes the keys of the columns that are not renamed in the
+// given key case, e.g. transform.KeyCaseSnake, so that inconsistent headers such as
+// "First Name", "firstName" and "FIRST_NAME" all become first_name. Options
+// may refer to the columns by their original name or by their key. Columns
+// whose keys collide fail the conversion.
+func WithKeyCase(style string) Option {
+	return func(c *Converter) {
+		c.keyCase = style
+	}
+}
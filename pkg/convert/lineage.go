@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// FieldLineage describes where an output field comes from.
+type FieldLineage struct {
+	// Field is the output key, dotted for nested fields and "$" for the
+	// value written when a single column is selected.
+	Field string `json:"field"`
+	// Sources are the input columns the field is derived from.
+	Sources []string `json:"sources"`
+	// Steps is the chain of operations applied in order, e.g. "rename",
+	// "transform:html_unescape" or "type:int".
+	Steps []string `json:"steps,omitempty"`
+}
+
+// Lineage describes how the output records are derived from the input.
+type Lineage struct {
+	Fields []FieldLineage `json:"fields"`
+	// RowFilters are the conditions rows must match to be converted.
+	RowFilters []string `json:"row_filters,omitempty"`
+}
+
+// lineage 根据表头和转换选项计算输出字段的来源
+func (c *Converter) lineage(columns []string) *Lineage {
+	var l Lineage
+
+	selected := columns
+	if len(c.columns) > 0 {
+		selected = lo.Filter(columns, func(col string, _ int) bool { return lo.Contains(c.columns, col) })
+	}
+	for _, col := range selected {
+		if c.dropped(col) {
+			continue
+		}
+		field := FieldLineage{Field: c.key(col), Sources: []string{col}}
+		if len(c.columns) == 1 {
+			field.Field = "$"
+		} else if field.Field != col {
+			field.Steps = append(field.Steps, "rename")
+		}
+		if _, ok := c.defaults[col]; ok {
+			field.Steps = append(field.Steps, "default")
+		}
+		if p, ok := c.protections[col]; ok {
+			// 受保护的单元格不再转换和解析类型
+			field.Steps = append(field.Steps, "protect:"+p.Action)
+			l.Fields = append(l.Fields, field)
+			continue
+		}
+		for _, name := range c.transforms[col] {
+			field.Steps = append(field.Steps, "transform:"+name)
+		}
+		if _, ok := c.valueMaps[col]; ok {
+			field.Steps = append(field.Steps, "map")
+		}
+		if _, ok := c.dictionary[col]; ok {
+			field.Steps = append(field.Steps, "dictionary")
+		}
+		switch typ, ok := c.types[col]; {
+		case ok:
+			field.Steps = append(field.Steps, "type:"+typ)
+		case c.parser != nil:
+			field.Steps = append(field.Steps, "parse")
+		}
+		if c.flatten && c.types[col] == TypeJSON {
+			field.Steps = append(field.Steps, "flatten")
+		}
+		if c.kAnonymity != nil && lo.Contains(c.kAnonymity.Columns, col) {
+			field.Steps = append(field.Steps, fmt.Sprintf("k_anonymity:%d", c.kAnonymity.K))
+		}
+		l.Fields = append(l.Fields, field)
+	}
+
+	if len(c.columns) != 1 {
+		for _, col := range c.detectLang {
+			l.Fields = append(l.Fields, FieldLineage{Field: c.key(col) + "_lang", Sources: []string{col}, Steps: []string{"detect_lang"}})
+		}
+		for _, col := range c.parseUA {
+			l.Fields = append(l.Fields, FieldLineage{Field: c.key(col) + "_ua", Sources: []string{col}, Steps: []string{"parse_ua"}})
+		}
+		if c.positionField != "" {
+			l.Fields = append(l.Fields, FieldLineage{Field: c.positionField, Sources: []string{}, Steps: []string{"position"}})
+		}
+		if c.rowNumberField != "" {
+			l.Fields = append(l.Fields, FieldLineage{Field: c.rowNumberField, Sources: []string{}, Steps: []string{"row_number"}})
+		}
+		metaFields := lo.Keys(c.metaFields)
+		sort.Strings(metaFields)
+		for _, name := range metaFields {
+			l.Fields = append(l.Fields, FieldLineage{Field: name, Sources: []string{}, Steps: []string{"meta"}})
+		}
+		if c.nested {
+			for i := range l.Fields {
+				if strings.Contains(l.Fields[i].Field, ".") {
+					l.Fields[i].Steps = append(l.Fields[i].Steps, "nest")
+				}
+			}
+		}
+	}
+
+	if c.whereDate != "" {
+		l.RowFilters = append(l.RowFilters, fmt.Sprintf("where-date: %s", c.whereDate))
+	}
+	if c.filter != "" {
+		l.RowFilters = append(l.RowFilters, fmt.Sprintf("filter: %s", c.filter))
+	}
+	if c.dedupe != nil {
+		l.RowFilters = append(l.RowFilters, fmt.Sprintf("dedupe: %s", strings.Join(c.dedupe.Columns, ",")))
+	}
+	if c.sample != nil && c.sample.Rate > 0 {
+		l.RowFilters = append(l.RowFilters, fmt.Sprintf("sample: rate %g", c.sample.Rate))
+	}
+	if c.sample != nil && c.sample.N > 0 {
+		l.RowFilters = append(l.RowFilters, fmt.Sprintf("sample: %d rows", c.sample.N))
+	}
+	return &l
+}
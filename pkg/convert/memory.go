@@ -0,0 +1,56 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Bytes converts the CSV in data to JSON Lines in memory, e.g. for a
+// serverless function answering a small payload synchronously. Rows are
+// converted in the calling goroutine unless WithWorkers asks for more.
+func Bytes(data []byte, opts ...Option) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(data) * 2)
+	if err := NewConverter(opts...).convertDirect(bytes.NewReader(data), &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// String is Bytes for CSV held in a string.
+func String(csv string, opts ...Option) (string, error) {
+	var b strings.Builder
+	b.Grow(len(csv) * 2)
+	if err := NewConverter(opts...).convertDirect(strings.NewReader(csv), &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// convertDirect 同 Convert，在调用的协程中转换，不经过 channel
+func (c *Converter) convertDirect(r io.Reader, w io.Writer) error {
+	if c.workers > 1 {
+		return c.Convert(r, w)
+	}
+	rc, rr, columns, enrich, err := c.start(r)
+	if err != nil || len(columns) == 0 {
+		return err
+	}
+	return rc.emitRows(rr, columns, enrich, rc.recordWriter(w))
+}
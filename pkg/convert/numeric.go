@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 每列每类问题保留的样例数
+const numericSampleLimit = 3
+
+// numericIssue 统计一列中溢出或丢失精度的数值
+type numericIssue struct {
+	count   int
+	samples []string
+}
+
+func (n *numericIssue) add(pos Position, cell string) {
+	n.count++
+	if len(n.samples) < numericSampleLimit {
+		n.samples = append(n.samples, fmt.Sprintf("%v: %q", pos, cell))
+	}
+}
+
+// numericColumn 转换为 int 或 float 的列
+type numericColumn struct {
+	name      string
+	typ       string
+	index     int
+	overflow  numericIssue
+	precision numericIssue
+}
+
+// numericChecker 检查转换为 int、float 的单元格是否超出 int64 范围
+// 或无法被 float64 精确表示，转换结束后汇总输出警告
+type numericChecker struct {
+	columns []*numericColumn
+}
+
+func (c *Converter) newNumericChecker(columns []string) *numericChecker {
+	var checker numericChecker
+	for i, col := range columns {
+		if typ := c.types[col]; typ == TypeInt || typ == TypeFloat {
+			checker.columns = append(checker.columns, &numericColumn{name: col, typ: typ, index: i})
+		}
+	}
+	if len(checker.columns) == 0 {
+		return nil
+	}
+	return &checker
+}
+
+// check 检查位于 pos 的行的数值列
+func (n *numericChecker) check(pos Position, row []string) {
+	for _, col := range n.columns {
+		if col.index >= len(row) {
+			continue
+		}
+		cell := row[col.index]
+		switch col.typ {
+		case TypeInt:
+			if _, err := strconv.ParseInt(cell, 10, 64); errors.Is(err, strconv.ErrRange) {
+				col.overflow.add(pos, cell)
+			}
+		case TypeFloat:
+			f, err := strconv.ParseFloat(cell, 64)
+			if errors.Is(err, strconv.ErrRange) {
+				col.overflow.add(pos, cell)
+			} else if err == nil && losesPrecision(cell, f) {
+				col.precision.add(pos, cell)
+			}
+		}
+	}
+}
+
+// losesPrecision 判断 f 的最短十进制表示是否与原始的十进制数不相等，
+// 即有效数字超出了 float64 的精度
+func losesPrecision(cell string, f float64) bool {
+	exact, ok := new(big.Rat).SetString(cell)
+	if !ok {
+		return false // 十六进制、Inf 等写法
+	}
+	shortest, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return exact.Cmp(shortest) != 0
+}
+
+// report 输出各列的问题数量及样例
+func (n *numericChecker) report(logger log.FieldLogger) {
+	for _, col := range n.columns {
+		if col.overflow.count > 0 {
+			logger.Warnf("column %s: %d values overflow %s and are written as strings, e.g. %s",
+				col.name, col.overflow.count, numericTypeName(col.typ), strings.Join(col.overflow.samples, ", "))
+		}
+		if col.precision.count > 0 {
+			logger.Warnf("column %s: %d values lose precision as float64, e.g. %s",
+				col.name, col.precision.count, strings.Join(col.precision.samples, ", "))
+		}
+	}
+}
+
+func numericTypeName(typ string) string {
+	if typ == TypeInt {
+		return "int64"
+	}
+	return "float64"
+}
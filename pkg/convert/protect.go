@@ -0,0 +1,148 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	"github.com/samber/lo"
+)
+
+// Protection actions of WithProtections.
+const (
+	// ProtectMask replaces each character of a cell with *.
+	ProtectMask = "mask"
+	// ProtectEncrypt writes a cell encrypted with AES-GCM under
+	// Protection.Key, base64 encoded with the nonce prepended.
+	ProtectEncrypt = "encrypt"
+	// ProtectDrop leaves the column out of the output.
+	ProtectDrop = "drop"
+	// ProtectHash writes the hex encoded transform.Digest of a cell under
+	// Protection.Hash, or the hash algorithm of WithHash when empty, with
+	// Protection.Salt prepended to the cell. Equal cells stay equal for
+	// joins.
+	ProtectHash = "hash"
+)
+
+// Protection protects the cells of a sensitive column before they are
+// written, e.g. a column classified as PII.
+type Protection struct {
+	// Action is ProtectMask, ProtectEncrypt, ProtectDrop or ProtectHash.
+	Action string
+	// Key is the AES key of ProtectEncrypt, 16, 24 or 32 bytes long.
+	Key []byte
+	// Hash is the hash algorithm of ProtectHash, empty for that of WithHash.
+	Hash string
+	// Salt is prepended to the cells of ProtectHash before hashing, so that
+	// the digests of guessable values can not be looked up without it.
+	Salt []byte
+}
+
+// IsValidProtection reports whether action is a supported protection action.
+func IsValidProtection(action string) bool {
+	switch action {
+	case ProtectMask, ProtectEncrypt, ProtectDrop, ProtectHash:
+		return true
+	}
+	return false
+}
+
+// protector 将单元格替换为受保护的值
+type protector func(cell string) string
+
+func maskCell(cell string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(cell))
+}
+
+func newEncryptor(key []byte) (protector, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return func(cell string) string {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			// 系统的随机数源不可用时无法安全地加密，不能退回写出原值
+			panic(fmt.Sprintf("protect: read random nonce failed: %v", err))
+		}
+		return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(cell), nil))
+	}, nil
+}
+
+// newProtectors 检查受保护的列，返回各列的保护函数，删除的列不在其中。
+// 受保护的列不能以原值出现在输出的其他位置
+func (c *Converter) newProtectors() (map[string]protector, error) {
+	if len(c.protections) == 0 {
+		return nil, nil
+	}
+	protectors := map[string]protector{}
+	for col, p := range c.protections {
+		switch {
+		case lo.Contains(c.detectLang, col):
+			return nil, fmt.Errorf("protect: column %s is protected and can not be used by detect-lang", col)
+		case lo.Contains(c.parseUA, col):
+			return nil, fmt.Errorf("protect: column %s is protected and can not be used by parse-ua", col)
+		case c.dictionary[col] != nil:
+			return nil, fmt.Errorf("protect: column %s is protected and can not be dictionary encoded", col)
+		}
+		switch p.Action {
+		case ProtectMask:
+			protectors[col] = maskCell
+		case ProtectEncrypt:
+			encrypt, err := newEncryptor(p.Key)
+			if err != nil {
+				return nil, fmt.Errorf("protect: encryption key of column %s: %v", col, err)
+			}
+			protectors[col] = encrypt
+		case ProtectHash:
+			hash, salt := c.hash, p.Salt
+			if p.Hash != "" {
+				if !transform.IsValidHash(p.Hash) {
+					return nil, fmt.Errorf("protect: unknown hash algorithm %s of column %s", p.Hash, col)
+				}
+				hash = p.Hash
+			}
+			protectors[col] = func(cell string) string {
+				return hex.EncodeToString(transform.Digest(hash, append(salt[:len(salt):len(salt)], cell...)))
+			}
+		case ProtectDrop:
+			if len(c.columns) == 1 && c.columns[0] == col {
+				return nil, fmt.Errorf("protect: column %s is dropped and can not be the only selected column", col)
+			}
+		default:
+			return nil, fmt.Errorf("protect: unknown action %s of column %s", p.Action, col)
+		}
+	}
+	return protectors, nil
+}
+
+// dropped 判断列是否因保护而不输出
+func (c *Converter) dropped(col string) bool {
+	p, ok := c.protections[col]
+	return ok && p.Action == ProtectDrop
+}
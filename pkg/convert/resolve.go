@@ -0,0 +1,321 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+)
+
+// ColumnResolver resolves the column references given to the options of a
+// Converter against the header of the input, so a reference means the same
+// column for every option. A reference is, in order of precedence:
+//
+//   - the name of a column
+//   - #n, the n-th column counting from 1, e.g. #3
+//   - the output name given to a column by WithRenames
+//   - the name of a column ignoring case, if case-insensitive
+//   - /regexp/, the columns whose names match the regular expression
+//   - a wildcard pattern with * matching any characters and ? matching one
+//     character, e.g. metric_*, the columns whose names match it
+type ColumnResolver struct {
+	columns  []string
+	renames  map[string]string // 输出名到列名
+	foldCase bool
+}
+
+// NewColumnResolver creates a ColumnResolver for the columns of a header.
+func NewColumnResolver(columns []string, renames map[string]string, foldCase bool) *ColumnResolver {
+	r := &ColumnResolver{columns: columns, foldCase: foldCase}
+	if len(renames) > 0 {
+		r.renames = make(map[string]string, len(renames))
+		for col, renamed := range renames {
+			r.renames[renamed] = col
+		}
+	}
+	return r
+}
+
+// Resolve returns the names of the columns the reference refers to.
+func (r *ColumnResolver) Resolve(ref string) ([]string, error) {
+	if isRegexpRef(ref) || isWildcardRef(ref) && r.indexOf(ref) < 0 {
+		re, err := r.pattern(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid column pattern %s: %v", ref, err)
+		}
+		var matched []string
+		for _, col := range r.columns {
+			if re.MatchString(col) {
+				matched = append(matched, col)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no column matches %s", ref)
+		}
+		return matched, nil
+	}
+	i, err := r.Index(ref)
+	if err != nil {
+		return nil, err
+	}
+	return []string{r.columns[i]}, nil
+}
+
+// Index returns the index of the single column the reference refers to.
+func (r *ColumnResolver) Index(ref string) (int, error) {
+	if i := r.indexOf(ref); i >= 0 {
+		return i, nil
+	}
+	if strings.HasPrefix(ref, "#") {
+		if n, err := strconv.Atoi(ref[1:]); err == nil {
+			if n < 1 || n > len(r.columns) {
+				return -1, fmt.Errorf("column %s out of range, the input has %d columns", ref, len(r.columns))
+			}
+			return n - 1, nil
+		}
+	}
+	if col, ok := r.renames[ref]; ok {
+		if i := r.indexOf(col); i >= 0 {
+			return i, nil
+		}
+	}
+	if r.foldCase {
+		index := -1
+		for i, col := range r.columns {
+			if !strings.EqualFold(col, ref) {
+				continue
+			}
+			if index >= 0 {
+				return -1, fmt.Errorf("column %s is ambiguous, it matches %s and %s", ref, r.columns[index], col)
+			}
+			index = i
+		}
+		if index >= 0 {
+			return index, nil
+		}
+	}
+	if isPatternRef(ref) {
+		cols, err := r.Resolve(ref)
+		if err != nil {
+			return -1, err
+		}
+		if len(cols) > 1 {
+			return -1, fmt.Errorf("column %s is ambiguous, it matches %s", ref, strings.Join(cols, ", "))
+		}
+		return r.indexOf(cols[0]), nil
+	}
+	return -1, fmt.Errorf("column %s not found", ref)
+}
+
+// pattern 编译正则表达式或通配符的列引用，通配符匹配整个列名，
+// 忽略大小写时通配符也忽略大小写
+func (r *ColumnResolver) pattern(ref string) (*regexp.Regexp, error) {
+	if isRegexpRef(ref) {
+		return regexp.Compile(ref[1 : len(ref)-1])
+	}
+	var b strings.Builder
+	if r.foldCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, part := range strings.SplitAfter(ref, "") {
+		switch part {
+		case "*":
+			b.WriteString(".*")
+		case "?":
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// isRegexpRef 判断列引用是否为 /regexp/
+func isRegexpRef(ref string) bool {
+	n := len(ref)
+	return n >= 2 && ref[0] == '/' && ref[n-1] == '/'
+}
+
+// isWildcardRef 判断列引用是否为包含 * 或 ? 的通配符
+func isWildcardRef(ref string) bool {
+	return strings.ContainsAny(ref, "*?")
+}
+
+// isPatternRef 判断列引用是否可能匹配多列
+func isPatternRef(ref string) bool {
+	return isRegexpRef(ref) || isWildcardRef(ref)
+}
+
+func (r *ColumnResolver) indexOf(name string) int {
+	for i, col := range r.columns {
+		if col == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolve 返回列引用替换为列名的 Converter 副本，原有的配置保持不变，
+// 以便对不同表头的输入重复使用
+func (c *Converter) resolve(columns []string) (*Converter, error) {
+	// 重命名的键只按列名和序号查找，避免与输出名互相引用
+	renames, err := resolveKeys(NewColumnResolver(columns, nil, c.foldCase), c.renames, false)
+	if err != nil {
+		return nil, fmt.Errorf("rename: %v", err)
+	}
+	if c.keyCase != "" {
+		if renames, err = caseKeys(columns, renames, c.keyCase); err != nil {
+			return nil, fmt.Errorf("key-case: %v", err)
+		}
+	}
+	res := NewColumnResolver(columns, renames, c.foldCase)
+
+	rc := *c
+	rc.resolver = res
+	rc.renames = renames
+	if rc.columns, err = resolveList(res, c.columns, false); err != nil {
+		return nil, fmt.Errorf("columns: %v", err)
+	}
+	if rc.types, err = resolveKeys(res, c.types, false); err != nil {
+		return nil, fmt.Errorf("types: %v", err)
+	}
+	if rc.jsonColumns, err = resolveList(res, c.jsonColumns, true); err != nil {
+		return nil, fmt.Errorf("parse-json: %v", err)
+	}
+	if len(rc.jsonColumns) > 0 {
+		// 按 JSON 解析的列即 TypeJSON 的列，显式指定的类型优先
+		types := make(map[string]string, len(rc.types)+len(rc.jsonColumns))
+		for _, col := range rc.jsonColumns {
+			types[col] = TypeJSON
+		}
+		for col, typ := range rc.types {
+			types[col] = typ
+		}
+		rc.types = types
+	}
+	if rc.dictionary, err = resolveKeys(res, c.dictionary, false); err != nil {
+		return nil, fmt.Errorf("dictionary: %v", err)
+	}
+	if rc.transforms, err = resolveKeys(res, c.transforms, true); err != nil {
+		return nil, fmt.Errorf("transform: %v", err)
+	}
+	if rc.valueMaps, err = resolveKeys(res, c.valueMaps, true); err != nil {
+		return nil, fmt.Errorf("map: %v", err)
+	}
+	if rc.defaults, err = resolveKeys(res, c.defaults, true); err != nil {
+		return nil, fmt.Errorf("default: %v", err)
+	}
+	if rc.protections, err = resolveKeys(res, c.protections, true); err != nil {
+		return nil, fmt.Errorf("protect: %v", err)
+	}
+	if rc.detectLang, err = resolveList(res, c.detectLang, true); err != nil {
+		return nil, fmt.Errorf("detect-lang: %v", err)
+	}
+	if rc.parseUA, err = resolveList(res, c.parseUA, true); err != nil {
+		return nil, fmt.Errorf("parse-ua: %v", err)
+	}
+	if c.assertSorted != nil {
+		i, err := res.Index(c.assertSorted.Column)
+		if err != nil {
+			return nil, fmt.Errorf("assert-sorted: %v", err)
+		}
+		assertion := *c.assertSorted
+		assertion.Column = columns[i]
+		rc.assertSorted = &assertion
+	}
+	if c.kAnonymity != nil {
+		ka := *c.kAnonymity
+		if ka.Columns, err = resolveList(res, c.kAnonymity.Columns, true); err != nil {
+			return nil, fmt.Errorf("k-anonymity: %v", err)
+		}
+		rc.kAnonymity = &ka
+	}
+	if c.dedupe != nil {
+		dedupe := *c.dedupe
+		if dedupe.Columns, err = resolveList(res, c.dedupe.Columns, true); err != nil {
+			return nil, fmt.Errorf("dedupe: %v", err)
+		}
+		rc.dedupe = &dedupe
+	}
+	return &rc, nil
+}
+
+// resolveRef 解析一个列引用。strict 为 false 时找不到的列名原样返回，
+// 与以前一样被忽略，序号、正则表达式和通配符仍然必须匹配
+func resolveRef(res *ColumnResolver, ref string, strict bool) ([]string, error) {
+	cols, err := res.Resolve(ref)
+	if err != nil && !strict && !isPatternRef(ref) && !strings.HasPrefix(ref, "#") {
+		return []string{ref}, nil
+	}
+	return cols, err
+}
+
+// resolveList 解析列引用的列表，保持引用的顺序
+func resolveList(res *ColumnResolver, refs []string, strict bool) ([]string, error) {
+	var cols []string
+	for _, ref := range refs {
+		resolved, err := resolveRef(res, ref, strict)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, resolved...)
+	}
+	return cols, nil
+}
+
+// resolveKeys 返回键替换为列名的副本，正则表达式匹配的每一列使用相同的值
+func resolveKeys[V any](res *ColumnResolver, m map[string]V, strict bool) (map[string]V, error) {
+	if m == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]V, len(m))
+	for ref, v := range m {
+		cols, err := resolveRef(res, ref, strict)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range cols {
+			resolved[col] = v
+		}
+	}
+	return resolved, nil
+}
+
+// caseKeys 将没有重命名的列按 style 转换后加入重命名，转换后相同的键返回错误
+func caseKeys(columns []string, renames map[string]string, style string) (map[string]string, error) {
+	keys := make(map[string]string, len(columns))
+	seen := make(map[string]string, len(columns))
+	for _, col := range columns {
+		key, ok := renames[col]
+		if !ok {
+			key = transform.KeyCase(style, col)
+		}
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("columns %q and %q both have the key %q", other, col, key)
+		}
+		seen[key] = col
+		if key != col {
+			keys[col] = key
+		}
+	}
+	return keys, nil
+}
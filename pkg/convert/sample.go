@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Sample selects a random subset of the rows for exploring a large input,
+// see WithSample.
+type Sample struct {
+	// Rate keeps each row with this probability, e.g. 0.01 for about 1%.
+	Rate float64
+	// N keeps a uniform sample of N rows by reservoir sampling. The rows
+	// are kept in memory and converted in input order once the input is
+	// read.
+	N int
+	// Seed of the random source: the same seed selects the same rows of
+	// the same input. A random seed is chosen if 0.
+	Seed int64
+}
+
+// WithSample converts a random sample of the rows matching the filters
+// instead of all of them. With both Rate and N, the reservoir samples the
+// rows kept by the rate. The limit applies to the sample.
+func WithSample(sample Sample) Option {
+	return func(c *Converter) {
+		if sample.Seed == 0 {
+			// 在这里确定种子，k-匿名的统计和转换抽取相同的行
+			sample.Seed = time.Now().UnixNano()
+		}
+		c.sample = &sample
+	}
+}
+
+// sampledRow 水塘中的一行
+type sampledRow struct {
+	row []string
+	pos Position
+}
+
+// sampler 按比例或水塘抽样选择行
+type sampler struct {
+	Sample
+	rng       *rand.Rand
+	seen      int
+	reservoir []sampledRow
+	filled    bool
+}
+
+func (c *Converter) newSampler() *sampler {
+	if c.sample == nil {
+		return nil
+	}
+	return &sampler{Sample: *c.sample, rng: rand.New(rand.NewSource(c.sample.Seed))}
+}
+
+// keep 按比例判断是否保留一行
+func (s *sampler) keep() bool {
+	return s.Rate <= 0 || s.rng.Float64() < s.Rate
+}
+
+// add 将一行加入水塘，水塘已满时以 N/seen 的概率替换其中一行
+func (s *sampler) add(row []string, pos Position) {
+	s.seen++
+	if len(s.reservoir) < s.N {
+		s.reservoir = append(s.reservoir, sampledRow{row, pos})
+	} else if j := s.rng.Intn(s.seen); j < s.N {
+		s.reservoir[j] = sampledRow{row, pos}
+	}
+}
+
+// nextSampled 第一次调用时读取所有行填满水塘，之后按输入的顺序返回水塘中的行
+func (r *rowReader) nextSampled() ([]string, Position) {
+	s := r.sampler
+	if !s.filled {
+		s.filled = true
+		for row, pos := r.read(); row != nil; row, pos = r.read() {
+			s.add(row, pos)
+		}
+		if r.err != nil {
+			return nil, Position{}
+		}
+		sort.Slice(s.reservoir, func(i, j int) bool { return s.reservoir[i].pos.Offset < s.reservoir[j].pos.Offset })
+		r.logger.Infof("sample: kept %d of %d rows", len(s.reservoir), s.seen)
+	}
+	if len(s.reservoir) == 0 {
+		return nil, Position{}
+	}
+	next := s.reservoir[0]
+	s.reservoir = s.reservoir[1:]
+	return next.row, next.pos
+}
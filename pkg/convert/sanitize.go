@@ -0,0 +1,50 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import "github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+
+// WithTrimSpace removes leading and trailing white space, including
+// non-breaking spaces, from the cells as they are read, before the filters,
+// checks, type inference and encoding see them.
+func WithTrimSpace(trim bool) Option {
+	return func(c *Converter) {
+		c.trimSpace = trim
+	}
+}
+
+// WithStripControlChars removes control characters other than tab, line
+// feed and carriage return from the cells as they are read, together with
+// invisible formatting characters: zero-width space, word joiner, soft
+// hyphen and byte order mark. It applies before WithTrimSpace.
+func WithStripControlChars(strip bool) Option {
+	return func(c *Converter) {
+		c.stripControl = strip
+	}
+}
+
+// sanitizer 返回原地清理一行单元格的函数，没有启用清理时返回 nil
+func (c *Converter) sanitizer() func(row []string) {
+	if !c.trimSpace && !c.stripControl {
+		return nil
+	}
+	trim, strip := c.trimSpace, c.stripControl
+	return func(row []string) {
+		for i, cell := range row {
+			row[i] = transform.SanitizeCell(cell, trim, strip)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// SortAssertion asserts the input is sorted by a column.
+type SortAssertion struct {
+	// Column is the name of the column the input is sorted by.
+	Column string
+	// Descending asserts a non-increasing order instead of non-decreasing.
+	Descending bool
+	// WarnOnly logs out-of-order rows instead of failing the conversion.
+	WarnOnly bool
+}
+
+// compareValues 比较两个单元格：都是数字时按数值，都是日期时按时间，否则按字符串比较
+func compareValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, err := parseDate(a); err == nil {
+		if y, err := parseDate(b); err == nil {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// sortChecker 逐行检查输入的顺序
+type sortChecker struct {
+	SortAssertion
+	index      int
+	prev       string
+	started    bool
+	violations int
+	warnings   *warnThrottle
+}
+
+func (c *Converter) newSortChecker(columns []string) (*sortChecker, error) {
+	if c.assertSorted == nil {
+		return nil, nil
+	}
+	index := lo.IndexOf(columns, c.assertSorted.Column)
+	if index < 0 {
+		return nil, fmt.Errorf("assert-sorted: column %s not found", c.assertSorted.Column)
+	}
+	return &sortChecker{SortAssertion: *c.assertSorted, index: index}, nil
+}
+
+// check 检查位于 pos 的行是否有序，WarnOnly 时只记录日志
+func (s *sortChecker) check(pos Position, row []string) error {
+	if s.index >= len(row) {
+		return nil
+	}
+	value := row[s.index]
+	defer func() {
+		s.prev, s.started = value, true
+	}()
+	if !s.started {
+		return nil
+	}
+
+	cmp := compareValues(s.prev, value)
+	if s.Descending {
+		cmp = -cmp
+	}
+	if cmp <= 0 {
+		return nil
+	}
+
+	s.violations++
+	err := fmt.Errorf("row at %v is out of order: %s %q after %q", pos, s.Column, value, s.prev)
+	if s.WarnOnly {
+		s.warnings.warn("assert-sorted", "%v", err)
+		return nil
+	}
+	return err
+}
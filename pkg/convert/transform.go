@@ -0,0 +1,58 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	"github.com/samber/lo"
+)
+
+// compileTransforms 检查转换的列和名称，返回各列依次应用的转换
+func (c *Converter) compileTransforms(columns []string) (map[string][]transform.Func, error) {
+	compiled := make(map[string][]transform.Func, len(c.transforms))
+	for col, names := range c.transforms {
+		if !lo.Contains(columns, col) {
+			return nil, fmt.Errorf("transform: column %s not found", col)
+		}
+		for _, name := range names {
+			t, err := transform.Lookup(name)
+			if err != nil {
+				return nil, fmt.Errorf("transform: column %s: %v", col, err)
+			}
+			compiled[col] = append(compiled[col], t)
+		}
+	}
+	return compiled, nil
+}
+
+// transform 依次应用列的转换，结果不再是字符串时 ok 为 false
+func (c *Converter) transform(col, colCell string) (v interface{}, ok bool) {
+	v = colCell
+	for _, t := range c.transformFuncs[col] {
+		if v = t(colCell); !isString(v) {
+			return v, false
+		}
+		colCell = v.(string)
+	}
+	return v, true
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
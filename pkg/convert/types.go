@@ -0,0 +1,132 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Column types supported by WithTypes.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeJSON   = "json"
+	// TypeDate normalizes dates to 2006-01-02, or RFC 3339 if they have a time.
+	TypeDate = "date"
+	// TypeNullIfEmpty writes empty cells as null and others as strings.
+	TypeNullIfEmpty = "null-if-empty"
+)
+
+// IsValidType reports whether typ is a supported column type.
+func IsValidType(typ string) bool {
+	switch typ {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeJSON, TypeDate, TypeNullIfEmpty:
+		return true
+	}
+	return false
+}
+
+// coerceCell converts the cell to the given type, the raw string is kept
+// if the cell can not be converted.
+func coerceCell(typ, colCell string) interface{} {
+	v, err := convertCell(typ, colCell)
+	if err != nil {
+		log.Debugf("convert %q to %s failed: %v", colCell, typ, err)
+		return colCell
+	}
+	return v
+}
+
+// convertCell 将单元格转换为 typ 类型，无法转换时返回错误
+func convertCell(typ, colCell string) (interface{}, error) {
+	var (
+		v   interface{}
+		err error
+	)
+
+	switch typ {
+	case TypeInt:
+		v, err = strconv.ParseInt(colCell, 10, 64)
+	case TypeFloat:
+		var f float64
+		f, err = strconv.ParseFloat(colCell, 64)
+		// JSON 无法表示 NaN 和 Inf
+		if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			err = fmt.Errorf("%v is not representable in json", f)
+		}
+		v = f
+	case TypeBool:
+		v, err = strconv.ParseBool(colCell)
+	case TypeJSON:
+		err = json.Unmarshal([]byte(colCell), &v)
+	case TypeDate:
+		var t time.Time
+		if t, err = parseDate(colCell); err == nil {
+			v = formatDate(t)
+		}
+	case TypeNullIfEmpty:
+		if colCell == "" {
+			return nil, nil
+		}
+		return colCell, nil
+	default:
+		return colCell, nil
+	}
+	return v, err
+}
+
+// ValueParser converts a cell of the column to the value written in the JSON
+// output. Columns with an explicit type given by WithTypes are not passed to it.
+type ValueParser func(column, cell string) interface{}
+
+var (
+	inferIntRe   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	inferFloatRe = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// InferTypes is a ValueParser converting integers, floats and the booleans
+// true and false (case-insensitive) to JSON numbers and booleans. Numbers
+// with leading zeros such as zip codes, and integers overflowing int64 are
+// kept as strings.
+func InferTypes(column, cell string) interface{} {
+	switch {
+	case inferIntRe.MatchString(cell):
+		if v, err := strconv.ParseInt(cell, 10, 64); err == nil {
+			return v
+		}
+		return cell
+	case inferFloatRe.MatchString(cell):
+		if v, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsInf(v, 0) {
+			return v
+		}
+		return cell
+	case strings.EqualFold(cell, "true"):
+		return true
+	case strings.EqualFold(cell, "false"):
+		return false
+	}
+	return cell
+}
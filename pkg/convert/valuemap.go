@@ -0,0 +1,32 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+// WithValueMaps rewrites the cells of the given columns found in their
+// lookup table after the transforms, e.g. {"status": {"0": "inactive",
+// "1": "active"}}. Mapped cells are written as strings without dictionary
+// encoding or types, the other cells are converted as usual.
+func WithValueMaps(maps map[string]map[string]string) Option {
+	return func(c *Converter) {
+		c.valueMaps = maps
+	}
+}
+
+// mapValue 返回列的查找表中单元格对应的值
+func (c *Converter) mapValue(col, colCell string) (string, bool) {
+	mapped, ok := c.valueMaps[col][colCell]
+	return mapped, ok
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultWarnLimit is the number of occurrences of each kind of row warning
+// logged by default before they are only counted, see WithWarnLimit.
+const DefaultWarnLimit = 10
+
+// warnInterval 超过上限后汇总输出省略的警告的间隔
+const warnInterval = 10 * time.Second
+
+// WithWarnLimit logs the first n occurrences of each kind of row warning,
+// e.g. cells that can not be converted to their type or malformed rows
+// skipped by the ErrorHandler. Further occurrences are counted, logged as
+// an aggregated count at most every 10 seconds and reported by
+// Stats.Warnings. DefaultWarnLimit applies if n is 0.
+func WithWarnLimit(n int) Option {
+	return func(c *Converter) {
+		c.warnLimit = n
+	}
+}
+
+// warnThrottle 按种类统计行的警告，每种只输出前 limit 次，之后定期汇总输出
+type warnThrottle struct {
+	limit  int
+	logger log.FieldLogger
+
+	mu         sync.Mutex
+	counts     map[string]int
+	kinds      []string       // 按第一次出现的顺序
+	suppressed map[string]int // 上次汇总之后省略的次数
+	reported   time.Time
+}
+
+func newWarnThrottle(limit int, logger log.FieldLogger) *warnThrottle {
+	if limit <= 0 {
+		limit = DefaultWarnLimit
+	}
+	return &warnThrottle{limit: limit, logger: logger, counts: map[string]int{}, suppressed: map[string]int{}, reported: time.Now()}
+}
+
+// warn 记录一次 kind 的警告，可以在多个协程中调用
+func (t *warnThrottle) warn(kind, format string, args ...interface{}) {
+	if t == nil {
+		log.Warnf("%s: %s", kind, fmt.Sprintf(format, args...))
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.counts[kind] + 1
+	if n == 1 {
+		t.kinds = append(t.kinds, kind)
+	}
+	t.counts[kind] = n
+	switch {
+	case n < t.limit:
+		t.logger.Warnf("%s: %s", kind, fmt.Sprintf(format, args...))
+		return
+	case n == t.limit:
+		t.logger.Warnf("%s: %s; further occurrences are only counted", kind, fmt.Sprintf(format, args...))
+		return
+	}
+	t.suppressed[kind]++
+	if time.Since(t.reported) >= warnInterval {
+		t.flush()
+	}
+}
+
+// flush 输出上次汇总之后省略的警告的次数
+func (t *warnThrottle) flush() {
+	for _, kind := range t.kinds {
+		if n := t.suppressed[kind]; n > 0 {
+			t.logger.Warnf("%s: %d more occurrences, %d in total", kind, n, t.counts[kind])
+			t.suppressed[kind] = 0
+		}
+	}
+	t.reported = time.Now()
+}
+
+// totals 输出超过上限的警告的总数，返回各种警告出现的次数
+func (t *warnThrottle) totals() map[string]int {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.counts) == 0 {
+		return nil
+	}
+	totals := make(map[string]int, len(t.counts))
+	for _, kind := range t.kinds {
+		if t.counts[kind] > t.limit {
+			t.logger.Warnf("%s: %d occurrences in total", kind, t.counts[kind])
+		}
+		totals[kind] = t.counts[kind]
+	}
+	return totals
+}
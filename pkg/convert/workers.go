@@ -0,0 +1,198 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// 每个任务包含的行数，减少 channel 的开销
+const workerBatchSize = 128
+
+type rowBatch struct {
+	seq       int
+	rows      [][]string
+	positions []Position
+	end       Checkpoint // 读取最后一行之后的位置
+}
+
+type recordBatch struct {
+	seq     int
+	records []json.RawMessage
+	values  []interface{} // 有 observer 时保留转换后的记录
+	end     Checkpoint
+	err     error
+}
+
+// convertParallel 由 rr 所在的协程按顺序读取行并分批，c.workers 个协程并发
+// 转换和序列化，再按输入的顺序写入 lines，c.unordered 时按转换完成的顺序写入。
+// cancel 关闭后停止读取
+func (c *Converter) convertParallel(rr *rowReader, columns []string, enrich enricher, lines chan<- interface{}, errc chan<- error, cancel <-chan struct{}) {
+	var (
+		jobs    = make(chan rowBatch, c.workers)
+		results = make(chan recordBatch, c.workers)
+		done    = make(chan struct{}) // 达到 limit 或出错时停止读取
+		wg      sync.WaitGroup
+	)
+
+	go func() {
+		defer close(jobs)
+		seq := 0
+		batch := rowBatch{rows: make([][]string, 0, workerBatchSize), positions: make([]Position, 0, workerBatchSize)}
+		send := func() bool {
+			batch.end = rr.progress(0)
+			select {
+			case jobs <- batch:
+				seq++
+				batch = rowBatch{seq: seq, rows: make([][]string, 0, workerBatchSize), positions: make([]Position, 0, workerBatchSize)}
+				return true
+			case <-done:
+				return false
+			}
+		}
+		for row, pos := rr.next(); row != nil; row, pos = rr.next() {
+			batch.rows = append(batch.rows, row)
+			if batch.positions = append(batch.positions, pos); len(batch.rows) == workerBatchSize && !send() {
+				return
+			}
+		}
+		if len(batch.rows) > 0 {
+			send()
+		}
+	}()
+
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			for job := range jobs {
+				res := recordBatch{seq: job.seq, end: job.end}
+				for i, row := range job.rows {
+					record, ok, err := c.buildRecord(columns, row, job.positions[i], enrich)
+					if res.err = err; err != nil {
+						break
+					}
+					if !ok {
+						continue
+					}
+					buf.Reset()
+					if res.err = enc.Encode(record); res.err != nil {
+						break
+					}
+					res.records = append(res.records, json.RawMessage(bytes.TrimSuffix(bytes.Clone(buf.Bytes()), []byte("\n"))))
+					if c.observe != nil {
+						res.values = append(res.values, record)
+					}
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		emitted int
+		err     error
+		stopped bool
+		next    int
+		pending = map[int]recordBatch{}
+	)
+	checkpointed := 0
+	if c.resume != nil {
+		emitted, checkpointed = c.resume.Emitted, c.resume.Rows
+	}
+	stop := func() {
+		if !stopped {
+			stopped = true
+			close(done)
+		}
+	}
+	// send 写入 lines，cancel 关闭时停止并返回 false
+	send := func(v interface{}) bool {
+		select {
+		case lines <- v:
+			return true
+		case <-cancel:
+			stop()
+			return false
+		}
+	}
+	emit := func(batch recordBatch) {
+		if stopped {
+			return
+		}
+		if batch.err != nil {
+			err = batch.err
+			stop()
+			return
+		}
+		for i, record := range batch.records {
+			if c.observe != nil {
+				c.observe(batch.values[i])
+			}
+			if !send(record) {
+				return
+			}
+			emitted++
+			if c.limit > 0 && emitted >= c.limit {
+				stop()
+				break
+			}
+		}
+		// 不按顺序写入时，之前的批次不一定都已写入，不能作为检查点
+		if !stopped && !c.unordered && c.checkpointRows > 0 && batch.end.Rows-checkpointed >= c.checkpointRows {
+			cp := batch.end
+			cp.Emitted = emitted
+			if !send(checkpointMarker(cp)) {
+				return
+			}
+			checkpointed = cp.Rows
+		}
+	}
+	// 停止后继续排空 results，避免工作协程阻塞
+	for res := range results {
+		if c.unordered {
+			emit(res)
+			continue
+		}
+		pending[res.seq] = res
+		for {
+			batch, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			emit(batch)
+		}
+	}
+
+	// results 关闭时读取协程已经退出，可以安全地访问 rr
+	if err == nil {
+		err = rr.err
+	}
+	rr.finish(emitted)
+	errc <- err
+	close(lines)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// benchmarkCSV 生成 rows 行的 CSV，每 1000 行有一行很长的文本，转换各批次的耗时不均
+func benchmarkCSV(rows int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("id,name,score,active,text\n")
+	long := strings.Repeat("&lt;p&gt; lorem ipsum &amp; dolor ", 2000)
+	for i := 0; i < rows; i++ {
+		text := "short &amp; sweet"
+		if i%1000 == 0 {
+			text = long
+		}
+		fmt.Fprintf(&buf, "%d,user %d,%d.5,%v,%s\n", i, i, i%100, i%2 == 0, text)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkConvertWorkers 比较顺序写出和 WithUnordered 的吞吐量，如
+// go test -run NONE -bench ConvertWorkers ./pkg/csv2jsonl
+func BenchmarkConvertWorkers(b *testing.B) {
+	log.SetLevel(log.PanicLevel)
+	data := benchmarkCSV(50000)
+	for _, bc := range []struct {
+		name      string
+		workers   int
+		unordered bool
+	}{
+		{"sequential", 1, false},
+		{"ordered-4", 4, false},
+		{"unordered-4", 4, true},
+		{"ordered-8", 8, false},
+		{"unordered-8", 8, true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				c := NewConverter(
+					WithTypes(map[string]string{"id": TypeInt, "score": TypeFloat, "active": TypeBool}),
+					WithTransforms(map[string][]string{"text": {"html_unescape", "upper"}}),
+					WithWorkers(bc.workers),
+					WithUnordered(bc.unordered),
+				)
+				if err := c.Convert(bytes.NewReader(data), io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// failingWriter 写出 n 次后失败
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	w.n--
+	return len(p), nil
+}
+
+// 写出失败后停止读取剩余的输入
+func TestConvertStopsOnWriteError(t *testing.T) {
+	log.SetLevel(log.PanicLevel)
+	data := benchmarkCSV(50000)
+	for _, workers := range []int{1, 4} {
+		r := bytes.NewReader(data)
+		err := NewConverter(WithWorkers(workers)).Convert(r, &failingWriter{n: 10})
+		if err != io.ErrClosedPipe {
+			t.Errorf("workers %d: err = %v, want %v", workers, err, io.ErrClosedPipe)
+		}
+		if read := len(data) - r.Len(); read > len(data)/10 {
+			t.Errorf("workers %d: read %d of %d bytes after the write error", workers, read, len(data))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package csv2jsonl
+
+import (
+	"encoding/csv"
+	"io"
+	"testing"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 导出的 API 的签名，修改签名会使编译失败，需要升级主版本，见 doc.go
+var (
+	_ func(...Option) *Converter                                      = NewConverter
+	_ func(*Converter, io.Reader, io.Writer) error                    = (*Converter).Convert
+	_ func(*Converter) Stats                                          = (*Converter).Stats
+	_ func(*Converter, []string) error                                = (*Converter).CheckHeader
+	_ func(*Converter, []string, string) (string, error)              = (*Converter).Field
+	_ func(*Converter, io.Reader, []string, int) (*KAnonymity, error) = (*Converter).BuildKAnonymity
+
+	_ func(...string) Option                    = WithColumns
+	_ func(bool) Option                         = WithCaseInsensitiveColumns
+	_ func(int) Option                          = WithLimit
+	_ func(int) Option                          = WithSkip
+	_ func(bool) Option                         = WithPretty
+	_ func(bool) Option                         = WithASCIIOnly
+	_ func(bool) Option                         = WithNested
+	_ func(bool) Option                         = WithEmptyAsNull
+	_ func(bool) Option                         = WithTrimSpace
+	_ func(bool) Option                         = WithStripControlChars
+	_ func(bool) Option                         = WithOmitEmpty
+	_ func(rune) Option                         = WithDelimiter
+	_ func(...string) Option                    = WithNoHeader
+	_ func(map[string]string) Option            = WithRenames
+	_ func(map[string]string) Option            = WithTypes
+	_ func(...string) Option                    = WithDateLayouts
+	_ func(string) Option                       = WithDateOutput
+	_ func(map[string][]string) Option          = WithTransforms
+	_ func(map[string]map[string]string) Option = WithValueMaps
+	_ func(map[string]string) Option            = WithDefaults
+	_ func(string) Option                       = WithKeyCase
+	_ func(...string) Option                    = WithJSONColumns
+	_ func(bool) Option                         = WithFlatten
+	_ func(ValueParser) Option                  = WithValueParser
+	_ func(Dictionary) Option                   = WithDictionary
+	_ func(string) Option                       = WithWhereDate
+	_ func(string) Option                       = WithFilter
+	_ func(int) Option                          = WithWorkers
+	_ func(bool) Option                         = WithUnordered
+	_ func(ErrorHandler) Option                 = WithErrorHandler
+	_ func(bool) Option                         = WithStrictColumns
+	_ func(int) Option                          = WithWarnLimit
+	_ func(string) Option                       = WithHash
+	_ func(...string) Option                    = WithDetectLang
+	_ func(...string) Option                    = WithParseUserAgent
+	_ func(func(*Lineage) error) Option         = WithLineage
+	_ func(string) Option                       = WithPositionField
+	_ func(string) Option                       = WithRowNumberField
+	_ func(map[string]interface{}) Option       = WithMetaFields
+	_ func(func(record interface{})) Option     = WithObserver
+	_ func(SortAssertion) Option                = WithAssertSorted
+	_ func(Dedupe) Option                       = WithDedupe
+	_ func(map[string]Protection) Option        = WithProtections
+	_ func(*KAnonymity) Option                  = WithKAnonymity
+	_ func(*template.Template) Option           = WithTemplate
+	_ func(Sample) Option                       = WithSample
+	_ func(int, func(Checkpoint) error) Option  = WithCheckpoint
+	_ func(Checkpoint) Option                   = WithResume
+	_ func(log.FieldLogger) Option              = WithLogger
+
+	_ func([]byte, ...Option) ([]byte, error) = ConvertBytes
+	_ func(string, ...Option) (string, error) = ConvertString
+
+	_ func(io.Reader, rune) (*csv.Reader, []string, error)           = NewCSVReader
+	_ func(io.Reader, rune, []string) (*csv.Reader, []string, error) = NewHeaderlessCSVReader
+	_ func(io.Reader, string, string) io.Reader                      = NewSeparatorReader
+	_ func(io.Reader, Dialect) io.Reader                             = NewDialectReader
+	_ func(io.Reader, rune, []string) (Dictionary, error)            = BuildDictionary
+	_ func(io.Reader, rune, InferOptions) (*Schema, error)           = InferSchema
+	_ func(*Schema) ValueParser                                      = SchemaParser
+	_ func([]string, map[string]string, bool) *ColumnResolver        = NewColumnResolver
+	_ func(*ColumnResolver, string) ([]string, error)                = (*ColumnResolver).Resolve
+	_ func(*ColumnResolver, string) (int, error)                     = (*ColumnResolver).Index
+	_ func(string) (*template.Template, error)                       = ParseTemplate
+
+	_ ValueParser                 = InferTypes
+	_ func(string) string         = DetectLanguage
+	_ func(string) *UserAgent     = ParseUserAgent
+	_ func(string) bool           = IsValidType
+	_ func(string) bool           = IsValidTransform
+	_ func(string) bool           = IsValidHash
+	_ func(string) bool           = IsValidProtection
+	_ func() []string             = TransformNames
+	_ func(string, []byte) []byte = Digest
+	_ func(string, []byte) uint64 = Sum64
+
+	_ error = (*RowError)(nil)
+)
+
+func TestVersion(t *testing.T) {
+	if Version[:2] != "2." {
+		t.Errorf("Version %s does not match the v2 import path", Version)
+	}
+}
@@ -0,0 +1,494 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package csv2jsonl
+
+import (
+	"encoding/csv"
+	"io"
+	"text/template"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/convert"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/sink"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/source"
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/transform"
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of package convert.
+type (
+	Checkpoint     = convert.Checkpoint
+	ColumnResolver = convert.ColumnResolver
+	ColumnSchema   = convert.ColumnSchema
+	Converter      = convert.Converter
+	Dedupe         = convert.Dedupe
+	Dictionary     = convert.Dictionary
+	ErrorHandler   = convert.ErrorHandler
+	FieldLineage   = convert.FieldLineage
+	InferOptions   = convert.InferOptions
+	KAnonymity     = convert.KAnonymity
+	Lineage        = convert.Lineage
+	Option         = convert.Option
+	Position       = convert.Position
+	Protection     = convert.Protection
+	RowError       = convert.RowError
+	Sample         = convert.Sample
+	Schema         = convert.Schema
+	SortAssertion  = convert.SortAssertion
+	Stats          = convert.Stats
+	ValueParser    = convert.ValueParser
+)
+
+// Constants of package convert.
+const (
+	DateAuto                       = convert.DateAuto
+	DateRFC3339                    = convert.DateRFC3339
+	DateEpoch                      = convert.DateEpoch
+	DefaultDedupeCapacity          = convert.DefaultDedupeCapacity
+	DefaultDedupeFalsePositiveRate = convert.DefaultDedupeFalsePositiveRate
+	ProtectMask                    = convert.ProtectMask
+	ProtectEncrypt                 = convert.ProtectEncrypt
+	ProtectDrop                    = convert.ProtectDrop
+	ProtectHash                    = convert.ProtectHash
+	TypeString                     = convert.TypeString
+	TypeInt                        = convert.TypeInt
+	TypeFloat                      = convert.TypeFloat
+	TypeBool                       = convert.TypeBool
+	TypeJSON                       = convert.TypeJSON
+	TypeDate                       = convert.TypeDate
+	TypeNullIfEmpty                = convert.TypeNullIfEmpty
+	MaxDictionaryValues            = convert.MaxDictionaryValues
+	LenientRatio                   = convert.LenientRatio
+	DefaultWarnLimit               = convert.DefaultWarnLimit
+)
+
+// NewConverter creates a Converter with the given options.
+func NewConverter(opts ...Option) *Converter {
+	return convert.NewConverter(opts...)
+}
+
+// ConvertBytes converts the CSV in data to JSON Lines in memory, see
+// convert.Bytes.
+func ConvertBytes(data []byte, opts ...Option) ([]byte, error) {
+	return convert.Bytes(data, opts...)
+}
+
+// ConvertString is ConvertBytes for CSV held in a string.
+func ConvertString(csv string, opts ...Option) (string, error) {
+	return convert.String(csv, opts...)
+}
+
+// BuildDictionary reads the distinct values of columns, see
+// convert.BuildDictionary.
+func BuildDictionary(r io.Reader, delimiter rune, columns []string) (Dictionary, error) {
+	return convert.BuildDictionary(r, delimiter, columns)
+}
+
+// InferSchema infers the types of the columns, see convert.InferSchema.
+func InferSchema(r io.Reader, delimiter rune, opts InferOptions) (*Schema, error) {
+	return convert.InferSchema(r, delimiter, opts)
+}
+
+// SchemaParser returns a ValueParser converting cells to the types of
+// schema, see convert.SchemaParser.
+func SchemaParser(schema *Schema) ValueParser {
+	return convert.SchemaParser(schema)
+}
+
+// InferTypes is a ValueParser guessing the type of each cell, see
+// convert.InferTypes.
+func InferTypes(column, cell string) interface{} {
+	return convert.InferTypes(column, cell)
+}
+
+// NewColumnResolver creates a ColumnResolver on the columns of a header, see
+// convert.NewColumnResolver.
+func NewColumnResolver(columns []string, renames map[string]string, foldCase bool) *ColumnResolver {
+	return convert.NewColumnResolver(columns, renames, foldCase)
+}
+
+// IsValidType reports whether typ is a supported column type.
+func IsValidType(typ string) bool {
+	return convert.IsValidType(typ)
+}
+
+// IsValidProtection reports whether action is a supported protection action.
+func IsValidProtection(action string) bool {
+	return convert.IsValidProtection(action)
+}
+
+// WithASCIIOnly is convert.WithASCIIOnly.
+func WithASCIIOnly(asciiOnly bool) Option {
+	return convert.WithASCIIOnly(asciiOnly)
+}
+
+// WithAssertSorted is convert.WithAssertSorted.
+func WithAssertSorted(assertion SortAssertion) Option {
+	return convert.WithAssertSorted(assertion)
+}
+
+// WithCaseInsensitiveColumns is convert.WithCaseInsensitiveColumns.
+func WithCaseInsensitiveColumns(foldCase bool) Option {
+	return convert.WithCaseInsensitiveColumns(foldCase)
+}
+
+// WithCheckpoint is convert.WithCheckpoint.
+func WithCheckpoint(n int, fn func(Checkpoint) error) Option {
+	return convert.WithCheckpoint(n, fn)
+}
+
+// WithColumns is convert.WithColumns.
+func WithColumns(columns ...string) Option {
+	return convert.WithColumns(columns...)
+}
+
+// WithDateLayouts is convert.WithDateLayouts.
+func WithDateLayouts(layouts ...string) Option {
+	return convert.WithDateLayouts(layouts...)
+}
+
+// WithDateOutput is convert.WithDateOutput.
+func WithDateOutput(output string) Option {
+	return convert.WithDateOutput(output)
+}
+
+// WithDedupe is convert.WithDedupe.
+func WithDedupe(dedupe Dedupe) Option {
+	return convert.WithDedupe(dedupe)
+}
+
+// WithDefaults is convert.WithDefaults.
+func WithDefaults(defaults map[string]string) Option {
+	return convert.WithDefaults(defaults)
+}
+
+// WithDelimiter is convert.WithDelimiter.
+func WithDelimiter(delimiter rune) Option {
+	return convert.WithDelimiter(delimiter)
+}
+
+// WithDetectLang is convert.WithDetectLang.
+func WithDetectLang(columns ...string) Option {
+	return convert.WithDetectLang(columns...)
+}
+
+// WithDictionary is convert.WithDictionary.
+func WithDictionary(d Dictionary) Option {
+	return convert.WithDictionary(d)
+}
+
+// WithEmptyAsNull is convert.WithEmptyAsNull.
+func WithEmptyAsNull(emptyAsNull bool) Option {
+	return convert.WithEmptyAsNull(emptyAsNull)
+}
+
+// WithErrorHandler is convert.WithErrorHandler.
+func WithErrorHandler(h ErrorHandler) Option {
+	return convert.WithErrorHandler(h)
+}
+
+// WithFilter is convert.WithFilter.
+func WithFilter(expr string) Option {
+	return convert.WithFilter(expr)
+}
+
+// WithFlatten is convert.WithFlatten.
+func WithFlatten(prefix bool) Option {
+	return convert.WithFlatten(prefix)
+}
+
+// WithHash is convert.WithHash.
+func WithHash(name string) Option {
+	return convert.WithHash(name)
+}
+
+// WithJSONColumns is convert.WithJSONColumns.
+func WithJSONColumns(columns ...string) Option {
+	return convert.WithJSONColumns(columns...)
+}
+
+// WithKAnonymity is convert.WithKAnonymity.
+func WithKAnonymity(ka *KAnonymity) Option {
+	return convert.WithKAnonymity(ka)
+}
+
+// WithKeyCase is convert.WithKeyCase.
+func WithKeyCase(style string) Option {
+	return convert.WithKeyCase(style)
+}
+
+// WithLimit is convert.WithLimit.
+func WithLimit(limit int) Option {
+	return convert.WithLimit(limit)
+}
+
+// WithLineage is convert.WithLineage.
+func WithLineage(fn func(*Lineage) error) Option {
+	return convert.WithLineage(fn)
+}
+
+// WithLogger is convert.WithLogger.
+func WithLogger(logger log.FieldLogger) Option {
+	return convert.WithLogger(logger)
+}
+
+// WithMetaFields is convert.WithMetaFields.
+func WithMetaFields(fields map[string]interface{}) Option {
+	return convert.WithMetaFields(fields)
+}
+
+// WithNested is convert.WithNested.
+func WithNested(nested bool) Option {
+	return convert.WithNested(nested)
+}
+
+// WithNoHeader is convert.WithNoHeader.
+func WithNoHeader(header ...string) Option {
+	return convert.WithNoHeader(header...)
+}
+
+// WithObserver is convert.WithObserver.
+func WithObserver(fn func(record interface{})) Option {
+	return convert.WithObserver(fn)
+}
+
+// WithOmitEmpty is convert.WithOmitEmpty.
+func WithOmitEmpty(omitEmpty bool) Option {
+	return convert.WithOmitEmpty(omitEmpty)
+}
+
+// WithParseUserAgent is convert.WithParseUserAgent.
+func WithParseUserAgent(columns ...string) Option {
+	return convert.WithParseUserAgent(columns...)
+}
+
+// WithPositionField is convert.WithPositionField.
+func WithPositionField(name string) Option {
+	return convert.WithPositionField(name)
+}
+
+// WithPretty is convert.WithPretty.
+func WithPretty(pretty bool) Option {
+	return convert.WithPretty(pretty)
+}
+
+// WithProtections is convert.WithProtections.
+func WithProtections(protections map[string]Protection) Option {
+	return convert.WithProtections(protections)
+}
+
+// WithRenames is convert.WithRenames.
+func WithRenames(renames map[string]string) Option {
+	return convert.WithRenames(renames)
+}
+
+// WithResume is convert.WithResume.
+func WithResume(cp Checkpoint) Option {
+	return convert.WithResume(cp)
+}
+
+// WithRowNumberField is convert.WithRowNumberField.
+func WithRowNumberField(name string) Option {
+	return convert.WithRowNumberField(name)
+}
+
+// WithSample is convert.WithSample.
+func WithSample(sample Sample) Option {
+	return convert.WithSample(sample)
+}
+
+// WithSkip is convert.WithSkip.
+func WithSkip(n int) Option {
+	return convert.WithSkip(n)
+}
+
+// WithStrictColumns is convert.WithStrictColumns.
+func WithStrictColumns(strict bool) Option {
+	return convert.WithStrictColumns(strict)
+}
+
+// WithStripControlChars is convert.WithStripControlChars.
+func WithStripControlChars(strip bool) Option {
+	return convert.WithStripControlChars(strip)
+}
+
+// WithTemplate is convert.WithTemplate.
+func WithTemplate(tmpl *template.Template) Option {
+	return convert.WithTemplate(tmpl)
+}
+
+// WithTransforms is convert.WithTransforms.
+func WithTransforms(transforms map[string][]string) Option {
+	return convert.WithTransforms(transforms)
+}
+
+// WithTrimSpace is convert.WithTrimSpace.
+func WithTrimSpace(trim bool) Option {
+	return convert.WithTrimSpace(trim)
+}
+
+// WithTypes is convert.WithTypes.
+func WithTypes(types map[string]string) Option {
+	return convert.WithTypes(types)
+}
+
+// WithUnordered is convert.WithUnordered.
+func WithUnordered(unordered bool) Option {
+	return convert.WithUnordered(unordered)
+}
+
+// WithValueMaps is convert.WithValueMaps.
+func WithValueMaps(maps map[string]map[string]string) Option {
+	return convert.WithValueMaps(maps)
+}
+
+// WithValueParser is convert.WithValueParser.
+func WithValueParser(parser ValueParser) Option {
+	return convert.WithValueParser(parser)
+}
+
+// WithWarnLimit is convert.WithWarnLimit.
+func WithWarnLimit(n int) Option {
+	return convert.WithWarnLimit(n)
+}
+
+// WithWhereDate is convert.WithWhereDate.
+func WithWhereDate(expr string) Option {
+	return convert.WithWhereDate(expr)
+}
+
+// WithWorkers is convert.WithWorkers.
+func WithWorkers(n int) Option {
+	return convert.WithWorkers(n)
+}
+
+// CSVHeader is the UTF-8 byte order mark some tools write at the start of a CSV file.
+var CSVHeader = source.BOM
+
+// SeparatorDelimiter is the delimiter of the text returned by
+// NewSeparatorReader for a field separator, the ASCII unit separator.
+const SeparatorDelimiter = source.SeparatorDelimiter
+
+// Dialect describes the separators of a CSV dialect encoding/csv can not
+// read directly, see source.Dialect.
+type Dialect = source.Dialect
+
+// NewCSVReader creates a csv.Reader on r and reads the header row, see
+// source.NewCSVReader.
+func NewCSVReader(r io.Reader, delimiter rune) (*csv.Reader, []string, error) {
+	return source.NewCSVReader(r, delimiter)
+}
+
+// NewHeaderlessCSVReader creates a csv.Reader on r for input without a
+// header row, see source.NewHeaderlessCSVReader.
+func NewHeaderlessCSVReader(r io.Reader, delimiter rune, header []string) (*csv.Reader, []string, error) {
+	return source.NewHeaderlessCSVReader(r, delimiter, header)
+}
+
+// NewSeparatorReader returns NewDialectReader(r, Dialect{Field: fieldSep,
+// Record: recordSep}).
+func NewSeparatorReader(r io.Reader, fieldSep, recordSep string) io.Reader {
+	return source.NewSeparatorReader(r, fieldSep, recordSep)
+}
+
+// NewDialectReader returns a reader of r for dialects encoding/csv can not
+// read directly, see source.NewDialectReader.
+func NewDialectReader(r io.Reader, d Dialect) io.Reader {
+	return source.NewDialectReader(r, d)
+}
+
+// ParseTemplate parses a Go text/template rendering a record as a JSON
+// document, see sink.ParseTemplate.
+func ParseTemplate(text string) (*template.Template, error) {
+	return sink.ParseTemplate(text)
+}
+
+// Transform rewrites a cell before it is written, see transform.Func.
+type Transform = transform.Func
+
+// UserAgent is the browser, operating system and device parsed from a
+// User-Agent header.
+type UserAgent = transform.UserAgent
+
+// Constants of package transform.
+const (
+	HashFNV     = transform.HashFNV
+	HashXXH3    = transform.HashXXH3
+	HashSHA256  = transform.HashSHA256
+	HashMurmur3 = transform.HashMurmur3
+
+	KeyCaseSnake = transform.KeyCaseSnake
+	KeyCaseCamel = transform.KeyCaseCamel
+	KeyCaseKebab = transform.KeyCaseKebab
+	KeyCaseLower = transform.KeyCaseLower
+
+	LanguageUndetermined = transform.LanguageUndetermined
+)
+
+// IsValidTransform reports whether name is a supported transform, see
+// transform.IsValid.
+func IsValidTransform(name string) bool {
+	return transform.IsValid(name)
+}
+
+// TransformNames returns the names of the supported transforms, see
+// transform.Names.
+func TransformNames() []string {
+	return transform.Names()
+}
+
+// IsValidHash reports whether name is a supported hash algorithm.
+func IsValidHash(name string) bool {
+	return transform.IsValidHash(name)
+}
+
+// Digest returns the digest of data under the hash algorithm name, see
+// transform.Digest.
+func Digest(name string, data []byte) []byte {
+	return transform.Digest(name, data)
+}
+
+// Sum64 returns the first 8 bytes of the Digest of data as a big-endian
+// integer.
+func Sum64(name string, data []byte) uint64 {
+	return transform.Sum64(name, data)
+}
+
+// IsValidKeyCase reports whether style is a supported key case.
+func IsValidKeyCase(style string) bool {
+	return transform.IsValidKeyCase(style)
+}
+
+// KeyCase returns name in the given key case, see transform.KeyCase.
+func KeyCase(style, name string) string {
+	return transform.KeyCase(style, name)
+}
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written
+// in, see transform.DetectLanguage.
+func DetectLanguage(text string) string {
+	return transform.DetectLanguage(text)
+}
+
+// ParseUserAgent parses a User-Agent header, see transform.ParseUserAgent.
+func ParseUserAgent(ua string) *UserAgent {
+	return transform.ParseUserAgent(ua)
+}
+
+// SanitizeCell returns the cell cleaned as by WithStripControlChars and
+// WithTrimSpace.
+func SanitizeCell(cell string, trim, strip bool) string {
+	return transform.SanitizeCell(cell, trim, strip)
+}
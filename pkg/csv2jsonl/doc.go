@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package csv2jsonl converts CSV data to JSON Lines.
+//
+// The conversion is implemented by the packages below pkg:
+//
+//   - convert: the Converter and its options;
+//   - source: CSV readers and dialects;
+//   - sink: encoding and shaping the written records;
+//   - transform: rewriting single cells.
+//
+// This package gathers their API under one name, as type aliases and
+// functions calling theirs, so that programs written against it keep
+// building. New programs may import the packages directly.
+//
+// # Compatibility
+//
+// The packages follow semantic versioning under the import path
+// github.com/chiyutianyi/csv2jsonl/v2, see Version. Within a major version:
+//
+//   - exported identifiers are not removed or renamed and their signatures
+//     do not change, checked by the api_test.go of each package;
+//   - an Option keeps its meaning, new behavior is added as new options and
+//     never enabled by default, so a Converter built with the same options
+//     writes the same records;
+//   - structs such as Stats, Sample or Checkpoint may gain fields, use keyed
+//     composite literals;
+//   - the names accepted by TransformNames, IsValidType, IsValidHash and
+//     IsValidProtection are only added to;
+//   - log messages and the random draws of the dp_* transforms and of
+//     Sample without a seed are not part of the API.
+//
+// Breaking changes move to a new major version with a new import path.
+package csv2jsonl
+
+// Version is the semantic version of the package.
+const Version = "2.0.0"
@@ -0,0 +1,36 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package csv2jsonl_test
+
+import (
+	"fmt"
+
+	"github.com/chiyutianyi/csv2jsonl/v2/pkg/csv2jsonl"
+)
+
+func ExampleConvertString() {
+	out, err := csv2jsonl.ConvertString("id,name,age\n1,Alice,30\n2,Bob,45\n",
+		csv2jsonl.WithColumns("name", "age"),
+		csv2jsonl.WithTypes(map[string]string{"age": csv2jsonl.TypeInt}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(out)
+	// Output:
+	// {"age":30,"name":"Alice"}
+	// {"age":45,"name":"Bob"}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// NewASCIIWriter returns a writer escaping the non-ASCII characters written
+// to it as \uXXXX, characters outside the Basic Multilingual Plane as
+// surrogate pairs, before writing them to w. It must only be written JSON,
+// where non-ASCII characters only occur in strings, so that the output is
+// equivalent JSON. Characters split across writes are escaped whole.
+func NewASCIIWriter(w io.Writer) io.Writer {
+	return &asciiWriter{w: w}
+}
+
+// asciiWriter 将非 ASCII 字符转义为 \uXXXX 后写入 w
+type asciiWriter struct {
+	w    io.Writer
+	buf  []byte
+	tail []byte // 上次写入末尾不完整的 UTF-8 字符
+}
+
+func (a *asciiWriter) Write(p []byte) (int, error) {
+	a.buf = a.buf[:0]
+	data := p
+	if len(a.tail) > 0 {
+		data = append(a.tail, p...)
+		a.tail = nil
+	}
+	for len(data) > 0 {
+		c := data[0]
+		if c < utf8.RuneSelf {
+			a.buf = append(a.buf, c)
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			a.tail = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			a.buf = append(a.buf, fmt.Sprintf(`\u%04x\u%04x`, r1, r2)...)
+		} else {
+			a.buf = append(a.buf, fmt.Sprintf(`\u%04x`, r)...)
+		}
+		data = data[size:]
+	}
+	if _, err := a.w.Write(a.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// RecordWriter is a writer told where each record starts, e.g. to rotate
+// its underlying files at record boundaries.
+type RecordWriter interface {
+	io.Writer
+	// BeginRecord is called before each record is written.
+	BeginRecord() error
+}
+
+// Encoder writes records as JSON Lines.
+type Encoder struct {
+	enc   *json.Encoder
+	begin func() error
+}
+
+// NewEncoder returns an Encoder writing to w, with the records indented if
+// pretty is true and with non-ASCII characters escaped if asciiOnly is true,
+// see NewASCIIWriter. HTML characters are not escaped. If w is a
+// RecordWriter, its BeginRecord is called before each record.
+func NewEncoder(w io.Writer, pretty, asciiOnly bool) *Encoder {
+	out := w
+	if asciiOnly {
+		out = NewASCIIWriter(w)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+
+	e := &Encoder{enc: enc, begin: func() error { return nil }}
+	if rw, ok := w.(RecordWriter); ok {
+		e.begin = rw.BeginRecord
+	}
+	return e
+}
+
+// Encode writes record followed by a line feed.
+func (e *Encoder) Encode(record interface{}) error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	return e.enc.Encode(record)
+}
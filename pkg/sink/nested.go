@@ -0,0 +1,69 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NestKeys returns data with dotted keys such as user.address.city written
+// as nested objects. A key whose path conflicts with another key, e.g.
+// user.name next to user, keeps its flat name.
+func NestKeys(data map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	// 先处理层级少的键，冲突时保留较短的路径
+	sort.Slice(keys, func(i, j int) bool {
+		if ni, nj := strings.Count(keys[i], "."), strings.Count(keys[j], "."); ni != nj {
+			return ni < nj
+		}
+		return keys[i] < keys[j]
+	})
+
+	nested := make(map[string]interface{}, len(data))
+	for _, key := range keys {
+		if !setPath(nested, strings.Split(key, "."), data[key]) {
+			log.Debugf("nested: key %s conflicts with another column, kept flat", key)
+			nested[key] = data[key]
+		}
+	}
+	return nested
+}
+
+// setPath 在 m 中按路径设置值，路径上已有非对象的值或目标已存在时返回 false
+func setPath(m map[string]interface{}, path []string, value interface{}) bool {
+	for _, p := range path[:len(path)-1] {
+		child, ok := m[p]
+		if !ok {
+			child = map[string]interface{}{}
+			m[p] = child
+		}
+		if m, ok = child.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	last := path[len(path)-1]
+	if _, ok := m[last]; ok {
+		return false
+	}
+	m[last] = value
+	return true
+}
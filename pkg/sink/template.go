@@ -0,0 +1,74 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs 模板中可用的函数
+var templateFuncs = template.FuncMap{
+	"json":  templateJSON,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// templateJSON 将值编码为 JSON，用于在模板中写出带引号等字符的文本
+func templateJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// ParseTemplate parses a Go text/template rendering a record as a JSON
+// document, e.g. {"full_name":"{{.first}} {{.last}}"}. Besides the builtin
+// functions, json writes a value as JSON, e.g. {"name":{{json .name}}}, and
+// lower, upper and trim transform text. Referring to a missing field is an
+// error.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("record").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// Render executes tmpl with record and returns the JSON document it renders,
+// decoded with numbers as json.Number so that they are written unchanged.
+func Render(tmpl *template.Template, record interface{}) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, record); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return v, nil
+		} else if err == nil {
+			err = fmt.Errorf("unexpected data after the document")
+		}
+	}
+	return nil, fmt.Errorf("template output is not valid JSON: %v", err)
+}
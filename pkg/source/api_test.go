@@ -0,0 +1,29 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package source
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// 导出的 API 的签名，修改签名会使编译失败，需要升级主版本，见 package csv2jsonl
+var (
+	_ func(io.Reader, rune) (*csv.Reader, []string, error)           = NewCSVReader
+	_ func(io.Reader, rune, []string) (*csv.Reader, []string, error) = NewHeaderlessCSVReader
+	_ func(io.Reader, string, string) io.Reader                      = NewSeparatorReader
+	_ func(io.Reader, Dialect) io.Reader                             = NewDialectReader
+)
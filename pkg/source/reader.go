@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BOM is the UTF-8 byte order mark some tools write at the start of a CSV file.
+const BOM = "\ufeff"
+
+// newCSVReader 创建宽松处理引号的 csv.Reader
+func newCSVReader(r io.Reader, delimiter rune) *csv.Reader {
+	csvReader := csv.NewReader(r)
+	csvReader.LazyQuotes = true
+	if delimiter != 0 {
+		csvReader.Comma = delimiter
+	}
+	return csvReader
+}
+
+// NewCSVReader creates a csv.Reader on r and reads the header row, the byte
+// order mark is stripped from the first column name. A zero delimiter means comma.
+func NewCSVReader(r io.Reader, delimiter rune) (*csv.Reader, []string, error) {
+	csvReader := newCSVReader(r, delimiter)
+
+	// 读取首行列名
+	columns, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(columns) > 0 && strings.HasPrefix(columns[0], BOM) {
+		// 去除列名前缀，LazyQuotes 模式下带引号的列名会保留引号
+		columns[0] = strings.TrimPrefix(columns[0], BOM)
+		if n := len(columns[0]); n >= 2 && columns[0][0] == '"' && columns[0][n-1] == '"' {
+			columns[0] = columns[0][1 : n-1]
+		}
+	}
+	return csvReader, columns, nil
+}
+
+// NewHeaderlessCSVReader creates a csv.Reader on r for input without a header
+// row. The columns are named header, or col1, col2, ... after the fields of
+// the first row if header is empty. A leading byte order mark is skipped,
+// the input offsets of the reader start after it.
+func NewHeaderlessCSVReader(r io.Reader, delimiter rune, header []string) (*csv.Reader, []string, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(len(BOM)); err == nil && string(bom) == BOM {
+		br.Discard(len(BOM))
+	}
+
+	if len(header) > 0 {
+		csvReader := newCSVReader(br, delimiter)
+		// 指定的列名决定每行的字段数，字段数不同的行为格式错误
+		csvReader.FieldsPerRecord = len(header)
+		return csvReader, header, nil
+	}
+
+	// 读取第一行确定列数，读取的数据在转换时重新读取
+	var peeked bytes.Buffer
+	first, err := newCSVReader(io.TeeReader(br, &peeked), delimiter).Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(first))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("col%d", i+1)
+	}
+	return newCSVReader(io.MultiReader(&peeked, br), delimiter), columns, nil
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"unicode/utf8"
+)
+
+// SeparatorDelimiter is the delimiter of the text returned by
+// NewSeparatorReader for a field separator, the ASCII unit separator.
+const SeparatorDelimiter = '\x1f'
+
+// Dialect describes the separators of a CSV dialect encoding/csv can not
+// read directly, see NewDialectReader.
+type Dialect struct {
+	// Delimiter separates the fields if neither Field nor FieldRegexp is
+	// set, a comma if 0.
+	Delimiter rune
+	// Field and Record are literal field and record separators, e.g. "||"
+	// for mainframe exports or "\r" for old Mac line endings.
+	Field  string
+	Record string
+	// FieldRegexp and RecordRegexp are separators given as regular
+	// expressions, e.g. `\s*\|\s*`. They take precedence over Field and
+	// Record and must not match an empty string.
+	FieldRegexp  *regexp.Regexp
+	RecordRegexp *regexp.Regexp
+}
+
+// NewSeparatorReader returns NewDialectReader(r, Dialect{Field: fieldSep,
+// Record: recordSep}).
+func NewSeparatorReader(r io.Reader, fieldSep, recordSep string) io.Reader {
+	return NewDialectReader(r, Dialect{Field: fieldSep, Record: recordSep})
+}
+
+// NewDialectReader returns a reader of r for dialects encoding/csv can not
+// read directly: outside quoted fields, the field separators are replaced
+// with SeparatorDelimiter and the record separators with a line feed, so
+// the result can be read with SeparatorDelimiter as the delimiter. Like in
+// encoding/csv, a quote only starts a quoted field at the start of a field,
+// and a doubled quote inside a quoted field is an escaped quote.
+//
+// Unquoted fields that contain a quote, or text that would separate fields
+// or records after the replacement, i.e. a unit separator or, with a record
+// separator, a line feed or carriage return, are quoted so that they keep
+// their value. Without a record separator, line feeds outside quoted fields
+// end records. The byte offsets of the converted rows count the replaced
+// text. Literal separators are replaced as the input is read, a field is
+// returned once it ends.
+// Regular expressions are matched line by line against the rest of the
+// line: a field separator never matches the line ending, and a record
+// separator only matches a line feed as its last character, e.g. `;\r?\n`.
+func NewDialectReader(r io.Reader, d Dialect) io.Reader {
+	delimiter := d.Delimiter
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	q := newQuoter(d.Field != "" || d.FieldRegexp != nil, d.Record != "" || d.RecordRegexp != nil)
+	if d.FieldRegexp == nil && d.RecordRegexp == nil {
+		return newSeparatorReader(r, delimiter, d.Field, d.Record, q)
+	}
+
+	rr := &regexpSeparatorReader{r: bufio.NewReader(r), field: d.FieldRegexp, record: d.RecordRegexp, fieldRepl: []byte{SeparatorDelimiter}, quoter: q, start: true}
+	switch {
+	case rr.field == nil && d.Field != "":
+		rr.field = regexp.MustCompile(regexp.QuoteMeta(d.Field))
+	case rr.field == nil:
+		rr.field = regexp.MustCompile(regexp.QuoteMeta(string(delimiter)))
+		rr.fieldRepl = utf8.AppendRune(nil, delimiter)
+	}
+	if rr.record == nil && d.Record != "" {
+		rr.record = regexp.MustCompile(regexp.QuoteMeta(d.Record))
+	}
+	return rr
+}
+
+// quoter 为替换分隔符后不在引号内的字段加引号，字段中的 special 的字符原样读取时
+// 会拆开字段或记录
+type quoter struct {
+	special string
+}
+
+// newQuoter 替换了字段分隔符时字段中的 SeparatorDelimiter、替换了记录分隔符时字段中的
+// 换行需要加引号，字段中的引号总是需要
+func newQuoter(field, record bool) quoter {
+	special := `"`
+	if field {
+		special += string(SeparatorDelimiter)
+	}
+	if record {
+		special += "\r\n"
+	}
+	return quoter{special: special}
+}
+
+// appendField 将字段追加到 out，含有 special 的字符时加引号并转义其中的引号
+func (q quoter) appendField(out, field []byte) []byte {
+	if !bytes.ContainsAny(field, q.special) {
+		return append(out, field...)
+	}
+	out = append(out, '"')
+	for _, b := range field {
+		if b == '"' {
+			out = append(out, '"')
+		}
+		out = append(out, b)
+	}
+	return append(out, '"')
+}
+
+// separatorReader 将引号外的字段分隔符替换为 SeparatorDelimiter，记录分隔符替换为换行
+type separatorReader struct {
+	r *bufio.Reader
+	// seps 按长度从长到短排列，一个是另一个的前缀时先匹配较长的
+	seps [][]byte
+	repl []byte
+	// delimiter 没有替换字段分隔符时分隔字段的字符，matched 为已读到的其前缀的字节数
+	delimiter []byte
+	matched   int
+	// lines 没有替换记录分隔符，换行结束记录
+	lines  bool
+	quoter quoter
+	// field 开头不是引号的字段，字段结束时加上需要的引号后写出
+	field []byte
+	// start 下一个字节位于字段的开头，quoted 位于引号内，escaped 下一个引号是转义的引号，
+	// quotedField 当前的字段以引号开头，原样写出
+	start       bool
+	quoted      bool
+	escaped     bool
+	quotedField bool
+	// out 已替换但还没有读取的文本
+	out []byte
+	err error
+}
+
+func newSeparatorReader(r io.Reader, delimiter rune, fieldSep, recordSep string, q quoter) *separatorReader {
+	sr := &separatorReader{r: bufio.NewReader(r), lines: recordSep == "", quoter: q, start: true}
+	if fieldSep == "" {
+		sr.delimiter = utf8.AppendRune(nil, delimiter)
+	}
+	add := func(sep string, repl byte) {
+		if sep != "" {
+			sr.seps = append(sr.seps, []byte(sep))
+			sr.repl = append(sr.repl, repl)
+		}
+	}
+	if len(recordSep) >= len(fieldSep) {
+		add(recordSep, '\n')
+		add(fieldSep, SeparatorDelimiter)
+	} else {
+		add(fieldSep, SeparatorDelimiter)
+		add(recordSep, '\n')
+	}
+	return sr
+}
+
+func (sr *separatorReader) Read(p []byte) (int, error) {
+	if len(sr.out) == 0 {
+		sr.out = sr.out[:0]
+	}
+	// 不为了填满 p 等待更多的输入，如 -follow 持续读取时
+	for sr.err == nil && (len(sr.out) == 0 || len(sr.out) < len(p) && sr.r.Buffered() > 0) {
+		sr.next()
+	}
+	if len(sr.out) == 0 {
+		return 0, sr.err
+	}
+	n := copy(p, sr.out)
+	sr.out = sr.out[n:]
+	return n, nil
+}
+
+// next 读取一个字节，引号内的字节直接写出，其他字段在结束时写出
+func (sr *separatorReader) next() {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		// 输入结束时写出最后一个字段
+		sr.endField(0)
+		sr.err = err
+		return
+	}
+	switch {
+	case sr.quoted:
+		sr.out = append(sr.out, b)
+		sr.unquote(b)
+	case sr.start && b == '"':
+		sr.out = append(sr.out, b)
+		sr.quoted, sr.quotedField, sr.start = true, true, false
+	default:
+		sr.start = false
+		if repl, ok := sr.replace(b); ok {
+			sr.endField(0, repl)
+			return
+		}
+		if sr.quotedField {
+			sr.out = append(sr.out, b)
+		} else {
+			sr.field = append(sr.field, b)
+		}
+		switch {
+		case sr.lines && b == '\n':
+			n := 1
+			if bytes.HasSuffix(sr.field, []byte("\r\n")) {
+				n = 2
+			}
+			sr.endField(n)
+		case sr.delimited(b):
+			sr.endField(len(sr.delimiter))
+		}
+	}
+}
+
+// endField 结束当前的字段：field 的最后 n 个字节是原样保留的分隔符，在字段之后写出，
+// 之后写出替换分隔符的 repl
+func (sr *separatorReader) endField(n int, repl ...byte) {
+	if !sr.quotedField {
+		end := len(sr.field) - n
+		sr.out = sr.quoter.appendField(sr.out, sr.field[:end])
+		sr.out = append(sr.out, sr.field[end:]...)
+	}
+	sr.out = append(sr.out, repl...)
+	sr.field, sr.quotedField, sr.start, sr.matched = sr.field[:0], false, true, 0
+}
+
+// unquote 处理引号内的字节 b，两个连续的引号为转义的引号，其他引号结束引号内的字段
+func (sr *separatorReader) unquote(b byte) {
+	if b != '"' {
+		return
+	}
+	if sr.escaped {
+		sr.escaped = false
+		return
+	}
+	if next, _ := sr.r.Peek(1); len(next) == 1 && next[0] == '"' {
+		sr.escaped = true
+		return
+	}
+	sr.quoted = false
+}
+
+// delimited 判断 b 是否结束了一个分隔字段的字符
+func (sr *separatorReader) delimited(b byte) bool {
+	if len(sr.delimiter) == 0 {
+		return false
+	}
+	if b == sr.delimiter[sr.matched] {
+		sr.matched++
+	} else if b == sr.delimiter[0] {
+		sr.matched = 1
+	} else {
+		sr.matched = 0
+	}
+	if sr.matched == len(sr.delimiter) {
+		sr.matched = 0
+		return true
+	}
+	return false
+}
+
+// replace 检查 b 是否开始一个分隔符，是时跳过分隔符的其余字节并返回替换的字节
+func (sr *separatorReader) replace(b byte) (byte, bool) {
+	for i, sep := range sr.seps {
+		if b != sep[0] {
+			continue
+		}
+		if len(sep) == 1 {
+			return sr.repl[i], true
+		}
+		// 输入结束时 Peek 返回的字节不足，不是分隔符
+		if rest, _ := sr.r.Peek(len(sep) - 1); bytes.Equal(rest, sep[1:]) {
+			sr.r.Discard(len(sep) - 1)
+			return sr.repl[i], true
+		}
+	}
+	return 0, false
+}
+
+// regexpSeparatorReader 按行读取输入，将引号外匹配 field 的文本替换为
+// fieldRepl，匹配 record 的文本替换为换行
+type regexpSeparatorReader struct {
+	r      *bufio.Reader
+	field  *regexp.Regexp
+	record *regexp.Regexp
+	// fieldRepl 替换字段分隔符的文本，只有记录分隔符时 field 匹配原有的分隔字段的字符，原样保留
+	fieldRepl []byte
+	quoter    quoter
+	// pending 开头不是引号的字段，可以跨行，字段结束时加上需要的引号后写出
+	pending     []byte
+	start       bool
+	quoted      bool
+	quotedField bool
+	// out 已替换但还没有读取的文本
+	out []byte
+	err error
+}
+
+func (rr *regexpSeparatorReader) Read(p []byte) (int, error) {
+	for len(rr.out) == 0 {
+		if rr.err != nil {
+			return 0, rr.err
+		}
+		line, err := rr.r.ReadBytes('\n')
+		rr.out = rr.out[:0]
+		rr.separate(line)
+		if err != nil {
+			// 输入结束时写出最后一个字段
+			rr.endField(nil)
+			rr.err = err
+		}
+	}
+	n := copy(p, rr.out)
+	rr.out = rr.out[n:]
+	return n, nil
+}
+
+// separate 替换一行中引号外的分隔符，引号内的字段可以跨行
+func (rr *regexpSeparatorReader) separate(line []byte) {
+	for pos := 0; pos < len(line); {
+		if rr.quoted {
+			i := bytes.IndexByte(line[pos:], '"')
+			if i < 0 {
+				rr.out = append(rr.out, line[pos:]...)
+				return
+			}
+			end := pos + i + 1
+			if end < len(line) && line[end] == '"' {
+				end++
+			} else {
+				rr.quoted = false
+			}
+			rr.out = append(rr.out, line[pos:end]...)
+			pos = end
+			continue
+		}
+		if rr.start && line[pos] == '"' {
+			rr.quoted, rr.quotedField, rr.start = true, true, false
+			rr.out = append(rr.out, '"')
+			pos++
+			continue
+		}
+
+		// 字段以记录分隔符或字段分隔符中最先出现的一个结束，没有记录分隔符时行尾的换行
+		// 也结束记录；字段分隔符不匹配行尾的换行
+		rest := line[pos:]
+		start, end, repl := len(rest), len(rest), []byte(nil)
+		lineEnd := len(rest)
+		if nl := bytes.IndexByte(rest, '\n'); nl >= 0 {
+			lineEnd = nl
+			if nl > 0 && rest[nl-1] == '\r' {
+				lineEnd = nl - 1
+			}
+			if rr.record == nil {
+				start, end, repl = lineEnd, nl+1, rest[lineEnd:nl+1]
+			}
+		}
+		if m := find(rr.record, rest); m != nil {
+			start, end, repl = m[0], m[1], []byte{'\n'}
+		}
+		fieldEnd := start
+		if fieldEnd > lineEnd {
+			fieldEnd = lineEnd
+		}
+		if m := find(rr.field, rest[:fieldEnd]); m != nil {
+			start, end, repl = m[0], m[1], rr.fieldRepl
+		}
+		if repl == nil {
+			rr.appendData(rest)
+			rr.start = false
+			return
+		}
+		rr.appendData(rest[:start])
+		rr.endField(repl)
+		pos += end
+	}
+}
+
+// appendData 将不在引号内的字段的文本追加到字段中
+func (rr *regexpSeparatorReader) appendData(b []byte) {
+	if rr.quotedField {
+		rr.out = append(rr.out, b...)
+	} else {
+		rr.pending = append(rr.pending, b...)
+	}
+}
+
+// endField 结束当前的字段，写出字段和替换分隔符的 repl
+func (rr *regexpSeparatorReader) endField(repl []byte) {
+	if !rr.quotedField {
+		rr.out = rr.quoter.appendField(rr.out, rr.pending)
+	}
+	rr.out = append(rr.out, repl...)
+	rr.pending, rr.quotedField, rr.start = rr.pending[:0], false, true
+}
+
+// find 返回 re 在 b 中第一个非空的匹配的位置，没有时返回 nil
+func find(re *regexp.Regexp, b []byte) []int {
+	if re == nil {
+		return nil
+	}
+	if m := re.FindIndex(b); m != nil && m[0] < m[1] {
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+// 导出的 API 的签名，修改签名会使编译失败，需要升级主版本，见 package csv2jsonl
+var (
+	_ func(string) (Func, error)      = Lookup
+	_ func(string) bool               = IsValid
+	_ func() []string                 = Names
+	_ func(string) bool               = IsValidHash
+	_ func(string, []byte) []byte     = Digest
+	_ func(string, []byte) uint64     = Sum64
+	_ func(string) bool               = IsValidKeyCase
+	_ func(string, string) string     = KeyCase
+	_ func(string) string             = DetectLanguage
+	_ func(string) *UserAgent         = ParseUserAgent
+	_ func(string, bool, bool) string = SanitizeCell
+)
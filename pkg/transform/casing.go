@@ -0,0 +1,171 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// titleCaser 首字母大写，其余字母小写
+func titleCaser(tag language.Tag, opts ...cases.Option) cases.Caser {
+	return cases.Title(tag, opts...)
+}
+
+// caseTransform 按语言的规则转换大小写，如土耳其语的 i 大写为 İ。
+// Caser 有状态，不能在转换的协程之间共享
+func caseTransform(tag language.Tag, newCaser func(language.Tag, ...cases.Option) cases.Caser) Func {
+	pool := sync.Pool{New: func() interface{} {
+		caser := newCaser(tag)
+		return &caser
+	}}
+	return func(cell string) interface{} {
+		caser := pool.Get().(*cases.Caser)
+		defer pool.Put(caser)
+		return caser.String(cell)
+	}
+}
+
+// newCaseTransform 创建按参数指定的语言（BCP 47，如 tr、de-CH）转换大小写的转换
+func newCaseTransform(newCaser func(language.Tag, ...cases.Option) cases.Caser) func(args []string) (Func, error) {
+	return func(args []string) (Func, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected one locale, got %d arguments", len(args))
+		}
+		tag, err := language.Parse(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("unknown locale %q", args[0])
+		}
+		return caseTransform(tag, newCaser), nil
+	}
+}
+
+// slugify 转换为小写、去掉变音符号，字母和数字以外的字符替换为 -，
+// 如 "Crème Brûlée, 2 pers." 转换为 creme-brulee-2-pers
+func slugify(cell string) interface{} {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(cell) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// 分解后的变音符号
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Key cases of KeyCase, see convert.WithKeyCase.
+const (
+	// KeyCaseSnake writes "First Name" as first_name.
+	KeyCaseSnake = "snake"
+	// KeyCaseCamel writes "First Name" as firstName.
+	KeyCaseCamel = "camel"
+	// KeyCaseKebab writes "First Name" as first-name.
+	KeyCaseKebab = "kebab"
+	// KeyCaseLower writes "First Name" as "first name".
+	KeyCaseLower = "lower"
+)
+
+// IsValidKeyCase reports whether style is a supported key case.
+func IsValidKeyCase(style string) bool {
+	switch style {
+	case KeyCaseSnake, KeyCaseCamel, KeyCaseKebab, KeyCaseLower:
+		return true
+	}
+	return false
+}
+
+// KeyCase returns name in the given key case, e.g. KeyCaseSnake writes
+// "First Name" as first_name. Words are separated by characters other than
+// letters and digits and by case changes such as in firstName or HTTPServer.
+// Dotted names are converted segment by segment so that they are still
+// nested by convert.WithNested.
+func KeyCase(style, name string) string {
+	if style == "" {
+		return name
+	}
+	if style == KeyCaseLower {
+		return strings.ToLower(strings.TrimSpace(name))
+	}
+	segments := strings.Split(name, ".")
+	for i, segment := range segments {
+		words := splitWords(segment)
+		for j, word := range words {
+			word = strings.ToLower(word)
+			if style == KeyCaseCamel && j > 0 {
+				r := []rune(word)
+				r[0] = unicode.ToUpper(r[0])
+				word = string(r)
+			}
+			words[j] = word
+		}
+		switch style {
+		case KeyCaseSnake:
+			segments[i] = strings.Join(words, "_")
+		case KeyCaseKebab:
+			segments[i] = strings.Join(words, "-")
+		default:
+			segments[i] = strings.Join(words, "")
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// splitWords 按字母和数字以外的字符及大小写的变化拆分单词，
+// 如 firstName、HTTPServer 拆分为 first Name、HTTP Server
+func splitWords(s string) []string {
+	var (
+		words []string
+		word  []rune
+	)
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+			continue
+		}
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && next {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
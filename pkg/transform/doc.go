@@ -0,0 +1,24 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package transform rewrites single cells: the named transforms of
+// convert.WithTransforms, key cases, hashes, language detection, User-Agent
+// parsing and cell sanitizing. The functions are safe for concurrent use.
+//
+// The package follows the compatibility rules of package csv2jsonl, the
+// names accepted by IsValid, IsValidHash and IsValidKeyCase are only added
+// to.
+package transform
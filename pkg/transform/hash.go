@@ -0,0 +1,75 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/fnv"
+
+	"github.com/spaolacci/murmur3"
+	"github.com/zeebo/xxh3"
+)
+
+// Hash algorithms of convert.WithHash. Every algorithm is stable: a key
+// hashes to the same value on every platform and in every version, so that
+// shards, bloom filters and hashed cells of different runs match each other
+// and the ones computed by other systems with the same algorithm.
+const (
+	// HashFNV is FNV-1a, the default. Shards use its 32-bit variant, the
+	// rest its 64-bit variant.
+	HashFNV = "fnv"
+	// HashXXH3 is the 64-bit XXH3 with seed 0.
+	HashXXH3 = "xxh3"
+	// HashSHA256 is SHA-256.
+	HashSHA256 = "sha256"
+	// HashMurmur3 is the 128-bit x64 MurmurHash3 with seed 0.
+	HashMurmur3 = "murmur3"
+)
+
+// IsValidHash reports whether name is a supported hash algorithm.
+func IsValidHash(name string) bool {
+	switch name {
+	case HashFNV, HashXXH3, HashSHA256, HashMurmur3:
+		return true
+	}
+	return false
+}
+
+// Digest returns the big-endian digest of data under the hash algorithm
+// name: 8 bytes for HashFNV and HashXXH3, 16 for HashMurmur3 and 32 for
+// HashSHA256. An empty name is HashFNV.
+func Digest(name string, data []byte) []byte {
+	switch name {
+	case HashXXH3:
+		return binary.BigEndian.AppendUint64(nil, xxh3.Hash(data))
+	case HashSHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case HashMurmur3:
+		h1, h2 := murmur3.Sum128(data)
+		return binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, h1), h2)
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Sum64 returns the first 8 bytes of the Digest of data as a big-endian
+// integer.
+func Sum64(name string, data []byte) uint64 {
+	return binary.BigEndian.Uint64(Digest(name, data))
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 常见虚词，用于区分拉丁字母书写的语言
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "with", "for", "this", "that", "it", "are", "on", "you", "a"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "pour", "dans", "avec", "du", "un", "que", "sur", "pas"},
+	"de": {"der", "die", "das", "und", "ist", "mit", "nicht", "ein", "eine", "für", "auf", "den", "zu", "von", "sich"},
+	"es": {"el", "la", "los", "las", "y", "es", "con", "para", "una", "por", "del", "que", "en", "un", "muy"},
+	"it": {"il", "la", "di", "che", "e", "è", "per", "con", "una", "un", "del", "della", "non", "sono", "gli"},
+	"pt": {"o", "a", "os", "as", "e", "é", "de", "com", "para", "uma", "um", "não", "do", "da", "em"},
+	"nl": {"de", "het", "en", "een", "van", "is", "met", "voor", "niet", "op", "dat", "zijn", "ook", "te", "naar"},
+}
+
+// 各语言特有的字母
+var letterHints = map[rune]string{
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ç': "fr", 'ê': "fr", 'è': "fr", 'œ': "fr",
+	'ã': "pt", 'õ': "pt",
+	'ì': "it", 'ò': "it",
+}
+
+// 语言的判断顺序，得分相同时靠前的优先
+var latinLanguages = []string{"en", "fr", "de", "es", "it", "pt", "nl"}
+
+var stopwordIndex = func() map[string][]string {
+	index := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			index[w] = append(index[w], lang)
+		}
+	}
+	return index
+}()
+
+// LanguageUndetermined is the ISO 639 code returned when the language of a
+// text cannot be detected.
+const LanguageUndetermined = "und"
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written
+// in. Non-Latin scripts are identified by their characters, Latin-script
+// languages (en, fr, de, es, it, pt, nl) by common words, and
+// LanguageUndetermined is returned when neither gives an answer.
+func DetectLanguage(text string) string {
+	var latin, han, kana, hangul, cyrillic, ukrainian, greek, arabic, hebrew, thai, devanagari int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// 取字符数最多的文字
+	script, best := "", 0
+	for _, s := range []struct {
+		lang  string
+		count int
+	}{
+		{"latin", latin}, {"zh", han + kana}, {"ko", hangul}, {"ru", cyrillic}, {"el", greek},
+		{"ar", arabic}, {"he", hebrew}, {"th", thai}, {"hi", devanagari},
+	} {
+		if s.count > best {
+			script, best = s.lang, s.count
+		}
+	}
+	switch script {
+	case "":
+		return LanguageUndetermined
+	case "latin":
+		return detectLatinLanguage(text)
+	case "zh":
+		if kana > 0 {
+			return "ja"
+		}
+	case "ru":
+		if ukrainian > 0 {
+			return "uk"
+		}
+	}
+	return script
+}
+
+// detectLatinLanguage 根据虚词和特有字母为拉丁字母书写的文本打分
+func detectLatinLanguage(text string) string {
+	scores := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		for _, lang := range stopwordIndex[w] {
+			scores[lang] += 2
+		}
+		for _, r := range w {
+			if lang, ok := letterHints[r]; ok {
+				scores[lang]++
+			}
+		}
+	}
+
+	lang, best := LanguageUndetermined, 0
+	for _, l := range latinLanguages {
+		if scores[l] > best {
+			lang, best = l, scores[l]
+		}
+	}
+	return lang
+}
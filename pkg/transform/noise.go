@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// uniform 返回 (0, 1] 上均匀分布的随机数，使用 crypto/rand，
+// 以免噪声能够由伪随机数的种子推算
+func uniform() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// 系统的随机数源不可用时无法安全地加噪，不能退回写出原值
+		panic(fmt.Sprintf("dp noise: read random failed: %v", err))
+	}
+	return float64(binary.LittleEndian.Uint64(b[:])>>11+1) / (1 << 53)
+}
+
+// noiseArgs 解析噪声转换的 epsilon 和可选的敏感度，n 为 epsilon 之后的必需参数个数
+func noiseArgs(args []float64, n int) (epsilon, sensitivity float64, err error) {
+	if len(args) != 1+n && len(args) != 2+n {
+		return 0, 0, errors.New("wrong number of arguments")
+	}
+	epsilon, sensitivity = args[0], 1
+	if len(args) == 2+n {
+		sensitivity = args[1+n]
+	}
+	if epsilon <= 0 || sensitivity <= 0 {
+		return 0, 0, errors.New("epsilon and sensitivity must be positive")
+	}
+	return epsilon, sensitivity, nil
+}
+
+// newLaplaceNoise 创建加 Laplace 噪声的转换，尺度为 sensitivity/epsilon
+func newLaplaceNoise(args []float64) (Func, error) {
+	epsilon, sensitivity, err := noiseArgs(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	scale := sensitivity / epsilon
+	return noiseTransform(func() float64 {
+		// 两个独立的指数分布之差服从 Laplace 分布
+		return scale * math.Log(uniform()/uniform())
+	}), nil
+}
+
+// newGaussianNoise 创建加高斯噪声的转换，标准差按 (epsilon, delta)-差分隐私的
+// 经典高斯机制取 sensitivity*sqrt(2ln(1.25/delta))/epsilon
+func newGaussianNoise(args []float64) (Func, error) {
+	epsilon, sensitivity, err := noiseArgs(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	delta := args[1]
+	if delta <= 0 || delta >= 1 {
+		return nil, errors.New("delta must be between 0 and 1")
+	}
+	sigma := sensitivity * math.Sqrt(2*math.Log(1.25/delta)) / epsilon
+	return noiseTransform(func() float64 {
+		// Box-Muller 变换
+		return sigma * math.Sqrt(-2*math.Log(uniform())) * math.Cos(2*math.Pi*uniform())
+	}), nil
+}
+
+// noiseTransform 为数值单元格加噪声，整数加噪后取整。空单元格保持不变，
+// 非数值的单元格写为 null，以免原值不加噪声地写出
+func noiseTransform(noise func() float64) Func {
+	return func(cell string) interface{} {
+		if cell == "" {
+			return cell
+		}
+		if i, err := strconv.ParseInt(cell, 10, 64); err == nil {
+			return int64(math.Round(float64(i) + noise()))
+		}
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil
+		}
+		return f + noise()
+	}
+}
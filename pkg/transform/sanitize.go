@@ -0,0 +1,53 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isStrippedChar 判断 -strip-control-chars 删除的字符，保留单元格中的制表符和换行
+func isStrippedChar(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	case '\u200b', '\u2060', '\u00ad', '\ufeff':
+		return true
+	}
+	return unicode.IsControl(r)
+}
+
+// SanitizeCell returns the cell with its leading and trailing white space
+// removed if trim is true, and with its control characters other than tab,
+// line feed and carriage return and its invisible formatting characters
+// removed if strip is true, as by convert.WithTrimSpace and
+// convert.WithStripControlChars.
+func SanitizeCell(cell string, trim, strip bool) string {
+	if strip && strings.IndexFunc(cell, isStrippedChar) >= 0 {
+		cell = strings.Map(func(r rune) rune {
+			if isStrippedChar(r) {
+				return -1
+			}
+			return r
+		}, cell)
+	}
+	if trim {
+		// unicode.IsSpace 包括不换行空格 U+00A0
+		cell = strings.TrimFunc(cell, unicode.IsSpace)
+	}
+	return cell
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Func rewrites a cell before it is written. A transform returning a
+// string may be followed by further transforms and the column type, any
+// other value is written as is.
+type Func func(cell string) interface{}
+
+// 内置的转换
+var transforms = map[string]Func{
+	"html_unescape": func(cell string) interface{} { return html.UnescapeString(cell) },
+	"urldecode":     urlDecode,
+	"parse_query":   parseQuery,
+	"lower":         caseTransform(language.Und, cases.Lower),
+	"upper":         caseTransform(language.Und, cases.Upper),
+	"title":         caseTransform(language.Und, titleCaser),
+	"slug":          slugify,
+}
+
+// urlDecode 解码 URL 编码的文本，+ 解码为空格，无法解码时保留原值
+func urlDecode(cell string) interface{} {
+	if s, err := url.QueryUnescape(cell); err == nil {
+		return s
+	}
+	return cell
+}
+
+// parseQuery 将 utm_source=x&utm_medium=y 形式的查询串解析为对象，
+// 参数出现多次时值为数组。完整的 URL 解析其查询部分，无法解析时保留原值
+func parseQuery(cell string) interface{} {
+	query := strings.TrimPrefix(cell, "?")
+	if strings.Contains(query, "://") {
+		u, err := url.Parse(query)
+		if err != nil {
+			return cell
+		}
+		query = u.RawQuery
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return cell
+	}
+	data := make(map[string]interface{}, len(values))
+	for key, vs := range values {
+		if len(vs) == 1 {
+			data[key] = vs[0]
+		} else {
+			data[key] = vs
+		}
+	}
+	return data
+}
+
+// 带参数的转换，名称形如 dp_laplace(0.5) 或 lower(tr)，参数可以加引号
+var transformFactories = map[string]struct {
+	usage  string
+	create func(args []string) (Func, error)
+}{
+	"dp_laplace":  {"dp_laplace(epsilon[,sensitivity])", numericArgs(newLaplaceNoise)},
+	"dp_gaussian": {"dp_gaussian(epsilon,delta[,sensitivity])", numericArgs(newGaussianNoise)},
+	"lower":       {"lower(locale)", newCaseTransform(cases.Lower)},
+	"upper":       {"upper(locale)", newCaseTransform(cases.Upper)},
+	"title":       {"title(locale)", newCaseTransform(titleCaser)},
+}
+
+// numericArgs 将参数解析为数字后创建转换
+func numericArgs(create func(args []float64) (Func, error)) func(args []string) (Func, error) {
+	return func(args []string) (Func, error) {
+		nums := make([]float64, len(args))
+		for i, arg := range args {
+			f, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("argument %q is not a number", arg)
+			}
+			nums[i] = f
+		}
+		return create(nums)
+	}
+}
+
+// Lookup returns the transform named name, creating the transforms taking
+// arguments from the arguments in the name, e.g. dp_laplace(0.5,1000).
+func Lookup(name string) (Func, error) {
+	if t, ok := transforms[name]; ok {
+		return t, nil
+	}
+	base, rest, ok := strings.Cut(name, "(")
+	factory, known := transformFactories[base]
+	if !ok || !known || !strings.HasSuffix(rest, ")") {
+		return nil, fmt.Errorf("unknown transform %s", name)
+	}
+	var args []string
+	for _, arg := range strings.Split(strings.TrimSuffix(rest, ")"), ",") {
+		arg = strings.TrimSpace(arg)
+		if n := len(arg); n >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[n-1] == arg[0] {
+			arg = arg[1 : n-1]
+		}
+		args = append(args, arg)
+	}
+	t, err := factory.create(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %s: %v, expected %s", name, err, factory.usage)
+	}
+	return t, nil
+}
+
+// IsValid reports whether name is a supported transform, including its
+// arguments for transforms taking arguments, e.g. dp_laplace(0.5).
+func IsValid(name string) bool {
+	_, err := Lookup(name)
+	return err == nil
+}
+
+// Names returns the names of the supported transforms, with the arguments
+// of the transforms taking arguments.
+func Names() []string {
+	names := lo.Keys(transforms)
+	for _, factory := range transformFactories {
+		names = append(names, factory.usage)
+	}
+	sort.Strings(names)
+	return names
+}
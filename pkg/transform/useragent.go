@@ -0,0 +1,119 @@
+/*
+ * Copyright 2024 Han Xin, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package transform
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgent is the browser, operating system and device parsed from a
+// User-Agent header.
+type UserAgent struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	// Device is desktop, mobile, tablet or bot.
+	Device string `json:"device,omitempty"`
+}
+
+type uaPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// 按顺序匹配，许多浏览器的 UA 中同时包含 Chrome、Safari 等字样
+var (
+	uaBots = regexp.MustCompile(`(?i)([a-z0-9_-]*(?:bot|crawler|spider|slurp)[a-z0-9_-]*|curl|wget|python-requests|go-http-client|okhttp)(?:/([0-9.]+))?`)
+
+	uaBrowsers = []uaPattern{
+		{"Edge", regexp.MustCompile(`(?:Edge?|EdgA|EdgiOS)/([0-9.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([0-9.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([0-9.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([0-9.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([0-9.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([0-9.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`MSIE ([0-9.]+)|Trident/.*rv:([0-9.]+)`)},
+	}
+
+	uaOSes = []uaPattern{
+		{"iOS", regexp.MustCompile(`(?:iPhone|CPU) OS ([0-9_]+)`)},
+		{"Android", regexp.MustCompile(`Android ?([0-9.]*)`)},
+		{"Chrome OS", regexp.MustCompile(`CrOS [^ ]+ ([0-9.]+)`)},
+		{"Windows", regexp.MustCompile(`Windows NT ([0-9.]+)`)},
+		{"macOS", regexp.MustCompile(`Mac OS X ?([0-9_.]*)`)},
+		{"Linux", regexp.MustCompile(`Linux()`)},
+	}
+
+	windowsVersions = map[string]string{
+		"10.0": "10", "6.3": "8.1", "6.2": "8", "6.1": "7", "6.0": "Vista", "5.1": "XP",
+	}
+)
+
+// firstGroup 返回第一个非空的子匹配
+func firstGroup(m []string) string {
+	for _, g := range m[1:] {
+		if g != "" {
+			return g
+		}
+	}
+	return ""
+}
+
+// ParseUserAgent parses a User-Agent header with the embedded patterns of
+// common browsers, operating systems and crawlers. It returns nil for an
+// empty header; fields it does not recognize are left empty.
+func ParseUserAgent(ua string) *UserAgent {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return nil
+	}
+
+	var parsed UserAgent
+	for _, p := range uaOSes {
+		if m := p.re.FindStringSubmatch(ua); m != nil {
+			parsed.OS = p.name
+			parsed.OSVersion = strings.ReplaceAll(firstGroup(m), "_", ".")
+			if p.name == "Windows" {
+				parsed.OSVersion = windowsVersions[parsed.OSVersion]
+			}
+			break
+		}
+	}
+
+	if m := uaBots.FindStringSubmatch(ua); m != nil {
+		parsed.Browser, parsed.BrowserVersion, parsed.Device = m[1], m[2], "bot"
+		return &parsed
+	}
+	for _, p := range uaBrowsers {
+		if m := p.re.FindStringSubmatch(ua); m != nil {
+			parsed.Browser, parsed.BrowserVersion = p.name, firstGroup(m)
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		parsed.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		parsed.Device = "tablet"
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone"):
+		parsed.Device = "mobile"
+	case parsed.OS != "":
+		parsed.Device = "desktop"
+	}
+	return &parsed
+}